@@ -0,0 +1,610 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+)
+
+func (c *cli) create(ctx context.Context, args []string) error {
+	fs := newFlagSet("create")
+	owner := fs.String("owner", "", "owner id in the external system")
+	name := fs.String("name", "", "display name")
+	labels := fs.String("labels", "", "comma-separated labels")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	info := entity.WalletInfo{OwnerId: *owner, DisplayName: *name}
+	if *labels != "" {
+		info.Labels = strings.Split(*labels, ",")
+	}
+	wallet, err := c.walletService.CreateWallet(ctx, info)
+	if err != nil {
+		return err
+	}
+	return c.printWallet(wallet)
+}
+
+func (c *cli) balance(ctx context.Context, args []string) error {
+	fs := newFlagSet("balance")
+	walletId := walletFlag(fs, "wallet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	wallet, err := c.walletService.WalletStatus(ctx, walletId.id)
+	if err != nil {
+		return err
+	}
+	return c.printWallet(wallet)
+}
+
+func (c *cli) history(ctx context.Context, args []string) error {
+	fs := newFlagSet("history")
+	walletId := walletFlag(fs, "wallet")
+	reference := fs.String("reference", "", "only transactions with this external reference")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	txs, err := c.walletService.TransactionHistory(ctx, walletId.id, entity.TransactionFilter{Reference: *reference})
+	if err != nil {
+		return err
+	}
+	return c.out.print(txs, transactionHeader, transactionRows(txs))
+}
+
+func (c *cli) transfer(ctx context.Context, args []string) error {
+	fs := newFlagSet("transfer")
+	from := walletFlag(fs, "from")
+	to := walletFlag(fs, "to")
+	amount := fs.Float64("amount", 0, "amount to transfer")
+	reason := fs.String("reason", "", "reason for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(from, to); err != nil {
+		return err
+	}
+
+	err := c.adminService.Transfer(ctx, c.actor, *reason, from.id, to.id, float32(*amount))
+	if err != nil {
+		return err
+	}
+	return c.printDone("transfer")
+}
+
+func (c *cli) adjust(ctx context.Context, args []string) error {
+	fs := newFlagSet("adjust")
+	walletId := walletFlag(fs, "wallet")
+	amount := fs.Float64("amount", 0, "amount to credit, negative to debit")
+	reason := fs.String("reason", "", "reason for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	err := c.adminService.AdjustBalance(ctx, c.actor, *reason, walletId.id, float32(*amount))
+	if err != nil {
+		return err
+	}
+	return c.printDone("adjust")
+}
+
+func (c *cli) freeze(ctx context.Context, args []string, frozen bool) error {
+	command := "freeze"
+	if !frozen {
+		command = "unfreeze"
+	}
+	fs := newFlagSet(command)
+	walletId := walletFlag(fs, "wallet")
+	reason := fs.String("reason", "", "reason for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	err := c.adminService.FreezeWallet(ctx, c.actor, *reason, walletId.id, frozen)
+	if err != nil {
+		return err
+	}
+	return c.printDone(command)
+}
+
+func (c *cli) verifyAlias(ctx context.Context, args []string) error {
+	fs := newFlagSet("verify-alias")
+	walletId := walletFlag(fs, "wallet")
+	kind := fs.String("kind", "", "alias kind: email or phone")
+	reason := fs.String("reason", "", "reason for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	alias, err := c.adminService.VerifyAlias(ctx, c.actor, *reason, walletId.id, *kind)
+	if err != nil {
+		return err
+	}
+	return c.out.print(alias, []string{"WALLET", "KIND", "VALUE", "VERIFIED"}, [][]string{
+		{alias.WalletId.String(), alias.Kind, alias.Value, alias.VerifiedAt.Format(time.RFC3339)},
+	})
+}
+
+func (c *cli) creditLine(ctx context.Context, args []string) error {
+	fs := newFlagSet("credit-line")
+	walletId := walletFlag(fs, "wallet")
+	limit := fs.Float64("limit", 0, "credit limit, 0 turns the overdraft off")
+	rate := fs.String("rate", "0", "annual rate on the debt in percent, e.g. 19.9")
+	dayCount := fs.String("day-count", entity.DayCountActual365, "act/365, act/360 or act/act")
+	dailyFee := fs.Float64("daily-fee", 0, "fee for each day that ends with a negative balance")
+	reason := fs.String("reason", "", "reason for the audit log")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+
+	line, err := c.adminService.SetCreditLine(ctx, c.actor, *reason, entity.CreditLine{
+		WalletId:    walletId.id,
+		CreditLimit: float32(*limit),
+		AnnualRate:  *rate,
+		DayCount:    *dayCount,
+		DailyFee:    float32(*dailyFee),
+	})
+	if err != nil {
+		return err
+	}
+	return c.out.print(line, []string{"WALLET", "LIMIT", "BALANCE", "RATE", "DAY COUNT", "DAILY FEE"}, [][]string{
+		{line.WalletId.String(), formatAmount(line.CreditLimit), formatAmount(line.Balance), line.AnnualRate, line.DayCount, formatAmount(line.DailyFee)},
+	})
+}
+
+func (c *cli) export(ctx context.Context, args []string) error {
+	fs := newFlagSet("export")
+	walletId := walletFlag(fs, "wallet")
+	format := fs.String("format", "csv", "csv or json")
+	outPath := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(walletId); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown export format %q", *format)
+	}
+
+	txs, err := c.walletService.TransactionHistory(ctx, walletId.id, entity.TransactionFilter{})
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "json" {
+		if txs == nil {
+			txs = []entity.Transaction{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(txs)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(transactionHeader); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(transactionRows(txs)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func (c *cli) reconcile(ctx context.Context) error {
+	mismatches, err := c.adminService.Reconcile(ctx)
+	if err != nil {
+		return err
+	}
+	if mismatches == nil {
+		mismatches = []entity.ReconciliationMismatch{}
+	}
+
+	rows := make([][]string, 0, len(mismatches))
+	for _, m := range mismatches {
+		rows = append(rows, []string{m.WalletId.String(), formatAmount(m.Balance), formatAmount(m.Expected)})
+	}
+	return c.out.print(mismatches, []string{"WALLET", "BALANCE", "EXPECTED"}, rows)
+}
+
+func (c *cli) createInterestProduct(ctx context.Context, args []string) error {
+	fs := newFlagSet("interest-product")
+	name := fs.String("name", "", "product name")
+	rate := fs.String("rate", "", "annual rate in percent, e.g. 5.25")
+	dayCount := fs.String("day-count", entity.DayCountActual365, "act/365, act/360 or act/act")
+	compounding := fs.String("compounding", entity.CompoundingMonthly, "daily, monthly, quarterly or yearly")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	p, err := c.interestService.CreateProduct(ctx, entity.InterestProduct{
+		Name:        *name,
+		AnnualRate:  *rate,
+		DayCount:    *dayCount,
+		Compounding: *compounding,
+	})
+	if err != nil {
+		return err
+	}
+	return c.out.print(p, interestProductHeader, interestProductRows([]entity.InterestProduct{p}))
+}
+
+func (c *cli) interestProducts(ctx context.Context) error {
+	products, err := c.interestService.ListProducts(ctx)
+	if err != nil {
+		return err
+	}
+	if products == nil {
+		products = []entity.InterestProduct{}
+	}
+	return c.out.print(products, interestProductHeader, interestProductRows(products))
+}
+
+func (c *cli) openDispute(ctx context.Context, args []string) error {
+	fs := newFlagSet("dispute-open")
+	transactionId := fs.Int64("transaction", 0, "id of the disputed transfer, see history")
+	amount := fs.Float64("amount", 0, "amount to hold, 0 - the whole transfer")
+	reason := fs.String("reason", "", "reason for the dispute")
+	deadline := fs.Duration("deadline", 0, "time to resolve the dispute, 0 - disputes.defaultDeadline")
+	var evidence []entity.DisputeEvidence
+	fs.Func("evidence", "attachment as name=url, can be repeated", func(s string) error {
+		name, u, ok := strings.Cut(s, "=")
+		if !ok {
+			return errors.New("must be name=url")
+		}
+		evidence = append(evidence, entity.DisputeEvidence{Name: name, Url: u})
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	d := entity.Dispute{
+		TransactionId: *transactionId,
+		Amount:        float32(*amount),
+		Reason:        *reason,
+		Evidence:      evidence,
+	}
+	if *deadline != 0 {
+		d.Deadline = time.Now().Add(*deadline)
+	}
+	d, err := c.disputeService.OpenDispute(ctx, c.actor, d)
+	if err != nil {
+		return err
+	}
+	return c.printDispute(d)
+}
+
+func (c *cli) addDisputeEvidence(ctx context.Context, args []string) error {
+	fs := newFlagSet("dispute-evidence")
+	id := idFlag(fs, "id", "dispute id")
+	name := fs.String("name", "", "attachment name")
+	u := fs.String("url", "", "link to the file in the external storage")
+	note := fs.String("note", "", "what the attachment shows")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(id); err != nil {
+		return err
+	}
+
+	d, err := c.disputeService.AddEvidence(ctx, c.actor, id.id, []entity.DisputeEvidence{{Name: *name, Url: *u, Note: *note}})
+	if err != nil {
+		return err
+	}
+	return c.printDispute(d)
+}
+
+func (c *cli) resolveDispute(ctx context.Context, args []string) error {
+	fs := newFlagSet("dispute-resolve")
+	id := idFlag(fs, "id", "dispute id")
+	favor := fs.String("favor", "", "sender or recipient")
+	note := fs.String("note", "", "reason for the decision")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(id); err != nil {
+		return err
+	}
+
+	d, err := c.disputeService.ResolveDispute(ctx, c.actor, id.id, *favor, *note)
+	if err != nil {
+		return err
+	}
+	return c.printDispute(d)
+}
+
+func (c *cli) dispute(ctx context.Context, args []string) error {
+	fs := newFlagSet("dispute")
+	id := idFlag(fs, "id", "dispute id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(id); err != nil {
+		return err
+	}
+
+	d, err := c.disputeService.GetDispute(ctx, id.id)
+	if err != nil {
+		return err
+	}
+	return c.printDispute(d)
+}
+
+func (c *cli) disputes(ctx context.Context, args []string) error {
+	fs := newFlagSet("disputes")
+	status := fs.String("status", "", "open, reversed or released")
+	walletId := walletFlag(fs, "wallet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := entity.DisputeFilter{Status: *status}
+	if walletId.set {
+		filter.WalletId = &walletId.id
+	}
+	disputes, err := c.disputeService.ListDisputes(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if disputes == nil {
+		disputes = []entity.Dispute{}
+	}
+	return c.out.print(disputes, disputeHeader, disputeRows(disputes))
+}
+
+func (c *cli) fraudCases(ctx context.Context, args []string) error {
+	fs := newFlagSet("fraud-cases")
+	status := fs.String("status", "", "pending, approved, rejected or blocked")
+	walletId := walletFlag(fs, "wallet")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := entity.FraudCaseFilter{Status: *status}
+	if walletId.set {
+		filter.WalletId = &walletId.id
+	}
+	cases, err := c.fraudService.ListCases(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if cases == nil {
+		cases = []entity.FraudCase{}
+	}
+	return c.out.print(cases, fraudCaseHeader, fraudCaseRows(cases))
+}
+
+func (c *cli) fraudCase(ctx context.Context, args []string) error {
+	fs := newFlagSet("fraud-case")
+	id := idFlag(fs, "id", "fraud case id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(id); err != nil {
+		return err
+	}
+
+	fc, err := c.fraudService.GetCase(ctx, id.id)
+	if err != nil {
+		return err
+	}
+	return c.printFraudCase(fc)
+}
+
+// approve - зачислить удержанную сумму получателю, иначе - вернуть отправителю
+func (c *cli) decideFraudCase(ctx context.Context, args []string, approve bool) error {
+	name := "fraud-reject"
+	if approve {
+		name = "fraud-approve"
+	}
+	fs := newFlagSet(name)
+	id := idFlag(fs, "id", "fraud case id")
+	note := fs.String("note", "", "reason for the decision")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := requireIds(id); err != nil {
+		return err
+	}
+
+	decide := c.fraudService.RejectCase
+	if approve {
+		decide = c.fraudService.ApproveCase
+	}
+	fc, err := decide(ctx, c.actor, id.id, *note)
+	if err != nil {
+		return err
+	}
+	return c.printFraudCase(fc)
+}
+
+func (c *cli) printWallet(wallet entity.Wallet) error {
+	return c.out.print(wallet, []string{"ID", "BALANCE", "CREDIT LIMIT", "FROZEN", "OWNER", "NAME", "LABELS"}, [][]string{
+		{wallet.Id.String(), formatAmount(wallet.Balance), formatAmount(wallet.CreditLimit), strconv.FormatBool(wallet.Frozen), wallet.OwnerId, wallet.DisplayName, strings.Join(wallet.Labels, ",")},
+	})
+}
+
+func (c *cli) printDone(command string) error {
+	return c.out.print(map[string]string{"command": command, "status": "ok"}, []string{"COMMAND", "STATUS"}, [][]string{{command, "ok"}})
+}
+
+var transactionHeader = []string{"ID", "TIME", "FROM", "TO", "AMOUNT", "SOURCE", "REFERENCE", "MEMO"}
+
+func transactionRows(txs []entity.Transaction) [][]string {
+	rows := make([][]string, 0, len(txs))
+	for _, tx := range txs {
+		var source string
+		if tx.Source != nil {
+			source = tx.Source.Type + ":" + tx.Source.Id.String()
+		}
+		rows = append(rows, []string{strconv.FormatInt(tx.Id, 10), tx.Time.Format(time.RFC3339), tx.From.String(), tx.To.String(), formatAmount(tx.Amount), source, tx.Reference, tx.Memo})
+	}
+	return rows
+}
+
+// в таблице под спором - вложения и история, в json они внутри спора
+func (c *cli) printDispute(d entity.Dispute) error {
+	if err := c.out.print(d, disputeHeader, disputeRows([]entity.Dispute{d})); err != nil || c.out.format == formatJSON {
+		return err
+	}
+
+	rows := make([][]string, 0, len(d.Evidence))
+	for _, e := range d.Evidence {
+		rows = append(rows, []string{e.Name, e.Url, e.Note, e.AddedBy, e.AddedAt.Format(time.RFC3339)})
+	}
+	fmt.Fprintln(c.out.w)
+	if err := c.out.print(nil, []string{"EVIDENCE", "URL", "NOTE", "ADDED BY", "ADDED AT"}, rows); err != nil {
+		return err
+	}
+
+	rows = make([][]string, 0, len(d.Events))
+	for _, e := range d.Events {
+		rows = append(rows, []string{e.Time.Format(time.RFC3339), e.FromStatus, e.ToStatus, e.Actor, e.Note})
+	}
+	fmt.Fprintln(c.out.w)
+	return c.out.print(nil, []string{"TIME", "FROM", "TO", "ACTOR", "NOTE"}, rows)
+}
+
+var disputeHeader = []string{"ID", "TRANSACTION", "SENDER", "RECIPIENT", "AMOUNT", "STATUS", "DEADLINE", "OPENED BY", "REASON"}
+
+func disputeRows(disputes []entity.Dispute) [][]string {
+	rows := make([][]string, 0, len(disputes))
+	for _, d := range disputes {
+		rows = append(rows, []string{
+			d.Id.String(), strconv.FormatInt(d.TransactionId, 10), d.Sender.String(), d.Recipient.String(),
+			formatAmount(d.Amount), d.Status, d.Deadline.Format(time.RFC3339), d.OpenedBy, d.Reason,
+		})
+	}
+	return rows
+}
+
+// в таблице под переводом - сработавшие правила, в json они внутри перевода
+func (c *cli) printFraudCase(fc entity.FraudCase) error {
+	if err := c.out.print(fc, fraudCaseHeader, fraudCaseRows([]entity.FraudCase{fc})); err != nil || c.out.format == formatJSON {
+		return err
+	}
+
+	rows := make([][]string, 0, len(fc.Reasons))
+	for _, r := range fc.Reasons {
+		rows = append(rows, []string{r.Rule, r.Type, strconv.Itoa(r.Score), r.Message})
+	}
+	fmt.Fprintln(c.out.w)
+	if err := c.out.print(nil, []string{"RULE", "TYPE", "SCORE", "MESSAGE"}, rows); err != nil {
+		return err
+	}
+	if fc.DecidedAt == nil {
+		return nil
+	}
+	fmt.Fprintln(c.out.w)
+	return c.out.print(nil, []string{"DECIDED AT", "DECIDED BY", "NOTE"}, [][]string{
+		{fc.DecidedAt.Format(time.RFC3339), fc.DecidedBy, fc.DecisionNote},
+	})
+}
+
+var fraudCaseHeader = []string{"ID", "CREATED", "FROM", "TO", "AMOUNT", "SCORE", "DECISION", "STATUS", "REFERENCE", "MEMO"}
+
+func fraudCaseRows(cases []entity.FraudCase) [][]string {
+	rows := make([][]string, 0, len(cases))
+	for _, fc := range cases {
+		rows = append(rows, []string{
+			fc.Id.String(), fc.CreatedAt.Format(time.RFC3339), fc.From.String(), fc.To.String(),
+			formatAmount(fc.Amount), strconv.Itoa(fc.Score), fc.Decision, fc.Status, fc.Reference, fc.Memo,
+		})
+	}
+	return rows
+}
+
+var interestProductHeader = []string{"ID", "NAME", "RATE", "DAY COUNT", "COMPOUNDING"}
+
+func interestProductRows(products []entity.InterestProduct) [][]string {
+	rows := make([][]string, 0, len(products))
+	for _, p := range products {
+		rows = append(rows, []string{p.Id.String(), p.Name, p.AnnualRate, p.DayCount, p.Compounding})
+	}
+	return rows
+}
+
+func formatAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', -1, 32)
+}
+
+func newFlagSet(command string) *flag.FlagSet {
+	return flag.NewFlagSet("ewalletctl "+command, flag.ContinueOnError)
+}
+
+// uuid-флаг, который помнит, был ли он задан
+type uuidFlag struct {
+	name string
+	id   uuid.UUID
+	set  bool
+}
+
+func walletFlag(fs *flag.FlagSet, name string) *uuidFlag {
+	return idFlag(fs, name, "wallet id")
+}
+
+func idFlag(fs *flag.FlagSet, name, usage string) *uuidFlag {
+	f := &uuidFlag{name: name}
+	fs.Func(name, usage, func(s string) error {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return err
+		}
+		f.id, f.set = id, true
+		return nil
+	})
+	return f
+}
+
+func requireIds(flags ...*uuidFlag) error {
+	var errs []error
+	for _, f := range flags {
+		if !f.set {
+			errs = append(errs, fmt.Errorf("-%s is required", f.name))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,188 @@
+// ewalletctl - утилита для операционных задач: работает с базой через те же
+// repository.WalletRepo и service.WalletService, что и приложение, поэтому бизнес-правила соблюдаются
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/config"
+	"github.com/timohahaa/ewallet/internal/app"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/service"
+	"github.com/timohahaa/postgres"
+)
+
+const defaultConfigFilePath = "./config/config.yaml"
+
+const usage = `usage: ewalletctl [flags] <command> [command flags]
+
+flags:
+  -config path     config file (default ./config/config.yaml)
+  -o table|json    output format (default table)
+  -actor name      operator name for the audit log (default current OS user)
+
+commands:
+  create    [-owner ID] [-name N] [-labels a,b]     create a wallet
+  balance   -wallet ID                              show wallet balance and state
+  history   -wallet ID [-reference R]               show wallet transaction history
+  transfer  -from ID -to ID -amount X -reason R     audited transfer between wallets
+  adjust    -wallet ID -amount X -reason R          audited balance adjustment, negative amount debits
+  freeze    -wallet ID -reason R                    audited freeze: the wallet can't send or receive
+  unfreeze  -wallet ID -reason R                    audited unfreeze
+  verify-alias -wallet ID -kind email|phone -reason R
+                                                    audited confirmation of the wallet's email or phone alias
+  credit-line -wallet ID -limit X [-rate R] [-day-count act/365|act/360|act/act] [-daily-fee F] -reason R
+                                                    audited credit limit and charges for a negative balance, -limit 0 turns the overdraft off
+  export    -wallet ID [-format csv|json] [-out F]  export transaction history
+  reconcile                                         list wallets whose balance doesn't match their transactions
+  interest-product -name N -rate R [-day-count act/365|act/360|act/act] [-compounding daily|monthly|quarterly|yearly]
+                                                    create an interest product, rate in percent per year
+  interest-products                                 list interest products
+  dispute-open -transaction N [-amount X] -reason R [-deadline D] [-evidence name=url ...]
+                                                    open a dispute on a transfer and hold the amount at the recipient,
+                                                    -amount defaults to the whole transfer, -deadline to disputes.defaultDeadline
+  dispute-evidence -id ID -name N -url U [-note T]  attach evidence to an open dispute
+  dispute-resolve -id ID -favor sender|recipient -note T
+                                                    resolve a dispute: sender gets the held amount back, recipient gets the hold released
+  dispute   -id ID                                  show a dispute with its evidence and history
+  disputes  [-status open|reversed|released] [-wallet ID]
+                                                    list disputes
+  fraud-cases [-status pending|approved|rejected|blocked] [-wallet ID]
+                                                    list transfers flagged by fraud rules
+  fraud-case -id ID                                 show a flagged transfer with the triggered rules
+  fraud-approve -id ID -note T                      credit a held transfer to the recipient
+  fraud-reject -id ID -note T                       return a held transfer to the sender
+`
+
+type cli struct {
+	walletService   service.WalletService
+	adminService    service.AdminService
+	interestService service.InterestService
+	disputeService  service.DisputeService
+	fraudService    service.FraudService
+	out             *printer
+	actor           string
+}
+
+func main() {
+	global := flag.NewFlagSet("ewalletctl", flag.ExitOnError)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	configFilePath := global.String("config", defaultConfigFilePath, "config file")
+	format := global.String("o", formatTable, "output format")
+	actor := global.String("actor", currentUser(), "operator name for the audit log")
+	_ = global.Parse(os.Args[1:])
+
+	if global.NArg() == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	out, err := newPrinter(os.Stdout, *format)
+	if err != nil {
+		fatal(err)
+	}
+
+	cfg, err := config.NewConfig(*configFilePath)
+	if err != nil {
+		fatal(fmt.Errorf("config error: %w", err))
+	}
+
+	// в stderr и только предупреждения - вывод команды не должен смешиваться с логами
+	logger := logrus.New()
+	logger.SetOutput(os.Stderr)
+	logger.SetLevel(logrus.WarnLevel)
+
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxConnPoolSize(cfg.PG.ConnPoolSize))
+	if err != nil {
+		fatal(fmt.Errorf("error connecting to postgres: %w", err))
+	}
+	defer pg.ConnPool.Close()
+
+	transactor := repository.NewTransactor(pg)
+	// политики карманов и данных переводов - из того же конфига, что и у приложения; антифрод переводы оператора не проверяет
+	walletService := app.NewWalletService(cfg, repository.NewWalletRepo(pg, logger), logger, nil, nil)
+	c := &cli{
+		walletService: walletService,
+		adminService:  service.NewAdminService(walletService, repository.NewAdminRepo(pg, logger), logger),
+		// утилита только заводит продукты, выплаты делает воркер приложения - казначейский кошелек не нужен
+		interestService: service.NewInterestService(walletService, repository.NewInterestRepo(pg, logger), transactor, logger, service.InterestPolicy{}),
+		// дедлайны споров по умолчанию - из того же конфига, что и у приложения; истекшие закрывает воркер приложения
+		disputeService: service.NewDisputeService(repository.NewDisputeRepo(pg, logger), transactor, logger, cfg.Disputes.DefaultDeadline, cfg.Disputes.RetryDelay),
+		fraudService:   service.NewFraudService(repository.NewFraudRepo(pg, logger), transactor, logger),
+		out:            out,
+		actor:          *actor,
+	}
+
+	if err := c.run(context.Background(), global.Arg(0), global.Args()[1:]); err != nil {
+		pg.ConnPool.Close()
+		fatal(err)
+	}
+}
+
+func (c *cli) run(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "create":
+		return c.create(ctx, args)
+	case "balance":
+		return c.balance(ctx, args)
+	case "history":
+		return c.history(ctx, args)
+	case "transfer":
+		return c.transfer(ctx, args)
+	case "adjust":
+		return c.adjust(ctx, args)
+	case "freeze":
+		return c.freeze(ctx, args, true)
+	case "unfreeze":
+		return c.freeze(ctx, args, false)
+	case "verify-alias":
+		return c.verifyAlias(ctx, args)
+	case "credit-line":
+		return c.creditLine(ctx, args)
+	case "export":
+		return c.export(ctx, args)
+	case "reconcile":
+		return c.reconcile(ctx)
+	case "interest-product":
+		return c.createInterestProduct(ctx, args)
+	case "interest-products":
+		return c.interestProducts(ctx)
+	case "dispute-open":
+		return c.openDispute(ctx, args)
+	case "dispute-evidence":
+		return c.addDisputeEvidence(ctx, args)
+	case "dispute-resolve":
+		return c.resolveDispute(ctx, args)
+	case "dispute":
+		return c.dispute(ctx, args)
+	case "disputes":
+		return c.disputes(ctx, args)
+	case "fraud-cases":
+		return c.fraudCases(ctx, args)
+	case "fraud-case":
+		return c.fraudCase(ctx, args)
+	case "fraud-approve":
+		return c.decideFraudCase(ctx, args, true)
+	case "fraud-reject":
+		return c.decideFraudCase(ctx, args, false)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "ewalletctl:", err)
+	os.Exit(1)
+}
@@ -1,9 +1,17 @@
 package main
 
-import "github.com/timohahaa/ewallet/internal/app"
+import (
+	"os"
+
+	"github.com/timohahaa/ewallet/internal/app"
+)
 
 const configFilePath = "./config/config.yaml"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		app.Migrate(configFilePath, os.Args[2:])
+		return
+	}
 	app.Run(configFilePath)
 }
@@ -2,22 +2,176 @@ package config
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
+const (
+	StoragePostgres = "postgres"
+	StorageMemory   = "memory"
+)
+
 type (
 	Config struct {
-		PG     `yaml:"postgres"`
-		Server `yaml:"server"`
+		PG      `yaml:"postgres"`
+		Server  `yaml:"server"`
+		Tracing `yaml:"tracing"`
+		Storage `yaml:"storage"`
+
+		Transfers          `yaml:"transfers"`
+		Pockets            `yaml:"pockets"`
+		ScheduledTransfers `yaml:"scheduledTransfers"`
+		StandingOrders     `yaml:"standingOrders"`
+		BatchTransfers     `yaml:"batchTransfers"`
+		Escrows            `yaml:"escrows"`
+		PaymentRequests    `yaml:"paymentRequests"`
+		Invoices           `yaml:"invoices"`
+		Interest           `yaml:"interest"`
+		Credit             `yaml:"credit"`
+		Disputes           `yaml:"disputes"`
+		Fraud              `yaml:"fraud"`
 	}
 	PG struct {
-		URL          string `yaml:"url" env:"PG_URL" env-required:"true"`
+		// обязателен для storage.backend = postgres
+		URL          string `yaml:"url" env:"PG_URL"`
 		ConnPoolSize int    `yaml:"maxConnPoolSize" env:"PG_MAX_POOL_SIZE"`
+		// накатывать миграции при старте приложения; по умолчанию выключено - в проде миграции применяются
+		// отдельным шагом (./app migrate up), а не каждой стартующей репликой
+		AutoMigrate bool `yaml:"autoMigrate" env:"PG_AUTO_MIGRATE" env-default:"false"`
 	}
 	Server struct {
 		Port    string `yaml:"port" env:"HTTP_SERVER_PORT"`
 		LogPath string `yaml:"logPath"`
+		// сколько ждать после перевода /readyz в fail перед остановкой сервера
+		DrainDelay time.Duration `yaml:"drainDelay" env:"HTTP_SERVER_DRAIN_DELAY" env-default:"5s"`
+	}
+	Storage struct {
+		// postgres | memory (для демо и локальной разработки, данные не сохраняются)
+		Backend string `yaml:"backend" env:"STORAGE_BACKEND" env-default:"postgres"`
+	}
+	Transfers struct {
+		// допустимые ключи metadata перевода; пустой список - любые ключи
+		MetadataKeys []string `yaml:"metadataKeys" env:"TRANSFERS_METADATA_KEYS" env-separator:","`
+		// максимальный размер metadata в байтах JSON; 0 - metadata не принимаются
+		MaxMetadataSize int `yaml:"maxMetadataSize" env:"TRANSFERS_MAX_METADATA_SIZE" env-default:"1024"`
+	}
+	Pockets struct {
+		// максимальное кол-во открытых карманов у одного кошелька
+		MaxPerWallet int `yaml:"maxPerWallet" env:"POCKETS_MAX_PER_WALLET" env-default:"10"`
+		// true - из кармана можно переводить только в родительский кошелек и соседние карманы
+		RestrictExternalTransfers bool `yaml:"restrictExternalTransfers" env:"POCKETS_RESTRICT_EXTERNAL_TRANSFERS" env-default:"false"`
+	}
+	ScheduledTransfers struct {
+		// как часто воркер ищет переводы, время которых наступило
+		Interval time.Duration `yaml:"interval" env:"SCHEDULED_TRANSFERS_INTERVAL" env-default:"10s"`
+		// сколько переводов исполняется за один проход
+		BatchSize int `yaml:"batchSize" env:"SCHEDULED_TRANSFERS_BATCH_SIZE" env-default:"100"`
+		// через сколько повторять перевод, отклоненный по бизнес-причине (например, не хватило баланса)
+		RetryDelay time.Duration `yaml:"retryDelay" env:"SCHEDULED_TRANSFERS_RETRY_DELAY" env-default:"1h"`
+	}
+	StandingOrders struct {
+		// как часто воркер ищет поручения, время запуска которых наступило
+		Interval time.Duration `yaml:"interval" env:"STANDING_ORDERS_INTERVAL" env-default:"30s"`
+		// сколько запусков обрабатывается за один проход
+		BatchSize int `yaml:"batchSize" env:"STANDING_ORDERS_BATCH_SIZE" env-default:"100"`
+	}
+	BatchTransfers struct {
+		// максимальное кол-во строк в одном пакете
+		MaxLines int `yaml:"maxLines" env:"BATCH_TRANSFERS_MAX_LINES" env-default:"1000"`
+		// пакеты больше этого размера исполняются асинхронно воркером
+		AsyncThreshold int `yaml:"asyncThreshold" env:"BATCH_TRANSFERS_ASYNC_THRESHOLD" env-default:"100"`
+		// как часто воркер исполняет ожидающие пакеты
+		Interval time.Duration `yaml:"interval" env:"BATCH_TRANSFERS_INTERVAL" env-default:"5s"`
+		// сколько пакетов исполняется за один проход
+		BatchSize int `yaml:"batchSize" env:"BATCH_TRANSFERS_BATCH_SIZE" env-default:"10"`
+	}
+	Escrows struct {
+		// как часто воркер ищет сделки с наступившим дедлайном
+		Interval time.Duration `yaml:"interval" env:"ESCROWS_INTERVAL" env-default:"30s"`
+		// сколько сделок закрывается за один проход
+		BatchSize int `yaml:"batchSize" env:"ESCROWS_BATCH_SIZE" env-default:"100"`
+		// на сколько сдвигать дедлайн, если автоматически передать средства не удалось (например, кошелек продавца заморожен)
+		RetryDelay time.Duration `yaml:"retryDelay" env:"ESCROWS_RETRY_DELAY" env-default:"1h"`
+	}
+	PaymentRequests struct {
+		// срок жизни запроса денег, если expiresAt не передан
+		DefaultTTL time.Duration `yaml:"defaultTtl" env:"PAYMENT_REQUESTS_DEFAULT_TTL" env-default:"168h"`
+		// как часто воркер помечает истекшие запросы
+		Interval time.Duration `yaml:"interval" env:"PAYMENT_REQUESTS_INTERVAL" env-default:"1m"`
+		// сколько запросов помечается за один проход
+		BatchSize int `yaml:"batchSize" env:"PAYMENT_REQUESTS_BATCH_SIZE" env-default:"1000"`
+	}
+	Invoices struct {
+		// валюта кошельков (ISO 4217) - счета в другой валюте не принимаются
+		Currency string `yaml:"currency" env:"INVOICES_CURRENCY" env-default:"RUB"`
+		// как часто воркер помечает просроченные счета
+		Interval time.Duration `yaml:"interval" env:"INVOICES_INTERVAL" env-default:"1m"`
+		// сколько счетов помечается за один проход
+		BatchSize int `yaml:"batchSize" env:"INVOICES_BATCH_SIZE" env-default:"1000"`
+	}
+	Interest struct {
+		// кошелек, с которого выплачиваются проценты; пусто - начисление процентов выключено
+		TreasuryWalletId string `yaml:"treasuryWalletId" env:"INTEREST_TREASURY_WALLET_ID"`
+		// как часто воркер начисляет и выплачивает проценты за закончившиеся дни
+		Interval time.Duration `yaml:"interval" env:"INTEREST_INTERVAL" env-default:"1m"`
+		// сколько дней (по всем кошелькам) начисляется за один проход
+		BatchSize int `yaml:"batchSize" env:"INTEREST_BATCH_SIZE" env-default:"1000"`
+		// через сколько повторять выплату, которая не прошла (например, на казначейском кошельке не хватило баланса)
+		RetryDelay time.Duration `yaml:"retryDelay" env:"INTEREST_RETRY_DELAY" env-default:"1h"`
+	}
+	Credit struct {
+		// кошелек, на который списываются проценты и комиссия по кредитным линиям; пусто - начисление выключено,
+		// лимиты и уведомления о пороге использования работают и без него
+		TreasuryWalletId string `yaml:"treasuryWalletId" env:"CREDIT_TREASURY_WALLET_ID"`
+		// как часто воркер начисляет за закончившиеся дни и проверяет пороги использования лимита
+		Interval time.Duration `yaml:"interval" env:"CREDIT_INTERVAL" env-default:"1m"`
+		// сколько дней начисления (по всем кошелькам) и сколько уведомлений обрабатывается за один проход
+		BatchSize int `yaml:"batchSize" env:"CREDIT_BATCH_SIZE" env-default:"1000"`
+		// через сколько повторять списание, которое не прошло (например, кошельку не хватило лимита)
+		RetryDelay time.Duration `yaml:"retryDelay" env:"CREDIT_RETRY_DELAY" env-default:"1h"`
+		// пороги задолженности в процентах лимита, о пересечении которых пишется уведомление
+		AlertThresholds []int `yaml:"alertThresholds" env:"CREDIT_ALERT_THRESHOLDS" env-separator:"," env-default:"50,80,100"`
+	}
+	Disputes struct {
+		// срок решения спора, если оператор не задал дедлайн при открытии
+		DefaultDeadline time.Duration `yaml:"defaultDeadline" env:"DISPUTES_DEFAULT_DEADLINE" env-default:"336h"`
+		// как часто воркер ищет споры с наступившим дедлайном
+		Interval time.Duration `yaml:"interval" env:"DISPUTES_INTERVAL" env-default:"1m"`
+		// сколько споров закрывается за один проход
+		BatchSize int `yaml:"batchSize" env:"DISPUTES_BATCH_SIZE" env-default:"100"`
+		// на сколько сдвигать дедлайн, если снять удержание не удалось (например, кошелек получателя заморожен)
+		RetryDelay time.Duration `yaml:"retryDelay" env:"DISPUTES_RETRY_DELAY" env-default:"1h"`
+	}
+	Fraud struct {
+		// сумма баллов сработавших правил, начиная с которой перевод отправляется на ручную проверку
+		ReviewScore int `yaml:"reviewScore" env:"FRAUD_REVIEW_SCORE" env-default:"50"`
+		// сумма баллов, начиная с которой перевод блокируется
+		BlockScore int `yaml:"blockScore" env:"FRAUD_BLOCK_SCORE" env-default:"100"`
+		// правила задаются только в файле; пустой список - проверка выключена
+		Rules []FraudRule `yaml:"rules"`
+	}
+	FraudRule struct {
+		Name string `yaml:"name"`
+		// velocity | new_counterparty | spike | fan_out
+		Type  string `yaml:"type"`
+		Score int    `yaml:"score"`
+		// velocity, fan_out: сколько переводов (новых получателей) за window допустимо
+		Count  int           `yaml:"count"`
+		Window time.Duration `yaml:"window"`
+		// new_counterparty: сумма, начиная с которой первый перевод получателю подозрителен
+		MinAmount float32 `yaml:"minAmount"`
+		// spike: во сколько раз сумма должна превышать среднюю за window и сколько переводов нужно для средней
+		Factor     float64 `yaml:"factor"`
+		MinHistory int     `yaml:"minHistory"`
+	}
+	Tracing struct {
+		// otlp | stdout | none
+		Exporter     string  `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+		OTLPEndpoint string  `yaml:"otlpEndpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT"`
+		ServiceName  string  `yaml:"serviceName" env:"OTEL_SERVICE_NAME" env-default:"ewallet"`
+		SampleRatio  float64 `yaml:"sampleRatio" env-default:"1"`
 	}
 )
 
@@ -29,6 +183,37 @@ func NewConfig(filePath string) (*Config, error) {
 		return nil, fmt.Errorf("error reading config file: %w", err)
 	}
 
+	switch cfg.Storage.Backend {
+	case StoragePostgres:
+		if cfg.PG.URL == "" {
+			return nil, fmt.Errorf("postgres url is required for %q storage backend (PG_URL)", StoragePostgres)
+		}
+	case StorageMemory:
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+
+	if cfg.Interest.TreasuryWalletId != "" {
+		if _, err := uuid.Parse(cfg.Interest.TreasuryWalletId); err != nil {
+			return nil, fmt.Errorf("invalid interest treasury wallet id %q: %w", cfg.Interest.TreasuryWalletId, err)
+		}
+	}
+
+	if cfg.Credit.TreasuryWalletId != "" {
+		if _, err := uuid.Parse(cfg.Credit.TreasuryWalletId); err != nil {
+			return nil, fmt.Errorf("invalid credit treasury wallet id %q: %w", cfg.Credit.TreasuryWalletId, err)
+		}
+	}
+	for i, t := range cfg.Credit.AlertThresholds {
+		if t < 1 || t > 100 || (i > 0 && t <= cfg.Credit.AlertThresholds[i-1]) {
+			return nil, fmt.Errorf("credit alert thresholds must be increasing percents between 1 and 100, got %v", cfg.Credit.AlertThresholds)
+		}
+	}
+
+	if err := validateFraud(cfg.Fraud); err != nil {
+		return nil, err
+	}
+
 	//	err = cleanenv.UpdateEnv(cfg)
 	//	if err != nil {
 	//		return nil, fmt.Errorf("error updating env: %w", err)
@@ -36,3 +221,44 @@ func NewConfig(filePath string) (*Config, error) {
 
 	return cfg, nil
 }
+
+func validateFraud(f Fraud) error {
+	if len(f.Rules) == 0 {
+		return nil
+	}
+	if f.ReviewScore <= 0 || f.BlockScore < f.ReviewScore {
+		return fmt.Errorf("fraud scores must satisfy 0 < reviewScore <= blockScore, got %d and %d", f.ReviewScore, f.BlockScore)
+	}
+
+	names := make(map[string]bool, len(f.Rules))
+	for i, r := range f.Rules {
+		if r.Name == "" {
+			return fmt.Errorf("fraud rule #%d: name is required", i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("fraud rule %q: duplicate name", r.Name)
+		}
+		names[r.Name] = true
+		if r.Score <= 0 {
+			return fmt.Errorf("fraud rule %q: score must be positive", r.Name)
+		}
+
+		switch r.Type {
+		case "velocity", "fan_out":
+			if r.Count <= 0 || r.Window <= 0 {
+				return fmt.Errorf("fraud rule %q: %s needs positive count and window", r.Name, r.Type)
+			}
+		case "new_counterparty":
+			if r.MinAmount <= 0 {
+				return fmt.Errorf("fraud rule %q: new_counterparty needs positive minAmount", r.Name)
+			}
+		case "spike":
+			if r.Factor <= 1 || r.Window <= 0 || r.MinHistory <= 0 {
+				return fmt.Errorf("fraud rule %q: spike needs factor above 1, positive window and minHistory", r.Name)
+			}
+		default:
+			return fmt.Errorf("fraud rule %q: unknown type %q", r.Name, r.Type)
+		}
+	}
+	return nil
+}
@@ -1,19 +1,25 @@
 package app
 
 import (
+	"context"
 	log2 "log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/timohahaa/ewallet/config"
 	v1 "github.com/timohahaa/ewallet/internal/controllers/http/v1"
+	"github.com/timohahaa/ewallet/internal/health"
+	"github.com/timohahaa/ewallet/internal/metrics"
 	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/memory"
 	"github.com/timohahaa/ewallet/internal/service"
 	"github.com/timohahaa/ewallet/pkg/httpserver"
 	log "github.com/timohahaa/ewallet/pkg/logger"
-	"github.com/timohahaa/postgres"
+	"github.com/timohahaa/ewallet/pkg/tracing"
 )
 
 func Run(configFilePath string) {
@@ -25,24 +31,174 @@ func Run(configFilePath string) {
 	logger := log.GetLogger("internal.log", cfg.Server.LogPath)
 	httpLogger := log.GetLogger("requests.log", cfg.Server.LogPath)
 
-	// database
-	logger.Info("initializing postgres connection...")
-	pg, err := postgres.New(cfg.PG.URL, postgres.MaxConnPoolSize(cfg.PG.ConnPoolSize))
+	// трейсинг
+	logger.WithFields(logrus.Fields{"exporter": cfg.Tracing.Exporter}).Info("initializing tracing...")
+	tracerProvider, err := tracing.New(cfg.Tracing.Exporter,
+		tracing.ServiceName(cfg.Tracing.ServiceName),
+		tracing.OTLPEndpoint(cfg.Tracing.OTLPEndpoint),
+		tracing.SampleRatio(cfg.Tracing.SampleRatio),
+	)
 	if err != nil {
-		logger.WithFields(logrus.Fields{"error": err}).Fatal("error connecting to postgres")
+		logger.WithFields(logrus.Fields{"error": err}).Fatal("error initializing tracing")
 	}
 
+	// метрики
+	logger.Info("initializing metrics...")
+	m := metrics.New()
+
+	// проверки для readiness-пробы
+	checker := health.NewChecker()
+
 	// транспортный слой
-	logger.Info("initializing repositories...")
-	walletRepo := repository.NewWalletRepo(pg, logger)
+	logger.WithFields(logrus.Fields{"backend": cfg.Storage.Backend}).Info("initializing repositories...")
+	var (
+		walletRepo            repository.WalletRepo
+		scheduledTransferRepo repository.ScheduledTransferRepo
+		standingOrderRepo     repository.StandingOrderRepo
+		batchTransferRepo     repository.BatchTransferRepo
+		escrowRepo            repository.EscrowRepo
+		paymentRequestRepo    repository.PaymentRequestRepo
+		invoiceRepo           repository.InvoiceRepo
+		aliasRepo             repository.AliasRepo
+		savingsGoalRepo       repository.SavingsGoalRepo
+		interestRepo          repository.InterestRepo
+		creditRepo            repository.CreditRepo
+		disputeRepo           repository.DisputeRepo
+		fraudRepo             repository.FraudRepo
+		transactor            repository.Transactor
+	)
+	switch cfg.Storage.Backend {
+	case config.StorageMemory:
+		logger.Warn("using in-memory storage, all data will be lost on restart")
+		walletRepo = memory.NewWalletRepo()
+	default:
+		pg := initPostgres(cfg, logger, m, checker)
+		walletRepo = repository.NewWalletRepo(pg, logger)
+		scheduledTransferRepo = repository.NewScheduledTransferRepo(pg, logger)
+		standingOrderRepo = repository.NewStandingOrderRepo(pg, logger)
+		batchTransferRepo = repository.NewBatchTransferRepo(pg, logger)
+		escrowRepo = repository.NewEscrowRepo(pg, logger)
+		paymentRequestRepo = repository.NewPaymentRequestRepo(pg, logger)
+		invoiceRepo = repository.NewInvoiceRepo(pg, logger)
+		aliasRepo = repository.NewAliasRepo(pg, logger)
+		savingsGoalRepo = repository.NewSavingsGoalRepo(pg, logger)
+		interestRepo = repository.NewInterestRepo(pg, logger)
+		creditRepo = repository.NewCreditRepo(pg, logger)
+		disputeRepo = repository.NewDisputeRepo(pg, logger)
+		fraudRepo = repository.NewFraudRepo(pg, logger)
+		transactor = repository.NewTransactor(pg)
+	}
 
 	// слой БЛ
 	logger.Info("initializing services...")
-	walletService := service.NewWalletService(walletRepo, logger)
+	pockets := PocketPolicy(cfg)
+	// правилам нужна история переводов из postgres - в in-memory режиме проверки нет
+	var fraud *service.FraudScreen
+	if fraudRepo != nil && len(cfg.Fraud.Rules) > 0 {
+		fraud = service.NewFraudScreen(fraudRepo, transactor, logger, FraudPolicy(cfg))
+	}
+	walletService := NewWalletService(cfg, walletRepo, logger, m, fraud)
+	services := service.Services{
+		Wallet: walletService,
+		Pocket: service.NewPocketService(walletRepo, walletService, logger, pockets),
+	}
+	// отложенные, регулярные и пакетные переводы, сделки с удержанием, запросы денег и счета требуют транзакций БД - в in-memory режиме недоступны
+	if transactor != nil {
+		services.ScheduledTransfer = service.NewScheduledTransferService(walletService, scheduledTransferRepo, transactor, logger, cfg.ScheduledTransfers.RetryDelay)
+		services.StandingOrder = service.NewStandingOrderService(walletService, standingOrderRepo, transactor, logger)
+		services.BatchTransfer = service.NewBatchTransferService(batchTransferRepo, transactor, logger, cfg.BatchTransfers.MaxLines, cfg.BatchTransfers.AsyncThreshold, walletRepo, pockets, fraud)
+		services.Escrow = service.NewEscrowService(escrowRepo, transactor, logger, cfg.Escrows.RetryDelay, walletRepo, pockets, fraud)
+		services.PaymentRequest = service.NewPaymentRequestService(walletService, paymentRequestRepo, transactor, logger, cfg.PaymentRequests.DefaultTTL)
+		services.Invoice = service.NewInvoiceService(walletService, invoiceRepo, transactor, logger, cfg.Invoices.Currency)
+		// проценты выплачивать не с чего, пока не задан казначейский кошелек
+		if cfg.Interest.TreasuryWalletId != "" {
+			services.Interest = service.NewInterestService(walletService, interestRepo, transactor, logger, service.InterestPolicy{
+				TreasuryWalletId: uuid.MustParse(cfg.Interest.TreasuryWalletId),
+				RetryDelay:       cfg.Interest.RetryDelay,
+			})
+		}
+		// лимиты задаются через ewalletctl; без казначейского кошелька проценты и комиссия не начисляются
+		credit := service.CreditPolicy{RetryDelay: cfg.Credit.RetryDelay, AlertThresholds: cfg.Credit.AlertThresholds}
+		if cfg.Credit.TreasuryWalletId != "" {
+			credit.TreasuryWalletId = uuid.MustParse(cfg.Credit.TreasuryWalletId)
+		}
+		services.Credit = service.NewCreditService(walletService, creditRepo, transactor, logger, credit)
+		services.Dispute = service.NewDisputeService(disputeRepo, transactor, logger, cfg.Disputes.DefaultDeadline, cfg.Disputes.RetryDelay)
+		services.Fraud = service.NewFraudService(fraudRepo, transactor, logger)
+	}
+	// справочник псевдонимов есть только в postgres
+	if aliasRepo != nil {
+		services.Alias = service.NewAliasService(aliasRepo, logger)
+	}
+	// цели накоплений есть только в postgres, правило округления - в обоих хранилищах
+	if savingsGoalRepo != nil {
+		services.SavingsGoal = service.NewSavingsGoalService(savingsGoalRepo, logger)
+	}
+
+	// фоновые воркеры
+	bg := newWorkers(logger)
+	if services.ScheduledTransfer != nil {
+		bg.Go("scheduled_transfers", cfg.ScheduledTransfers.Interval, func(ctx context.Context) error {
+			_, err := services.ScheduledTransfer.ExecuteDue(ctx, cfg.ScheduledTransfers.BatchSize)
+			return err
+		})
+	}
+	if services.StandingOrder != nil {
+		bg.Go("standing_orders", cfg.StandingOrders.Interval, func(ctx context.Context) error {
+			_, err := services.StandingOrder.ExecuteDue(ctx, cfg.StandingOrders.BatchSize)
+			return err
+		})
+	}
+	if services.BatchTransfer != nil {
+		bg.Go("batch_transfers", cfg.BatchTransfers.Interval, func(ctx context.Context) error {
+			_, err := services.BatchTransfer.ExecutePending(ctx, cfg.BatchTransfers.BatchSize)
+			return err
+		})
+	}
+	if services.Escrow != nil {
+		bg.Go("escrows", cfg.Escrows.Interval, func(ctx context.Context) error {
+			_, err := services.Escrow.ReleaseExpired(ctx, cfg.Escrows.BatchSize)
+			return err
+		})
+	}
+	if services.PaymentRequest != nil {
+		bg.Go("payment_requests", cfg.PaymentRequests.Interval, func(ctx context.Context) error {
+			_, err := services.PaymentRequest.ExpireDue(ctx, cfg.PaymentRequests.BatchSize)
+			return err
+		})
+	}
+	if services.Invoice != nil {
+		bg.Go("invoices", cfg.Invoices.Interval, func(ctx context.Context) error {
+			_, err := services.Invoice.MarkOverdue(ctx, cfg.Invoices.BatchSize)
+			return err
+		})
+	}
+	if services.Interest != nil {
+		bg.Go("interest", cfg.Interest.Interval, func(ctx context.Context) error {
+			_, err := services.Interest.AccrueDue(ctx, cfg.Interest.BatchSize)
+			return err
+		})
+	}
+
+	if services.Credit != nil {
+		bg.Go("credit", cfg.Credit.Interval, func(ctx context.Context) error {
+			if _, err := services.Credit.AccrueDue(ctx, cfg.Credit.BatchSize); err != nil {
+				return err
+			}
+			_, err := services.Credit.CheckUtilization(ctx, cfg.Credit.BatchSize)
+			return err
+		})
+	}
+	if services.Dispute != nil {
+		bg.Go("disputes", cfg.Disputes.Interval, func(ctx context.Context) error {
+			_, err := services.Dispute.ExpireDue(ctx, cfg.Disputes.BatchSize)
+			return err
+		})
+	}
 
 	// слой представления - handlers and routes
 	logger.Info("initializing handlers and routes...")
-	handler := v1.NewRouter(walletService, httpLogger)
+	handler := v1.NewRouter(services, httpLogger, m, checker)
 
 	logger.Infof("starting http server...")
 	server := httpserver.New(handler, httpserver.Port(cfg.Server.Port))
@@ -57,8 +213,21 @@ func Run(configFilePath string) {
 	<-shutdownChan
 
 	logger.Info("shutting down...")
+	// сначала readiness, чтобы балансировщик снял трафик, и только потом останавливаем сервер
+	checker.SetShuttingDown()
+	logger.WithFields(logrus.Fields{"delay": cfg.Server.DrainDelay.String()}).Info("draining traffic...")
+	time.Sleep(cfg.Server.DrainDelay)
+
 	err = server.Shutdown()
 	if err != nil {
 		logger.WithFields(logrus.Fields{"error": err}).Fatal("error shutting down the server")
 	}
+
+	logger.Info("stopping background workers...")
+	bg.Stop()
+
+	err = tracerProvider.Shutdown(context.Background())
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Error("error flushing traces")
+	}
 }
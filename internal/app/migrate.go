@@ -0,0 +1,82 @@
+package app
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	log2 "log"
+	"os"
+
+	"github.com/timohahaa/ewallet/config"
+	"github.com/timohahaa/ewallet/migrations"
+	"github.com/timohahaa/ewallet/pkg/migrator"
+	"github.com/timohahaa/postgres"
+)
+
+const migrateUsage = `usage: app migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [-n N]   revert the last N applied migrations (default 1)
+  version       print the current and the latest schema version
+`
+
+// Migrate - подкоманда migrate; args - аргументы после "migrate"
+func Migrate(configFilePath string, args []string) {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.NewConfig(configFilePath)
+	if err != nil {
+		log2.Fatalf("config error: %s", err)
+	}
+
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxConnPoolSize(cfg.PG.ConnPoolSize))
+	if err != nil {
+		log2.Fatalf("error connecting to postgres: %s", err)
+	}
+	defer pg.ConnPool.Close()
+
+	migr, err := migrator.New(pg.ConnPool, migrations.FS)
+	if err != nil {
+		log2.Fatalf("error loading migrations: %s", err)
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		applied, err := migr.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log2.Fatalf("migrate up: %s", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ExitOnError)
+		steps := fs.Int("n", 1, "number of migrations to revert")
+		_ = fs.Parse(args[1:])
+
+		reverted, err := migr.Down(ctx, *steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log2.Fatalf("migrate down: %s", err)
+		}
+	case "version":
+		version, err := migr.Version(ctx)
+		if err != nil {
+			log2.Fatalf("migrate version: %s", err)
+		}
+		fmt.Printf("current: %d\nlatest: %d\n", version, migr.Latest())
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/config"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/service"
+)
+
+// политики сервисов из конфига - общие для приложения и ewalletctl, чтобы переводы оператора
+// проходили по тем же правилам, что и через API
+
+func PocketPolicy(cfg *config.Config) service.PocketPolicy {
+	return service.PocketPolicy{
+		MaxPerWallet:              cfg.Pockets.MaxPerWallet,
+		RestrictExternalTransfers: cfg.Pockets.RestrictExternalTransfers,
+	}
+}
+
+func TransferDetailsPolicy(cfg *config.Config) service.TransferDetailsPolicy {
+	return service.TransferDetailsPolicy{
+		MetadataKeys:    cfg.Transfers.MetadataKeys,
+		MaxMetadataSize: cfg.Transfers.MaxMetadataSize,
+	}
+}
+
+func FraudPolicy(cfg *config.Config) service.FraudPolicy {
+	policy := service.FraudPolicy{ReviewScore: cfg.Fraud.ReviewScore, BlockScore: cfg.Fraud.BlockScore}
+	for _, r := range cfg.Fraud.Rules {
+		policy.Rules = append(policy.Rules, service.FraudRule{
+			Name:       r.Name,
+			Type:       r.Type,
+			Score:      r.Score,
+			Count:      r.Count,
+			Window:     r.Window,
+			MinAmount:  r.MinAmount,
+			Factor:     r.Factor,
+			MinHistory: r.MinHistory,
+		})
+	}
+	return policy
+}
+
+// NewWalletService - WalletService с политиками из cfg; m и fraud могут быть nil
+func NewWalletService(cfg *config.Config, wr repository.WalletRepo, log *logrus.Logger, m *metrics.Metrics, fraud *service.FraudScreen) service.WalletService {
+	return service.NewWalletService(wr, log, m, TransferDetailsPolicy(cfg), PocketPolicy(cfg), fraud)
+}
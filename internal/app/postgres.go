@@ -0,0 +1,45 @@
+package app
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/config"
+	"github.com/timohahaa/ewallet/internal/health"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/migrations"
+	"github.com/timohahaa/ewallet/pkg/migrator"
+	"github.com/timohahaa/postgres"
+)
+
+// подключение к postgres, миграции, метрики пула и readiness-проверки базы
+func initPostgres(cfg *config.Config, logger *logrus.Logger, m *metrics.Metrics, checker *health.Checker) *postgres.Postgres {
+	// database
+	logger.Info("initializing postgres connection...")
+	pg, err := postgres.New(cfg.PG.URL, postgres.MaxConnPoolSize(cfg.PG.ConnPoolSize))
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Fatal("error connecting to postgres")
+	}
+
+	// миграции
+	migr, err := migrator.New(pg.ConnPool, migrations.FS)
+	if err != nil {
+		logger.WithFields(logrus.Fields{"error": err}).Fatal("error loading migrations")
+	}
+	if cfg.PG.AutoMigrate {
+		logger.Info("applying migrations...")
+		applied, err := migr.Up(context.Background())
+		if err != nil {
+			logger.WithFields(logrus.Fields{"error": err}).Fatal("error applying migrations")
+		}
+		logger.WithFields(logrus.Fields{"applied": len(applied), "version": migr.Latest()}).Info("migrations applied")
+	}
+
+	m.Register(metrics.NewPoolCollector(pg.ConnPool))
+
+	checker.Add("postgres", health.PostgresPing(pg.ConnPool))
+	checker.Add("postgres_pool", health.PoolSaturation(pg.ConnPool))
+	checker.Add("migrations", health.MigrationsVersion(migr.Version, migr.Latest()))
+
+	return pg
+}
@@ -0,0 +1,57 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// фоновые воркеры приложения - периодически вызывают свою функцию, пока не отменен контекст
+type workers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	log    *logrus.Logger
+}
+
+func newWorkers(logger *logrus.Logger) *workers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workers{
+		ctx:    ctx,
+		cancel: cancel,
+		log:    logger,
+	}
+}
+
+// запуск воркера: fn вызывается раз в interval, очередной проход начинается только после завершения предыдущего
+func (w *workers) Go(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		logger := w.log.WithFields(logrus.Fields{"worker": name})
+		logger.WithFields(logrus.Fields{"interval": interval.String()}).Info("worker started")
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-w.ctx.Done():
+				logger.Info("worker stopped")
+				return
+			case <-ticker.C:
+				if err := fn(w.ctx); err != nil && w.ctx.Err() == nil {
+					logger.WithFields(logrus.Fields{"error": err}).Error("worker iteration failed")
+				}
+			}
+		}
+	}()
+}
+
+// остановка всех воркеров - ждет завершения текущих проходов
+func (w *workers) Stop() {
+	w.cancel()
+	w.wg.Wait()
+}
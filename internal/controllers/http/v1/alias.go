@@ -0,0 +1,145 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type aliasRoutes struct {
+	aliasService service.AliasService
+	log          *logrus.Logger
+}
+
+func newAliasRoutes(g *echo.Group, as service.AliasService, logger *logrus.Logger) {
+	r := &aliasRoutes{
+		aliasService: as,
+		log:          logger,
+	}
+
+	g.GET("/wallet/:walletId/aliases", r.List)
+	g.PUT("/wallet/:walletId/aliases/:kind", r.Set)
+	g.DELETE("/wallet/:walletId/aliases/:kind", r.Remove)
+	g.GET("/aliases/lookup", r.Lookup)
+}
+
+type aliasInput struct {
+	Value string `json:"value"`
+}
+
+// GET /api/v1/wallet/{walletId}/aliases?history=true
+func (r *aliasRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var withRemoved bool
+	if v := c.QueryParam("history"); v != "" {
+		withRemoved, err = strconv.ParseBool(v)
+		if err != nil {
+			newValidationErrorMessage(c, []service.FieldError{{Field: "history", Message: "must be true or false"}})
+			return nil
+		}
+	}
+
+	aliases, err := r.aliasService.ListAliases(c.Request().Context(), walletId, withRemoved)
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("aliasRoutes.List - aliasService.ListAliases")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, aliases)
+}
+
+// PUT /api/v1/wallet/{walletId}/aliases/{kind}
+func (r *aliasRoutes) Set(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var input aliasInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+
+	alias, err := r.aliasService.SetAlias(c.Request().Context(), walletId, c.Param("kind"), input.Value)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrAliasTaken) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("aliasRoutes.Set - aliasService.SetAlias")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, alias)
+}
+
+// DELETE /api/v1/wallet/{walletId}/aliases/{kind}
+func (r *aliasRoutes) Remove(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	err = r.aliasService.RemoveAlias(c.Request().Context(), walletId, c.Param("kind"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrAliasNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("aliasRoutes.Remove - aliasService.RemoveAlias")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GET /api/v1/aliases/lookup?alias=@ivan
+func (r *aliasRoutes) Lookup(c echo.Context) error {
+	lookup, err := r.aliasService.LookupAlias(c.Request().Context(), c.QueryParam("alias"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrAliasNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("aliasRoutes.Lookup - aliasService.LookupAlias")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, lookup)
+}
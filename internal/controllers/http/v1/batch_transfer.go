@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	// лимит тела для пакетного перевода - строк в пакете может быть тысячи, кол-во строк ограничивает сервис
+	maxBatchRequestBodySize = 1 << 20
+)
+
+type batchTransferRoutes struct {
+	batchTransferService service.BatchTransferService
+	log                  *logrus.Logger
+}
+
+func newBatchTransferRoutes(g *echo.Group, bts service.BatchTransferService, logger *logrus.Logger) {
+	r := &batchTransferRoutes{
+		batchTransferService: bts,
+		log:                  logger,
+	}
+
+	g.POST("/wallet/:walletId/batch-transfers", r.Create)
+	g.GET("/wallet/:walletId/batch-transfers/:batchId", r.Get).Name = "batchTransferStatus"
+}
+
+type batchTransferInput struct {
+	Mode  string          `json:"mode"`
+	Lines []transferInput `json:"lines"`
+}
+
+// POST /api/v1/wallet/{walletId}/batch-transfers
+func (r *batchTransferRoutes) Create(c echo.Context) error {
+	fromWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, fromWalletId)
+
+	var input batchTransferInput
+	if err := bindJSONLimit(c, &input, maxBatchRequestBodySize); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+
+	var fieldErrs []service.FieldError
+	lines := make([]entity.BatchTransferLine, 0, len(input.Lines))
+	for i, in := range input.Lines {
+		to, amount, errs := in.validate()
+		for _, f := range errs {
+			fieldErrs = append(fieldErrs, service.FieldError{Field: fmt.Sprintf("lines[%d].%s", i, f.Field), Message: f.Message})
+		}
+		lines = append(lines, entity.BatchTransferLine{To: to, Amount: amount})
+	}
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	bt, err := r.batchTransferService.CreateBatchTransfer(c.Request().Context(), fromWalletId, input.Mode, lines)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrPocketTransferNotAllowed) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("batchTransferRoutes.Create - batchTransferService.CreateBatchTransfer")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	// большой пакет принят к асинхронному исполнению - статус по ссылке из Location
+	if bt.Status == entity.BatchTransferPending {
+		c.Response().Header().Set(echo.HeaderLocation, c.Echo().Reverse("batchTransferStatus", fromWalletId, bt.Id))
+		return c.JSON(http.StatusAccepted, bt)
+	}
+	return c.JSON(http.StatusOK, bt)
+}
+
+// GET /api/v1/wallet/{walletId}/batch-transfers/{batchId}
+func (r *batchTransferRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	batchId, err := pathUUID(c, "batchId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	bt, err := r.batchTransferService.GetBatchTransfer(c.Request().Context(), walletId, batchId)
+	if errors.Is(err, service.ErrBatchTransferNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("batchTransferRoutes.Get - batchTransferService.GetBatchTransfer")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, bt)
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/timohahaa/ewallet/internal/service"
+)
+
+const (
+	// максимальный размер тела запроса в байтах
+	maxRequestBodySize = 4 << 10
+)
+
+var (
+	ErrRequestBodyTooLarge = errors.New("request body too large")
+	ErrInvalidRequestBody  = errors.New("invalid request body")
+)
+
+// строгий биндинг json-тела запроса: ограничение на размер, запрет неизвестных полей и мусора после объекта
+func bindJSON(c echo.Context, dst any) error {
+	return bindJSONLimit(c, dst, maxRequestBodySize)
+}
+
+// то же, что bindJSON, но со своим лимитом на размер тела - для заведомо больших запросов (пакетные переводы)
+func bindJSONLimit(c echo.Context, dst any, limit int64) error {
+	req := c.Request()
+	if !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON) {
+		return ErrInvalidRequestBody
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(c.Response(), req.Body, limit))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+
+	err := dec.Decode(dst)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ErrRequestBodyTooLarge
+	}
+	if err != nil {
+		// неизвестное поле - сообщаем, какое именно
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return &service.ValidationError{Fields: []service.FieldError{{Field: strings.Trim(field, `"`), Message: "unknown field"}}}
+		}
+		return ErrInvalidRequestBody
+	}
+
+	// после объекта в теле ничего быть не должно
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		if errors.As(err, &maxBytesErr) {
+			return ErrRequestBodyTooLarge
+		}
+		return ErrInvalidRequestBody
+	}
+
+	return nil
+}
+
+// ответ на ошибку биндинга
+func newBindErrorMessage(c echo.Context, err error) {
+	if errors.Is(err, ErrRequestBodyTooLarge) {
+		newErrorMessage(c, http.StatusRequestEntityTooLarge, ErrRequestBodyTooLarge.Error())
+		return
+	}
+
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return
+	}
+
+	newErrorMessage(c, http.StatusBadRequest, ErrInvalidRequestBody.Error())
+}
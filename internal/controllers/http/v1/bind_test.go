@@ -0,0 +1,122 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/timohahaa/ewallet/internal/service"
+)
+
+// тело ответа с ошибкой; errors - только у ошибок валидации
+type errorBody struct {
+	Message string               `json:"message"`
+	Errors  []service.FieldError `json:"errors"`
+}
+
+func bindRequest(t *testing.T, contentType, body string, dst any) (*httptest.ResponseRecorder, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	err := bindJSON(c, dst)
+	if err != nil {
+		newBindErrorMessage(c, err)
+	}
+	return rec, err
+}
+
+func TestBindJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantFields  []string
+	}{
+		{"valid", echo.MIMEApplicationJSON, `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 25}`, http.StatusOK, nil},
+		{"charset in content type", echo.MIMEApplicationJSONCharsetUTF8, `{"amount": 1}`, http.StatusOK, nil},
+		{"unknown field", echo.MIMEApplicationJSON, `{"to": "x", "amount": 1, "currency": "RUB"}`, http.StatusBadRequest, []string{"currency"}},
+		{"malformed json", echo.MIMEApplicationJSON, `{"to": "x",`, http.StatusBadRequest, nil},
+		{"wrong type", echo.MIMEApplicationJSON, `{"to": 42}`, http.StatusBadRequest, nil},
+		{"trailing data", echo.MIMEApplicationJSON, `{"amount": 1} {"amount": 2}`, http.StatusBadRequest, nil},
+		{"empty body", echo.MIMEApplicationJSON, ``, http.StatusBadRequest, nil},
+		{"not json", echo.MIMETextPlain, `{"amount": 1}`, http.StatusBadRequest, nil},
+		{"oversized body", echo.MIMEApplicationJSON, `{"memo": "` + strings.Repeat("a", maxRequestBodySize) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input sendInput
+			rec, err := bindRequest(t, tt.contentType, tt.body, &input)
+			if tt.wantStatus == http.StatusOK {
+				if err != nil {
+					t.Fatalf("bindJSON: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("bindJSON: got nil error")
+			}
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var body errorBody
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body.Message == "" {
+				t.Error("response has no message")
+			}
+			if len(body.Errors) != len(tt.wantFields) {
+				t.Fatalf("fields = %+v, want %v", body.Errors, tt.wantFields)
+			}
+			for i, f := range body.Errors {
+				if f.Field != tt.wantFields[i] {
+					t.Errorf("fields[%d] = %q, want %q", i, f.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTransferInputValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+	}{
+		{"valid", `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 25.125}`, nil},
+		{"missing fields", `{}`, []string{"to", "amount"}},
+		{"invalid uuid", `{"to": "wallet-1", "amount": 1}`, []string{"to"}},
+		{"beyond minor unit", `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 1.0001}`, []string{"amount"}},
+		{"tiny exponent", `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 1e-5}`, []string{"amount"}},
+		{"not exact in float32", `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 1234567.891}`, []string{"amount"}},
+		{"exact in float32", `{"to": "05bb88df-eef6-4b6e-b024-a3d9d7448e6c", "amount": 1234567.5}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input sendInput
+			if _, err := bindRequest(t, echo.MIMEApplicationJSON, tt.body, &input); err != nil {
+				t.Fatalf("bindJSON: %v", err)
+			}
+
+			_, _, fields := input.validate()
+			if len(fields) != len(tt.wantFields) {
+				t.Fatalf("validate: got fields %+v, want %v", fields, tt.wantFields)
+			}
+			for i, f := range fields {
+				if f.Field != tt.wantFields[i] {
+					t.Errorf("fields[%d] = %q, want %q", i, f.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type creditRoutes struct {
+	creditService service.CreditService
+	log           *logrus.Logger
+}
+
+// лимит и условия задаются через ewalletctl, в API - только просмотр
+func newCreditRoutes(g *echo.Group, cs service.CreditService, logger *logrus.Logger) {
+	r := &creditRoutes{
+		creditService: cs,
+		log:           logger,
+	}
+
+	g.GET("/wallet/:walletId/credit", r.Get)
+	g.GET("/wallet/:walletId/credit/accruals", r.ListAccruals)
+	g.GET("/wallet/:walletId/credit/charges", r.ListCharges)
+	g.GET("/wallet/:walletId/credit/alerts", r.ListAlerts)
+}
+
+// GET /api/v1/wallet/{walletId}/credit
+func (r *creditRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	line, err := r.creditService.GetLine(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrCreditLineNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("creditRoutes.Get - creditService.GetLine")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, line)
+}
+
+// GET /api/v1/wallet/{walletId}/credit/accruals?from=2024-01-01&to=2024-01-31
+func (r *creditRoutes) ListAccruals(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	filter, fieldErrs := accrualFilter(c)
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	accruals, err := r.creditService.ListAccruals(c.Request().Context(), walletId, filter)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrCreditLineNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("creditRoutes.ListAccruals - creditService.ListAccruals")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, accruals)
+}
+
+// GET /api/v1/wallet/{walletId}/credit/charges
+func (r *creditRoutes) ListCharges(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	charges, err := r.creditService.ListCharges(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrCreditLineNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("creditRoutes.ListCharges - creditService.ListCharges")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, charges)
+}
+
+// GET /api/v1/wallet/{walletId}/credit/alerts
+func (r *creditRoutes) ListAlerts(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	alerts, err := r.creditService.ListAlerts(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrCreditLineNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("creditRoutes.ListAlerts - creditService.ListAlerts")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, alerts)
+}
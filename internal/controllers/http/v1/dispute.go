@@ -0,0 +1,314 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type disputeRoutes struct {
+	disputeService service.DisputeService
+	log            *logrus.Logger
+}
+
+func newDisputeRoutes(g *echo.Group, ds service.DisputeService, logger *logrus.Logger) {
+	r := &disputeRoutes{
+		disputeService: ds,
+		log:            logger,
+	}
+
+	// walletId - отправитель или получатель перевода
+	g.GET("/wallet/:walletId/disputes", r.List)
+	g.GET("/wallet/:walletId/disputes/:disputeId", r.Get)
+
+	// споры открывает и решает поддержка - так же, как через ewalletctl; оператор для аудита - из заголовка X-Operator
+	admin := g.Group("/admin/disputes")
+	admin.POST("", r.Open)
+	admin.GET("", r.AdminList)
+	admin.GET("/:disputeId", r.AdminGet)
+	admin.POST("/:disputeId/evidence", r.AddEvidence)
+	admin.POST("/:disputeId/resolve", r.Resolve)
+}
+
+const operatorHeader = "X-Operator"
+
+type disputeEvidenceInput struct {
+	Name string `json:"name"`
+	Url  string `json:"url"`
+	Note string `json:"note"`
+}
+
+type disputeInput struct {
+	TransactionId *int64                 `json:"transactionId"`
+	Amount        *json.Number           `json:"amount"`
+	Reason        string                 `json:"reason"`
+	Deadline      *time.Time             `json:"deadline"`
+	Evidence      []disputeEvidenceInput `json:"evidence"`
+}
+
+// синтаксическая валидация тела запроса, доменные правила проверяются в сервисе
+func (in disputeInput) validate() (entity.Dispute, []service.FieldError) {
+	var fields []service.FieldError
+	d := entity.Dispute{Reason: in.Reason, Evidence: evidenceOf(in.Evidence)}
+
+	if in.TransactionId == nil {
+		fields = append(fields, service.FieldError{Field: "transactionId", Message: "is required"})
+	} else {
+		d.TransactionId = *in.TransactionId
+	}
+
+	// без суммы оспаривается весь перевод
+	if in.Amount != nil {
+		if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+			fields = append(fields, *fieldErr)
+		} else {
+			d.Amount = a
+		}
+	}
+
+	if in.Deadline != nil {
+		d.Deadline = *in.Deadline
+	}
+
+	return d, fields
+}
+
+func evidenceOf(in []disputeEvidenceInput) []entity.DisputeEvidence {
+	evidence := make([]entity.DisputeEvidence, 0, len(in))
+	for _, e := range in {
+		evidence = append(evidence, entity.DisputeEvidence{Name: e.Name, Url: e.Url, Note: e.Note})
+	}
+	return evidence
+}
+
+// POST /api/v1/admin/disputes
+func (r *disputeRoutes) Open(c echo.Context) error {
+	var input disputeInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	d, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	d, err := r.disputeService.OpenDispute(c.Request().Context(), c.Request().Header.Get(operatorHeader), d)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrTransactionNotFound) || errors.Is(err, service.ErrWalletNotFound) {
+		newErrorMessage(c, http.StatusNotFound, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrTransactionNotDisputable) || errors.Is(err, service.ErrDisputeHoldNotCovered) {
+		newErrorMessage(c, http.StatusBadRequest, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrDisputeExists) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.Open - disputeService.OpenDispute")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, d)
+}
+
+// GET /api/v1/admin/disputes?status=open&walletId=...
+func (r *disputeRoutes) AdminList(c echo.Context) error {
+	filter := entity.DisputeFilter{Status: c.QueryParam("status")}
+	if v := c.QueryParam("walletId"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			newValidationErrorMessage(c, []service.FieldError{{Field: "walletId", Message: "must be a valid uuid"}})
+			return nil
+		}
+		filter.WalletId = &id
+	}
+
+	disputes, err := r.disputeService.ListDisputes(c.Request().Context(), filter)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.AdminList - disputeService.ListDisputes")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+	if disputes == nil {
+		disputes = []entity.Dispute{}
+	}
+
+	return c.JSON(http.StatusOK, disputes)
+}
+
+// GET /api/v1/admin/disputes/{disputeId}
+func (r *disputeRoutes) AdminGet(c echo.Context) error {
+	disputeId, err := pathUUID(c, "disputeId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	dispute, err := r.disputeService.GetDispute(c.Request().Context(), disputeId)
+	if errors.Is(err, service.ErrDisputeNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.AdminGet - disputeService.GetDispute")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, dispute)
+}
+
+// POST /api/v1/admin/disputes/{disputeId}/evidence
+func (r *disputeRoutes) AddEvidence(c echo.Context) error {
+	disputeId, err := pathUUID(c, "disputeId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	var input struct {
+		Evidence []disputeEvidenceInput `json:"evidence"`
+	}
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+
+	dispute, err := r.disputeService.AddEvidence(c.Request().Context(), c.Request().Header.Get(operatorHeader), disputeId, evidenceOf(input.Evidence))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrDisputeNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrDisputeNotOpen) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.AddEvidence - disputeService.AddEvidence")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, dispute)
+}
+
+// POST /api/v1/admin/disputes/{disputeId}/resolve
+func (r *disputeRoutes) Resolve(c echo.Context) error {
+	disputeId, err := pathUUID(c, "disputeId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	var input struct {
+		Favor string `json:"favor"`
+		Note  string `json:"note"`
+	}
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+
+	dispute, err := r.disputeService.ResolveDispute(c.Request().Context(), c.Request().Header.Get(operatorHeader), disputeId, input.Favor, input.Note)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrDisputeNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrDisputeNotOpen) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	// вернуть или снять удержание нельзя, пока кошелек заморожен - спор остается открытым
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.Resolve - disputeService.ResolveDispute")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, dispute)
+}
+
+// GET /api/v1/wallet/{walletId}/disputes?status=open
+func (r *disputeRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	disputes, err := r.disputeService.ListWalletDisputes(c.Request().Context(), walletId, c.QueryParam("status"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.List - disputeService.ListWalletDisputes")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, disputes)
+}
+
+// GET /api/v1/wallet/{walletId}/disputes/{disputeId}
+func (r *disputeRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	disputeId, err := pathUUID(c, "disputeId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	dispute, err := r.disputeService.GetWalletDispute(c.Request().Context(), walletId, disputeId)
+	if errors.Is(err, service.ErrDisputeNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("disputeRoutes.Get - disputeService.GetWalletDispute")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, dispute)
+}
@@ -2,8 +2,10 @@ package v1
 
 import (
 	"errors"
+	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"github.com/timohahaa/ewallet/internal/service"
 )
 
 var (
@@ -16,3 +18,14 @@ func newErrorMessage(c echo.Context, statusCode int, message string) {
 	httpErr := echo.NewHTTPError(statusCode, message)
 	_ = c.JSON(statusCode, httpErr)
 }
+
+// ответ с ошибками валидации по конкретным полям
+func newValidationErrorMessage(c echo.Context, fields []service.FieldError) {
+	_ = c.JSON(http.StatusBadRequest, struct {
+		Message string               `json:"message"`
+		Errors  []service.FieldError `json:"errors"`
+	}{
+		Message: service.ErrValidation.Error(),
+		Errors:  fields,
+	})
+}
@@ -0,0 +1,215 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type escrowRoutes struct {
+	escrowService service.EscrowService
+	log           *logrus.Logger
+}
+
+func newEscrowRoutes(g *echo.Group, es service.EscrowService, logger *logrus.Logger) {
+	r := &escrowRoutes{
+		escrowService: es,
+		log:           logger,
+	}
+
+	// walletId - участник сделки, от имени которого выполняется действие
+	g.POST("/wallet/:walletId/escrows", r.Create)
+	g.GET("/wallet/:walletId/escrows", r.List)
+	g.GET("/wallet/:walletId/escrows/:escrowId", r.Get)
+	g.POST("/wallet/:walletId/escrows/:escrowId/release", r.Release)
+	g.POST("/wallet/:walletId/escrows/:escrowId/cancel", r.Cancel)
+}
+
+type escrowInput struct {
+	Seller      *string      `json:"seller"`
+	Amount      *json.Number `json:"amount"`
+	Deadline    *time.Time   `json:"deadline"`
+	Description string       `json:"description"`
+}
+
+// синтаксическая валидация тела запроса, доменные правила проверяются в сервисе
+func (in escrowInput) validate() (uuid.UUID, float32, []service.FieldError) {
+	var (
+		fields []service.FieldError
+		seller uuid.UUID
+		amount float32
+	)
+
+	if in.Seller == nil {
+		fields = append(fields, service.FieldError{Field: "seller", Message: "is required"})
+	} else if id, err := uuid.Parse(*in.Seller); err != nil {
+		fields = append(fields, service.FieldError{Field: "seller", Message: "must be a valid uuid"})
+	} else {
+		seller = id
+	}
+
+	if in.Amount == nil {
+		fields = append(fields, service.FieldError{Field: "amount", Message: "is required"})
+	} else if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	} else {
+		amount = a
+	}
+
+	if in.Deadline == nil {
+		fields = append(fields, service.FieldError{Field: "deadline", Message: "is required"})
+	}
+
+	return seller, amount, fields
+}
+
+// POST /api/v1/wallet/{walletId}/escrows
+func (r *escrowRoutes) Create(c echo.Context) error {
+	buyerWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, buyerWalletId)
+
+	var input escrowInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	sellerWalletId, amount, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	escrow, err := r.escrowService.CreateEscrow(c.Request().Context(), buyerWalletId, sellerWalletId, amount, *input.Deadline, input.Description)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrTargetWalletNotFound) || errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) ||
+		errors.Is(err, service.ErrPocketTransferNotAllowed) || errors.Is(err, service.ErrTransferBlocked) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("escrowRoutes.Create - escrowService.CreateEscrow")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, escrow)
+}
+
+// GET /api/v1/wallet/{walletId}/escrows?status=funded
+func (r *escrowRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	escrows, err := r.escrowService.ListEscrows(c.Request().Context(), walletId, c.QueryParam("status"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("escrowRoutes.List - escrowService.ListEscrows")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, escrows)
+}
+
+// GET /api/v1/wallet/{walletId}/escrows/{escrowId}
+func (r *escrowRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	escrowId, err := pathUUID(c, "escrowId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	escrow, err := r.escrowService.GetEscrow(c.Request().Context(), walletId, escrowId)
+	if errors.Is(err, service.ErrEscrowNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("escrowRoutes.Get - escrowService.GetEscrow")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, escrow)
+}
+
+// POST /api/v1/wallet/{walletId}/escrows/{escrowId}/release
+func (r *escrowRoutes) Release(c echo.Context) error {
+	return r.transition(c, "escrowRoutes.Release - escrowService.ReleaseEscrow", r.escrowService.ReleaseEscrow)
+}
+
+// POST /api/v1/wallet/{walletId}/escrows/{escrowId}/cancel
+func (r *escrowRoutes) Cancel(c echo.Context) error {
+	return r.transition(c, "escrowRoutes.Cancel - escrowService.CancelEscrow", r.escrowService.CancelEscrow)
+}
+
+func (r *escrowRoutes) transition(c echo.Context, op string, fn func(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error)) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	escrowId, err := pathUUID(c, "escrowId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	escrow, err := fn(c.Request().Context(), walletId, escrowId)
+	if errors.Is(err, service.ErrEscrowNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrInvalidEscrowTransition) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrEscrowActionNotAllowed) ||
+		errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error(op)
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, escrow)
+}
@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/timohahaa/ewallet/internal/health"
+)
+
+type healthRoutes struct {
+	checker *health.Checker
+}
+
+func newHealthRoutes(e *echo.Echo, checker *health.Checker) {
+	r := &healthRoutes{
+		checker: checker,
+	}
+
+	e.GET("/livez", r.Live)
+	// оставлен для обратной совместимости, по смыслу - liveness
+	e.GET("/health", r.Live)
+	e.GET("/readyz", r.Ready)
+}
+
+// GET /livez
+// процесс жив и обслуживает запросы, от зависимостей не зависит
+func (r *healthRoutes) Live(c echo.Context) error {
+	return c.JSON(http.StatusOK, health.Report{Status: health.StatusOK, Checks: []health.CheckResult{}})
+}
+
+// GET /readyz
+func (r *healthRoutes) Ready(c echo.Context) error {
+	report := r.checker.Ready(c.Request().Context())
+	if report.Status != health.StatusOK {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,211 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type interestRoutes struct {
+	interestService service.InterestService
+	log             *logrus.Logger
+}
+
+// продукты создаются через ewalletctl, в API - только список
+func newInterestRoutes(g *echo.Group, is service.InterestService, logger *logrus.Logger) {
+	r := &interestRoutes{
+		interestService: is,
+		log:             logger,
+	}
+
+	g.GET("/interest/products", r.ListProducts)
+	g.GET("/wallet/:walletId/interest", r.Get)
+	g.PUT("/wallet/:walletId/interest", r.Open)
+	g.DELETE("/wallet/:walletId/interest", r.Close)
+	g.GET("/wallet/:walletId/interest/accruals", r.ListAccruals)
+	g.GET("/wallet/:walletId/interest/payouts", r.ListPayouts)
+}
+
+type interestAccountInput struct {
+	ProductId string `json:"productId"`
+}
+
+// GET /api/v1/interest/products
+func (r *interestRoutes) ListProducts(c echo.Context) error {
+	products, err := r.interestService.ListProducts(c.Request().Context())
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.ListProducts - interestService.ListProducts")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, products)
+}
+
+// GET /api/v1/wallet/{walletId}/interest
+func (r *interestRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	acc, err := r.interestService.GetAccount(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrInterestAccountNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.Get - interestService.GetAccount")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, acc)
+}
+
+// PUT /api/v1/wallet/{walletId}/interest
+func (r *interestRoutes) Open(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var input interestAccountInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	productId, err := uuid.Parse(input.ProductId)
+	if err != nil {
+		newValidationErrorMessage(c, []service.FieldError{{Field: "productId", Message: "must be an interest product id"}})
+		return nil
+	}
+
+	acc, err := r.interestService.OpenAccount(c.Request().Context(), walletId, productId)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrInterestProductNotFound) {
+		newValidationErrorMessage(c, []service.FieldError{{Field: "productId", Message: "interest product not found"}})
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.Open - interestService.OpenAccount")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, acc)
+}
+
+// DELETE /api/v1/wallet/{walletId}/interest
+func (r *interestRoutes) Close(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	acc, err := r.interestService.CloseAccount(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrInterestAccountNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.Close - interestService.CloseAccount")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, acc)
+}
+
+// GET /api/v1/wallet/{walletId}/interest/accruals?from=2024-01-01&to=2024-01-31
+func (r *interestRoutes) ListAccruals(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	filter, fieldErrs := accrualFilter(c)
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	accruals, err := r.interestService.ListAccruals(c.Request().Context(), walletId, filter)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrInterestAccountNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.ListAccruals - interestService.ListAccruals")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, accruals)
+}
+
+// GET /api/v1/wallet/{walletId}/interest/payouts
+func (r *interestRoutes) ListPayouts(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	payouts, err := r.interestService.ListPayouts(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrInterestAccountNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("interestRoutes.ListPayouts - interestService.ListPayouts")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, payouts)
+}
+
+// from и to из query в формате YYYY-MM-DD - для истории начислений процентов и по кредитной линии
+func accrualFilter(c echo.Context) (entity.InterestAccrualFilter, []service.FieldError) {
+	var filter entity.InterestAccrualFilter
+	var fieldErrs []service.FieldError
+	for _, q := range []struct {
+		name string
+		dst  **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		if v := c.QueryParam(q.name); v != "" {
+			t, err := time.Parse(time.DateOnly, v)
+			if err != nil {
+				fieldErrs = append(fieldErrs, service.FieldError{Field: q.name, Message: "must be a date in YYYY-MM-DD format"})
+				continue
+			}
+			*q.dst = &t
+		}
+	}
+	return filter, fieldErrs
+}
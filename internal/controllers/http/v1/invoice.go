@@ -0,0 +1,332 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type invoiceRoutes struct {
+	invoiceService service.InvoiceService
+	log            *logrus.Logger
+}
+
+func newInvoiceRoutes(g *echo.Group, is service.InvoiceService, logger *logrus.Logger) {
+	r := &invoiceRoutes{
+		invoiceService: is,
+		log:            logger,
+	}
+
+	// кабинет продавца
+	g.POST("/wallet/:walletId/invoices", r.Create)
+	g.GET("/wallet/:walletId/invoices", r.List)
+	g.GET("/wallet/:walletId/invoices/:invoiceId", r.MerchantGet)
+	g.POST("/wallet/:walletId/invoices/:invoiceId/void", r.Void)
+
+	// ссылка на оплату - доступна любому кошельку
+	g.GET("/invoices/:invoiceId", r.Get).Name = "invoicePaymentLink"
+	g.POST("/invoices/:invoiceId/pay", r.Pay)
+}
+
+type invoiceItemInput struct {
+	Description string       `json:"description"`
+	Quantity    int          `json:"quantity"`
+	UnitPrice   *json.Number `json:"unitPrice"`
+}
+
+type invoiceInput struct {
+	Amount    *json.Number       `json:"amount"`
+	Currency  string             `json:"currency"`
+	DueAt     *time.Time         `json:"dueAt"`
+	Reference string             `json:"reference"`
+	Items     []invoiceItemInput `json:"items"`
+}
+
+// синтаксическая валидация тела запроса, доменные правила проверяются в сервисе
+func (in invoiceInput) validate() (entity.Invoice, []service.FieldError) {
+	var fields []service.FieldError
+	inv := entity.Invoice{Currency: in.Currency, Reference: in.Reference}
+
+	if in.Amount != nil {
+		if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+			fields = append(fields, *fieldErr)
+		} else {
+			inv.Amount = a
+		}
+	} else if len(in.Items) == 0 {
+		fields = append(fields, service.FieldError{Field: "amount", Message: "is required without items"})
+	}
+	if in.Currency == "" {
+		fields = append(fields, service.FieldError{Field: "currency", Message: "is required"})
+	}
+	if in.DueAt == nil {
+		fields = append(fields, service.FieldError{Field: "dueAt", Message: "is required"})
+	} else {
+		inv.DueAt = *in.DueAt
+	}
+
+	for i, item := range in.Items {
+		it := entity.InvoiceItem{Description: item.Description, Quantity: item.Quantity}
+		field := fmt.Sprintf("items[%d].unitPrice", i)
+		if item.UnitPrice == nil {
+			fields = append(fields, service.FieldError{Field: field, Message: "is required"})
+		} else if p, fieldErr := parseAmount(field, *item.UnitPrice); fieldErr != nil {
+			fields = append(fields, *fieldErr)
+		} else {
+			it.UnitPrice = p
+		}
+		inv.Items = append(inv.Items, it)
+	}
+
+	return inv, fields
+}
+
+// POST /api/v1/wallet/{walletId}/invoices
+func (r *invoiceRoutes) Create(c echo.Context) error {
+	merchantWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, merchantWalletId)
+
+	var input invoiceInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	inv, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	inv, err = r.invoiceService.CreateInvoice(c.Request().Context(), merchantWalletId, inv)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrInvoiceReferenceExists) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.Create - invoiceService.CreateInvoice")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	// ссылка на оплату, которую продавец передает покупателю
+	c.Response().Header().Set(echo.HeaderLocation, c.Echo().Reverse("invoicePaymentLink", inv.Id))
+	return c.JSON(http.StatusCreated, inv)
+}
+
+// GET /api/v1/wallet/{walletId}/invoices?status=overdue&reference=order-42&dueFrom=...&dueTo=...
+func (r *invoiceRoutes) List(c echo.Context) error {
+	merchantWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, merchantWalletId)
+
+	filter := entity.InvoiceFilter{Status: c.QueryParam("status"), Reference: c.QueryParam("reference")}
+	var fieldErrs []service.FieldError
+	for _, q := range []struct {
+		name string
+		dst  **time.Time
+	}{{"dueFrom", &filter.DueFrom}, {"dueTo", &filter.DueTo}} {
+		if v := c.QueryParam(q.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fieldErrs = append(fieldErrs, service.FieldError{Field: q.name, Message: "must be an RFC 3339 timestamp"})
+				continue
+			}
+			*q.dst = &t
+		}
+	}
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	invoices, err := r.invoiceService.ListInvoices(c.Request().Context(), merchantWalletId, filter)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.List - invoiceService.ListInvoices")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, invoices)
+}
+
+// GET /api/v1/wallet/{walletId}/invoices/{invoiceId}
+func (r *invoiceRoutes) MerchantGet(c echo.Context) error {
+	merchantWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, merchantWalletId)
+	invoiceId, err := pathUUID(c, "invoiceId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	inv, err := r.invoiceService.GetMerchantInvoice(c.Request().Context(), merchantWalletId, invoiceId)
+	if errors.Is(err, service.ErrInvoiceNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.MerchantGet - invoiceService.GetMerchantInvoice")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, inv)
+}
+
+// POST /api/v1/wallet/{walletId}/invoices/{invoiceId}/void
+func (r *invoiceRoutes) Void(c echo.Context) error {
+	merchantWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, merchantWalletId)
+	invoiceId, err := pathUUID(c, "invoiceId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	inv, err := r.invoiceService.VoidInvoice(c.Request().Context(), merchantWalletId, invoiceId)
+	if errors.Is(err, service.ErrInvoiceNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrInvoiceNotVoidable) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.Void - invoiceService.VoidInvoice")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, inv)
+}
+
+// GET /api/v1/invoices/{invoiceId}
+func (r *invoiceRoutes) Get(c echo.Context) error {
+	invoiceId, err := pathUUID(c, "invoiceId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	inv, err := r.invoiceService.GetInvoice(c.Request().Context(), invoiceId)
+	if errors.Is(err, service.ErrInvoiceNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.Get - invoiceService.GetInvoice")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, inv)
+}
+
+type invoicePaymentInput struct {
+	From   *string      `json:"from"`
+	Amount *json.Number `json:"amount"`
+}
+
+// POST /api/v1/invoices/{invoiceId}/pay
+func (r *invoiceRoutes) Pay(c echo.Context) error {
+	invoiceId, err := pathUUID(c, "invoiceId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	var input invoicePaymentInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	var (
+		fieldErrs []service.FieldError
+		from      uuid.UUID
+		amount    float32
+	)
+	if input.From == nil {
+		fieldErrs = append(fieldErrs, service.FieldError{Field: "from", Message: "is required"})
+	} else if id, err := uuid.Parse(*input.From); err != nil {
+		fieldErrs = append(fieldErrs, service.FieldError{Field: "from", Message: "must be a valid uuid"})
+	} else {
+		from = id
+		withWalletId(c, from)
+	}
+	// без amount оплачивается весь остаток
+	if input.Amount != nil {
+		if a, fieldErr := parseAmount("amount", *input.Amount); fieldErr != nil {
+			fieldErrs = append(fieldErrs, *fieldErr)
+		} else {
+			amount = a
+		}
+	}
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	inv, err := r.invoiceService.PayInvoice(c.Request().Context(), invoiceId, from, amount)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrInvoiceNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrInvoiceNotPayable) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) || errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) ||
+		errors.Is(err, service.ErrPocketTransferNotAllowed) || errors.Is(err, service.ErrTransferBlocked) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("invoiceRoutes.Pay - invoiceService.PayInvoice")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, inv)
+}
@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/timohahaa/ewallet/internal/controllers/http/v1")
+
+const maxRequestIDLength = 128
+
+// request id берется из X-Request-ID (если клиент прислал валидный) или генерируется,
+// отдается в ответе и кладется в контекст вместе с роутом - дальше его подхватывают все логи запроса
+func requestIDMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if !validRequestID(requestID) {
+				requestID = uuid.NewString()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+
+			ctx := log.WithFields(req.Context(), logrus.Fields{
+				log.FieldRequestID: requestID,
+				log.FieldRoute:     routeOf(c),
+			})
+			c.SetRequest(req.WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+// не доверяем произвольным заголовкам - они попадут в логи как есть
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		isAlnum := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !isAlnum && r != '-' && r != '_' && r != '.' && r != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+// добавляет id кошелька в поля логов запроса
+func withWalletId(c echo.Context, walletId uuid.UUID) {
+	ctx := log.WithFields(c.Request().Context(), logrus.Fields{log.FieldWalletID: walletId.String()})
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+// серверный спан на запрос: trace-context берется из входящих заголовков (W3C traceparent)
+// и отдается в заголовках ответа, чтобы клиент мог найти свой трейс
+func tracingMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			propagator := otel.GetTextMapPropagator()
+			route := routeOf(c)
+
+			ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, req.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(req.Method),
+					semconv.HTTPRoute(route),
+					semconv.URLPath(req.URL.Path),
+					attribute.String("ewallet.request_id", log.RequestID(req.Context())),
+				),
+			)
+			defer span.End()
+
+			c.SetRequest(req.WithContext(ctx))
+			propagator.Inject(ctx, propagation.HeaderCarrier(c.Response().Header()))
+
+			err := next(c)
+
+			status := responseStatus(c, err)
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if err != nil {
+				span.RecordError(err)
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
+
+// гистограмма времени ответа по шаблону роута (c.Path()), а не по URI - чтобы id кошельков не попадали в лейблы
+func metricsMiddleware(m *metrics.Metrics) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			m.ObserveHTTPRequest(c.Request().Method, routeOf(c), strconv.Itoa(responseStatus(c, err)), time.Since(start))
+			return err
+		}
+	}
+}
+
+// шаблон роута (/api/v1/wallet/:walletId) - в отличие от URI не содержит id кошельков
+func routeOf(c echo.Context) string {
+	if route := c.Path(); route != "" {
+		return route
+	}
+	return "unmatched"
+}
+
+// если ответ еще не записан - его запишет HTTPErrorHandler эхо, статус берем из ошибки
+func responseStatus(c echo.Context, err error) int {
+	if err == nil || c.Response().Committed {
+		return c.Response().Status
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,213 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type paymentRequestRoutes struct {
+	paymentRequestService service.PaymentRequestService
+	log                   *logrus.Logger
+}
+
+func newPaymentRequestRoutes(g *echo.Group, prs service.PaymentRequestService, logger *logrus.Logger) {
+	r := &paymentRequestRoutes{
+		paymentRequestService: prs,
+		log:                   logger,
+	}
+
+	g.POST("/wallet/:walletId/payment-requests", r.Create)
+	g.GET("/wallet/:walletId/payment-requests", r.List)
+	g.GET("/wallet/:walletId/payment-requests/:requestId", r.Get)
+	g.POST("/wallet/:walletId/payment-requests/:requestId/accept", r.Accept)
+	g.POST("/wallet/:walletId/payment-requests/:requestId/decline", r.Decline)
+}
+
+type paymentRequestInput struct {
+	Payer     *string      `json:"payer"`
+	Amount    *json.Number `json:"amount"`
+	Memo      string       `json:"memo"`
+	ExpiresAt *time.Time   `json:"expiresAt"`
+}
+
+// синтаксическая валидация тела запроса, доменные правила проверяются в сервисе
+func (in paymentRequestInput) validate() (uuid.UUID, float32, []service.FieldError) {
+	var (
+		fields []service.FieldError
+		payer  uuid.UUID
+		amount float32
+	)
+
+	if in.Payer == nil {
+		fields = append(fields, service.FieldError{Field: "payer", Message: "is required"})
+	} else if id, err := uuid.Parse(*in.Payer); err != nil {
+		fields = append(fields, service.FieldError{Field: "payer", Message: "must be a valid uuid"})
+	} else {
+		payer = id
+	}
+
+	if in.Amount == nil {
+		fields = append(fields, service.FieldError{Field: "amount", Message: "is required"})
+	} else if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	} else {
+		amount = a
+	}
+
+	return payer, amount, fields
+}
+
+// POST /api/v1/wallet/{walletId}/payment-requests
+func (r *paymentRequestRoutes) Create(c echo.Context) error {
+	requesterWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, requesterWalletId)
+
+	var input paymentRequestInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	payerWalletId, amount, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+	var expiresAt time.Time
+	if input.ExpiresAt != nil {
+		expiresAt = *input.ExpiresAt
+	}
+
+	req, err := r.paymentRequestService.CreatePaymentRequest(c.Request().Context(), requesterWalletId, payerWalletId, amount, input.Memo, expiresAt)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrTargetWalletNotFound) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("paymentRequestRoutes.Create - paymentRequestService.CreatePaymentRequest")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, req)
+}
+
+// GET /api/v1/wallet/{walletId}/payment-requests?direction=incoming&status=pending
+func (r *paymentRequestRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	requests, err := r.paymentRequestService.ListPaymentRequests(c.Request().Context(), walletId, c.QueryParam("direction"), c.QueryParam("status"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("paymentRequestRoutes.List - paymentRequestService.ListPaymentRequests")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, requests)
+}
+
+// GET /api/v1/wallet/{walletId}/payment-requests/{requestId}
+func (r *paymentRequestRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	requestId, err := pathUUID(c, "requestId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	req, err := r.paymentRequestService.GetPaymentRequest(c.Request().Context(), walletId, requestId)
+	if errors.Is(err, service.ErrPaymentRequestNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("paymentRequestRoutes.Get - paymentRequestService.GetPaymentRequest")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, req)
+}
+
+// POST /api/v1/wallet/{walletId}/payment-requests/{requestId}/accept
+func (r *paymentRequestRoutes) Accept(c echo.Context) error {
+	return r.resolve(c, "paymentRequestRoutes.Accept - paymentRequestService.AcceptPaymentRequest", r.paymentRequestService.AcceptPaymentRequest)
+}
+
+// POST /api/v1/wallet/{walletId}/payment-requests/{requestId}/decline
+func (r *paymentRequestRoutes) Decline(c echo.Context) error {
+	return r.resolve(c, "paymentRequestRoutes.Decline - paymentRequestService.DeclinePaymentRequest", r.paymentRequestService.DeclinePaymentRequest)
+}
+
+func (r *paymentRequestRoutes) resolve(c echo.Context, op string, fn func(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error)) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	requestId, err := pathUUID(c, "requestId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	req, err := fn(c.Request().Context(), walletId, requestId)
+	if errors.Is(err, service.ErrPaymentRequestNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrPaymentRequestNotPending) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrPaymentRequestActionNotAllowed) ||
+		errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) ||
+		errors.Is(err, service.ErrPocketTransferNotAllowed) || errors.Is(err, service.ErrTransferBlocked) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error(op)
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, req)
+}
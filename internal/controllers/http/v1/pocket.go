@@ -0,0 +1,257 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type pocketRoutes struct {
+	pocketService service.PocketService
+	log           *logrus.Logger
+}
+
+func newPocketRoutes(g *echo.Group, ps service.PocketService, logger *logrus.Logger) {
+	r := &pocketRoutes{
+		pocketService: ps,
+		log:           logger,
+	}
+
+	g.POST("/wallet/:walletId/pockets", r.Create)
+	g.GET("/wallet/:walletId/pockets", r.List)
+	g.POST("/wallet/:walletId/pockets/:pocketId/deposit", r.Deposit)
+	g.POST("/wallet/:walletId/pockets/:pocketId/withdraw", r.Withdraw)
+	g.POST("/wallet/:walletId/pockets/:pocketId/close", r.Close)
+	g.PUT("/wallet/:walletId/round-up", r.SetRoundUp)
+	g.DELETE("/wallet/:walletId/round-up", r.DisableRoundUp)
+}
+
+type pocketMoveInput struct {
+	Amount *json.Number `json:"amount"`
+}
+
+type roundUpInput struct {
+	PocketId string `json:"pocketId"`
+}
+
+// POST /api/v1/wallet/{walletId}/pockets
+func (r *pocketRoutes) Create(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var input walletInfoInput
+	if c.Request().ContentLength != 0 {
+		if err := bindJSON(c, &input); err != nil {
+			newBindErrorMessage(c, err)
+			return err
+		}
+	}
+
+	pocket, err := r.pocketService.CreatePocket(c.Request().Context(), walletId, entity.WalletInfo(input))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrNestedPocket) || errors.Is(err, service.ErrTooManyPockets) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("pocketRoutes.Create - pocketService.CreatePocket")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, pocket)
+}
+
+// GET /api/v1/wallet/{walletId}/pockets
+func (r *pocketRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	pockets, err := r.pocketService.ListPockets(c.Request().Context(), walletId)
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("pocketRoutes.List - pocketService.ListPockets")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, pockets)
+}
+
+// POST /api/v1/wallet/{walletId}/pockets/{pocketId}/deposit
+func (r *pocketRoutes) Deposit(c echo.Context) error {
+	return r.move(c, r.pocketService.Deposit)
+}
+
+// POST /api/v1/wallet/{walletId}/pockets/{pocketId}/withdraw
+func (r *pocketRoutes) Withdraw(c echo.Context) error {
+	return r.move(c, r.pocketService.Withdraw)
+}
+
+func (r *pocketRoutes) move(c echo.Context, move func(ctx context.Context, parentId, pocketId uuid.UUID, amount float32) (entity.Wallet, error)) error {
+	walletId, pocketId, ok := r.pocketPath(c)
+	if !ok {
+		return nil
+	}
+
+	var input pocketMoveInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	if input.Amount == nil {
+		newValidationErrorMessage(c, []service.FieldError{{Field: "amount", Message: "is required"}})
+		return nil
+	}
+	amount, fieldErr := parseAmount("amount", *input.Amount)
+	if fieldErr != nil {
+		newValidationErrorMessage(c, []service.FieldError{*fieldErr})
+		return nil
+	}
+
+	pocket, err := move(c.Request().Context(), walletId, pocketId, amount)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrPocketNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrPocketClosed) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("pocketRoutes.move - pocketService")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, pocket)
+}
+
+// POST /api/v1/wallet/{walletId}/pockets/{pocketId}/close
+func (r *pocketRoutes) Close(c echo.Context) error {
+	walletId, pocketId, ok := r.pocketPath(c)
+	if !ok {
+		return nil
+	}
+
+	pocket, err := r.pocketService.ClosePocket(c.Request().Context(), walletId, pocketId)
+	if errors.Is(err, service.ErrPocketNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("pocketRoutes.Close - pocketService.ClosePocket")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, pocket)
+}
+
+// PUT /api/v1/wallet/{walletId}/round-up
+func (r *pocketRoutes) SetRoundUp(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var input roundUpInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	pocketId, err := uuid.Parse(input.PocketId)
+	if err != nil {
+		newValidationErrorMessage(c, []service.FieldError{{Field: "pocketId", Message: "must be a pocket id"}})
+		return nil
+	}
+
+	return r.roundUp(c, walletId, &pocketId)
+}
+
+// DELETE /api/v1/wallet/{walletId}/round-up
+func (r *pocketRoutes) DisableRoundUp(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	return r.roundUp(c, walletId, nil)
+}
+
+func (r *pocketRoutes) roundUp(c echo.Context, walletId uuid.UUID, pocketId *uuid.UUID) error {
+	wallet, err := r.pocketService.SetRoundUp(c.Request().Context(), walletId, pocketId)
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrPocketNotFound) {
+		newValidationErrorMessage(c, []service.FieldError{{Field: "pocketId", Message: "must be an open pocket of the wallet"}})
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("pocketRoutes.roundUp - pocketService.SetRoundUp")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, wallet)
+}
+
+// id кошелька и кармана из пути; false - ответ с ошибкой уже отправлен
+func (r *pocketRoutes) pocketPath(c echo.Context) (uuid.UUID, uuid.UUID, bool) {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return uuid.Nil, uuid.Nil, false
+	}
+	withWalletId(c, walletId)
+	pocketId, err := pathUUID(c, "pocketId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return uuid.Nil, uuid.Nil, false
+	}
+	return walletId, pocketId, true
+}
@@ -1,16 +1,20 @@
 package v1
 
 import (
-	"net/http"
-
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/health"
+	"github.com/timohahaa/ewallet/internal/metrics"
 	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
 )
 
-func NewRouter(walletService service.WalletService, logger *logrus.Logger) *echo.Echo {
+func NewRouter(services service.Services, logger *logrus.Logger, m *metrics.Metrics, checker *health.Checker) *echo.Echo {
 	e := echo.New()
+	e.Use(requestIDMiddleware())
+	e.Use(tracingMiddleware())
+	e.Use(metricsMiddleware(m))
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogMethod:   true,
 		LogStatus:   true,
@@ -18,7 +22,7 @@ func NewRouter(walletService service.WalletService, logger *logrus.Logger) *echo
 		LogError:    true,
 		LogRemoteIP: true,
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
-			logger.WithFields(logrus.Fields{
+			log.FromContext(c.Request().Context(), logger).WithFields(logrus.Fields{
 				"method": v.Method,
 				"URI":    v.URI,
 				"status": v.Status,
@@ -29,13 +33,46 @@ func NewRouter(walletService service.WalletService, logger *logrus.Logger) *echo
 			return nil
 		},
 	}))
-	e.GET("/health", func(c echo.Context) error {
-		return c.NoContent(http.StatusOK)
-	})
+	newHealthRoutes(e, checker)
+	e.GET("/metrics", echo.WrapHandler(m.Handler()))
 
 	v1 := e.Group("/api/v1")
 	{
-		newWalletRoutes(v1, walletService)
+		newWalletRoutes(v1, services.Wallet, services.Alias, logger)
+		newPocketRoutes(v1, services.Pocket, logger)
+		if services.ScheduledTransfer != nil {
+			newScheduledTransferRoutes(v1, services.ScheduledTransfer, logger)
+		}
+		if services.StandingOrder != nil {
+			newStandingOrderRoutes(v1, services.StandingOrder, logger)
+		}
+		if services.BatchTransfer != nil {
+			newBatchTransferRoutes(v1, services.BatchTransfer, logger)
+		}
+		if services.Escrow != nil {
+			newEscrowRoutes(v1, services.Escrow, logger)
+		}
+		if services.PaymentRequest != nil {
+			newPaymentRequestRoutes(v1, services.PaymentRequest, logger)
+		}
+		if services.Invoice != nil {
+			newInvoiceRoutes(v1, services.Invoice, logger)
+		}
+		if services.Alias != nil {
+			newAliasRoutes(v1, services.Alias, logger)
+		}
+		if services.SavingsGoal != nil {
+			newSavingsGoalRoutes(v1, services.SavingsGoal, logger)
+		}
+		if services.Interest != nil {
+			newInterestRoutes(v1, services.Interest, logger)
+		}
+		if services.Credit != nil {
+			newCreditRoutes(v1, services.Credit, logger)
+		}
+		if services.Dispute != nil {
+			newDisputeRoutes(v1, services.Dispute, logger)
+		}
 	}
 
 	return e
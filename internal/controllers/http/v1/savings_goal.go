@@ -0,0 +1,179 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type savingsGoalRoutes struct {
+	savingsGoalService service.SavingsGoalService
+	log                *logrus.Logger
+}
+
+func newSavingsGoalRoutes(g *echo.Group, gs service.SavingsGoalService, logger *logrus.Logger) {
+	r := &savingsGoalRoutes{
+		savingsGoalService: gs,
+		log:                logger,
+	}
+
+	g.GET("/wallet/:walletId/goals", r.List)
+	g.PUT("/wallet/:walletId/pockets/:pocketId/goal", r.Set)
+	g.GET("/wallet/:walletId/pockets/:pocketId/goal", r.Get)
+	g.DELETE("/wallet/:walletId/pockets/:pocketId/goal", r.Delete)
+}
+
+type savingsGoalInput struct {
+	TargetAmount *json.Number `json:"targetAmount"`
+	// YYYY-MM-DD
+	TargetDate string `json:"targetDate"`
+}
+
+func (in savingsGoalInput) validate() (float32, *time.Time, []service.FieldError) {
+	var (
+		fields     []service.FieldError
+		amount     float32
+		targetDate *time.Time
+	)
+
+	if in.TargetAmount == nil {
+		fields = append(fields, service.FieldError{Field: "targetAmount", Message: "is required"})
+	} else if a, fieldErr := parseAmount("targetAmount", *in.TargetAmount); fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	} else {
+		amount = a
+	}
+
+	if in.TargetDate != "" {
+		t, err := time.Parse(time.DateOnly, in.TargetDate)
+		if err != nil {
+			fields = append(fields, service.FieldError{Field: "targetDate", Message: "must be a date in YYYY-MM-DD format"})
+		} else {
+			targetDate = &t
+		}
+	}
+
+	return amount, targetDate, fields
+}
+
+// GET /api/v1/wallet/{walletId}/goals
+func (r *savingsGoalRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	goals, err := r.savingsGoalService.ListGoals(c.Request().Context(), walletId)
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("savingsGoalRoutes.List - savingsGoalService.ListGoals")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, goals)
+}
+
+// PUT /api/v1/wallet/{walletId}/pockets/{pocketId}/goal
+func (r *savingsGoalRoutes) Set(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	pocketId, err := pathUUID(c, "pocketId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	var input savingsGoalInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	amount, targetDate, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	goal, err := r.savingsGoalService.SetGoal(c.Request().Context(), walletId, pocketId, amount, targetDate)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrPocketNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("savingsGoalRoutes.Set - savingsGoalService.SetGoal")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, goal)
+}
+
+// GET /api/v1/wallet/{walletId}/pockets/{pocketId}/goal
+func (r *savingsGoalRoutes) Get(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	pocketId, err := pathUUID(c, "pocketId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	goal, err := r.savingsGoalService.GetGoal(c.Request().Context(), walletId, pocketId)
+	if errors.Is(err, service.ErrSavingsGoalNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("savingsGoalRoutes.Get - savingsGoalService.GetGoal")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, goal)
+}
+
+// DELETE /api/v1/wallet/{walletId}/pockets/{pocketId}/goal
+func (r *savingsGoalRoutes) Delete(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	pocketId, err := pathUUID(c, "pocketId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	err = r.savingsGoalService.DeleteGoal(c.Request().Context(), walletId, pocketId)
+	if errors.Is(err, service.ErrSavingsGoalNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("savingsGoalRoutes.Delete - savingsGoalService.DeleteGoal")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,139 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type scheduledTransferRoutes struct {
+	scheduledTransferService service.ScheduledTransferService
+	log                      *logrus.Logger
+}
+
+func newScheduledTransferRoutes(g *echo.Group, sts service.ScheduledTransferService, logger *logrus.Logger) {
+	r := &scheduledTransferRoutes{
+		scheduledTransferService: sts,
+		log:                      logger,
+	}
+
+	g.POST("/wallet/:walletId/scheduled-transfers", r.Create)
+	g.GET("/wallet/:walletId/scheduled-transfers", r.List)
+	g.DELETE("/wallet/:walletId/scheduled-transfers/:transferId", r.Cancel)
+}
+
+type scheduledTransferInput struct {
+	transferInput
+	ExecuteAt  *time.Time `json:"executeAt"`
+	MaxRetries int        `json:"maxRetries"`
+}
+
+// POST /api/v1/wallet/{walletId}/scheduled-transfers
+func (r *scheduledTransferRoutes) Create(c echo.Context) error {
+	fromWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, fromWalletId)
+
+	var input scheduledTransferInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	toWalletId, amount, fieldErrs := input.transferInput.validate()
+	if input.ExecuteAt == nil {
+		fieldErrs = append(fieldErrs, service.FieldError{Field: "executeAt", Message: "is required"})
+	}
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	st, err := r.scheduledTransferService.CreateScheduledTransfer(c.Request().Context(), fromWalletId, toWalletId, amount, *input.ExecuteAt, input.MaxRetries)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrTargetWalletNotFound) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("scheduledTransferRoutes.Create - scheduledTransferService.CreateScheduledTransfer")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, st)
+}
+
+// GET /api/v1/wallet/{walletId}/scheduled-transfers?status=pending
+func (r *scheduledTransferRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	transfers, err := r.scheduledTransferService.ListScheduledTransfers(c.Request().Context(), walletId, c.QueryParam("status"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("scheduledTransferRoutes.List - scheduledTransferService.ListScheduledTransfers")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, transfers)
+}
+
+// DELETE /api/v1/wallet/{walletId}/scheduled-transfers/{transferId}
+func (r *scheduledTransferRoutes) Cancel(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	transferId, err := pathUUID(c, "transferId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	err = r.scheduledTransferService.CancelScheduledTransfer(c.Request().Context(), walletId, transferId)
+	if errors.Is(err, service.ErrScheduledTransferNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrScheduledTransferNotPending) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("scheduledTransferRoutes.Cancel - scheduledTransferService.CancelScheduledTransfer")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// uuid из параметра пути
+func pathUUID(c echo.Context, name string) (uuid.UUID, error) {
+	return uuid.Parse(c.Param(name))
+}
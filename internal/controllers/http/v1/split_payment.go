@@ -0,0 +1,149 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type splitShareInput struct {
+	To      *string      `json:"to"`
+	Percent *json.Number `json:"percent"`
+	Amount  *json.Number `json:"amount"`
+}
+
+type splitInput struct {
+	Amount *json.Number      `json:"amount"`
+	Shares []splitShareInput `json:"shares"`
+}
+
+// синтаксическая валидация; сумма долей, округление и прочие доменные правила - в сервисе
+func (in splitInput) validate() (float32, []entity.SplitShare, []service.FieldError) {
+	var (
+		fields []service.FieldError
+		amount float32
+	)
+
+	if in.Amount == nil {
+		fields = append(fields, service.FieldError{Field: "amount", Message: "is required"})
+	} else if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	} else {
+		amount = a
+	}
+
+	shares := make([]entity.SplitShare, len(in.Shares))
+	for i, share := range in.Shares {
+		prefix := fmt.Sprintf("shares[%d].", i)
+		if share.To == nil {
+			fields = append(fields, service.FieldError{Field: prefix + "to", Message: "is required"})
+		} else if id, err := uuid.Parse(*share.To); err != nil {
+			fields = append(fields, service.FieldError{Field: prefix + "to", Message: "must be a valid uuid"})
+		} else {
+			shares[i].To = id
+		}
+
+		if share.Percent != nil {
+			p, err := strconv.ParseFloat(share.Percent.String(), 64)
+			if err != nil {
+				fields = append(fields, service.FieldError{Field: prefix + "percent", Message: "must be a number"})
+			} else {
+				shares[i].Percent = &p
+			}
+		}
+		if share.Amount != nil {
+			a, fieldErr := parseAmount(prefix+"amount", *share.Amount)
+			if fieldErr != nil {
+				fields = append(fields, *fieldErr)
+			} else {
+				shares[i].Amount = &a
+			}
+		}
+	}
+
+	return amount, shares, fields
+}
+
+// POST /api/v1/wallet/{walletId}/split
+func (r *walletRoutes) SplitTransfer(c echo.Context) error {
+	fromWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, fromWalletId)
+
+	var input splitInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	amount, shares, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	sp, err := r.walletService.SplitTransfer(c.Request().Context(), fromWalletId, amount, shares)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrTargetWalletNotFound) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if errors.Is(err, service.ErrNotEnoughBalance) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) ||
+		errors.Is(err, service.ErrPocketTransferNotAllowed) || errors.Is(err, service.ErrTransferBlocked) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.SplitTransfer - walletService.SplitTransfer")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, sp)
+}
+
+// GET /api/v1/wallet/{walletId}/split/{splitId}
+func (r *walletRoutes) SplitPayment(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	splitId, err := pathUUID(c, "splitId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	sp, err := r.walletService.GetSplitPayment(c.Request().Context(), walletId, splitId)
+	if errors.Is(err, service.ErrSplitPaymentNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.SplitPayment - walletService.GetSplitPayment")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, sp)
+}
@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type standingOrderRoutes struct {
+	standingOrderService service.StandingOrderService
+	log                  *logrus.Logger
+}
+
+func newStandingOrderRoutes(g *echo.Group, sos service.StandingOrderService, logger *logrus.Logger) {
+	r := &standingOrderRoutes{
+		standingOrderService: sos,
+		log:                  logger,
+	}
+
+	g.POST("/wallet/:walletId/standing-orders", r.Create)
+	g.GET("/wallet/:walletId/standing-orders", r.List)
+	g.GET("/wallet/:walletId/standing-orders/:orderId/runs", r.Runs)
+	g.DELETE("/wallet/:walletId/standing-orders/:orderId", r.Cancel)
+}
+
+type standingOrderInput struct {
+	transferInput
+	Schedule   string     `json:"schedule"`
+	StartsAt   *time.Time `json:"startsAt"`
+	EndsAt     *time.Time `json:"endsAt"`
+	MaxCount   *int       `json:"maxCount"`
+	MissedRuns string     `json:"missedRuns"`
+}
+
+// POST /api/v1/wallet/{walletId}/standing-orders
+func (r *standingOrderRoutes) Create(c echo.Context) error {
+	fromWalletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, fromWalletId)
+
+	var input standingOrderInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+	toWalletId, amount, fieldErrs := input.transferInput.validate()
+	if input.Schedule == "" {
+		fieldErrs = append(fieldErrs, service.FieldError{Field: "schedule", Message: "is required"})
+	}
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	so := entity.StandingOrder{
+		From:       fromWalletId,
+		To:         toWalletId,
+		Amount:     amount,
+		Schedule:   input.Schedule,
+		EndsAt:     input.EndsAt,
+		MaxCount:   input.MaxCount,
+		MissedRuns: input.MissedRuns,
+	}
+	if input.StartsAt != nil {
+		so.StartsAt = *input.StartsAt
+	}
+
+	so, err = r.standingOrderService.CreateStandingOrder(c.Request().Context(), so)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrTargetWalletNotFound) {
+		return c.NoContent(http.StatusBadRequest)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("standingOrderRoutes.Create - standingOrderService.CreateStandingOrder")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusCreated, so)
+}
+
+// GET /api/v1/wallet/{walletId}/standing-orders?status=active
+func (r *standingOrderRoutes) List(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	orders, err := r.standingOrderService.ListStandingOrders(c.Request().Context(), walletId, c.QueryParam("status"))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("standingOrderRoutes.List - standingOrderService.ListStandingOrders")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, orders)
+}
+
+// GET /api/v1/wallet/{walletId}/standing-orders/{orderId}/runs
+func (r *standingOrderRoutes) Runs(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	orderId, err := pathUUID(c, "orderId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	runs, err := r.standingOrderService.ListStandingOrderRuns(c.Request().Context(), walletId, orderId)
+	if errors.Is(err, service.ErrStandingOrderNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("standingOrderRoutes.Runs - standingOrderService.ListStandingOrderRuns")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, runs)
+}
+
+// DELETE /api/v1/wallet/{walletId}/standing-orders/{orderId}
+func (r *standingOrderRoutes) Cancel(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+	orderId, err := pathUUID(c, "orderId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+
+	err = r.standingOrderService.CancelStandingOrder(c.Request().Context(), walletId, orderId)
+	if errors.Is(err, service.ErrStandingOrderNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if errors.Is(err, service.ErrStandingOrderNotActive) {
+		newErrorMessage(c, http.StatusConflict, err.Error())
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("standingOrderRoutes.Cancel - standingOrderService.CancelStandingOrder")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
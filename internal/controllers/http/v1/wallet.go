@@ -1,34 +1,76 @@
 package v1
 
 import (
+	"encoding/json"
 	"errors"
-	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
 	"github.com/timohahaa/ewallet/internal/service"
+	log "github.com/timohahaa/ewallet/pkg/logger"
 )
 
 type walletRoutes struct {
 	walletService service.WalletService
+	// nil - псевдонимы недоступны, получатель перевода указывается только по id
+	aliasService service.AliasService
+	log          *logrus.Logger
 }
 
-func newWalletRoutes(g *echo.Group, ws service.WalletService) {
+func newWalletRoutes(g *echo.Group, ws service.WalletService, as service.AliasService, logger *logrus.Logger) {
 	r := &walletRoutes{
 		walletService: ws,
+		aliasService:  as,
+		log:           logger,
 	}
 
 	g.POST("/wallet", r.CreateWallet)
+	g.GET("/wallet", r.ListWallets)
+	g.PATCH("/wallet/:walletId", r.UpdateWalletInfo)
 	g.POST("/wallet/:walletId/send", r.Transfer)
 	g.GET("/wallet/:walletId/history", r.TransactionHistory)
 	g.GET("/wallet/:walletId", r.Wallet)
+	g.POST("/wallet/:walletId/split", r.SplitTransfer)
+	g.GET("/wallet/:walletId/split/:splitId", r.SplitPayment)
+}
+
+// тело POST /wallet; тело необязательно - кошелек без данных владельца
+type walletInfoInput struct {
+	OwnerId     string   `json:"ownerId"`
+	DisplayName string   `json:"displayName"`
+	Labels      []string `json:"labels"`
+}
+
+// тело PATCH /wallet/{walletId} - отсутствующие поля не меняются
+type walletInfoUpdateInput struct {
+	OwnerId     *string   `json:"ownerId"`
+	DisplayName *string   `json:"displayName"`
+	Labels      *[]string `json:"labels"`
 }
 
 // POST /api/v1/wallet
 func (r *walletRoutes) CreateWallet(c echo.Context) error {
-	wallet, err := r.walletService.CreateWallet(c.Request().Context())
+	var input walletInfoInput
+	if c.Request().ContentLength != 0 {
+		if err := bindJSON(c, &input); err != nil {
+			newBindErrorMessage(c, err)
+			return err
+		}
+	}
+
+	wallet, err := r.walletService.CreateWallet(c.Request().Context(), entity.WalletInfo(input))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
 	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.CreateWallet - walletService.CreateWallet")
 		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
 		return err
 	}
@@ -36,6 +78,113 @@ func (r *walletRoutes) CreateWallet(c echo.Context) error {
 	return c.JSON(http.StatusOK, wallet)
 }
 
+// PATCH /api/v1/wallet/{walletId}
+func (r *walletRoutes) UpdateWalletInfo(c echo.Context) error {
+	walletId, err := pathUUID(c, "walletId")
+	if err != nil {
+		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
+		return err
+	}
+	withWalletId(c, walletId)
+
+	var input walletInfoUpdateInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
+		return err
+	}
+
+	wallet, err := r.walletService.UpdateWalletInfo(c.Request().Context(), walletId, entity.WalletInfoUpdate(input))
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if errors.Is(err, service.ErrWalletNotFound) {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.UpdateWalletInfo - walletService.UpdateWalletInfo")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, wallet)
+}
+
+// GET /api/v1/wallet?ownerId=u1&label=vip&createdFrom=...&createdTo=...&minBalance=10&maxBalance=500&limit=50&after={walletId}
+func (r *walletRoutes) ListWallets(c echo.Context) error {
+	filter, fieldErrs := walletFilterFromQuery(c)
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
+
+	page, err := r.walletService.ListWallets(c.Request().Context(), filter)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.ListWallets - walletService.ListWallets")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return nil
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// синтаксический разбор параметров списка кошельков, диапазоны проверяются в сервисе
+func walletFilterFromQuery(c echo.Context) (entity.WalletFilter, []service.FieldError) {
+	filter := entity.WalletFilter{OwnerId: c.QueryParam("ownerId"), Label: c.QueryParam("label")}
+	var fields []service.FieldError
+
+	for _, q := range []struct {
+		name string
+		dst  **time.Time
+	}{{"createdFrom", &filter.CreatedFrom}, {"createdTo", &filter.CreatedTo}} {
+		if v := c.QueryParam(q.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				fields = append(fields, service.FieldError{Field: q.name, Message: "must be an RFC 3339 timestamp"})
+				continue
+			}
+			*q.dst = &t
+		}
+	}
+	for _, q := range []struct {
+		name string
+		dst  **float32
+	}{{"minBalance", &filter.MinBalance}, {"maxBalance", &filter.MaxBalance}} {
+		if v := c.QueryParam(q.name); v != "" {
+			a, fieldErr := parseAmount(q.name, json.Number(v))
+			if fieldErr != nil {
+				fields = append(fields, *fieldErr)
+				continue
+			}
+			*q.dst = &a
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			fields = append(fields, service.FieldError{Field: "limit", Message: "must be an integer"})
+		} else {
+			filter.Limit = limit
+		}
+	}
+	if v := c.QueryParam("after"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			fields = append(fields, service.FieldError{Field: "after", Message: "must be a valid uuid"})
+		} else {
+			filter.After = &id
+		}
+	}
+
+	return filter, fields
+}
+
 // POST /api/v1/wallet/{walletId}/send
 func (r *walletRoutes) Transfer(c echo.Context) error {
 	walletId := c.Param("walletId")
@@ -44,17 +193,30 @@ func (r *walletRoutes) Transfer(c echo.Context) error {
 		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
 		return err
 	}
+	withWalletId(c, fromWalletId)
 
-	var input struct {
-		To     uuid.UUID `json:"to"`
-		Amount float32   `json:"amount"`
-	}
-	if err := c.Bind(&input); err != nil {
-		newErrorMessage(c, http.StatusBadRequest, "invalid request body")
+	var input sendInput
+	if err := bindJSON(c, &input); err != nil {
+		newBindErrorMessage(c, err)
 		return err
 	}
+	toAlias, ok := r.resolveRecipient(c, &input.transferInput)
+	if !ok {
+		return nil
+	}
+	toWalletId, amount, fieldErrs := input.validate()
+	if len(fieldErrs) > 0 {
+		newValidationErrorMessage(c, fieldErrs)
+		return nil
+	}
 
-	err = r.walletService.Transfer(c.Request().Context(), fromWalletId, input.To, input.Amount)
+	details := entity.TransferDetails{Memo: input.Memo, Reference: input.Reference, Metadata: input.Metadata, ToAlias: toAlias}
+	err = r.walletService.TransferWithDetails(c.Request().Context(), fromWalletId, toWalletId, amount, details)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		newValidationErrorMessage(c, validationErr.Fields)
+		return nil
+	}
 	if errors.Is(err, service.ErrWalletNotFound) {
 		return c.NoContent(http.StatusNotFound)
 	}
@@ -64,8 +226,21 @@ func (r *walletRoutes) Transfer(c echo.Context) error {
 	if errors.Is(err, service.ErrNotEnoughBalance) {
 		return c.NoContent(http.StatusBadRequest)
 	}
+	if errors.Is(err, service.ErrWalletFrozen) || errors.Is(err, service.ErrTargetWalletFrozen) ||
+		errors.Is(err, service.ErrPocketTransferNotAllowed) || errors.Is(err, service.ErrTransferBlocked) {
+		newErrorMessage(c, http.StatusForbidden, err.Error())
+		return nil
+	}
+	// сумма уже списана и удерживается до решения оператора
+	var heldErr *service.TransferHeldError
+	if errors.As(err, &heldErr) {
+		return c.JSON(http.StatusAccepted, struct {
+			Message  string    `json:"message"`
+			ReviewId uuid.UUID `json:"reviewId"`
+		}{Message: heldErr.Error(), ReviewId: heldErr.CaseId})
+	}
 	if err != nil {
-		slog.Error("walletRoutes.Transfer - walletService.Transfer", "err", err)
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.Transfer - walletService.Transfer")
 		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
 		return nil
 	}
@@ -73,7 +248,98 @@ func (r *walletRoutes) Transfer(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
-// GET /api/v1/wallet/{walletId}/history
+// получатель в to может быть указан псевдонимом (@handle, email, phone) - тогда to заменяется на id кошелька,
+// а псевдоним возвращается для истории; false - ответ с ошибкой уже отправлен
+func (r *walletRoutes) resolveRecipient(c echo.Context, in *transferInput) (string, bool) {
+	if in.To == nil || r.aliasService == nil {
+		return "", true
+	}
+	if _, err := uuid.Parse(*in.To); err == nil {
+		return "", true
+	}
+
+	walletId, alias, err := r.aliasService.ResolveAlias(c.Request().Context(), *in.To)
+	var validationErr *service.ValidationError
+	if errors.As(err, &validationErr) {
+		fields := make([]service.FieldError, 0, len(validationErr.Fields))
+		for _, f := range validationErr.Fields {
+			fields = append(fields, service.FieldError{Field: "to", Message: "must be a wallet id or an alias: " + f.Message})
+		}
+		newValidationErrorMessage(c, fields)
+		return "", false
+	}
+	if errors.Is(err, service.ErrAliasNotFound) {
+		newErrorMessage(c, http.StatusBadRequest, err.Error())
+		return "", false
+	}
+	if err != nil {
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.resolveRecipient - aliasService.ResolveAlias")
+		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
+		return "", false
+	}
+
+	to := walletId.String()
+	in.To = &to
+	return alias, true
+}
+
+// тело запроса на перевод - поля указателями, чтобы отличать отсутствующее поле от нулевого значения
+type transferInput struct {
+	To     *string      `json:"to"`
+	Amount *json.Number `json:"amount"`
+}
+
+// тело POST /send; memo, reference и metadata есть только у прямого перевода
+type sendInput struct {
+	transferInput
+	Memo      string         `json:"memo"`
+	Reference string         `json:"reference"`
+	Metadata  map[string]any `json:"metadata"`
+}
+
+// синтаксическая валидация тела запроса, доменные правила проверяются в сервисе
+func (in transferInput) validate() (uuid.UUID, float32, []service.FieldError) {
+	var (
+		fields []service.FieldError
+		to     uuid.UUID
+		amount float32
+	)
+
+	if in.To == nil {
+		fields = append(fields, service.FieldError{Field: "to", Message: "is required"})
+	} else if id, err := uuid.Parse(*in.To); err != nil {
+		fields = append(fields, service.FieldError{Field: "to", Message: "must be a valid uuid"})
+	} else {
+		to = id
+	}
+
+	if in.Amount == nil {
+		fields = append(fields, service.FieldError{Field: "amount", Message: "is required"})
+	} else if a, fieldErr := parseAmount("amount", *in.Amount); fieldErr != nil {
+		fields = append(fields, *fieldErr)
+	} else {
+		amount = a
+	}
+
+	return to, amount, fields
+}
+
+// сумма из json-числа: не больше service.AmountPrecision знаков после запятой, без потерь при приведении к float32
+func parseAmount(field string, num json.Number) (float32, *service.FieldError) {
+	a, err := strconv.ParseFloat(num.String(), 64)
+	if err != nil {
+		return 0, &service.FieldError{Field: field, Message: "must be a number"}
+	}
+	if service.FractionDigits(a, 64) > service.AmountPrecision {
+		return 0, &service.FieldError{Field: field, Message: "must have at most " + strconv.Itoa(service.AmountPrecision) + " decimal places"}
+	}
+	if !service.ExactAmount(a) {
+		return 0, &service.FieldError{Field: field, Message: "has too many significant digits to be stored exactly"}
+	}
+	return float32(a), nil
+}
+
+// GET /api/v1/wallet/{walletId}/history?reference=inv-42
 func (r *walletRoutes) TransactionHistory(c echo.Context) error {
 	walletIdStr := c.Param("walletId")
 	walletId, err := uuid.Parse(walletIdStr)
@@ -81,13 +347,14 @@ func (r *walletRoutes) TransactionHistory(c echo.Context) error {
 		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
 		return err
 	}
+	withWalletId(c, walletId)
 
-	txs, err := r.walletService.TransactionHistory(c.Request().Context(), walletId)
+	txs, err := r.walletService.TransactionHistory(c.Request().Context(), walletId, entity.TransactionFilter{Reference: c.QueryParam("reference")})
 	if errors.Is(err, service.ErrWalletNotFound) {
 		return c.NoContent(http.StatusNotFound)
 	}
 	if err != nil {
-		slog.Error("walletRoutes.TransactionHistory - walletService.TransactionHistory", "err", err)
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.TransactionHistory - walletService.TransactionHistory")
 		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
 		return nil
 	}
@@ -103,13 +370,14 @@ func (r *walletRoutes) Wallet(c echo.Context) error {
 		newErrorMessage(c, http.StatusBadRequest, "invalid path parametr")
 		return err
 	}
+	withWalletId(c, walletId)
 
 	wallet, err := r.walletService.WalletStatus(c.Request().Context(), walletId)
 	if errors.Is(err, service.ErrWalletNotFound) {
 		return c.NoContent(http.StatusNotFound)
 	}
 	if err != nil {
-		slog.Error("walletRoutes.Wallet - walletService.WalletStatus", "err", err)
+		log.FromContext(c.Request().Context(), r.log).WithError(err).Error("walletRoutes.Wallet - walletService.WalletStatus")
 		newErrorMessage(c, http.StatusInternalServerError, "internal server error")
 		return nil
 	}
@@ -0,0 +1,35 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// виды псевдонимов кошелька
+const (
+	AliasHandle = "handle"
+	AliasEmail  = "email"
+	AliasPhone  = "phone"
+)
+
+// псевдоним кошелька; замененный или удаленный псевдоним остается в истории с RemovedAt
+type WalletAlias struct {
+	Id       uuid.UUID `json:"id"`
+	WalletId uuid.UUID `json:"walletId"`
+	Kind     string    `json:"kind"`
+	// нормализованное значение: handle без @, email в нижнем регистре, phone в формате E.164
+	Value      string     `json:"value"`
+	Verified   bool       `json:"verified"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	VerifiedAt *time.Time `json:"verifiedAt,omitempty"`
+	RemovedAt  *time.Time `json:"removedAt,omitempty"`
+}
+
+// результат поиска по псевдониму - подтвержденные псевдонимы получателя, чтобы отправитель убедился,
+// что переводит тому, кому нужно; email и phone замаскированы, id кошелька не раскрывается
+type AliasLookup struct {
+	Handle string `json:"handle,omitempty"`
+	Email  string `json:"email,omitempty"`
+	Phone  string `json:"phone,omitempty"`
+}
@@ -0,0 +1,40 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// действия администратора, попадающие в аудит
+const (
+	AuditActionTransfer    = "transfer"
+	AuditActionAdjustment  = "adjustment"
+	AuditActionFreeze      = "freeze"
+	AuditActionUnfreeze    = "unfreeze"
+	AuditActionVerifyAlias = "verify_alias"
+	AuditActionCreditLine  = "credit_line"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailed  = "failed"
+)
+
+type AuditRecord struct {
+	Id       int64          `json:"id"`
+	Time     time.Time      `json:"time"`
+	Actor    string         `json:"actor"`
+	Action   string         `json:"action"`
+	WalletId uuid.UUID      `json:"walletId"`
+	Details  map[string]any `json:"details"`
+	Reason   string         `json:"reason"`
+	Outcome  string         `json:"outcome"`
+}
+
+// расхождение между балансом кошелька и суммой по его транзакциям
+type ReconciliationMismatch struct {
+	WalletId uuid.UUID `json:"walletId"`
+	Balance  float32   `json:"balance"`
+	Expected float32   `json:"expected"`
+}
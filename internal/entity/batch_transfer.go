@@ -0,0 +1,48 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// если хотя бы одна строка не проходит - не исполняется ни одна
+	BatchModeAllOrNothing = "all_or_nothing"
+	// исполняются все строки, которые можно исполнить
+	BatchModeBestEffort = "best_effort"
+)
+
+const (
+	BatchTransferPending   = "pending"
+	BatchTransferCompleted = "completed"
+	BatchTransferFailed    = "failed"
+)
+
+const (
+	BatchLinePending   = "pending"
+	BatchLineSucceeded = "succeeded"
+	BatchLineFailed    = "failed"
+)
+
+// пакетный перевод - одно списание с кошелька From и зачисления по строкам
+type BatchTransfer struct {
+	Id     uuid.UUID `json:"id"`
+	From   uuid.UUID `json:"from"`
+	Mode   string    `json:"mode"`
+	Status string    `json:"status"`
+	// причина неуспеха всего пакета (например, кошелек отправителя заморожен)
+	FailureReason string              `json:"failureReason,omitempty"`
+	Lines         []BatchTransferLine `json:"lines"`
+	CreatedAt     time.Time           `json:"createdAt"`
+	CompletedAt   *time.Time          `json:"completedAt,omitempty"`
+}
+
+type BatchTransferLine struct {
+	// номер строки в запросе, с 0
+	Line   int       `json:"line"`
+	To     uuid.UUID `json:"to"`
+	Amount float32   `json:"amount"`
+	Status string    `json:"status"`
+	Error  string    `json:"error,omitempty"`
+}
@@ -0,0 +1,72 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// кредитная линия кошелька: лимит овердрафта и плата за задолженность; даты - дни по UTC.
+// Ставки и накопленные суммы - десятичные строки, как у процентных счетов
+type CreditLine struct {
+	WalletId uuid.UUID `json:"walletId"`
+	// лимит и баланс хранятся в кошельке, здесь - на момент чтения
+	CreditLimit float32 `json:"creditLimit"`
+	Balance     float32 `json:"balance"`
+	// в процентах годовых на задолженность, до 4 знаков после запятой
+	AnnualRate string `json:"annualRate"`
+	DayCount   string `json:"dayCount"`
+	// за каждый день, закончившийся с отрицательным балансом
+	DailyFee float32 `json:"dailyFee"`
+	// последний день, за который начислены проценты и комиссия
+	AccruedThrough time.Time `json:"accruedThrough"`
+	// начислено, но еще не списано, до 10 знаков после запятой
+	Pending string `json:"pending"`
+	// месяц закончился, а списание еще не сделано
+	ChargeDue bool `json:"chargeDue"`
+	// списание не прошло - следующая попытка не раньше
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+	// наибольший порог использования лимита (в процентах), о котором уже уведомили; 0 - ни одного
+	AlertThreshold int       `json:"alertThreshold"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// начисление за день, закончившийся с отрицательным балансом; (WalletId, Date) уникальна
+type CreditAccrual struct {
+	WalletId   uuid.UUID `json:"walletId"`
+	Date       time.Time `json:"date"`
+	Balance    float32   `json:"balance"`
+	AnnualRate string    `json:"annualRate"`
+	DayCount   string    `json:"dayCount"`
+	// проценты за день, до 10 знаков после запятой
+	Interest string  `json:"interest"`
+	Fee      float32 `json:"fee"`
+	// nil - еще не списано
+	ChargeId  *uuid.UUID `json:"chargeId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// списание за месяц - перевод с кошелька на казначейский; (WalletId, PeriodEnd) уникальна
+type CreditCharge struct {
+	Id        uuid.UUID `json:"id"`
+	WalletId  uuid.UUID `json:"walletId"`
+	PeriodEnd time.Time `json:"periodEnd"`
+	// накоплено к списанию вместе с остатком прошлого списания
+	Accrued string `json:"accrued"`
+	// Accrued, округленное вниз до тысячных
+	Amount float32 `json:"amount"`
+	// остаток меньше тысячной - переходит в следующее списание
+	Carry     string    `json:"carry"`
+	ChargedAt time.Time `json:"chargedAt"`
+}
+
+// уведомление: использование лимита достигло Threshold процентов
+type CreditAlert struct {
+	Id          int64     `json:"id"`
+	WalletId    uuid.UUID `json:"walletId"`
+	Threshold   int       `json:"threshold"`
+	Balance     float32   `json:"balance"`
+	CreditLimit float32   `json:"creditLimit"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
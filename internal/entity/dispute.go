@@ -0,0 +1,68 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// сумма удерживается у получателя, спор ждет решения
+	DisputeOpen = "open"
+	// решен в пользу отправителя: удержанная сумма возвращена ему
+	DisputeReversed = "reversed"
+	// решен в пользу получателя: удержание снято
+	DisputeReleased = "released"
+)
+
+// в чью пользу решается спор
+const (
+	DisputeFavorSender    = "sender"
+	DisputeFavorRecipient = "recipient"
+)
+
+// инициатор перехода, не являющийся оператором (воркер дедлайнов)
+const DisputeActorSystem = "system"
+
+// спор по переводу TransactionId: Amount удерживается у получателя до решения или дедлайна
+type Dispute struct {
+	Id            uuid.UUID         `json:"id"`
+	TransactionId int64             `json:"transactionId"`
+	Sender        uuid.UUID         `json:"sender"`
+	Recipient     uuid.UUID         `json:"recipient"`
+	Amount        float32           `json:"amount"`
+	Reason        string            `json:"reason"`
+	Status        string            `json:"status"`
+	Deadline      time.Time         `json:"deadline"`
+	OpenedBy      string            `json:"openedBy"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	ResolvedAt    *time.Time        `json:"resolvedAt,omitempty"`
+	Evidence      []DisputeEvidence `json:"evidence,omitempty"`
+	Events        []DisputeEvent    `json:"events,omitempty"`
+}
+
+// вложение к спору - ссылка на файл во внешнем хранилище
+type DisputeEvidence struct {
+	Id      int64     `json:"id"`
+	Name    string    `json:"name"`
+	Url     string    `json:"url"`
+	Note    string    `json:"note,omitempty"`
+	AddedBy string    `json:"addedBy"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// запись истории спора; FromStatus пустой у открытия
+type DisputeEvent struct {
+	Time       time.Time `json:"time"`
+	FromStatus string    `json:"fromStatus,omitempty"`
+	ToStatus   string    `json:"toStatus"`
+	Actor      string    `json:"actor"`
+	Note       string    `json:"note,omitempty"`
+}
+
+// фильтры списка споров; пустые поля не фильтруют
+type DisputeFilter struct {
+	Status string
+	// кошелек - отправитель или получатель
+	WalletId *uuid.UUID
+}
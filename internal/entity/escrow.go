@@ -0,0 +1,42 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// средства списаны с покупателя и удерживаются
+	EscrowFunded = "funded"
+	// средства переданы продавцу
+	EscrowReleased = "released"
+	// средства возвращены покупателю
+	EscrowRefunded = "refunded"
+)
+
+// инициатор перехода, не являющийся участником сделки (воркер дедлайнов)
+const EscrowActorSystem = "system"
+
+// сделка с удержанием средств: покупатель -> escrow -> продавец или обратно покупателю
+type Escrow struct {
+	Id          uuid.UUID     `json:"id"`
+	Buyer       uuid.UUID     `json:"buyer"`
+	Seller      uuid.UUID     `json:"seller"`
+	Amount      float32       `json:"amount"`
+	Description string        `json:"description,omitempty"`
+	Status      string        `json:"status"`
+	Deadline    time.Time     `json:"deadline"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	SettledAt   *time.Time    `json:"settledAt,omitempty"`
+	Events      []EscrowEvent `json:"events,omitempty"`
+}
+
+// запись истории сделки; FromStatus пустой у создания
+type EscrowEvent struct {
+	Time       time.Time `json:"time"`
+	FromStatus string    `json:"fromStatus,omitempty"`
+	ToStatus   string    `json:"toStatus"`
+	Actor      string    `json:"actor"`
+	Note       string    `json:"note,omitempty"`
+}
@@ -0,0 +1,74 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// типы антифрод-правил
+const (
+	// больше Count исходящих переводов за Window
+	FraudRuleVelocity = "velocity"
+	// первый перевод этому получателю на сумму от MinAmount
+	FraudRuleNewCounterparty = "new_counterparty"
+	// сумма в Factor и более раз больше средней суммы исходящих переводов за Window
+	FraudRuleSpike = "spike"
+	// больше Count новых получателей за Window
+	FraudRuleFanOut = "fan_out"
+)
+
+// итог проверки перевода
+const (
+	FraudAllow  = "allow"
+	FraudReview = "review"
+	FraudBlock  = "block"
+)
+
+const (
+	// сумма удерживается у отправителя до решения оператора
+	FraudCasePending = "pending"
+	// перевод одобрен, сумма зачислена получателю
+	FraudCaseApproved = "approved"
+	// перевод отклонен, сумма возвращена отправителю
+	FraudCaseRejected = "rejected"
+	// перевод заблокирован правилами, средства не списывались
+	FraudCaseBlocked = "blocked"
+)
+
+// сработавшее правило
+type FraudReason struct {
+	Rule    string `json:"rule"`
+	Type    string `json:"type"`
+	Score   int    `json:"score"`
+	Message string `json:"message"`
+}
+
+// перевод, отправленный правилами на проверку или заблокированный
+type FraudCase struct {
+	Id      uuid.UUID     `json:"id"`
+	From    uuid.UUID     `json:"from"`
+	To      uuid.UUID     `json:"to"`
+	Amount  float32       `json:"amount"`
+	Score   int           `json:"score"`
+	Reasons []FraudReason `json:"reasons"`
+	// review | block
+	Decision string `json:"decision"`
+	Status   string `json:"status"`
+	// данные перевода, с которыми он будет зачислен получателю после одобрения
+	Memo         string         `json:"memo,omitempty"`
+	Reference    string         `json:"reference,omitempty"`
+	Metadata     map[string]any `json:"metadata,omitempty"`
+	ToAlias      string         `json:"toAlias,omitempty"`
+	CreatedAt    time.Time      `json:"createdAt"`
+	DecidedAt    *time.Time     `json:"decidedAt,omitempty"`
+	DecidedBy    string         `json:"decidedBy,omitempty"`
+	DecisionNote string         `json:"decisionNote,omitempty"`
+}
+
+// фильтры очереди проверки; пустые поля не фильтруют
+type FraudCaseFilter struct {
+	Status string
+	// кошелек - отправитель или получатель
+	WalletId *uuid.UUID
+}
@@ -0,0 +1,96 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// сколько дней в году при расчете дневного начисления
+const (
+	// всегда 365
+	DayCountActual365 = "act/365"
+	// всегда 360
+	DayCountActual360 = "act/360"
+	// фактическое кол-во дней в году дня начисления (365 или 366)
+	DayCountActualActual = "act/act"
+)
+
+// как часто начисленные проценты выплачиваются на баланс (и дальше сами приносят проценты)
+const (
+	CompoundingDaily     = "daily"
+	CompoundingMonthly   = "monthly"
+	CompoundingQuarterly = "quarterly"
+	CompoundingYearly    = "yearly"
+)
+
+const (
+	InterestAccountActive = "active"
+	InterestAccountClosed = "closed"
+)
+
+// процентный продукт; ставки и суммы начислений - десятичные строки, чтобы не терять точность на float
+type InterestProduct struct {
+	Id   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// в процентах годовых, до 4 знаков после запятой
+	AnnualRate  string    `json:"annualRate"`
+	DayCount    string    `json:"dayCount"`
+	Compounding string    `json:"compounding"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// счет начисления - подключение кошелька к продукту; даты - дни по UTC
+type InterestAccount struct {
+	WalletId  uuid.UUID        `json:"walletId"`
+	ProductId uuid.UUID        `json:"productId"`
+	Product   *InterestProduct `json:"product,omitempty"`
+	Status    string           `json:"status"`
+	// последний день, за который начислены проценты
+	AccruedThrough time.Time `json:"accruedThrough"`
+	// с этого дня начисление прекращено; nil - бессрочно
+	EndsOn *time.Time `json:"endsOn,omitempty"`
+	// начислено, но еще не выплачено, до 10 знаков после запятой
+	Pending string `json:"pending"`
+	// период закончился, а выплата еще не сделана
+	PayoutDue bool `json:"payoutDue"`
+	// выплата не прошла - следующая попытка не раньше
+	RetryAt   *time.Time `json:"retryAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// начисление за один день по остатку на конец дня; (WalletId, Date) уникальна
+type InterestAccrual struct {
+	WalletId   uuid.UUID `json:"walletId"`
+	Date       time.Time `json:"date"`
+	ProductId  uuid.UUID `json:"productId"`
+	Balance    float32   `json:"balance"`
+	AnnualRate string    `json:"annualRate"`
+	DayCount   string    `json:"dayCount"`
+	// до 10 знаков после запятой
+	Amount string `json:"amount"`
+	// nil - еще не выплачено
+	PayoutId  *uuid.UUID `json:"payoutId,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// выплата процентов - перевод с казначейского кошелька; (WalletId, PeriodEnd) уникальна
+type InterestPayout struct {
+	Id        uuid.UUID `json:"id"`
+	WalletId  uuid.UUID `json:"walletId"`
+	PeriodEnd time.Time `json:"periodEnd"`
+	// накоплено к выплате вместе с остатком прошлой выплаты
+	Accrued string `json:"accrued"`
+	// Accrued, округленное вниз до тысячных
+	Amount float32 `json:"amount"`
+	// остаток меньше тысячной - переходит в следующую выплату
+	Carry  string    `json:"carry"`
+	PaidAt time.Time `json:"paidAt"`
+}
+
+// фильтр истории начислений; nil - без ограничения
+type InterestAccrualFilter struct {
+	From *time.Time
+	To   *time.Time
+}
@@ -0,0 +1,54 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	InvoiceOpen          = "open"
+	InvoicePartiallyPaid = "partially_paid"
+	InvoicePaid          = "paid"
+	InvoiceVoid          = "void"
+	// срок оплаты прошел, а счет оплачен не полностью; оплата все еще принимается
+	InvoiceOverdue = "overdue"
+)
+
+// счет продавца, оплачиваемый с любого кошелька, в т.ч. частями
+type Invoice struct {
+	Id         uuid.UUID        `json:"id"`
+	Merchant   uuid.UUID        `json:"merchant"`
+	Amount     float32          `json:"amount"`
+	Currency   string           `json:"currency"`
+	DueAt      time.Time        `json:"dueAt"`
+	Reference  string           `json:"reference,omitempty"`
+	Items      []InvoiceItem    `json:"items,omitempty"`
+	Status     string           `json:"status"`
+	PaidAmount float32          `json:"paidAmount"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	PaidAt     *time.Time       `json:"paidAt,omitempty"`
+	VoidedAt   *time.Time       `json:"voidedAt,omitempty"`
+	Payments   []InvoicePayment `json:"payments,omitempty"`
+}
+
+type InvoiceItem struct {
+	Description string  `json:"description"`
+	Quantity    int     `json:"quantity"`
+	UnitPrice   float32 `json:"unitPrice"`
+}
+
+// оплата счета - транзакция с источником invoice
+type InvoicePayment struct {
+	Time   time.Time `json:"time"`
+	From   uuid.UUID `json:"from"`
+	Amount float32   `json:"amount"`
+}
+
+// фильтры списка счетов продавца; пустые поля не фильтруют
+type InvoiceFilter struct {
+	Status    string
+	Reference string
+	DueFrom   *time.Time
+	DueTo     *time.Time
+}
@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PaymentRequestPending  = "pending"
+	PaymentRequestPaid     = "paid"
+	PaymentRequestDeclined = "declined"
+	PaymentRequestExpired  = "expired"
+)
+
+const (
+	// запросы, выставленные кошельку (он - плательщик)
+	PaymentRequestsIncoming = "incoming"
+	// запросы, выставленные кошельком (он - получатель)
+	PaymentRequestsOutgoing = "outgoing"
+)
+
+// запрос денег: Requester просит Payer перевести Amount
+type PaymentRequest struct {
+	Id         uuid.UUID  `json:"id"`
+	Requester  uuid.UUID  `json:"requester"`
+	Payer      uuid.UUID  `json:"payer"`
+	Amount     float32    `json:"amount"`
+	Memo       string     `json:"memo,omitempty"`
+	Status     string     `json:"status"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
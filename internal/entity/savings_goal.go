@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SavingsGoal - цель накопления кармана; прогресс считается по текущему балансу кармана
+type SavingsGoal struct {
+	PocketId     uuid.UUID `json:"pocketId"`
+	WalletId     uuid.UUID `json:"walletId"`
+	TargetAmount float32   `json:"targetAmount"`
+	// день, к которому нужно накопить (UTC); nil - без срока
+	TargetDate *time.Time `json:"targetDate,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+
+	// баланс кармана на момент чтения
+	Saved float32 `json:"saved"`
+	// заполняются сервисом
+	Remaining float32 `json:"remaining"`
+	// доля накопленного, 0-100
+	Percent  float32 `json:"percent"`
+	Achieved bool    `json:"achieved"`
+	// срок прошел, а цель не достигнута
+	Overdue bool `json:"overdue"`
+	// дней до срока, включая сегодняшний; nil - без срока или срок прошел
+	DaysLeft *int `json:"daysLeft,omitempty"`
+	// сколько откладывать в день, чтобы успеть к сроку
+	DailyAmount *float32 `json:"dailyAmount,omitempty"`
+}
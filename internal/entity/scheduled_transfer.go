@@ -0,0 +1,28 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScheduledTransferPending  = "pending"
+	ScheduledTransferExecuted = "executed"
+	ScheduledTransferFailed   = "failed"
+	ScheduledTransferCanceled = "canceled"
+)
+
+type ScheduledTransfer struct {
+	Id            uuid.UUID  `json:"id"`
+	From          uuid.UUID  `json:"from"`
+	To            uuid.UUID  `json:"to"`
+	Amount        float32    `json:"amount"`
+	ExecuteAt     time.Time  `json:"executeAt"`
+	Status        string     `json:"status"`
+	Attempts      int        `json:"attempts"`
+	MaxAttempts   int        `json:"maxAttempts"`
+	FailureReason string     `json:"failureReason,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	ExecutedAt    *time.Time `json:"executedAt,omitempty"`
+}
@@ -0,0 +1,30 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// доля получателя в запросе на разделенный платеж - ровно одно из Percent и Amount
+type SplitShare struct {
+	To uuid.UUID `json:"to"`
+	// процент от суммы, оставшейся после фиксированных долей, до 2 знаков после запятой
+	Percent *float64 `json:"percent,omitempty"`
+	// фиксированная сумма
+	Amount *float32 `json:"amount,omitempty"`
+}
+
+type SplitLine struct {
+	To     uuid.UUID `json:"to"`
+	Amount float32   `json:"amount"`
+}
+
+// разделенный платеж - родительская запись над транзакциями-строками (источник split_payment)
+type SplitPayment struct {
+	Id     uuid.UUID   `json:"id"`
+	From   uuid.UUID   `json:"from"`
+	Amount float32     `json:"amount"`
+	Time   time.Time   `json:"time"`
+	Lines  []SplitLine `json:"lines"`
+}
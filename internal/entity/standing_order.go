@@ -0,0 +1,57 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	StandingOrderActive    = "active"
+	StandingOrderCompleted = "completed"
+	StandingOrderCanceled  = "canceled"
+)
+
+// что делать с запусками, пропущенными во время простоя
+const (
+	// исполнить каждый пропущенный запуск по порядку
+	MissedRunsCatchUp = "catch_up"
+	// исполнить только последний наступивший запуск, остальные пометить skipped
+	MissedRunsSkip = "skip"
+)
+
+const (
+	StandingOrderRunExecuted = "executed"
+	StandingOrderRunFailed   = "failed"
+	StandingOrderRunSkipped  = "skipped"
+)
+
+// постоянное поручение - регулярный перевод по cron-расписанию (UTC)
+type StandingOrder struct {
+	Id       uuid.UUID  `json:"id"`
+	From     uuid.UUID  `json:"from"`
+	To       uuid.UUID  `json:"to"`
+	Amount   float32    `json:"amount"`
+	Schedule string     `json:"schedule"`
+	StartsAt time.Time  `json:"startsAt"`
+	EndsAt   *time.Time `json:"endsAt,omitempty"`
+	// максимальное кол-во исполненных переводов (неуспешные и пропущенные запуски не считаются); nil - без ограничения
+	MaxCount   *int   `json:"maxCount,omitempty"`
+	MissedRuns string `json:"missedRuns"`
+	Status     string `json:"status"`
+	// кол-во исполненных переводов - с ним сравнивается MaxCount
+	RunsCount int `json:"runsCount"`
+	// nil - поручение завершено или отменено
+	NextRunAt         *time.Time `json:"nextRunAt,omitempty"`
+	LastFailureReason string     `json:"lastFailureReason,omitempty"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+// один запуск поручения - (StandingOrderId, ScheduledFor) уникальна, запуск не материализуется дважды
+type StandingOrderRun struct {
+	StandingOrderId uuid.UUID `json:"standingOrderId"`
+	ScheduledFor    time.Time `json:"scheduledFor"`
+	Status          string    `json:"status"`
+	FailureReason   string    `json:"failureReason,omitempty"`
+	ExecutedAt      time.Time `json:"executedAt"`
+}
@@ -6,11 +6,78 @@ import (
 	"github.com/google/uuid"
 )
 
+// подсистемы, от имени которых совершаются переводы
+const (
+	TransferSourceScheduledTransfer = "scheduled_transfer"
+	TransferSourceStandingOrder     = "standing_order"
+	TransferSourceBatchTransfer     = "batch_transfer"
+	TransferSourceSplitPayment      = "split_payment"
+	TransferSourceEscrow            = "escrow"
+	TransferSourcePaymentRequest    = "payment_request"
+	TransferSourceInvoice           = "invoice"
+	// перемещение между кошельком и его карманом, в т.ч. выметание баланса при закрытии кармана
+	TransferSourcePocket = "pocket"
+	// сдача исходящего перевода до целой единицы, id - карман, в который она отложена
+	TransferSourceRoundUp = "round_up"
+	// выплата процентов с казначейского кошелька, id - выплата
+	TransferSourceInterest = "interest"
+	// списание процентов и комиссии по кредитной линии на казначейский кошелек, id - списание
+	TransferSourceCreditCharge = "credit_charge"
+	// удержание суммы спора у получателя и его снятие или возврат отправителю, id - спор
+	TransferSourceDispute = "dispute"
+	// удержание перевода, отправленного антифрод-правилами на проверку, и его зачисление или возврат, id - проверка
+	TransferSourceFraudReview = "fraud_review"
+)
+
+// переводы, которые система совершает сама: начисления и списания, сдача, удержания и их снятие по решению оператора
+var SystemTransferSources = []string{
+	TransferSourceRoundUp,
+	TransferSourceInterest,
+	TransferSourceCreditCharge,
+	TransferSourceDispute,
+	TransferSourceFraudReview,
+}
+
+// переводы, которые антифрод-правила не проверяют и не учитывают в истории отправителя: системные
+// и перемещения между кошельком и его карманами, в которых владелец двигает собственные деньги
+var FraudExemptTransferSources = append([]string{TransferSourcePocket}, SystemTransferSources...)
+
+// источник перевода - по нему транзакцию в истории можно связать с породившим ее объектом
+type TransferSource struct {
+	Type string    `json:"type"`
+	Id   uuid.UUID `json:"id"`
+}
+
+// у корректировок баланса администратором одна из сторон - uuid.Nil
 type Transaction struct {
+	// по id на перевод открывается спор
+	Id     int64     `json:"id"`
 	Time   time.Time `json:"time"`
 	From   uuid.UUID `json:"from"`
 	To     uuid.UUID `json:"to"`
 	Amount float32   `json:"amount"`
+	// nil - обычный перевод, сделанный напрямую
+	Source *TransferSource `json:"source,omitempty"`
+	// назначение платежа, внешний идентификатор и произвольные данные отправителя
+	Memo      string         `json:"memo,omitempty"`
+	Reference string         `json:"reference,omitempty"`
+	Metadata  map[string]any `json:"metadata,omitempty"`
+	// псевдоним, по которому отправитель указал получателя, в том виде, в каком он был на момент перевода
+	ToAlias string `json:"toAlias,omitempty"`
+}
+
+// необязательные данные перевода, которые отправитель передает вместе с ним
+type TransferDetails struct {
+	Memo      string
+	Reference string
+	Metadata  map[string]any
+	// псевдоним получателя (@handle, email или phone), если перевод был по псевдониму
+	ToAlias string
+}
+
+// фильтры истории транзакций; пустые поля не фильтруют
+type TransactionFilter struct {
+	Reference string
 }
 
 func NewTransaction(time time.Time, from, to uuid.UUID, amount float32) *Transaction {
@@ -1,10 +1,68 @@
 package entity
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Wallet struct {
 	Id      uuid.UUID `json:"id"`
 	Balance float32   `json:"balance"`
+	Frozen  bool      `json:"frozen"`
+	// баланс может уйти в минус не ниже -CreditLimit; 0 - без овердрафта
+	CreditLimit float32 `json:"creditLimit"`
+	// у кармана - id родительского кошелька
+	ParentId *uuid.UUID `json:"parentId,omitempty"`
+	WalletInfo
+	CreatedAt time.Time `json:"createdAt"`
+	// время последнего изменения кошелька, в т.ч. баланса
+	UpdatedAt time.Time `json:"updatedAt"`
+	// закрытый карман заморожен, его баланс переведен родителю
+	ClosedAt *time.Time `json:"closedAt,omitempty"`
+	// карман, в который уходит сдача исходящих переводов до целой единицы; nil - округление выключено
+	RoundUpPocketId *uuid.UUID `json:"roundUpPocketId,omitempty"`
+
+	// сводка по кошельку с карманами - заполняется только в WalletStatus для кошелька, не являющегося карманом:
+	// открытые карманы и общий баланс кошелька вместе с ними
+	Pockets      []Wallet `json:"pockets,omitempty"`
+	TotalBalance *float32 `json:"totalBalance,omitempty"`
+	// доступно к списанию с учетом кредитного лимита - заполняется только в WalletStatus
+	Available *float32 `json:"available,omitempty"`
+}
+
+// данные владельца кошелька - задаются при создании и меняются отдельно от баланса
+type WalletInfo struct {
+	// идентификатор владельца во внешней системе
+	OwnerId     string   `json:"ownerId,omitempty"`
+	DisplayName string   `json:"displayName,omitempty"`
+	Labels      []string `json:"labels"`
+}
+
+// изменение данных владельца; nil - поле не меняется
+type WalletInfoUpdate struct {
+	OwnerId     *string
+	DisplayName *string
+	Labels      *[]string
+}
+
+// фильтры списка кошельков; пустые поля не фильтруют
+type WalletFilter struct {
+	OwnerId     string
+	Label       string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	MinBalance  *float32
+	MaxBalance  *float32
+	// курсор: id последнего кошелька предыдущей страницы
+	After *uuid.UUID
+	Limit int
+}
+
+// страница списка кошельков; Next - курсор следующей страницы, пустой на последней
+type WalletPage struct {
+	Wallets []Wallet `json:"wallets"`
+	Next    string   `json:"next,omitempty"`
 }
 
 func NewWallet(id uuid.UUID, balance float32) *Wallet {
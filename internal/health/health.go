@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+const defaultCheckTimeout = 2 * time.Second
+
+// CheckFunc - проверка зависимости; details попадают в ответ как есть (например, заполненность пула)
+type CheckFunc func(ctx context.Context) (details map[string]any, err error)
+
+type CheckResult struct {
+	Name      string         `json:"name"`
+	Status    string         `json:"status"`
+	LatencyMs float64        `json:"latency_ms"`
+	Error     string         `json:"error,omitempty"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+type Report struct {
+	Status string        `json:"status"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type namedCheck struct {
+	name string
+	fn   CheckFunc
+}
+
+// Checker - набор проверок для readiness-пробы.
+// После SetShuttingDown проба всегда отвечает fail, чтобы балансировщик перестал слать трафик до остановки сервера.
+type Checker struct {
+	checks       []namedCheck
+	checkTimeout time.Duration
+	shuttingDown atomic.Bool
+}
+
+func NewChecker() *Checker {
+	return &Checker{
+		checkTimeout: defaultCheckTimeout,
+	}
+}
+
+func (h *Checker) Add(name string, fn CheckFunc) {
+	h.checks = append(h.checks, namedCheck{name: name, fn: fn})
+}
+
+func (h *Checker) SetShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+// Ready - выполняет все проверки параллельно, каждую со своим таймаутом
+func (h *Checker) Ready(ctx context.Context) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make([]CheckResult, len(h.checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func(i int, check namedCheck) {
+			defer wg.Done()
+			report.Checks[i] = h.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	if h.shuttingDown.Load() {
+		report.Status = StatusFail
+		report.Checks = append(report.Checks, CheckResult{Name: "shutdown", Status: StatusFail, Error: "server is shutting down"})
+	}
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+
+	return report
+}
+
+func (h *Checker) run(ctx context.Context, check namedCheck) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, h.checkTimeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := check.fn(ctx)
+	res := CheckResult{
+		Name:      check.name,
+		Status:    StatusOK,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		Details:   details,
+	}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,48 @@
+package health
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresPing - доступность базы
+func PostgresPing(pool *pgxpool.Pool) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		return nil, pool.Ping(ctx)
+	}
+}
+
+// PoolSaturation - заполненность пула соединений; только репортит, не роняет пробу -
+// под нагрузкой пул и должен быть занят, а снимать инстанс из балансировки из-за этого нельзя
+func PoolSaturation(pool *pgxpool.Pool) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		stat := pool.Stat()
+		saturation := 0.0
+		if stat.MaxConns() > 0 {
+			saturation = float64(stat.AcquiredConns()) / float64(stat.MaxConns())
+		}
+		return map[string]any{
+			"acquired_conns": stat.AcquiredConns(),
+			"idle_conns":     stat.IdleConns(),
+			"max_conns":      stat.MaxConns(),
+			"saturation":     saturation,
+		}, nil
+	}
+}
+
+// MigrationsVersion - схема в базе на той версии, которую ожидает бинарник
+func MigrationsVersion(current func(ctx context.Context) (int, error), expected int) CheckFunc {
+	return func(ctx context.Context) (map[string]any, error) {
+		version, err := current(ctx)
+		if err != nil {
+			return nil, err
+		}
+		details := map[string]any{"version": version, "expected": expected}
+		if version != expected {
+			return details, fmt.Errorf("schema version is %d, expected %d", version, expected)
+		}
+		return details, nil
+	}
+}
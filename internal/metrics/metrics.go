@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ewallet"
+
+// причины неуспешного перевода - значения лейбла reason у ewallet_transfers_total,
+// набор фиксированный, чтобы не раздувать кардинальность
+const (
+	ReasonNone                = ""
+	ReasonValidation          = "validation"
+	ReasonWalletNotFound      = "wallet_not_found"
+	ReasonTargetWalletMissing = "target_wallet_not_found"
+	ReasonNotEnoughBalance    = "not_enough_balance"
+	ReasonWalletFrozen        = "wallet_frozen"
+	ReasonPocketRestricted    = "pocket_restricted"
+	ReasonFraudReview         = "fraud_review"
+	ReasonFraudBlocked        = "fraud_blocked"
+	ReasonInternal            = "internal"
+)
+
+// Metrics - все метрики приложения, зарегистрированные в отдельном (не глобальном) реестре.
+//
+// HTTP:
+//   - ewallet_http_request_duration_seconds{method, route, status} - histogram, route - шаблон пути из роутера (/api/v1/wallet/:walletId), а не сам URI
+//
+// Бизнес-метрики:
+//   - ewallet_wallets_created_total - counter
+//   - ewallet_transfers_total{result, reason} - counter, result: success|failed, reason - см. константы Reason*
+//   - ewallet_transferred_amount_total - counter, суммарный объем успешных переводов
+//   - ewallet_transfer_duration_seconds{result} - histogram, время выполнения перевода в сервисном слое
+//
+// Пул соединений postgres (см. PoolCollector):
+//   - ewallet_pgxpool_* - gauges/counters из pgxpool.Stat
+//
+// Рантайм: стандартные go_* и process_* метрики.
+//
+// Идентификаторы кошельков в лейблы не попадают никогда.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequestDuration *prometheus.HistogramVec
+
+	walletsCreated    prometheus.Counter
+	transfers         *prometheus.CounterVec
+	transferredAmount prometheus.Counter
+	transferDuration  *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "HTTP request latency by route template, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		walletsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "wallets_created_total",
+			Help:      "Number of wallets created.",
+		}),
+		transfers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transfers_total",
+			Help:      "Number of transfers by result and failure reason.",
+		}, []string{"result", "reason"}),
+		transferredAmount: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transferred_amount_total",
+			Help:      "Total amount moved by successful transfers.",
+		}),
+		transferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "transfer_duration_seconds",
+			Help:      "Transfer latency in the service layer by result.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequestDuration,
+		m.walletsCreated,
+		m.transfers,
+		m.transferredAmount,
+		m.transferDuration,
+	)
+
+	return m
+}
+
+// Register - регистрация дополнительных коллекторов (например, PoolCollector)
+func (m *Metrics) Register(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// Handler - http-хендлер для /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// методы записи ниже безопасно вызывать на nil *Metrics - тогда метрики просто не пишутся
+
+func (m *Metrics) ObserveHTTPRequest(method, route, status string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpRequestDuration.WithLabelValues(method, route, status).Observe(duration.Seconds())
+}
+
+func (m *Metrics) WalletCreated() {
+	if m == nil {
+		return
+	}
+	m.walletsCreated.Inc()
+}
+
+func (m *Metrics) TransferSucceeded(amount float32, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.transfers.WithLabelValues("success", ReasonNone).Inc()
+	m.transferredAmount.Add(float64(amount))
+	m.transferDuration.WithLabelValues("success").Observe(duration.Seconds())
+}
+
+func (m *Metrics) TransferFailed(reason string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.transfers.WithLabelValues("failed", reason).Inc()
+	m.transferDuration.WithLabelValues("failed").Observe(duration.Seconds())
+}
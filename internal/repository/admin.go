@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+type adminRepoImpl struct {
+	db     *postgres.Postgres
+	log    *logrus.Logger
+	credit *creditRepoImpl
+}
+
+func NewAdminRepo(db *postgres.Postgres, log *logrus.Logger) *adminRepoImpl {
+	return &adminRepoImpl{
+		db:     db,
+		log:    log,
+		credit: NewCreditRepo(db, log),
+	}
+}
+
+// корректировка баланса: положительная сумма - зачисление, отрицательная - списание.
+// Изменение баланса и запись в transactions - в одной транзакции
+func (ar *adminRepoImpl) AdjustBalance(ctx context.Context, walletId uuid.UUID, amount float32) (err error) {
+	ctx, span := startSpan(ctx, "AdjustBalance")
+	defer func() { endSpan(span, err) }()
+
+	updateSql, updateArgs, err := ar.db.Builder.
+		Update("wallets").
+		Set("balance", squirrel.Expr("balance + ?", amount)).
+		Where("id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.AdjustBalance - db.Builder")
+		return err
+	}
+
+	// вторая сторона корректировки - NULL
+	var from, to any = nil, walletId
+	if amount < 0 {
+		from, to = walletId, nil
+		amount = -amount
+	}
+	insertSql, insertArgs, err := ar.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount").
+		Values(time.Now().UTC(), from, to, amount).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.AdjustBalance - db.Builder")
+		return err
+	}
+
+	err = withinTx(ctx, ar.db, func(ctx context.Context, tx pgx.Tx) error {
+		qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", updateSql)
+		tag, err := tx.Exec(qctx, updateSql, updateArgs...)
+		endSpan(qspan, err)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repoerrors.ErrWalletNotFound
+		}
+
+		qctx, qspan = startQuerySpan(ctx, "INSERT transactions", insertSql)
+		_, err = tx.Exec(qctx, insertSql, insertArgs...)
+		endSpan(qspan, err)
+		return err
+	})
+	if isCheckViolation(err) {
+		return repoerrors.ErrNotEnoughBalance
+	}
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return err
+	}
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.AdjustBalance - tx")
+		return err
+	}
+
+	return nil
+}
+
+func (ar *adminRepoImpl) SetFrozen(ctx context.Context, walletId uuid.UUID, frozen bool) (err error) {
+	ctx, span := startSpan(ctx, "SetFrozen")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ar.db.Builder.
+		Update("wallets").
+		Set("frozen", frozen).
+		Where("id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SetFrozen - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+	tag, err := conn(ctx, ar.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SetFrozen - db.ConnPool.Exec")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repoerrors.ErrWalletNotFound
+	}
+
+	return nil
+}
+
+// VerifyAlias - подтверждает действующий псевдоним кошелька вида kind; повторное подтверждение ничего не меняет
+func (ar *adminRepoImpl) VerifyAlias(ctx context.Context, walletId uuid.UUID, kind string) (_ entity.WalletAlias, err error) {
+	ctx, span := startSpan(ctx, "VerifyAlias")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ar.db.Builder.
+		Update("wallet_aliases").
+		Set("verified_at", squirrel.Expr("COALESCE(verified_at, ?)", time.Now().UTC())).
+		Where("wallet_id = ? AND kind = ? AND removed_at IS NULL", walletId, kind).
+		Suffix("RETURNING " + strings.Join(aliasColumns, ", ")).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.VerifyAlias - db.Builder")
+		return entity.WalletAlias{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallet_aliases", sql)
+	a, err := scanAlias(conn(ctx, ar.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.WalletAlias{}, repoerrors.ErrAliasNotFound
+	}
+	// тот же email или телефон уже подтвержден за другим кошельком
+	if isUniqueViolation(err, "wallet_aliases_value_key") {
+		return entity.WalletAlias{}, repoerrors.ErrAliasTaken
+	}
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.VerifyAlias - QueryRow")
+		return entity.WalletAlias{}, err
+	}
+
+	return a, nil
+}
+
+// SetCreditLine - лимит кошелька и условия кредитной линии; новая линия начисляет за дни после line.AccruedThrough,
+// у существующей меняются только лимит и условия - они действуют для еще не начисленных дней
+func (ar *adminRepoImpl) SetCreditLine(ctx context.Context, line entity.CreditLine) (_ entity.CreditLine, err error) {
+	ctx, span := startSpan(ctx, "SetCreditLine")
+	defer func() { endSpan(span, err) }()
+
+	rate, err := numeric(line.AnnualRate)
+	if err != nil {
+		return entity.CreditLine{}, err
+	}
+	now := time.Now().UTC()
+
+	updateSql, updateArgs, err := ar.db.Builder.
+		Update("wallets").
+		Set("credit_limit", line.CreditLimit).
+		Where("id = ?", line.WalletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SetCreditLine - db.Builder")
+		return entity.CreditLine{}, err
+	}
+	insertSql, insertArgs, err := ar.db.Builder.
+		Insert("credit_lines").
+		Columns("wallet_id", "annual_rate", "day_count", "daily_fee", "accrued_through", "created_at", "updated_at").
+		Values(line.WalletId, rate, line.DayCount, line.DailyFee, line.AccruedThrough, now, now).
+		Suffix(`ON CONFLICT (wallet_id) DO UPDATE SET
+			annual_rate = EXCLUDED.annual_rate,
+			day_count = EXCLUDED.day_count,
+			daily_fee = EXCLUDED.daily_fee,
+			updated_at = EXCLUDED.updated_at`).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SetCreditLine - db.Builder")
+		return entity.CreditLine{}, err
+	}
+
+	err = withinTx(ctx, ar.db, func(ctx context.Context, tx pgx.Tx) error {
+		qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", updateSql)
+		tag, err := tx.Exec(qctx, updateSql, updateArgs...)
+		endSpan(qspan, err)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return repoerrors.ErrWalletNotFound
+		}
+
+		qctx, qspan = startQuerySpan(ctx, "INSERT credit_lines", insertSql)
+		_, err = tx.Exec(qctx, insertSql, insertArgs...)
+		endSpan(qspan, err)
+		if err != nil {
+			return err
+		}
+
+		line, err = ar.credit.getCreditLine(ctx, line.WalletId)
+		return err
+	})
+	// balance >= -credit_limit: задолженность уже больше нового лимита
+	if isCheckViolation(err) {
+		return entity.CreditLine{}, repoerrors.ErrCreditLimitBelowDebt
+	}
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.CreditLine{}, err
+	}
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SetCreditLine - tx")
+		return entity.CreditLine{}, err
+	}
+
+	return line, nil
+}
+
+func (ar *adminRepoImpl) SaveAuditRecord(ctx context.Context, record entity.AuditRecord) (err error) {
+	ctx, span := startSpan(ctx, "SaveAuditRecord")
+	defer func() { endSpan(span, err) }()
+
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SaveAuditRecord - json.Marshal")
+		return err
+	}
+	// аудит может относиться к несуществующему кошельку (неудачная попытка) - тогда без ссылки
+	var walletId any
+	if record.WalletId != uuid.Nil {
+		walletId = record.WalletId
+	}
+
+	sql, args, err := ar.db.Builder.
+		Insert("admin_audit_log").
+		Columns("made_at", "actor", "action", "wallet_id", "details", "reason", "outcome").
+		Values(record.Time, record.Actor, record.Action, walletId, details, record.Reason, record.Outcome).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SaveAuditRecord - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT admin_audit_log", sql)
+	_, err = conn(ctx, ar.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.SaveAuditRecord - db.ConnPool.Exec")
+		return err
+	}
+
+	return nil
+}
+
+// сверка: баланс каждого кошелька должен быть равен начальному балансу плюс входящие минус исходящие транзакции
+func (ar *adminRepoImpl) Reconcile(ctx context.Context) (_ []entity.ReconciliationMismatch, err error) {
+	ctx, span := startSpan(ctx, "Reconcile")
+	defer func() { endSpan(span, err) }()
+
+	incoming := ar.db.Builder.
+		Select("transfered_to AS id", "SUM(amount) AS total").
+		From("transactions").
+		Where("transfered_to IS NOT NULL").
+		GroupBy("transfered_to")
+	outgoing := ar.db.Builder.
+		Select("transfered_from AS id", "SUM(amount) AS total").
+		From("transactions").
+		Where("transfered_from IS NOT NULL").
+		GroupBy("transfered_from")
+	expected := squirrel.Expr("? + COALESCE(i.total, 0) - COALESCE(o.total, 0)", InitialWalletBalance)
+
+	sql, args, err := ar.db.Builder.
+		Select("w.id", "w.balance").
+		Column(squirrel.Alias(expected, "expected")).
+		From("wallets w").
+		JoinClause(incoming.Prefix("LEFT JOIN (").Suffix(") i ON i.id = w.id")).
+		JoinClause(outgoing.Prefix("LEFT JOIN (").Suffix(") o ON o.id = w.id")).
+		Where(squirrel.Expr("w.balance <> ? + COALESCE(i.total, 0) - COALESCE(o.total, 0)", InitialWalletBalance)).
+		OrderBy("w.id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.Reconcile - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT reconciliation", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ar.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.Reconcile - db.ConnPool.Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mismatches []entity.ReconciliationMismatch
+	for rows.Next() {
+		var m entity.ReconciliationMismatch
+		if err := rows.Scan(&m.WalletId, &m.Balance, &m.Expected); err != nil {
+			logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.Reconcile - rows.Scan")
+			return nil, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("adminRepoImpl.Reconcile - rows.Err")
+		return nil, err
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,250 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var aliasColumns = []string{"id", "wallet_id", "kind", "value", "created_at", "verified_at", "removed_at"}
+
+type aliasRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewAliasRepo(db *postgres.Postgres, log *logrus.Logger) *aliasRepoImpl {
+	return &aliasRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+func (ar *aliasRepoImpl) SetAlias(ctx context.Context, a entity.WalletAlias) (_ entity.WalletAlias, err error) {
+	ctx, span := startSpan(ctx, "SetAlias")
+	defer func() { endSpan(span, err) }()
+
+	err = withinTx(ctx, ar.db, func(ctx context.Context, tx pgx.Tx) error {
+		// блокировка кошелька упорядочивает одновременные смены псевдонимов одного кошелька
+		_, err := ar.wallets.getWallet(ctx, tx, a.WalletId, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		current, err := ar.activeAlias(ctx, tx, a.WalletId, a.Kind)
+		if err == nil && current.Value == a.Value {
+			a = current
+			return nil
+		}
+		if err == nil {
+			if err := ar.removeAlias(ctx, tx, current.Id, time.Now().UTC()); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		a.Id, err = uuid.NewRandom()
+		if err != nil {
+			logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.SetAlias - uuid.NewRandom")
+			return err
+		}
+		a.CreatedAt = time.Now().UTC()
+		a.RemovedAt = nil
+		a.VerifiedAt = nil
+		if a.Verified {
+			a.VerifiedAt = &a.CreatedAt
+		}
+
+		sql, args, err := ar.db.Builder.
+			Insert("wallet_aliases").
+			Columns("id", "wallet_id", "kind", "value", "created_at", "verified_at").
+			Values(a.Id, a.WalletId, a.Kind, a.Value, a.CreatedAt, a.VerifiedAt).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.SetAlias - db.Builder")
+			return err
+		}
+
+		qctx, qspan := startQuerySpan(ctx, "INSERT wallet_aliases", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if isUniqueViolation(err, "wallet_aliases_value_key") {
+			return repoerrors.ErrAliasTaken
+		}
+		if err != nil {
+			logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.SetAlias - tx.Exec")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.WalletAlias{}, err
+	}
+
+	return a, nil
+}
+
+func (ar *aliasRepoImpl) RemoveAlias(ctx context.Context, walletId uuid.UUID, kind string) (err error) {
+	ctx, span := startSpan(ctx, "RemoveAlias")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ar.db.Builder.
+		Update("wallet_aliases").
+		Set("removed_at", time.Now().UTC()).
+		Where("wallet_id = ? AND kind = ? AND removed_at IS NULL", walletId, kind).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.RemoveAlias - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallet_aliases", sql)
+	tag, err := conn(ctx, ar.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.RemoveAlias - Exec")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repoerrors.ErrAliasNotFound
+	}
+
+	return nil
+}
+
+func (ar *aliasRepoImpl) ListAliases(ctx context.Context, walletId uuid.UUID, withRemoved bool) (_ []entity.WalletAlias, err error) {
+	ctx, span := startSpan(ctx, "ListAliases")
+	defer func() { endSpan(span, err) }()
+
+	builder := ar.db.Builder.
+		Select(aliasColumns...).
+		From("wallet_aliases").
+		Where("wallet_id = ?", walletId).
+		OrderBy("created_at", "id")
+	if !withRemoved {
+		builder = builder.Where("removed_at IS NULL")
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.ListAliases - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallet_aliases", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ar.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.ListAliases - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var aliases []entity.WalletAlias
+	for rows.Next() {
+		a, err := scanAlias(rows)
+		if err != nil {
+			logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.ListAliases - rows.Scan")
+			return nil, err
+		}
+		aliases = append(aliases, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.ListAliases - rows.Err")
+		return nil, err
+	}
+
+	return aliases, nil
+}
+
+func (ar *aliasRepoImpl) FindAlias(ctx context.Context, kind, value string) (_ entity.WalletAlias, err error) {
+	ctx, span := startSpan(ctx, "FindAlias")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ar.db.Builder.
+		Select(aliasColumns...).
+		From("wallet_aliases").
+		Where("kind = ? AND value = ?", kind, value).
+		Where("removed_at IS NULL AND verified_at IS NOT NULL").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.FindAlias - db.Builder")
+		return entity.WalletAlias{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallet_aliases", sql)
+	a, err := scanAlias(conn(ctx, ar.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.WalletAlias{}, repoerrors.ErrAliasNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.FindAlias - QueryRow")
+		return entity.WalletAlias{}, err
+	}
+
+	return a, nil
+}
+
+// действующий псевдоним кошелька вида kind, заблокированный до конца транзакции
+func (ar *aliasRepoImpl) activeAlias(ctx context.Context, q querier, walletId uuid.UUID, kind string) (entity.WalletAlias, error) {
+	sql, args, err := ar.db.Builder.
+		Select(aliasColumns...).
+		From("wallet_aliases").
+		Where("wallet_id = ? AND kind = ? AND removed_at IS NULL", walletId, kind).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.activeAlias - db.Builder")
+		return entity.WalletAlias{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallet_aliases", sql)
+	a, err := scanAlias(q.QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.activeAlias - QueryRow")
+	}
+	return a, err
+}
+
+func (ar *aliasRepoImpl) removeAlias(ctx context.Context, q querier, id uuid.UUID, at time.Time) error {
+	sql, args, err := ar.db.Builder.
+		Update("wallet_aliases").
+		Set("removed_at", at).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.removeAlias - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallet_aliases", sql)
+	_, err = q.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ar.log).WithError(err).Error("aliasRepoImpl.removeAlias - Exec")
+		return err
+	}
+	return nil
+}
+
+func scanAlias(row pgx.Row) (entity.WalletAlias, error) {
+	var a entity.WalletAlias
+	err := row.Scan(&a.Id, &a.WalletId, &a.Kind, &a.Value, &a.CreatedAt, &a.VerifiedAt, &a.RemovedAt)
+	a.Verified = a.VerifiedAt != nil
+	return a, err
+}
@@ -0,0 +1,453 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+// причина отказа строки, которая сама по себе исполнима, но пакет all_or_nothing отклонен из-за других строк
+const batchRejectedReason = "batch rejected: another line failed"
+
+var batchTransferColumns = []string{"id", "transfer_from", "mode", "status", "failure_reason", "created_at", "completed_at"}
+
+type batchTransferRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewBatchTransferRepo(db *postgres.Postgres, log *logrus.Logger) *batchTransferRepoImpl {
+	return &batchTransferRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+func (br *batchTransferRepoImpl) CreateBatchTransfer(ctx context.Context, bt entity.BatchTransfer) (_ entity.BatchTransfer, err error) {
+	ctx, span := startSpan(ctx, "CreateBatchTransfer")
+	defer func() { endSpan(span, err) }()
+
+	bt.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.CreateBatchTransfer - uuid.NewRandom")
+		return entity.BatchTransfer{}, err
+	}
+	bt.Status = entity.BatchTransferPending
+	bt.CreatedAt = time.Now().UTC()
+
+	err = withinTx(ctx, br.db, func(ctx context.Context, tx pgx.Tx) error {
+		sql, args, err := br.db.Builder.
+			Insert("batch_transfers").
+			Columns("id", "transfer_from", "mode", "status", "created_at").
+			Values(bt.Id, bt.From, bt.Mode, bt.Status, bt.CreatedAt).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.CreateBatchTransfer - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "INSERT batch_transfers", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if isForeignKeyViolation(err, "batch_transfers_transfer_from_fkey") {
+			return repoerrors.ErrWalletNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.CreateBatchTransfer - Exec")
+			return err
+		}
+
+		builder := br.db.Builder.
+			Insert("batch_transfer_lines").
+			Columns("batch_id", "line_no", "transfer_to", "amount", "status")
+		for i := range bt.Lines {
+			bt.Lines[i].Line = i
+			bt.Lines[i].Status = entity.BatchLinePending
+			builder = builder.Values(bt.Id, i, bt.Lines[i].To, bt.Lines[i].Amount, bt.Lines[i].Status)
+		}
+		sql, args, err = builder.ToSql()
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.CreateBatchTransfer - db.Builder")
+			return err
+		}
+		qctx, qspan = startQuerySpan(ctx, "INSERT batch_transfer_lines", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.CreateBatchTransfer - Exec")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.BatchTransfer{}, err
+	}
+
+	return bt, nil
+}
+
+func (br *batchTransferRepoImpl) GetBatchTransfer(ctx context.Context, walletId, id uuid.UUID) (_ entity.BatchTransfer, err error) {
+	ctx, span := startSpan(ctx, "GetBatchTransfer")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := br.db.Builder.
+		Select(batchTransferColumns...).
+		From("batch_transfers").
+		Where(squirrel.Eq{"id": id, "transfer_from": walletId}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.GetBatchTransfer - db.Builder")
+		return entity.BatchTransfer{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT batch_transfers", sql)
+	bt, err := scanBatchTransfer(conn(ctx, br.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.BatchTransfer{}, repoerrors.ErrBatchTransferNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.GetBatchTransfer - QueryRow")
+		return entity.BatchTransfer{}, err
+	}
+
+	bt.Lines, err = br.getLines(ctx, bt.Id)
+	if err != nil {
+		return entity.BatchTransfer{}, err
+	}
+	return bt, nil
+}
+
+func (br *batchTransferRepoImpl) ClaimPendingBatchTransfer(ctx context.Context) (_ entity.BatchTransfer, err error) {
+	ctx, span := startSpan(ctx, "ClaimPendingBatchTransfer")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := br.db.Builder.
+		Select(batchTransferColumns...).
+		From("batch_transfers").
+		Where("status = ?", entity.BatchTransferPending).
+		OrderBy("created_at").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.ClaimPendingBatchTransfer - db.Builder")
+		return entity.BatchTransfer{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT batch_transfers", sql)
+	bt, err := scanBatchTransfer(conn(ctx, br.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.BatchTransfer{}, repoerrors.ErrNoPendingBatchTransfers
+	}
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.ClaimPendingBatchTransfer - QueryRow")
+		return entity.BatchTransfer{}, err
+	}
+
+	bt.Lines, err = br.getLines(ctx, bt.Id)
+	if err != nil {
+		return entity.BatchTransfer{}, err
+	}
+	return bt, nil
+}
+
+func (br *batchTransferRepoImpl) getLines(ctx context.Context, batchId uuid.UUID) (_ []entity.BatchTransferLine, err error) {
+	sql, args, err := br.db.Builder.
+		Select("line_no", "transfer_to", "amount", "status", "error").
+		From("batch_transfer_lines").
+		Where("batch_id = ?", batchId).
+		OrderBy("line_no").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.getLines - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT batch_transfer_lines", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, br.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.getLines - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []entity.BatchTransferLine
+	for rows.Next() {
+		var line entity.BatchTransferLine
+		if err := rows.Scan(&line.Line, &line.To, &line.Amount, &line.Status, &line.Error); err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.getLines - rows.Scan")
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.getLines - rows.Err")
+		return nil, err
+	}
+
+	return lines, nil
+}
+
+func (br *batchTransferRepoImpl) ExecuteBatchTransfer(ctx context.Context, bt entity.BatchTransfer) (_ entity.BatchTransfer, err error) {
+	ctx, span := startSpan(ctx, "ExecuteBatchTransfer")
+	defer func() { endSpan(span, err) }()
+
+	err = withinTx(ctx, br.db, func(ctx context.Context, tx pgx.Tx) error {
+		ids := make([]uuid.UUID, 0, len(bt.Lines)+1)
+		ids = append(ids, bt.From)
+		for _, line := range bt.Lines {
+			ids = append(ids, line.To)
+		}
+		wallets, err := br.lockWallets(ctx, tx, ids)
+		if err != nil {
+			return err
+		}
+
+		credits := applyBatch(&bt, wallets)
+		if bt.Status == entity.BatchTransferCompleted {
+			if err := br.moveFunds(ctx, tx, bt, credits); err != nil {
+				return err
+			}
+		}
+		return br.saveResult(ctx, tx, bt)
+	})
+	if err != nil {
+		return entity.BatchTransfer{}, err
+	}
+
+	return bt, nil
+}
+
+// блокирует кошельки одним запросом в порядке id - тот же порядок, что и у обычного перевода (lockOrder)
+func (br *batchTransferRepoImpl) lockWallets(ctx context.Context, tx pgx.Tx, ids []uuid.UUID) (map[uuid.UUID]entity.Wallet, error) {
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+
+	sql, args, err := br.db.Builder.
+		Select("id", "balance", "frozen", "credit_limit").
+		From("wallets").
+		Where(squirrel.Eq{"id": ids}).
+		OrderBy("id").
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.lockWallets - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+	rows, err := tx.Query(qctx, sql, args...)
+	if err != nil {
+		endSpan(qspan, err)
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.lockWallets - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := make(map[uuid.UUID]entity.Wallet, len(ids))
+	for rows.Next() {
+		var wallet entity.Wallet
+		if err := rows.Scan(&wallet.Id, &wallet.Balance, &wallet.Frozen, &wallet.CreditLimit); err != nil {
+			endSpan(qspan, err)
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.lockWallets - rows.Scan")
+			return nil, err
+		}
+		wallets[wallet.Id] = wallet
+	}
+	err = rows.Err()
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.lockWallets - rows.Err")
+		return nil, err
+	}
+
+	return wallets, nil
+}
+
+// applyBatch - проставляет результат каждой строки и статус пакета, возвращает суммы зачислений по получателям в тысячных.
+// Строки проверяются по порядку: строка, на которую уже не хватает баланса с учетом кредитного лимита, отклоняется, следующие - нет;
+// строка, отклоненная до исполнения, остается отклоненной.
+// Баланс и суммы считаются в тысячных, как хранятся: на тысячах строк float32 накопил бы ошибку
+func applyBatch(bt *entity.BatchTransfer, wallets map[uuid.UUID]entity.Wallet) map[uuid.UUID]int64 {
+	now := time.Now().UTC()
+	bt.CompletedAt = &now
+
+	from, ok := wallets[bt.From]
+	switch {
+	case !ok:
+		failBatch(bt, repoerrors.ErrWalletNotFound.Error())
+		return nil
+	case from.Frozen:
+		failBatch(bt, repoerrors.ErrWalletFrozen.Error())
+		return nil
+	}
+
+	available := units(from.Balance) + units(from.CreditLimit)
+	credits := make(map[uuid.UUID]int64)
+	failed := false
+	for i := range bt.Lines {
+		line := &bt.Lines[i]
+		to, ok := wallets[line.To]
+		switch {
+		case line.Status == entity.BatchLineFailed:
+			// строку отклонили еще до исполнения (антифрод-правила)
+		case !ok:
+			line.Status, line.Error = entity.BatchLineFailed, repoerrors.ErrTargetWalletNotFound.Error()
+		case to.Frozen:
+			line.Status, line.Error = entity.BatchLineFailed, repoerrors.ErrTargetWalletFrozen.Error()
+		case available < units(line.Amount):
+			line.Status, line.Error = entity.BatchLineFailed, repoerrors.ErrNotEnoughBalance.Error()
+		default:
+			line.Status, line.Error = entity.BatchLineSucceeded, ""
+			available -= units(line.Amount)
+			credits[line.To] += units(line.Amount)
+			continue
+		}
+		failed = true
+	}
+
+	if failed && bt.Mode == entity.BatchModeAllOrNothing {
+		bt.Status = entity.BatchTransferFailed
+		bt.FailureReason = batchRejectedReason
+		for i := range bt.Lines {
+			if bt.Lines[i].Status == entity.BatchLineSucceeded {
+				bt.Lines[i].Status, bt.Lines[i].Error = entity.BatchLineFailed, batchRejectedReason
+			}
+		}
+		return nil
+	}
+
+	bt.Status = entity.BatchTransferCompleted
+	return credits
+}
+
+func failBatch(bt *entity.BatchTransfer, reason string) {
+	bt.Status = entity.BatchTransferFailed
+	bt.FailureReason = reason
+	for i := range bt.Lines {
+		bt.Lines[i].Status, bt.Lines[i].Error = entity.BatchLineFailed, reason
+	}
+}
+
+// одно списание, по одному зачислению на получателя и транзакция на каждую успешную строку;
+// правило округления отправителя к пакету не применяется
+func (br *batchTransferRepoImpl) moveFunds(ctx context.Context, tx pgx.Tx, bt entity.BatchTransfer, credits map[uuid.UUID]int64) error {
+	if len(credits) == 0 {
+		return nil
+	}
+
+	var total int64
+	for _, amount := range credits {
+		total += amount
+	}
+	deltas := make(map[uuid.UUID]int64, len(credits)+1)
+	for id, amount := range credits {
+		deltas[id] = amount
+	}
+	deltas[bt.From] -= total
+
+	// изменения балансов - точными NUMERIC в тысячных, без float32
+	for id, delta := range deltas {
+		sql, args, err := br.db.Builder.
+			Update("wallets").
+			Set("balance", squirrel.Expr("balance + ?", unitsNumeric(delta))).
+			Where("id = ?", id).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.moveFunds - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.moveFunds - Exec")
+			return err
+		}
+	}
+
+	txTime := time.Now().UTC()
+	builder := br.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id")
+	for _, line := range bt.Lines {
+		if line.Status == entity.BatchLineSucceeded {
+			builder = builder.Values(txTime, bt.From, line.To, line.Amount, entity.TransferSourceBatchTransfer, bt.Id)
+		}
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.moveFunds - db.Builder")
+		return err
+	}
+	qctx, qspan := startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.moveFunds - Exec")
+		return err
+	}
+
+	return nil
+}
+
+// результаты строк отправляются одним pgx.Batch - тысячи строк не превращаются в тысячи round-trip'ов
+func (br *batchTransferRepoImpl) saveResult(ctx context.Context, tx pgx.Tx, bt entity.BatchTransfer) error {
+	batch := &pgx.Batch{}
+	for _, line := range bt.Lines {
+		sql, args, err := br.db.Builder.
+			Update("batch_transfer_lines").
+			Set("status", line.Status).
+			Set("error", line.Error).
+			Where(squirrel.Eq{"batch_id": bt.Id, "line_no": line.Line}).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.saveResult - db.Builder")
+			return err
+		}
+		batch.Queue(sql, args...)
+	}
+
+	sql, args, err := br.db.Builder.
+		Update("batch_transfers").
+		Set("status", bt.Status).
+		Set("failure_reason", bt.FailureReason).
+		Set("completed_at", bt.CompletedAt).
+		Where("id = ?", bt.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.saveResult - db.Builder")
+		return err
+	}
+	batch.Queue(sql, args...)
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE batch_transfer_lines", sql)
+	err = tx.SendBatch(qctx, batch).Close()
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, br.log).WithError(err).Error("batchTransferRepoImpl.saveResult - SendBatch")
+		return err
+	}
+
+	return nil
+}
+
+func scanBatchTransfer(row pgx.Row) (entity.BatchTransfer, error) {
+	var bt entity.BatchTransfer
+	err := row.Scan(&bt.Id, &bt.From, &bt.Mode, &bt.Status, &bt.FailureReason, &bt.CreatedAt, &bt.CompletedAt)
+	return bt, err
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+)
+
+// 10000 строк по 0.001 списывают баланс 10 ровно до нуля; во float32 сумма разошлась бы с балансом
+func TestApplyBatchSumsInUnits(t *testing.T) {
+	const lines = 10000
+	from, a, b := uuid.New(), uuid.New(), uuid.New()
+	wallets := map[uuid.UUID]entity.Wallet{
+		from: {Id: from, Balance: 10},
+		a:    {Id: a},
+		b:    {Id: b},
+	}
+
+	bt := entity.BatchTransfer{From: from, Mode: entity.BatchModeBestEffort}
+	for i := 0; i < lines; i++ {
+		to := a
+		if i%2 == 1 {
+			to = b
+		}
+		bt.Lines = append(bt.Lines, entity.BatchTransferLine{Line: i + 1, To: to, Amount: 0.001})
+	}
+	// на эту строку баланса уже не хватает
+	bt.Lines = append(bt.Lines, entity.BatchTransferLine{Line: lines + 1, To: a, Amount: 0.001})
+
+	credits := applyBatch(&bt, wallets)
+	if bt.Status != entity.BatchTransferCompleted {
+		t.Fatalf("status = %s, want %s", bt.Status, entity.BatchTransferCompleted)
+	}
+	for i, line := range bt.Lines[:lines] {
+		if line.Status != entity.BatchLineSucceeded {
+			t.Fatalf("lines[%d] = %s (%s), want %s", i, line.Status, line.Error, entity.BatchLineSucceeded)
+		}
+	}
+	if last := bt.Lines[lines]; last.Status != entity.BatchLineFailed {
+		t.Errorf("last line = %s, want %s", last.Status, entity.BatchLineFailed)
+	}
+	if credits[a] != lines/2 || credits[b] != lines/2 {
+		t.Errorf("credits = %v, want %d units each", credits, lines/2)
+	}
+}
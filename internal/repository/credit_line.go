@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+// линия вместе с лимитом и балансом кошелька
+var creditLineColumns = []string{
+	"c.wallet_id", "w.credit_limit", "w.balance", "c.annual_rate", "c.day_count", "c.daily_fee", "c.accrued_through",
+	"c.pending", "c.charge_due", "c.retry_at", "c.alert_threshold", "c.created_at", "c.updated_at",
+}
+
+var creditAccrualColumns = []string{"wallet_id", "accrual_date", "balance", "annual_rate", "day_count", "interest", "fee", "charge_id", "created_at"}
+
+type creditRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+	// остаток на конец дня считается так же, как для процентов
+	interest *interestRepoImpl
+}
+
+func NewCreditRepo(db *postgres.Postgres, log *logrus.Logger) *creditRepoImpl {
+	return &creditRepoImpl{
+		db:       db,
+		log:      log,
+		interest: NewInterestRepo(db, log),
+	}
+}
+
+func (cr *creditRepoImpl) GetCreditLine(ctx context.Context, walletId uuid.UUID) (_ entity.CreditLine, err error) {
+	ctx, span := startSpan(ctx, "GetCreditLine")
+	defer func() { endSpan(span, err) }()
+
+	return cr.getCreditLine(ctx, walletId)
+}
+
+// ListCreditAccruals - начисления по возрастанию даты
+func (cr *creditRepoImpl) ListCreditAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) (_ []entity.CreditAccrual, err error) {
+	ctx, span := startSpan(ctx, "ListCreditAccruals")
+	defer func() { endSpan(span, err) }()
+
+	builder := cr.db.Builder.
+		Select(creditAccrualColumns...).
+		From("credit_accruals").
+		Where("wallet_id = ?", walletId).
+		OrderBy("accrual_date")
+	if filter.From != nil {
+		builder = builder.Where("accrual_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		builder = builder.Where("accrual_date <= ?", *filter.To)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAccruals - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_accruals", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, cr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAccruals - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accruals []entity.CreditAccrual
+	for rows.Next() {
+		var a entity.CreditAccrual
+		err := rows.Scan(&a.WalletId, &a.Date, &a.Balance, &a.AnnualRate, &a.DayCount, &a.Interest, &a.Fee, &a.ChargeId, &a.CreatedAt)
+		if err != nil {
+			logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAccruals - rows.Scan")
+			return nil, err
+		}
+		accruals = append(accruals, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAccruals - rows.Err")
+		return nil, err
+	}
+
+	return accruals, nil
+}
+
+// ListCreditCharges - списания по возрастанию конца периода
+func (cr *creditRepoImpl) ListCreditCharges(ctx context.Context, walletId uuid.UUID) (_ []entity.CreditCharge, err error) {
+	ctx, span := startSpan(ctx, "ListCreditCharges")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := cr.db.Builder.
+		Select("id", "wallet_id", "period_end", "accrued", "amount", "carry", "charged_at").
+		From("credit_charges").
+		Where("wallet_id = ?", walletId).
+		OrderBy("period_end").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditCharges - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_charges", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, cr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditCharges - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var charges []entity.CreditCharge
+	for rows.Next() {
+		var c entity.CreditCharge
+		if err := rows.Scan(&c.Id, &c.WalletId, &c.PeriodEnd, &c.Accrued, &c.Amount, &c.Carry, &c.ChargedAt); err != nil {
+			logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditCharges - rows.Scan")
+			return nil, err
+		}
+		charges = append(charges, c)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditCharges - rows.Err")
+		return nil, err
+	}
+
+	return charges, nil
+}
+
+// ListCreditAlerts - уведомления от новых к старым
+func (cr *creditRepoImpl) ListCreditAlerts(ctx context.Context, walletId uuid.UUID) (_ []entity.CreditAlert, err error) {
+	ctx, span := startSpan(ctx, "ListCreditAlerts")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := cr.db.Builder.
+		Select("id", "wallet_id", "threshold", "balance", "credit_limit", "created_at").
+		From("credit_alerts").
+		Where("wallet_id = ?", walletId).
+		OrderBy("id DESC").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAlerts - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_alerts", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, cr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAlerts - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []entity.CreditAlert
+	for rows.Next() {
+		var a entity.CreditAlert
+		if err := rows.Scan(&a.Id, &a.WalletId, &a.Threshold, &a.Balance, &a.CreditLimit, &a.CreatedAt); err != nil {
+			logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAlerts - rows.Scan")
+			return nil, err
+		}
+		alerts = append(alerts, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ListCreditAlerts - rows.Err")
+		return nil, err
+	}
+
+	return alerts, nil
+}
+
+// ClaimDueCreditLine - блокирует (FOR UPDATE SKIP LOCKED) одну линию, у которой есть неначисленный день
+// не позже through или несделанное списание; линии с retry_at позже now пропускаются
+func (cr *creditRepoImpl) ClaimDueCreditLine(ctx context.Context, through, now time.Time) (_ entity.CreditLine, err error) {
+	ctx, span := startSpan(ctx, "ClaimDueCreditLine")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := cr.db.Builder.
+		Select(creditLineColumns...).
+		From("credit_lines c").
+		Join("wallets w ON w.id = c.wallet_id").
+		Where("(c.retry_at IS NULL OR c.retry_at <= ?)", now).
+		Where("(c.accrued_through < ?::date OR c.charge_due)", through).
+		OrderBy("c.accrued_through").
+		Limit(1).
+		Suffix("FOR UPDATE OF c SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ClaimDueCreditLine - db.Builder")
+		return entity.CreditLine{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_lines", sql)
+	line, err := scanCreditLine(conn(ctx, cr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.CreditLine{}, repoerrors.ErrNoDueCreditLines
+	}
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ClaimDueCreditLine - QueryRow")
+		return entity.CreditLine{}, err
+	}
+
+	return line, nil
+}
+
+// ClaimCreditAlert - блокирует (FOR UPDATE SKIP LOCKED) одну линию, у которой наибольший достигнутый порог
+// из thresholds (в процентах лимита) отличается от alert_threshold; возвращает линию и достигнутый порог, 0 - ни одного
+func (cr *creditRepoImpl) ClaimCreditAlert(ctx context.Context, thresholds []int) (_ entity.CreditLine, reached int, err error) {
+	ctx, span := startSpan(ctx, "ClaimCreditAlert")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := cr.db.Builder.
+		Select(append(creditLineColumns, "r.reached")...).
+		From("credit_lines c").
+		Join("wallets w ON w.id = c.wallet_id").
+		// задолженность -balance в процентах лимита; при нулевом лимите порогов нет
+		JoinClause(`CROSS JOIN LATERAL (
+			SELECT COALESCE(MAX(t), 0) AS reached FROM unnest(?::int[]) AS t
+			WHERE w.credit_limit > 0 AND -w.balance * 100 >= t * w.credit_limit
+		) r`, thresholds).
+		Where("c.alert_threshold <> r.reached").
+		Limit(1).
+		Suffix("FOR UPDATE OF c SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ClaimCreditAlert - db.Builder")
+		return entity.CreditLine{}, 0, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_lines", sql)
+	line, err := scanCreditLine(conn(ctx, cr.db).QueryRow(qctx, sql, args...), &reached)
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.CreditLine{}, 0, repoerrors.ErrNoCreditAlertsDue
+	}
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.ClaimCreditAlert - QueryRow")
+		return entity.CreditLine{}, 0, err
+	}
+
+	return line, reached, nil
+}
+
+// SaveCreditAlert - сохраняет уведомление и запоминает порог в линии, чтобы не уведомлять о нем повторно
+func (cr *creditRepoImpl) SaveCreditAlert(ctx context.Context, a entity.CreditAlert) (_ entity.CreditAlert, err error) {
+	ctx, span := startSpan(ctx, "SaveCreditAlert")
+	defer func() { endSpan(span, err) }()
+
+	a.CreatedAt = time.Now().UTC()
+	sql, args, err := cr.db.Builder.
+		Insert("credit_alerts").
+		Columns("wallet_id", "threshold", "balance", "credit_limit", "created_at").
+		Values(a.WalletId, a.Threshold, a.Balance, a.CreditLimit, a.CreatedAt).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditAlert - db.Builder")
+		return entity.CreditAlert{}, err
+	}
+
+	err = withinTx(ctx, cr.db, func(ctx context.Context, tx pgx.Tx) error {
+		qctx, qspan := startQuerySpan(ctx, "INSERT credit_alerts", sql)
+		err := tx.QueryRow(qctx, sql, args...).Scan(&a.Id)
+		endSpan(qspan, err)
+		if err != nil {
+			return err
+		}
+		return cr.SetCreditAlertThreshold(ctx, a.WalletId, a.Threshold)
+	})
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditAlert - tx")
+		return entity.CreditAlert{}, err
+	}
+
+	return a, nil
+}
+
+// SetCreditAlertThreshold - запоминает достигнутый порог без уведомления (например, когда задолженность уменьшилась)
+func (cr *creditRepoImpl) SetCreditAlertThreshold(ctx context.Context, walletId uuid.UUID, threshold int) (err error) {
+	ctx, span := startSpan(ctx, "SetCreditAlertThreshold")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := cr.db.Builder.
+		Update("credit_lines").
+		Set("alert_threshold", threshold).
+		Set("updated_at", time.Now().UTC()).
+		Where("wallet_id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SetCreditAlertThreshold - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE credit_lines", sql)
+	_, err = conn(ctx, cr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SetCreditAlertThreshold - Exec")
+		return err
+	}
+
+	return nil
+}
+
+// EndOfDayBalance - баланс кошелька на момент at, восстановленный по транзакциям
+func (cr *creditRepoImpl) EndOfDayBalance(ctx context.Context, walletId uuid.UUID, at time.Time) (float32, error) {
+	return cr.interest.EndOfDayBalance(ctx, walletId, at)
+}
+
+// SaveCreditAccrual - false, если за этот день уже начислено
+func (cr *creditRepoImpl) SaveCreditAccrual(ctx context.Context, a entity.CreditAccrual) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "SaveCreditAccrual")
+	defer func() { endSpan(span, err) }()
+
+	rate, err := numeric(a.AnnualRate)
+	if err != nil {
+		return false, err
+	}
+	interest, err := numeric(a.Interest)
+	if err != nil {
+		return false, err
+	}
+
+	sql, args, err := cr.db.Builder.
+		Insert("credit_accruals").
+		Columns("wallet_id", "accrual_date", "balance", "annual_rate", "day_count", "interest", "fee", "created_at").
+		Values(a.WalletId, a.Date, a.Balance, rate, a.DayCount, interest, a.Fee, time.Now().UTC()).
+		Suffix("ON CONFLICT (wallet_id, accrual_date) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditAccrual - db.Builder")
+		return false, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT credit_accruals", sql)
+	tag, err := conn(ctx, cr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditAccrual - Exec")
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SaveCreditCharge - сохраняет списание и привязывает к нему несписанные начисления по c.PeriodEnd включительно;
+// false, если период уже списан
+func (cr *creditRepoImpl) SaveCreditCharge(ctx context.Context, c entity.CreditCharge) (inserted bool, err error) {
+	ctx, span := startSpan(ctx, "SaveCreditCharge")
+	defer func() { endSpan(span, err) }()
+
+	accrued, err := numeric(c.Accrued)
+	if err != nil {
+		return false, err
+	}
+	carry, err := numeric(c.Carry)
+	if err != nil {
+		return false, err
+	}
+
+	insertSql, insertArgs, err := cr.db.Builder.
+		Insert("credit_charges").
+		Columns("id", "wallet_id", "period_end", "accrued", "amount", "carry", "charged_at").
+		Values(c.Id, c.WalletId, c.PeriodEnd, accrued, c.Amount, carry, c.ChargedAt).
+		Suffix("ON CONFLICT (wallet_id, period_end) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditCharge - db.Builder")
+		return false, err
+	}
+	updateSql, updateArgs, err := cr.db.Builder.
+		Update("credit_accruals").
+		Set("charge_id", c.Id).
+		Where("wallet_id = ? AND charge_id IS NULL AND accrual_date <= ?", c.WalletId, c.PeriodEnd).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditCharge - db.Builder")
+		return false, err
+	}
+
+	err = withinTx(ctx, cr.db, func(ctx context.Context, tx pgx.Tx) error {
+		qctx, qspan := startQuerySpan(ctx, "INSERT credit_charges", insertSql)
+		tag, err := tx.Exec(qctx, insertSql, insertArgs...)
+		endSpan(qspan, err)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		inserted = true
+
+		qctx, qspan = startQuerySpan(ctx, "UPDATE credit_accruals", updateSql)
+		_, err = tx.Exec(qctx, updateSql, updateArgs...)
+		endSpan(qspan, err)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.SaveCreditCharge - tx")
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// UpdateCreditLineProgress - сохраняет accrued_through, pending, charge_due и retry_at
+func (cr *creditRepoImpl) UpdateCreditLineProgress(ctx context.Context, line entity.CreditLine) (err error) {
+	ctx, span := startSpan(ctx, "UpdateCreditLineProgress")
+	defer func() { endSpan(span, err) }()
+
+	pending, err := numeric(line.Pending)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := cr.db.Builder.
+		Update("credit_lines").
+		SetMap(map[string]any{
+			"accrued_through": line.AccruedThrough,
+			"pending":         pending,
+			"charge_due":      line.ChargeDue,
+			"retry_at":        line.RetryAt,
+			"updated_at":      time.Now().UTC(),
+		}).
+		Where("wallet_id = ?", line.WalletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.UpdateCreditLineProgress - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE credit_lines", sql)
+	_, err = conn(ctx, cr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.UpdateCreditLineProgress - Exec")
+		return err
+	}
+
+	return nil
+}
+
+func (cr *creditRepoImpl) getCreditLine(ctx context.Context, walletId uuid.UUID) (entity.CreditLine, error) {
+	sql, args, err := cr.db.Builder.
+		Select(creditLineColumns...).
+		From("credit_lines c").
+		Join("wallets w ON w.id = c.wallet_id").
+		Where("c.wallet_id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.getCreditLine - db.Builder")
+		return entity.CreditLine{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT credit_lines", sql)
+	line, err := scanCreditLine(conn(ctx, cr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.CreditLine{}, repoerrors.ErrCreditLineNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, cr.log).WithError(err).Error("creditRepoImpl.getCreditLine - QueryRow")
+		return entity.CreditLine{}, err
+	}
+	return line, nil
+}
+
+// extra - колонки запроса после creditLineColumns
+func scanCreditLine(row pgx.Row, extra ...any) (entity.CreditLine, error) {
+	var line entity.CreditLine
+	err := row.Scan(append([]any{
+		&line.WalletId, &line.CreditLimit, &line.Balance, &line.AnnualRate, &line.DayCount, &line.DailyFee, &line.AccruedThrough,
+		&line.Pending, &line.ChargeDue, &line.RetryAt, &line.AlertThreshold, &line.CreatedAt, &line.UpdatedAt,
+	}, extra...)...)
+	return line, err
+}
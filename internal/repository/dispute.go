@@ -0,0 +1,538 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var disputeColumns = []string{"id", "transaction_id", "sender", "recipient", "amount", "reason", "status", "deadline", "opened_by", "created_at", "resolved_at"}
+
+// удержанная сумма, как и у сделок с удержанием, не лежит ни на одном кошельке: в transactions удержание
+// пишется с transfered_to = NULL, снятие или возврат - с transfered_from = NULL
+type disputeRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewDisputeRepo(db *postgres.Postgres, log *logrus.Logger) *disputeRepoImpl {
+	return &disputeRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+func (dr *disputeRepoImpl) GetTransaction(ctx context.Context, id int64) (_ entity.Transaction, err error) {
+	ctx, span := startSpan(ctx, "GetTransaction")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := dr.db.Builder.
+		// у корректировок и движений средств сделок одна из сторон NULL - отдаем ее как uuid.Nil
+		Select("id", "made_at", "COALESCE(transfered_from, '"+uuid.Nil.String()+"')", "COALESCE(transfered_to, '"+uuid.Nil.String()+"')", "amount", "source_type", "source_id").
+		From("transactions").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.GetTransaction - db.Builder")
+		return entity.Transaction{}, err
+	}
+
+	var t entity.Transaction
+	var sourceType *string
+	var sourceId *uuid.UUID
+	qctx, qspan := startQuerySpan(ctx, "SELECT transactions", sql)
+	err = conn(ctx, dr.db).QueryRow(qctx, sql, args...).Scan(&t.Id, &t.Time, &t.From, &t.To, &t.Amount, &sourceType, &sourceId)
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Transaction{}, repoerrors.ErrTransactionNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.GetTransaction - QueryRow")
+		return entity.Transaction{}, err
+	}
+	if sourceType != nil && sourceId != nil {
+		t.Source = &entity.TransferSource{Type: *sourceType, Id: *sourceId}
+	}
+
+	return t, nil
+}
+
+func (dr *disputeRepoImpl) CreateDispute(ctx context.Context, d entity.Dispute) (_ entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "CreateDispute")
+	defer func() { endSpan(span, err) }()
+
+	d.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.CreateDispute - uuid.NewRandom")
+		return entity.Dispute{}, err
+	}
+	d.Status = entity.DisputeOpen
+	d.CreatedAt = time.Now().UTC()
+
+	err = withinTx(ctx, dr.db, func(ctx context.Context, tx pgx.Tx) error {
+		// удержание накладывает оператор, поэтому заморозка получателя ему не мешает; удерживается только то,
+		// что есть на балансе - кредитная линия на спор не расходуется
+		recipient, err := dr.wallets.getWallet(ctx, tx, d.Recipient, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrWalletNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.CreateDispute - getWallet")
+			return err
+		}
+		if units(recipient.Balance) < units(d.Amount) {
+			return repoerrors.ErrNotEnoughBalance
+		}
+		if err := dr.wallets.updateWallet(ctx, tx, recipient.Id, recipient.Balance-d.Amount); err != nil {
+			return err
+		}
+
+		sql, args, err := dr.db.Builder.
+			Insert("disputes").
+			Columns("id", "transaction_id", "sender", "recipient", "amount", "reason", "status", "deadline", "opened_by", "created_at").
+			Values(d.Id, d.TransactionId, d.Sender, d.Recipient, d.Amount, d.Reason, d.Status, d.Deadline, d.OpenedBy, d.CreatedAt).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.CreateDispute - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "INSERT disputes", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if isUniqueViolation(err, "disputes_transaction_id_key") {
+			return repoerrors.ErrDisputeExists
+		}
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.CreateDispute - tx.Exec")
+			return err
+		}
+
+		if err := dr.insertTransaction(ctx, tx, d, &d.Recipient, nil, d.CreatedAt); err != nil {
+			return err
+		}
+		for i := range d.Evidence {
+			d.Evidence[i].AddedAt = d.CreatedAt
+			if d.Evidence[i].Id, err = dr.insertEvidence(ctx, tx, d.Id, d.Evidence[i]); err != nil {
+				return err
+			}
+		}
+		event := entity.DisputeEvent{Time: d.CreatedAt, ToStatus: d.Status, Actor: d.OpenedBy, Note: d.Reason}
+		if err := dr.insertEvent(ctx, tx, d.Id, event); err != nil {
+			return err
+		}
+		d.Events = []entity.DisputeEvent{event}
+		return nil
+	})
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+
+	return d, nil
+}
+
+// спор с вложениями и историей
+func (dr *disputeRepoImpl) GetDispute(ctx context.Context, id uuid.UUID) (_ entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "GetDispute")
+	defer func() { endSpan(span, err) }()
+
+	d, err := dr.getDispute(ctx, id, false)
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+	if d.Evidence, err = dr.getEvidence(ctx, d.Id); err != nil {
+		return entity.Dispute{}, err
+	}
+	if d.Events, err = dr.getEvents(ctx, d.Id); err != nil {
+		return entity.Dispute{}, err
+	}
+	return d, nil
+}
+
+func (dr *disputeRepoImpl) ListDisputes(ctx context.Context, filter entity.DisputeFilter) (_ []entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "ListDisputes")
+	defer func() { endSpan(span, err) }()
+
+	builder := dr.db.Builder.
+		Select(disputeColumns...).
+		From("disputes").
+		OrderBy("created_at", "id")
+	if filter.Status != "" {
+		builder = builder.Where("status = ?", filter.Status)
+	}
+	if filter.WalletId != nil {
+		builder = builder.Where("(sender = ? OR recipient = ?)", *filter.WalletId, *filter.WalletId)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ListDisputes - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT disputes", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, dr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ListDisputes - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var disputes []entity.Dispute
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ListDisputes - rows.Scan")
+			return nil, err
+		}
+		disputes = append(disputes, d)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ListDisputes - rows.Err")
+		return nil, err
+	}
+
+	return disputes, nil
+}
+
+func (dr *disputeRepoImpl) LockDispute(ctx context.Context, id uuid.UUID) (_ entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "LockDispute")
+	defer func() { endSpan(span, err) }()
+
+	return dr.getDispute(ctx, id, true)
+}
+
+func (dr *disputeRepoImpl) AddDisputeEvidence(ctx context.Context, id uuid.UUID, evidence []entity.DisputeEvidence) (_ []entity.DisputeEvidence, err error) {
+	ctx, span := startSpan(ctx, "AddDisputeEvidence")
+	defer func() { endSpan(span, err) }()
+
+	now := time.Now().UTC()
+	err = withinTx(ctx, dr.db, func(ctx context.Context, tx pgx.Tx) error {
+		for i := range evidence {
+			evidence[i].AddedAt = now
+			if evidence[i].Id, err = dr.insertEvidence(ctx, tx, id, evidence[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return evidence, nil
+}
+
+func (dr *disputeRepoImpl) ClaimExpiredDispute(ctx context.Context, now time.Time) (_ entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "ClaimExpiredDispute")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - несколько воркеров (реплик) разбирают споры, не мешая друг другу
+	sql, args, err := dr.db.Builder.
+		Select(disputeColumns...).
+		From("disputes").
+		Where("status = ?", entity.DisputeOpen).
+		Where("deadline <= ?", now).
+		OrderBy("deadline").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ClaimExpiredDispute - db.Builder")
+		return entity.Dispute{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT disputes", sql)
+	d, err := scanDispute(conn(ctx, dr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Dispute{}, repoerrors.ErrNoExpiredDisputes
+	}
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.ClaimExpiredDispute - QueryRow")
+		return entity.Dispute{}, err
+	}
+
+	return d, nil
+}
+
+func (dr *disputeRepoImpl) SettleDispute(ctx context.Context, d entity.Dispute, status, actor, note string) (_ entity.Dispute, err error) {
+	ctx, span := startSpan(ctx, "SettleDispute")
+	defer func() { endSpan(span, err) }()
+
+	target := d.Recipient
+	if status == entity.DisputeReversed {
+		target = d.Sender
+	}
+
+	err = withinTx(ctx, dr.db, func(ctx context.Context, tx pgx.Tx) error {
+		wallet, err := dr.wallets.getWallet(ctx, tx, target, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.SettleDispute - getWallet")
+			return err
+		}
+		if wallet.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+		if err := dr.wallets.updateWallet(ctx, tx, wallet.Id, wallet.Balance+d.Amount); err != nil {
+			return err
+		}
+
+		resolvedAt := time.Now().UTC()
+		sql, args, err := dr.db.Builder.
+			Update("disputes").
+			Set("status", status).
+			Set("resolved_at", resolvedAt).
+			Where("id = ?", d.Id).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.SettleDispute - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "UPDATE disputes", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.SettleDispute - tx.Exec")
+			return err
+		}
+
+		if err := dr.insertTransaction(ctx, tx, d, nil, &target, resolvedAt); err != nil {
+			return err
+		}
+		event := entity.DisputeEvent{Time: resolvedAt, FromStatus: d.Status, ToStatus: status, Actor: actor, Note: note}
+		if err := dr.insertEvent(ctx, tx, d.Id, event); err != nil {
+			return err
+		}
+
+		d.Status = status
+		d.ResolvedAt = &resolvedAt
+		return nil
+	})
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+
+	return d, nil
+}
+
+func (dr *disputeRepoImpl) PostponeDisputeDeadline(ctx context.Context, id uuid.UUID, deadline time.Time, note string) (err error) {
+	ctx, span := startSpan(ctx, "PostponeDisputeDeadline")
+	defer func() { endSpan(span, err) }()
+
+	return withinTx(ctx, dr.db, func(ctx context.Context, tx pgx.Tx) error {
+		sql, args, err := dr.db.Builder.
+			Update("disputes").
+			Set("deadline", deadline).
+			Where("id = ?", id).
+			Suffix("RETURNING status").
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.PostponeDisputeDeadline - db.Builder")
+			return err
+		}
+
+		var status string
+		qctx, qspan := startQuerySpan(ctx, "UPDATE disputes", sql)
+		err = tx.QueryRow(qctx, sql, args...).Scan(&status)
+		endSpan(qspan, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrDisputeNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.PostponeDisputeDeadline - QueryRow")
+			return err
+		}
+
+		// статус не меняется - в истории переход в тот же статус с причиной
+		event := entity.DisputeEvent{Time: time.Now().UTC(), FromStatus: status, ToStatus: status, Actor: entity.DisputeActorSystem, Note: note}
+		return dr.insertEvent(ctx, tx, id, event)
+	})
+}
+
+func (dr *disputeRepoImpl) getDispute(ctx context.Context, id uuid.UUID, forUpdate bool) (entity.Dispute, error) {
+	builder := dr.db.Builder.
+		Select(disputeColumns...).
+		From("disputes").
+		Where("id = ?", id)
+	if forUpdate {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getDispute - db.Builder")
+		return entity.Dispute{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT disputes", sql)
+	d, err := scanDispute(conn(ctx, dr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Dispute{}, repoerrors.ErrDisputeNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getDispute - QueryRow")
+		return entity.Dispute{}, err
+	}
+	return d, nil
+}
+
+// движение удержанной суммы в журнале транзакций; одна из сторон - NULL
+func (dr *disputeRepoImpl) insertTransaction(ctx context.Context, tx pgx.Tx, d entity.Dispute, from, to *uuid.UUID, at time.Time) error {
+	sql, args, err := dr.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id").
+		Values(at, from, to, d.Amount, entity.TransferSourceDispute, d.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertTransaction - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertTransaction - tx.Exec")
+		return err
+	}
+	return nil
+}
+
+func (dr *disputeRepoImpl) insertEvidence(ctx context.Context, tx pgx.Tx, disputeId uuid.UUID, e entity.DisputeEvidence) (int64, error) {
+	sql, args, err := dr.db.Builder.
+		Insert("dispute_evidence").
+		Columns("dispute_id", "name", "url", "note", "added_by", "added_at").
+		Values(disputeId, e.Name, e.Url, e.Note, e.AddedBy, e.AddedAt).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertEvidence - db.Builder")
+		return 0, err
+	}
+
+	var id int64
+	qctx, qspan := startQuerySpan(ctx, "INSERT dispute_evidence", sql)
+	err = tx.QueryRow(qctx, sql, args...).Scan(&id)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertEvidence - QueryRow")
+		return 0, err
+	}
+	return id, nil
+}
+
+func (dr *disputeRepoImpl) insertEvent(ctx context.Context, tx pgx.Tx, disputeId uuid.UUID, event entity.DisputeEvent) error {
+	sql, args, err := dr.db.Builder.
+		Insert("dispute_events").
+		Columns("dispute_id", "made_at", "from_status", "to_status", "actor", "note").
+		Values(disputeId, event.Time, event.FromStatus, event.ToStatus, event.Actor, event.Note).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertEvent - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT dispute_events", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.insertEvent - tx.Exec")
+		return err
+	}
+	return nil
+}
+
+func (dr *disputeRepoImpl) getEvidence(ctx context.Context, disputeId uuid.UUID) (_ []entity.DisputeEvidence, err error) {
+	sql, args, err := dr.db.Builder.
+		Select("id", "name", "url", "note", "added_by", "added_at").
+		From("dispute_evidence").
+		Where("dispute_id = ?", disputeId).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvidence - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT dispute_evidence", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, dr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvidence - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var evidence []entity.DisputeEvidence
+	for rows.Next() {
+		var e entity.DisputeEvidence
+		if err := rows.Scan(&e.Id, &e.Name, &e.Url, &e.Note, &e.AddedBy, &e.AddedAt); err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvidence - rows.Scan")
+			return nil, err
+		}
+		evidence = append(evidence, e)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvidence - rows.Err")
+		return nil, err
+	}
+
+	return evidence, nil
+}
+
+func (dr *disputeRepoImpl) getEvents(ctx context.Context, disputeId uuid.UUID) (_ []entity.DisputeEvent, err error) {
+	sql, args, err := dr.db.Builder.
+		Select("made_at", "from_status", "to_status", "actor", "note").
+		From("dispute_events").
+		Where("dispute_id = ?", disputeId).
+		OrderBy("made_at", "id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvents - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT dispute_events", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, dr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvents - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.DisputeEvent
+	for rows.Next() {
+		var event entity.DisputeEvent
+		if err := rows.Scan(&event.Time, &event.FromStatus, &event.ToStatus, &event.Actor, &event.Note); err != nil {
+			logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvents - rows.Scan")
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, dr.log).WithError(err).Error("disputeRepoImpl.getEvents - rows.Err")
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func scanDispute(row pgx.Row) (entity.Dispute, error) {
+	var d entity.Dispute
+	err := row.Scan(&d.Id, &d.TransactionId, &d.Sender, &d.Recipient, &d.Amount, &d.Reason, &d.Status, &d.Deadline, &d.OpenedBy, &d.CreatedAt, &d.ResolvedAt)
+	return d, err
+}
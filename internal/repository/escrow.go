@@ -0,0 +1,441 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var escrowColumns = []string{"id", "buyer", "seller", "amount", "description", "status", "deadline", "created_at", "settled_at"}
+
+// удерживаемые средства не лежат ни на одном кошельке: в transactions списание пишется с transfered_to = NULL,
+// зачисление - с transfered_from = NULL, как у корректировок - сверка остается согласованной
+type escrowRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewEscrowRepo(db *postgres.Postgres, log *logrus.Logger) *escrowRepoImpl {
+	return &escrowRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+func (er *escrowRepoImpl) CreateEscrow(ctx context.Context, e entity.Escrow) (_ entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "CreateEscrow")
+	defer func() { endSpan(span, err) }()
+
+	e.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.CreateEscrow - uuid.NewRandom")
+		return entity.Escrow{}, err
+	}
+	e.Status = entity.EscrowFunded
+	e.CreatedAt = time.Now().UTC()
+
+	err = withinTx(ctx, er.db, func(ctx context.Context, tx pgx.Tx) error {
+		// те же проверки и порядок блокировки, что и у перевода покупатель -> продавец
+		wallets := make(map[uuid.UUID]entity.Wallet, 2)
+		for _, id := range lockOrder(e.Buyer, e.Seller) {
+			wallet, err := er.wallets.getWallet(ctx, tx, id, true)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.CreateEscrow - getWallet")
+				return err
+			}
+			wallets[id] = wallet
+		}
+
+		buyer, ok := wallets[e.Buyer]
+		if !ok {
+			return repoerrors.ErrWalletNotFound
+		}
+		if buyer.Frozen {
+			return repoerrors.ErrWalletFrozen
+		}
+		if !CanDebit(buyer, e.Amount) {
+			return repoerrors.ErrNotEnoughBalance
+		}
+		seller, ok := wallets[e.Seller]
+		if !ok {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if seller.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+
+		if err := er.wallets.updateWallet(ctx, tx, buyer.Id, buyer.Balance-e.Amount); err != nil {
+			return err
+		}
+
+		sql, args, err := er.db.Builder.
+			Insert("escrows").
+			Columns("id", "buyer", "seller", "amount", "description", "status", "deadline", "created_at").
+			Values(e.Id, e.Buyer, e.Seller, e.Amount, e.Description, e.Status, e.Deadline, e.CreatedAt).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.CreateEscrow - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "INSERT escrows", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.CreateEscrow - tx.Exec")
+			return err
+		}
+
+		if err := er.insertTransaction(ctx, tx, e, &e.Buyer, nil, e.CreatedAt); err != nil {
+			return err
+		}
+		event := entity.EscrowEvent{Time: e.CreatedAt, ToStatus: e.Status, Actor: e.Buyer.String()}
+		if err := er.insertEvent(ctx, tx, e.Id, event); err != nil {
+			return err
+		}
+		e.Events = []entity.EscrowEvent{event}
+		return nil
+	})
+	if err != nil {
+		return entity.Escrow{}, err
+	}
+
+	return e, nil
+}
+
+// сделка видна только покупателю и продавцу
+func (er *escrowRepoImpl) GetEscrow(ctx context.Context, walletId, id uuid.UUID) (_ entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "GetEscrow")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := er.db.Builder.
+		Select(escrowColumns...).
+		From("escrows").
+		Where("id = ?", id).
+		Where("(buyer = ? OR seller = ?)", walletId, walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.GetEscrow - db.Builder")
+		return entity.Escrow{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT escrows", sql)
+	e, err := scanEscrow(conn(ctx, er.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Escrow{}, repoerrors.ErrEscrowNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.GetEscrow - QueryRow")
+		return entity.Escrow{}, err
+	}
+
+	e.Events, err = er.getEvents(ctx, e.Id)
+	if err != nil {
+		return entity.Escrow{}, err
+	}
+	return e, nil
+}
+
+func (er *escrowRepoImpl) ListEscrows(ctx context.Context, walletId uuid.UUID, status string) (_ []entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "ListEscrows")
+	defer func() { endSpan(span, err) }()
+
+	builder := er.db.Builder.
+		Select(escrowColumns...).
+		From("escrows").
+		Where("(buyer = ? OR seller = ?)", walletId, walletId).
+		OrderBy("created_at", "id")
+	if status != "" {
+		builder = builder.Where("status = ?", status)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ListEscrows - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT escrows", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, er.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ListEscrows - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var escrows []entity.Escrow
+	for rows.Next() {
+		e, err := scanEscrow(rows)
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ListEscrows - rows.Scan")
+			return nil, err
+		}
+		escrows = append(escrows, e)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ListEscrows - rows.Err")
+		return nil, err
+	}
+
+	return escrows, nil
+}
+
+func (er *escrowRepoImpl) LockEscrow(ctx context.Context, id uuid.UUID) (_ entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "LockEscrow")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := er.db.Builder.
+		Select(escrowColumns...).
+		From("escrows").
+		Where("id = ?", id).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.LockEscrow - db.Builder")
+		return entity.Escrow{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT escrows", sql)
+	e, err := scanEscrow(conn(ctx, er.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Escrow{}, repoerrors.ErrEscrowNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.LockEscrow - QueryRow")
+		return entity.Escrow{}, err
+	}
+
+	return e, nil
+}
+
+func (er *escrowRepoImpl) ClaimExpiredEscrow(ctx context.Context, now time.Time) (_ entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "ClaimExpiredEscrow")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - несколько воркеров (реплик) разбирают сделки, не мешая друг другу
+	sql, args, err := er.db.Builder.
+		Select(escrowColumns...).
+		From("escrows").
+		Where("status = ?", entity.EscrowFunded).
+		Where("deadline <= ?", now).
+		OrderBy("deadline").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ClaimExpiredEscrow - db.Builder")
+		return entity.Escrow{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT escrows", sql)
+	e, err := scanEscrow(conn(ctx, er.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Escrow{}, repoerrors.ErrNoExpiredEscrows
+	}
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.ClaimExpiredEscrow - QueryRow")
+		return entity.Escrow{}, err
+	}
+
+	return e, nil
+}
+
+func (er *escrowRepoImpl) SettleEscrow(ctx context.Context, e entity.Escrow, status, actor, note string) (_ entity.Escrow, err error) {
+	ctx, span := startSpan(ctx, "SettleEscrow")
+	defer func() { endSpan(span, err) }()
+
+	recipient := e.Buyer
+	if status == entity.EscrowReleased {
+		recipient = e.Seller
+	}
+
+	err = withinTx(ctx, er.db, func(ctx context.Context, tx pgx.Tx) error {
+		wallet, err := er.wallets.getWallet(ctx, tx, recipient, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.SettleEscrow - getWallet")
+			return err
+		}
+		if wallet.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+		if err := er.wallets.updateWallet(ctx, tx, wallet.Id, wallet.Balance+e.Amount); err != nil {
+			return err
+		}
+
+		settledAt := time.Now().UTC()
+		sql, args, err := er.db.Builder.
+			Update("escrows").
+			Set("status", status).
+			Set("settled_at", settledAt).
+			Where("id = ?", e.Id).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.SettleEscrow - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "UPDATE escrows", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.SettleEscrow - tx.Exec")
+			return err
+		}
+
+		if err := er.insertTransaction(ctx, tx, e, nil, &recipient, settledAt); err != nil {
+			return err
+		}
+		event := entity.EscrowEvent{Time: settledAt, FromStatus: e.Status, ToStatus: status, Actor: actor, Note: note}
+		if err := er.insertEvent(ctx, tx, e.Id, event); err != nil {
+			return err
+		}
+
+		e.Status = status
+		e.SettledAt = &settledAt
+		e.Events = append(e.Events, event)
+		return nil
+	})
+	if err != nil {
+		return entity.Escrow{}, err
+	}
+
+	return e, nil
+}
+
+func (er *escrowRepoImpl) PostponeEscrowDeadline(ctx context.Context, id uuid.UUID, deadline time.Time, note string) (err error) {
+	ctx, span := startSpan(ctx, "PostponeEscrowDeadline")
+	defer func() { endSpan(span, err) }()
+
+	return withinTx(ctx, er.db, func(ctx context.Context, tx pgx.Tx) error {
+		sql, args, err := er.db.Builder.
+			Update("escrows").
+			Set("deadline", deadline).
+			Where("id = ?", id).
+			Suffix("RETURNING status").
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.PostponeEscrowDeadline - db.Builder")
+			return err
+		}
+
+		var status string
+		qctx, qspan := startQuerySpan(ctx, "UPDATE escrows", sql)
+		err = tx.QueryRow(qctx, sql, args...).Scan(&status)
+		endSpan(qspan, err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrEscrowNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.PostponeEscrowDeadline - QueryRow")
+			return err
+		}
+
+		// статус не меняется - в истории переход в тот же статус с причиной
+		event := entity.EscrowEvent{Time: time.Now().UTC(), FromStatus: status, ToStatus: status, Actor: entity.EscrowActorSystem, Note: note}
+		return er.insertEvent(ctx, tx, id, event)
+	})
+}
+
+// движение средств сделки в журнале транзакций; одна из сторон - NULL
+func (er *escrowRepoImpl) insertTransaction(ctx context.Context, tx pgx.Tx, e entity.Escrow, from, to *uuid.UUID, at time.Time) error {
+	sql, args, err := er.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id").
+		Values(at, from, to, e.Amount, entity.TransferSourceEscrow, e.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.insertTransaction - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.insertTransaction - tx.Exec")
+		return err
+	}
+	return nil
+}
+
+func (er *escrowRepoImpl) insertEvent(ctx context.Context, tx pgx.Tx, escrowId uuid.UUID, event entity.EscrowEvent) error {
+	sql, args, err := er.db.Builder.
+		Insert("escrow_events").
+		Columns("escrow_id", "made_at", "from_status", "to_status", "actor", "note").
+		Values(escrowId, event.Time, event.FromStatus, event.ToStatus, event.Actor, event.Note).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.insertEvent - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT escrow_events", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.insertEvent - tx.Exec")
+		return err
+	}
+	return nil
+}
+
+func (er *escrowRepoImpl) getEvents(ctx context.Context, escrowId uuid.UUID) (_ []entity.EscrowEvent, err error) {
+	sql, args, err := er.db.Builder.
+		Select("made_at", "from_status", "to_status", "actor", "note").
+		From("escrow_events").
+		Where("escrow_id = ?", escrowId).
+		OrderBy("made_at", "id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.getEvents - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT escrow_events", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, er.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.getEvents - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []entity.EscrowEvent
+	for rows.Next() {
+		var event entity.EscrowEvent
+		if err := rows.Scan(&event.Time, &event.FromStatus, &event.ToStatus, &event.Actor, &event.Note); err != nil {
+			logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.getEvents - rows.Scan")
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, er.log).WithError(err).Error("escrowRepoImpl.getEvents - rows.Err")
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func scanEscrow(row pgx.Row) (entity.Escrow, error) {
+	var e entity.Escrow
+	err := row.Scan(&e.Id, &e.Buyer, &e.Seller, &e.Amount, &e.Description, &e.Status, &e.Deadline, &e.CreatedAt, &e.SettledAt)
+	return e, err
+}
@@ -0,0 +1,493 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var fraudCaseColumns = []string{
+	"id", "transfer_from", "transfer_to", "amount", "score", "reasons", "decision", "status",
+	"COALESCE(memo, '')", "COALESCE(reference, '')", "metadata", "COALESCE(to_alias, '')",
+	"created_at", "decided_at", "decided_by", "decision_note",
+}
+
+// история для правил - переводы, которые совершил сам владелец кошелька, напрямую или через подсистему,
+// одобренные после проверки переводы и сделки с удержанием, которые он открыл; системные переводы и перемещения
+// между кошельком и карманами (entity.FraudExemptTransferSources) правилами не проверяются и не учитываются.
+// Сумма перевода на проверке, как и у сделок с удержанием, не лежит ни на одном кошельке
+type fraudRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewFraudRepo(db *postgres.Postgres, log *logrus.Logger) *fraudRepoImpl {
+	return &fraudRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+// history - исходящие переводы from для правил: (transfer_to, amount, made_at)
+func (fr *fraudRepoImpl) history(from uuid.UUID) squirrel.SelectBuilder {
+	// одобренный перевод зачисляется получателю без отправителя в журнале (средства уже списаны при удержании),
+	// поэтому для правил он берется из очереди проверки
+	approved := fr.db.Builder.
+		Select("transfer_to", "amount", "created_at").
+		From("fraud_cases").
+		Where("transfer_from = ?", from).
+		Where("status = ?", entity.FraudCaseApproved).
+		Prefix("UNION ALL").
+		PlaceholderFormat(squirrel.Question)
+	// покупатель открывает сделку сам: для правил это перевод продавцу в момент открытия
+	escrows := fr.db.Builder.
+		Select("seller", "amount", "created_at").
+		From("escrows").
+		Where("buyer = ?", from).
+		Prefix("UNION ALL").
+		SuffixExpr(approved).
+		PlaceholderFormat(squirrel.Question)
+
+	return fr.db.Builder.
+		Select("transfered_to AS transfer_to", "amount", "made_at").
+		From("transactions").
+		Where("transfered_from = ?", from).
+		Where("transfered_to IS NOT NULL").
+		Where("(source_type IS NULL OR source_type <> ALL(?))", entity.FraudExemptTransferSources).
+		SuffixExpr(escrows)
+}
+
+// блокируется не строка кошелька, а advisory-ключ отправителя: перевод блокирует кошельки в порядке id (lockOrder),
+// и кошелек отправителя, заблокированный раньше остальных, приводил бы к взаимным блокировкам встречных переводов
+func (fr *fraudRepoImpl) LockSender(ctx context.Context, from uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "LockSender")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := fr.db.Builder.
+		Select().
+		Column(squirrel.Expr("pg_advisory_xact_lock(hashtextextended(?, 0))", from.String())).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.LockSender - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT pg_advisory_xact_lock", sql)
+	_, err = conn(ctx, fr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.LockSender - Exec")
+		return err
+	}
+	return nil
+}
+
+func (fr *fraudRepoImpl) CountTransfersSince(ctx context.Context, from uuid.UUID, since time.Time) (_ int, err error) {
+	ctx, span := startSpan(ctx, "CountTransfersSince")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := fr.db.Builder.
+		Select("COUNT(*)").
+		FromSelect(fr.history(from), "h").
+		Where("made_at >= ?", since).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.CountTransfersSince - db.Builder")
+		return 0, err
+	}
+
+	var count int
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud history", sql)
+	err = conn(ctx, fr.db).QueryRow(qctx, sql, args...).Scan(&count)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.CountTransfersSince - QueryRow")
+		return 0, err
+	}
+	return count, nil
+}
+
+func (fr *fraudRepoImpl) HasTransferredTo(ctx context.Context, from, to uuid.UUID) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "HasTransferredTo")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := fr.db.Builder.
+		Select("1").
+		FromSelect(fr.history(from), "h").
+		Where("transfer_to = ?", to).
+		Prefix("SELECT EXISTS (").
+		Suffix(")").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.HasTransferredTo - db.Builder")
+		return false, err
+	}
+
+	var exists bool
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud history", sql)
+	err = conn(ctx, fr.db).QueryRow(qctx, sql, args...).Scan(&exists)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.HasTransferredTo - QueryRow")
+		return false, err
+	}
+	return exists, nil
+}
+
+func (fr *fraudRepoImpl) AverageTransferSince(ctx context.Context, from uuid.UUID, since time.Time) (_ float64, _ int, err error) {
+	ctx, span := startSpan(ctx, "AverageTransferSince")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := fr.db.Builder.
+		Select("COALESCE(AVG(amount), 0)::float8", "COUNT(*)").
+		FromSelect(fr.history(from), "h").
+		Where("made_at >= ?", since).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.AverageTransferSince - db.Builder")
+		return 0, 0, err
+	}
+
+	var avg float64
+	var count int
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud history", sql)
+	err = conn(ctx, fr.db).QueryRow(qctx, sql, args...).Scan(&avg, &count)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.AverageTransferSince - QueryRow")
+		return 0, 0, err
+	}
+	return avg, count, nil
+}
+
+func (fr *fraudRepoImpl) CountNewRecipientsSince(ctx context.Context, from uuid.UUID, since time.Time) (_ int, err error) {
+	ctx, span := startSpan(ctx, "CountNewRecipientsSince")
+	defer func() { endSpan(span, err) }()
+
+	// новый получатель - тот, кому первый перевод сделан не раньше since
+	sql, args, err := fr.db.Builder.
+		Select("transfer_to").
+		FromSelect(fr.history(from), "h").
+		GroupBy("transfer_to").
+		Having("MIN(made_at) >= ?", since).
+		Prefix("SELECT COUNT(*) FROM (").
+		Suffix(") r").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.CountNewRecipientsSince - db.Builder")
+		return 0, err
+	}
+
+	var count int
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud history", sql)
+	err = conn(ctx, fr.db).QueryRow(qctx, sql, args...).Scan(&count)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.CountNewRecipientsSince - QueryRow")
+		return 0, err
+	}
+	return count, nil
+}
+
+func (fr *fraudRepoImpl) HoldTransfer(ctx context.Context, c entity.FraudCase) (_ entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "HoldTransfer")
+	defer func() { endSpan(span, err) }()
+
+	if c, err = fr.newCase(ctx, c, entity.FraudCasePending); err != nil {
+		return entity.FraudCase{}, err
+	}
+	err = withinTx(ctx, fr.db, func(ctx context.Context, tx pgx.Tx) error {
+		// те же проверки и порядок блокировки, что и у самого перевода
+		wallets := make(map[uuid.UUID]entity.Wallet, 2)
+		for _, id := range lockOrder(c.From, c.To) {
+			wallet, err := fr.wallets.getWallet(ctx, tx, id, true)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.HoldTransfer - getWallet")
+				return err
+			}
+			wallets[id] = wallet
+		}
+
+		from, ok := wallets[c.From]
+		if !ok {
+			return repoerrors.ErrWalletNotFound
+		}
+		if from.Frozen {
+			return repoerrors.ErrWalletFrozen
+		}
+		if !CanDebit(from, c.Amount) {
+			return repoerrors.ErrNotEnoughBalance
+		}
+		to, ok := wallets[c.To]
+		if !ok {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if to.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+
+		if err := fr.wallets.updateWallet(ctx, tx, from.Id, from.Balance-c.Amount); err != nil {
+			return err
+		}
+		if err := fr.insertCase(ctx, tx, c); err != nil {
+			return err
+		}
+		return fr.insertTransaction(ctx, tx, c, &c.From, nil, c.CreatedAt, entity.TransferDetails{})
+	})
+	if err != nil {
+		return entity.FraudCase{}, err
+	}
+
+	return c, nil
+}
+
+func (fr *fraudRepoImpl) SaveBlockedTransfer(ctx context.Context, c entity.FraudCase) (_ entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "SaveBlockedTransfer")
+	defer func() { endSpan(span, err) }()
+
+	if c, err = fr.newCase(ctx, c, entity.FraudCaseBlocked); err != nil {
+		return entity.FraudCase{}, err
+	}
+	err = fr.insertCase(ctx, conn(ctx, fr.db), c)
+	if isForeignKeyViolation(err, "fraud_cases_transfer_from_fkey") {
+		return entity.FraudCase{}, repoerrors.ErrWalletNotFound
+	}
+	if isForeignKeyViolation(err, "fraud_cases_transfer_to_fkey") {
+		return entity.FraudCase{}, repoerrors.ErrTargetWalletNotFound
+	}
+	if err != nil {
+		return entity.FraudCase{}, err
+	}
+	return c, nil
+}
+
+func (fr *fraudRepoImpl) GetFraudCase(ctx context.Context, id uuid.UUID) (_ entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "GetFraudCase")
+	defer func() { endSpan(span, err) }()
+
+	return fr.getCase(ctx, id, false)
+}
+
+func (fr *fraudRepoImpl) LockFraudCase(ctx context.Context, id uuid.UUID) (_ entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "LockFraudCase")
+	defer func() { endSpan(span, err) }()
+
+	return fr.getCase(ctx, id, true)
+}
+
+func (fr *fraudRepoImpl) ListFraudCases(ctx context.Context, filter entity.FraudCaseFilter) (_ []entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "ListFraudCases")
+	defer func() { endSpan(span, err) }()
+
+	builder := fr.db.Builder.
+		Select(fraudCaseColumns...).
+		From("fraud_cases").
+		OrderBy("created_at", "id")
+	if filter.Status != "" {
+		builder = builder.Where("status = ?", filter.Status)
+	}
+	if filter.WalletId != nil {
+		builder = builder.Where("(transfer_from = ? OR transfer_to = ?)", *filter.WalletId, *filter.WalletId)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.ListFraudCases - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud_cases", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, fr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.ListFraudCases - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cases []entity.FraudCase
+	for rows.Next() {
+		c, err := scanFraudCase(rows)
+		if err != nil {
+			logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.ListFraudCases - rows.Scan")
+			return nil, err
+		}
+		cases = append(cases, c)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.ListFraudCases - rows.Err")
+		return nil, err
+	}
+
+	return cases, nil
+}
+
+func (fr *fraudRepoImpl) SettleFraudCase(ctx context.Context, c entity.FraudCase, status, actor, note string) (_ entity.FraudCase, err error) {
+	ctx, span := startSpan(ctx, "SettleFraudCase")
+	defer func() { endSpan(span, err) }()
+
+	// одобренный перевод зачисляется получателю с данными исходного перевода, отклоненный - возвращается отправителю
+	target, details := c.From, entity.TransferDetails{}
+	if status == entity.FraudCaseApproved {
+		target = c.To
+		details = entity.TransferDetails{Memo: c.Memo, Reference: c.Reference, Metadata: c.Metadata, ToAlias: c.ToAlias}
+	}
+
+	err = withinTx(ctx, fr.db, func(ctx context.Context, tx pgx.Tx) error {
+		wallet, err := fr.wallets.getWallet(ctx, tx, target, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if err != nil {
+			logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.SettleFraudCase - getWallet")
+			return err
+		}
+		if wallet.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+		if err := fr.wallets.updateWallet(ctx, tx, wallet.Id, wallet.Balance+c.Amount); err != nil {
+			return err
+		}
+
+		decidedAt := time.Now().UTC()
+		sql, args, err := fr.db.Builder.
+			Update("fraud_cases").
+			Set("status", status).
+			Set("decided_at", decidedAt).
+			Set("decided_by", actor).
+			Set("decision_note", note).
+			Where("id = ?", c.Id).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.SettleFraudCase - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "UPDATE fraud_cases", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.SettleFraudCase - tx.Exec")
+			return err
+		}
+
+		if err := fr.insertTransaction(ctx, tx, c, nil, &target, decidedAt, details); err != nil {
+			return err
+		}
+
+		c.Status = status
+		c.DecidedAt = &decidedAt
+		c.DecidedBy = actor
+		c.DecisionNote = note
+		return nil
+	})
+	if err != nil {
+		return entity.FraudCase{}, err
+	}
+
+	return c, nil
+}
+
+func (fr *fraudRepoImpl) getCase(ctx context.Context, id uuid.UUID, forUpdate bool) (entity.FraudCase, error) {
+	builder := fr.db.Builder.
+		Select(fraudCaseColumns...).
+		From("fraud_cases").
+		Where("id = ?", id)
+	if forUpdate {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.getCase - db.Builder")
+		return entity.FraudCase{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT fraud_cases", sql)
+	c, err := scanFraudCase(conn(ctx, fr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.FraudCase{}, repoerrors.ErrFraudCaseNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.getCase - QueryRow")
+		return entity.FraudCase{}, err
+	}
+	return c, nil
+}
+
+func (fr *fraudRepoImpl) newCase(ctx context.Context, c entity.FraudCase, status string) (entity.FraudCase, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.newCase - uuid.NewRandom")
+		return entity.FraudCase{}, err
+	}
+	c.Id = id
+	c.Status = status
+	c.CreatedAt = time.Now().UTC()
+	return c, nil
+}
+
+func (fr *fraudRepoImpl) insertCase(ctx context.Context, q querier, c entity.FraudCase) error {
+	sql, args, err := fr.db.Builder.
+		Insert("fraud_cases").
+		Columns("id", "transfer_from", "transfer_to", "amount", "score", "reasons", "decision", "status",
+			"memo", "reference", "metadata", "to_alias", "created_at").
+		Values(c.Id, c.From, c.To, c.Amount, c.Score, c.Reasons, c.Decision, c.Status,
+			nullIfEmpty(c.Memo), nullIfEmpty(c.Reference), metadataValue(c.Metadata), nullIfEmpty(c.ToAlias), c.CreatedAt).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.insertCase - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT fraud_cases", sql)
+	_, err = q.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.insertCase - Exec")
+		return err
+	}
+	return nil
+}
+
+// движение суммы перевода на проверке в журнале транзакций; одна из сторон - NULL
+func (fr *fraudRepoImpl) insertTransaction(ctx context.Context, tx pgx.Tx, c entity.FraudCase, from, to *uuid.UUID, at time.Time, details entity.TransferDetails) error {
+	sql, args, err := fr.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id", "memo", "reference", "metadata", "to_alias").
+		Values(at, from, to, c.Amount, entity.TransferSourceFraudReview, c.Id,
+			nullIfEmpty(details.Memo), nullIfEmpty(details.Reference), metadataValue(details.Metadata), nullIfEmpty(details.ToAlias)).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.insertTransaction - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, fr.log).WithError(err).Error("fraudRepoImpl.insertTransaction - tx.Exec")
+		return err
+	}
+	return nil
+}
+
+func scanFraudCase(row pgx.Row) (entity.FraudCase, error) {
+	var c entity.FraudCase
+	err := row.Scan(&c.Id, &c.From, &c.To, &c.Amount, &c.Score, &c.Reasons, &c.Decision, &c.Status,
+		&c.Memo, &c.Reference, &c.Metadata, &c.ToAlias, &c.CreatedAt, &c.DecidedAt, &c.DecidedBy, &c.DecisionNote)
+	return c, err
+}
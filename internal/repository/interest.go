@@ -0,0 +1,537 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var interestProductColumns = []string{"p.id", "p.name", "p.annual_rate", "p.day_count", "p.compounding", "p.created_at"}
+
+// счет вместе с продуктом
+var interestAccountColumns = append([]string{
+	"a.wallet_id", "a.product_id", "a.status", "a.accrued_through", "a.ends_on", "a.pending",
+	"a.payout_due", "a.retry_at", "a.created_at", "a.updated_at",
+}, interestProductColumns...)
+
+var interestAccrualColumns = []string{"wallet_id", "accrual_date", "product_id", "balance", "annual_rate", "day_count", "amount", "payout_id", "created_at"}
+
+type interestRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+}
+
+func NewInterestRepo(db *postgres.Postgres, log *logrus.Logger) *interestRepoImpl {
+	return &interestRepoImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (ir *interestRepoImpl) CreateInterestProduct(ctx context.Context, p entity.InterestProduct) (_ entity.InterestProduct, err error) {
+	ctx, span := startSpan(ctx, "CreateInterestProduct")
+	defer func() { endSpan(span, err) }()
+
+	p.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.CreateInterestProduct - uuid.NewRandom")
+		return entity.InterestProduct{}, err
+	}
+	p.CreatedAt = time.Now().UTC()
+	rate, err := numeric(p.AnnualRate)
+	if err != nil {
+		return entity.InterestProduct{}, err
+	}
+
+	sql, args, err := ir.db.Builder.
+		Insert("interest_products").
+		Columns("id", "name", "annual_rate", "day_count", "compounding", "created_at").
+		Values(p.Id, p.Name, rate, p.DayCount, p.Compounding, p.CreatedAt).
+		Suffix("RETURNING annual_rate").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.CreateInterestProduct - db.Builder")
+		return entity.InterestProduct{}, err
+	}
+
+	// ставка - в том виде, в каком ее сохранила база
+	qctx, qspan := startQuerySpan(ctx, "INSERT interest_products", sql)
+	err = conn(ctx, ir.db).QueryRow(qctx, sql, args...).Scan(&p.AnnualRate)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.CreateInterestProduct - QueryRow")
+		return entity.InterestProduct{}, err
+	}
+
+	return p, nil
+}
+
+func (ir *interestRepoImpl) ListInterestProducts(ctx context.Context) (_ []entity.InterestProduct, err error) {
+	ctx, span := startSpan(ctx, "ListInterestProducts")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select(interestProductColumns...).
+		From("interest_products p").
+		OrderBy("p.created_at", "p.id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestProducts - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT interest_products", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestProducts - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var products []entity.InterestProduct
+	for rows.Next() {
+		var p entity.InterestProduct
+		if err := rows.Scan(&p.Id, &p.Name, &p.AnnualRate, &p.DayCount, &p.Compounding, &p.CreatedAt); err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestProducts - rows.Scan")
+			return nil, err
+		}
+		products = append(products, p)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestProducts - rows.Err")
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// OpenInterestAccount - подключает кошелек к продукту с начислением после accruedThrough; у действующего счета
+// меняет продукт и отменяет закрытие, закрытый открывает заново, не начисляя повторно уже начисленные дни
+func (ir *interestRepoImpl) OpenInterestAccount(ctx context.Context, walletId, productId uuid.UUID, accruedThrough time.Time) (_ entity.InterestAccount, err error) {
+	ctx, span := startSpan(ctx, "OpenInterestAccount")
+	defer func() { endSpan(span, err) }()
+
+	now := time.Now().UTC()
+	sql, args, err := ir.db.Builder.
+		Insert("interest_accounts").
+		Columns("wallet_id", "product_id", "status", "accrued_through", "created_at", "updated_at").
+		Values(walletId, productId, entity.InterestAccountActive, accruedThrough, now, now).
+		Suffix(`ON CONFLICT (wallet_id) DO UPDATE SET
+			product_id = EXCLUDED.product_id,
+			status = EXCLUDED.status,
+			ends_on = NULL,
+			accrued_through = CASE WHEN interest_accounts.status = ?
+				THEN GREATEST(interest_accounts.accrued_through, EXCLUDED.accrued_through)
+				ELSE interest_accounts.accrued_through END,
+			updated_at = EXCLUDED.updated_at`, entity.InterestAccountClosed).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.OpenInterestAccount - db.Builder")
+		return entity.InterestAccount{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT interest_accounts", sql)
+	_, err = conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if isForeignKeyViolation(err, "interest_accounts_wallet_id_fkey") {
+		return entity.InterestAccount{}, repoerrors.ErrWalletNotFound
+	}
+	if isForeignKeyViolation(err, "interest_accounts_product_id_fkey") {
+		return entity.InterestAccount{}, repoerrors.ErrInterestProductNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.OpenInterestAccount - Exec")
+		return entity.InterestAccount{}, err
+	}
+
+	return ir.getInterestAccount(ctx, walletId)
+}
+
+// CloseInterestAccount - начисление прекращается с endsOn; повторный вызов дату не сдвигает
+func (ir *interestRepoImpl) CloseInterestAccount(ctx context.Context, walletId uuid.UUID, endsOn time.Time) (_ entity.InterestAccount, err error) {
+	ctx, span := startSpan(ctx, "CloseInterestAccount")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Update("interest_accounts").
+		Set("ends_on", squirrel.Expr("COALESCE(ends_on, ?)", endsOn)).
+		Set("updated_at", time.Now().UTC()).
+		Where(squirrel.Eq{"wallet_id": walletId, "status": entity.InterestAccountActive}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.CloseInterestAccount - db.Builder")
+		return entity.InterestAccount{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE interest_accounts", sql)
+	tag, err := conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.CloseInterestAccount - Exec")
+		return entity.InterestAccount{}, err
+	}
+	if tag.RowsAffected() == 0 {
+		return entity.InterestAccount{}, repoerrors.ErrInterestAccountNotFound
+	}
+
+	return ir.getInterestAccount(ctx, walletId)
+}
+
+func (ir *interestRepoImpl) GetInterestAccount(ctx context.Context, walletId uuid.UUID) (_ entity.InterestAccount, err error) {
+	ctx, span := startSpan(ctx, "GetInterestAccount")
+	defer func() { endSpan(span, err) }()
+
+	return ir.getInterestAccount(ctx, walletId)
+}
+
+// ListInterestAccruals - начисления по возрастанию даты
+func (ir *interestRepoImpl) ListInterestAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) (_ []entity.InterestAccrual, err error) {
+	ctx, span := startSpan(ctx, "ListInterestAccruals")
+	defer func() { endSpan(span, err) }()
+
+	builder := ir.db.Builder.
+		Select(interestAccrualColumns...).
+		From("interest_accruals").
+		Where("wallet_id = ?", walletId).
+		OrderBy("accrual_date")
+	if filter.From != nil {
+		builder = builder.Where("accrual_date >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		builder = builder.Where("accrual_date <= ?", *filter.To)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestAccruals - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT interest_accruals", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestAccruals - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accruals []entity.InterestAccrual
+	for rows.Next() {
+		var a entity.InterestAccrual
+		err := rows.Scan(&a.WalletId, &a.Date, &a.ProductId, &a.Balance, &a.AnnualRate, &a.DayCount, &a.Amount, &a.PayoutId, &a.CreatedAt)
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestAccruals - rows.Scan")
+			return nil, err
+		}
+		accruals = append(accruals, a)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestAccruals - rows.Err")
+		return nil, err
+	}
+
+	return accruals, nil
+}
+
+// ListInterestPayouts - выплаты по возрастанию конца периода
+func (ir *interestRepoImpl) ListInterestPayouts(ctx context.Context, walletId uuid.UUID) (_ []entity.InterestPayout, err error) {
+	ctx, span := startSpan(ctx, "ListInterestPayouts")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select("id", "wallet_id", "period_end", "accrued", "amount", "carry", "paid_at").
+		From("interest_payouts").
+		Where("wallet_id = ?", walletId).
+		OrderBy("period_end").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestPayouts - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT interest_payouts", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestPayouts - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payouts []entity.InterestPayout
+	for rows.Next() {
+		var p entity.InterestPayout
+		if err := rows.Scan(&p.Id, &p.WalletId, &p.PeriodEnd, &p.Accrued, &p.Amount, &p.Carry, &p.PaidAt); err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestPayouts - rows.Scan")
+			return nil, err
+		}
+		payouts = append(payouts, p)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ListInterestPayouts - rows.Err")
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// ClaimDueInterestAccount - блокирует (FOR UPDATE SKIP LOCKED) один действующий счет, у которого есть
+// неначисленный день не позже through, несделанная выплата или наступившее закрытие; счета с retry_at позже now пропускаются
+func (ir *interestRepoImpl) ClaimDueInterestAccount(ctx context.Context, through, now time.Time) (_ entity.InterestAccount, err error) {
+	ctx, span := startSpan(ctx, "ClaimDueInterestAccount")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select(interestAccountColumns...).
+		From("interest_accounts a").
+		Join("interest_products p ON p.id = a.product_id").
+		Where("a.status = ?", entity.InterestAccountActive).
+		Where("(a.retry_at IS NULL OR a.retry_at <= ?)", now).
+		// LEAST игнорирует NULL: без ends_on граница - through
+		Where("(a.accrued_through < LEAST(?::date, a.ends_on - 1) OR a.payout_due OR a.ends_on IS NOT NULL)", through).
+		OrderBy("a.accrued_through").
+		Limit(1).
+		Suffix("FOR UPDATE OF a SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ClaimDueInterestAccount - db.Builder")
+		return entity.InterestAccount{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT interest_accounts", sql)
+	acc, err := scanInterestAccount(conn(ctx, ir.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.InterestAccount{}, repoerrors.ErrNoDueInterestAccounts
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.ClaimDueInterestAccount - QueryRow")
+		return entity.InterestAccount{}, err
+	}
+
+	return acc, nil
+}
+
+// EndOfDayBalance - баланс кошелька на момент at: текущий баланс за вычетом движений, сделанных начиная с at;
+// одним запросом, чтобы баланс и транзакции были из одного снимка
+func (ir *interestRepoImpl) EndOfDayBalance(ctx context.Context, walletId uuid.UUID, at time.Time) (_ float32, err error) {
+	ctx, span := startSpan(ctx, "EndOfDayBalance")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select().
+		Column(squirrel.Expr(`w.balance
+			- COALESCE((SELECT SUM(amount) FROM transactions WHERE transfered_to = w.id AND made_at >= ?), 0)
+			+ COALESCE((SELECT SUM(amount) FROM transactions WHERE transfered_from = w.id AND made_at >= ?), 0)`, at, at)).
+		From("wallets w").
+		Where("w.id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.EndOfDayBalance - db.Builder")
+		return 0, err
+	}
+
+	var balance float32
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+	err = conn(ctx, ir.db).QueryRow(qctx, sql, args...).Scan(&balance)
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, repoerrors.ErrWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.EndOfDayBalance - QueryRow")
+		return 0, err
+	}
+
+	return balance, nil
+}
+
+// SaveInterestAccrual - false, если за этот день кошельку уже начислено
+func (ir *interestRepoImpl) SaveInterestAccrual(ctx context.Context, a entity.InterestAccrual) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "SaveInterestAccrual")
+	defer func() { endSpan(span, err) }()
+
+	rate, err := numeric(a.AnnualRate)
+	if err != nil {
+		return false, err
+	}
+	amount, err := numeric(a.Amount)
+	if err != nil {
+		return false, err
+	}
+
+	sql, args, err := ir.db.Builder.
+		Insert("interest_accruals").
+		Columns("wallet_id", "accrual_date", "product_id", "balance", "annual_rate", "day_count", "amount", "created_at").
+		Values(a.WalletId, a.Date, a.ProductId, a.Balance, rate, a.DayCount, amount, time.Now().UTC()).
+		Suffix("ON CONFLICT (wallet_id, accrual_date) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.SaveInterestAccrual - db.Builder")
+		return false, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT interest_accruals", sql)
+	tag, err := conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.SaveInterestAccrual - Exec")
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// SaveInterestPayout - сохраняет выплату и привязывает к ней невыплаченные начисления по p.PeriodEnd включительно;
+// false, если период уже выплачен
+func (ir *interestRepoImpl) SaveInterestPayout(ctx context.Context, p entity.InterestPayout) (inserted bool, err error) {
+	ctx, span := startSpan(ctx, "SaveInterestPayout")
+	defer func() { endSpan(span, err) }()
+
+	accrued, err := numeric(p.Accrued)
+	if err != nil {
+		return false, err
+	}
+	carry, err := numeric(p.Carry)
+	if err != nil {
+		return false, err
+	}
+
+	insertSql, insertArgs, err := ir.db.Builder.
+		Insert("interest_payouts").
+		Columns("id", "wallet_id", "period_end", "accrued", "amount", "carry", "paid_at").
+		Values(p.Id, p.WalletId, p.PeriodEnd, accrued, p.Amount, carry, p.PaidAt).
+		Suffix("ON CONFLICT (wallet_id, period_end) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.SaveInterestPayout - db.Builder")
+		return false, err
+	}
+	updateSql, updateArgs, err := ir.db.Builder.
+		Update("interest_accruals").
+		Set("payout_id", p.Id).
+		Where("wallet_id = ? AND payout_id IS NULL AND accrual_date <= ?", p.WalletId, p.PeriodEnd).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.SaveInterestPayout - db.Builder")
+		return false, err
+	}
+
+	err = withinTx(ctx, ir.db, func(ctx context.Context, tx pgx.Tx) error {
+		qctx, qspan := startQuerySpan(ctx, "INSERT interest_payouts", insertSql)
+		tag, err := tx.Exec(qctx, insertSql, insertArgs...)
+		endSpan(qspan, err)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		inserted = true
+
+		qctx, qspan = startQuerySpan(ctx, "UPDATE interest_accruals", updateSql)
+		_, err = tx.Exec(qctx, updateSql, updateArgs...)
+		endSpan(qspan, err)
+		return err
+	})
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.SaveInterestPayout - tx")
+		return false, err
+	}
+
+	return inserted, nil
+}
+
+// UpdateInterestAccountProgress - сохраняет status, accrued_through, pending, payout_due и retry_at
+func (ir *interestRepoImpl) UpdateInterestAccountProgress(ctx context.Context, acc entity.InterestAccount) (err error) {
+	ctx, span := startSpan(ctx, "UpdateInterestAccountProgress")
+	defer func() { endSpan(span, err) }()
+
+	pending, err := numeric(acc.Pending)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := ir.db.Builder.
+		Update("interest_accounts").
+		SetMap(map[string]any{
+			"status":          acc.Status,
+			"accrued_through": acc.AccruedThrough,
+			"pending":         pending,
+			"payout_due":      acc.PayoutDue,
+			"retry_at":        acc.RetryAt,
+			"updated_at":      time.Now().UTC(),
+		}).
+		Where("wallet_id = ?", acc.WalletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.UpdateInterestAccountProgress - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE interest_accounts", sql)
+	_, err = conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.UpdateInterestAccountProgress - Exec")
+		return err
+	}
+
+	return nil
+}
+
+func (ir *interestRepoImpl) getInterestAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error) {
+	sql, args, err := ir.db.Builder.
+		Select(interestAccountColumns...).
+		From("interest_accounts a").
+		Join("interest_products p ON p.id = a.product_id").
+		Where("a.wallet_id = ?", walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.getInterestAccount - db.Builder")
+		return entity.InterestAccount{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT interest_accounts", sql)
+	acc, err := scanInterestAccount(conn(ctx, ir.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.InterestAccount{}, repoerrors.ErrInterestAccountNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("interestRepoImpl.getInterestAccount - QueryRow")
+		return entity.InterestAccount{}, err
+	}
+	return acc, nil
+}
+
+func scanInterestAccount(row pgx.Row) (entity.InterestAccount, error) {
+	var (
+		acc entity.InterestAccount
+		p   entity.InterestProduct
+	)
+	err := row.Scan(
+		&acc.WalletId, &acc.ProductId, &acc.Status, &acc.AccruedThrough, &acc.EndsOn, &acc.Pending,
+		&acc.PayoutDue, &acc.RetryAt, &acc.CreatedAt, &acc.UpdatedAt,
+		&p.Id, &p.Name, &p.AnnualRate, &p.DayCount, &p.Compounding, &p.CreatedAt,
+	)
+	acc.Product = &p
+	return acc, err
+}
+
+// десятичная строка как NUMERIC - без потери точности на float
+func numeric(s string) (pgtype.Numeric, error) {
+	var n pgtype.Numeric
+	if err := n.Scan(s); err != nil {
+		return pgtype.Numeric{}, err
+	}
+	return n, nil
+}
@@ -2,14 +2,261 @@ package repository
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/timohahaa/ewallet/internal/entity"
 )
 
+// WalletRepo - история транзакций отдается в порядке совершения (от старых к новым),
+// перевод атомарен: либо изменены оба баланса и записана транзакция (и сдача по правилу округления), либо ничего;
+// источник и данные перевода (memo, reference, metadata) Transfer берет из контекста
 type WalletRepo interface {
-	CreateWallet(ctx context.Context) (entity.Wallet, error)
+	CreateWallet(ctx context.Context, info entity.WalletInfo) (entity.Wallet, error)
+	// UpdateWalletInfo - меняет данные владельца, баланс не трогает
+	UpdateWalletInfo(ctx context.Context, walletId uuid.UUID, update entity.WalletInfoUpdate) (entity.Wallet, error)
+	// ListWallets - кошельки по возрастанию (created_at, id), не больше filter.Limit, после курсора filter.After
+	ListWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error)
 	Transfer(ctx context.Context, from, to uuid.UUID, amount float32) error
-	GetTransactionHistory(ctx context.Context, walletId uuid.UUID) ([]entity.Transaction, error)
+	GetTransactionHistory(ctx context.Context, walletId uuid.UUID, filter entity.TransactionFilter) ([]entity.Transaction, error)
 	GetWalletStatus(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error)
+	// SplitTransfer - одно списание sp.Amount с sp.From и зачисления по sp.Lines, атомарно;
+	// ошибки - как у Transfer, для любого из получателей
+	SplitTransfer(ctx context.Context, sp entity.SplitPayment) (entity.SplitPayment, error)
+	// GetSplitPayment - платеж виден отправителю и каждому из получателей
+	GetSplitPayment(ctx context.Context, walletId, id uuid.UUID) (entity.SplitPayment, error)
+	// CreatePocket - карман кошелька parentId с нулевым балансом; у кармана не бывает своих карманов,
+	// открытых карманов у кошелька не больше limit, пустой info.OwnerId - владелец кошелька
+	CreatePocket(ctx context.Context, parentId uuid.UUID, info entity.WalletInfo, limit int) (entity.Wallet, error)
+	// ListPockets - открытые карманы по возрастанию (created_at, id)
+	ListPockets(ctx context.Context, parentId uuid.UUID) ([]entity.Wallet, error)
+	// ClosePocket - переводит остаток кармана родителю, замораживает карман и помечает закрытым; идемпотентно
+	ClosePocket(ctx context.Context, parentId, pocketId uuid.UUID) (entity.Wallet, error)
+	// SetRoundUp - правило округления: сдача каждого исходящего перевода до целой единицы переводится
+	// в открытый карман pocketId в той же транзакции; пакетные переводы и разделенные платежи не округляются; nil - выключить
+	SetRoundUp(ctx context.Context, walletId uuid.UUID, pocketId *uuid.UUID) (entity.Wallet, error)
+}
+
+// операции администратора - только для ewalletctl, в HTTP API не выставлены
+type AdminRepo interface {
+	AdjustBalance(ctx context.Context, walletId uuid.UUID, amount float32) error
+	SetFrozen(ctx context.Context, walletId uuid.UUID, frozen bool) error
+	SaveAuditRecord(ctx context.Context, record entity.AuditRecord) error
+	Reconcile(ctx context.Context) ([]entity.ReconciliationMismatch, error)
+	// VerifyAlias - подтверждает действующий email или phone кошелька
+	VerifyAlias(ctx context.Context, walletId uuid.UUID, kind string) (entity.WalletAlias, error)
+	// SetCreditLine - лимит кошелька и условия кредитной линии, новая линия начисляет за дни после line.AccruedThrough;
+	// лимит меньше текущей задолженности - ErrCreditLimitBelowDebt
+	SetCreditLine(ctx context.Context, line entity.CreditLine) (entity.CreditLine, error)
+}
+
+type ScheduledTransferRepo interface {
+	CreateScheduledTransfer(ctx context.Context, st entity.ScheduledTransfer) (entity.ScheduledTransfer, error)
+	// status == "" - все статусы
+	ListScheduledTransfers(ctx context.Context, walletId uuid.UUID, status string) ([]entity.ScheduledTransfer, error)
+	CancelScheduledTransfer(ctx context.Context, walletId, id uuid.UUID) error
+	// ClaimDueScheduledTransfer - блокирует (FOR UPDATE SKIP LOCKED) один перевод, время которого наступило;
+	// вызывать внутри Transactor.WithinTx, блокировка держится до конца транзакции
+	ClaimDueScheduledTransfer(ctx context.Context, now time.Time) (entity.ScheduledTransfer, error)
+	// UpdateScheduledTransferResult - сохраняет status, attempts, failure_reason, execute_at и executed_at
+	UpdateScheduledTransferResult(ctx context.Context, st entity.ScheduledTransfer) error
+}
+
+type StandingOrderRepo interface {
+	CreateStandingOrder(ctx context.Context, so entity.StandingOrder) (entity.StandingOrder, error)
+	// status == "" - все статусы
+	ListStandingOrders(ctx context.Context, walletId uuid.UUID, status string) ([]entity.StandingOrder, error)
+	// запуски поручения от новых к старым
+	ListStandingOrderRuns(ctx context.Context, walletId, id uuid.UUID) ([]entity.StandingOrderRun, error)
+	CancelStandingOrder(ctx context.Context, walletId, id uuid.UUID) error
+	// ClaimDueStandingOrder - блокирует (FOR UPDATE SKIP LOCKED) одно активное поручение, время запуска которого наступило;
+	// вызывать внутри Transactor.WithinTx
+	ClaimDueStandingOrder(ctx context.Context, now time.Time) (entity.StandingOrder, error)
+	// SaveStandingOrderRun - false, если этот запуск уже был записан ранее
+	SaveStandingOrderRun(ctx context.Context, run entity.StandingOrderRun) (bool, error)
+	// UpdateStandingOrderProgress - сохраняет status, runs_count, next_run_at и last_failure_reason
+	UpdateStandingOrderProgress(ctx context.Context, so entity.StandingOrder) error
+}
+
+type BatchTransferRepo interface {
+	// CreateBatchTransfer - сохраняет пакет со строками в статусе pending
+	CreateBatchTransfer(ctx context.Context, bt entity.BatchTransfer) (entity.BatchTransfer, error)
+	GetBatchTransfer(ctx context.Context, walletId, id uuid.UUID) (entity.BatchTransfer, error)
+	// ClaimPendingBatchTransfer - блокирует (FOR UPDATE SKIP LOCKED) самый старый пакет в статусе pending;
+	// вызывать внутри Transactor.WithinTx
+	ClaimPendingBatchTransfer(ctx context.Context) (entity.BatchTransfer, error)
+	// ExecuteBatchTransfer - исполняет пакет в одной транзакции: одно списание, зачисления по строкам,
+	// результат каждой строки и итоговый статус пакета сохраняются и возвращаются
+	ExecuteBatchTransfer(ctx context.Context, bt entity.BatchTransfer) (entity.BatchTransfer, error)
+}
+
+// EscrowRepo - хранение и движение средств сделок; допустимость переходов проверяет сервис
+type EscrowRepo interface {
+	// CreateEscrow - списывает Amount с покупателя и создает сделку в статусе funded; ошибки - как у Transfer
+	CreateEscrow(ctx context.Context, e entity.Escrow) (entity.Escrow, error)
+	// GetEscrow - сделка с историей, видна только покупателю и продавцу
+	GetEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error)
+	// ListEscrows - сделки, где кошелек покупатель или продавец; status == "" - все статусы
+	ListEscrows(ctx context.Context, walletId uuid.UUID, status string) ([]entity.Escrow, error)
+	// LockEscrow - блокирует сделку (FOR UPDATE) до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockEscrow(ctx context.Context, id uuid.UUID) (entity.Escrow, error)
+	// ClaimExpiredEscrow - блокирует (FOR UPDATE SKIP LOCKED) одну сделку funded с наступившим дедлайном
+	ClaimExpiredEscrow(ctx context.Context, now time.Time) (entity.Escrow, error)
+	// SettleEscrow - зачисляет средства продавцу (released) или покупателю (refunded), меняет статус и пишет историю
+	SettleEscrow(ctx context.Context, e entity.Escrow, status, actor, note string) (entity.Escrow, error)
+	// PostponeEscrowDeadline - сдвигает дедлайн и пишет причину в историю
+	PostponeEscrowDeadline(ctx context.Context, id uuid.UUID, deadline time.Time, note string) error
+}
+
+// PaymentRequestRepo - хранение запросов денег; перевод при оплате идет через WalletService
+type PaymentRequestRepo interface {
+	CreatePaymentRequest(ctx context.Context, pr entity.PaymentRequest) (entity.PaymentRequest, error)
+	// GetPaymentRequest - запрос виден только получателю и плательщику
+	GetPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error)
+	// direction == "" - входящие и исходящие, status == "" - все статусы
+	ListPaymentRequests(ctx context.Context, walletId uuid.UUID, direction, status string) ([]entity.PaymentRequest, error)
+	// LockPaymentRequest - блокирует запрос (FOR UPDATE) до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockPaymentRequest(ctx context.Context, id uuid.UUID) (entity.PaymentRequest, error)
+	// ResolvePaymentRequest - переводит запрос в конечный статус
+	ResolvePaymentRequest(ctx context.Context, id uuid.UUID, status string, at time.Time) error
+	// ExpirePaymentRequests - помечает expired до limit ожидающих запросов с истекшим сроком; возвращает, сколько помечено
+	ExpirePaymentRequests(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// InvoiceRepo - хранение счетов; оплата идет через WalletService, репозиторий хранит только состояние счета
+type InvoiceRepo interface {
+	// CreateInvoice - сохраняет счет с позициями в статусе open
+	CreateInvoice(ctx context.Context, inv entity.Invoice) (entity.Invoice, error)
+	// GetInvoice - счет с позициями; withPayments - добавить оплаты (для продавца)
+	GetInvoice(ctx context.Context, id uuid.UUID, withPayments bool) (entity.Invoice, error)
+	ListInvoices(ctx context.Context, merchant uuid.UUID, filter entity.InvoiceFilter) ([]entity.Invoice, error)
+	// LockInvoice - блокирует счет (FOR UPDATE) до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockInvoice(ctx context.Context, id uuid.UUID) (entity.Invoice, error)
+	// UpdateInvoiceState - сохраняет Status, PaidAmount, PaidAt и VoidedAt
+	UpdateInvoiceState(ctx context.Context, inv entity.Invoice) error
+	// MarkOverdueInvoices - помечает overdue до limit неоплаченных счетов с прошедшим сроком; возвращает, сколько помечено
+	MarkOverdueInvoices(ctx context.Context, now time.Time, limit int) (int, error)
+}
+
+// AliasRepo - справочник псевдонимов; замененные и удаленные псевдонимы остаются в истории с removed_at
+type AliasRepo interface {
+	// SetAlias - закрывает действующий псевдоним кошелька того же вида и сохраняет новый, атомарно;
+	// тот же псевдоним повторно не создается - возвращается действующий
+	SetAlias(ctx context.Context, a entity.WalletAlias) (entity.WalletAlias, error)
+	RemoveAlias(ctx context.Context, walletId uuid.UUID, kind string) error
+	// withRemoved - вместе с замененными и удаленными
+	ListAliases(ctx context.Context, walletId uuid.UUID, withRemoved bool) ([]entity.WalletAlias, error)
+	// FindAlias - действующий подтвержденный псевдоним
+	FindAlias(ctx context.Context, kind, value string) (entity.WalletAlias, error)
+}
+
+// SavingsGoalRepo - цели накопления карманов; цели закрытых карманов не видны, Saved - текущий баланс кармана
+type SavingsGoalRepo interface {
+	// SetSavingsGoal - создает или заменяет цель открытого кармана
+	SetSavingsGoal(ctx context.Context, goal entity.SavingsGoal) (entity.SavingsGoal, error)
+	GetSavingsGoal(ctx context.Context, walletId, pocketId uuid.UUID) (entity.SavingsGoal, error)
+	ListSavingsGoals(ctx context.Context, walletId uuid.UUID) ([]entity.SavingsGoal, error)
+	DeleteSavingsGoal(ctx context.Context, walletId, pocketId uuid.UUID) error
+}
+
+// InterestRepo - процентные продукты, счета начисления, дневные начисления и выплаты; даты - дни по UTC
+type InterestRepo interface {
+	CreateInterestProduct(ctx context.Context, p entity.InterestProduct) (entity.InterestProduct, error)
+	ListInterestProducts(ctx context.Context) ([]entity.InterestProduct, error)
+	// OpenInterestAccount - подключает кошелек к продукту, начисление - за дни после accruedThrough;
+	// у уже подключенного кошелька меняет продукт и отменяет закрытие, дни повторно не начисляются
+	OpenInterestAccount(ctx context.Context, walletId, productId uuid.UUID, accruedThrough time.Time) (entity.InterestAccount, error)
+	// CloseInterestAccount - начисление прекращается с endsOn, остаток выплачивает воркер
+	CloseInterestAccount(ctx context.Context, walletId uuid.UUID, endsOn time.Time) (entity.InterestAccount, error)
+	// GetInterestAccount - счет вместе с продуктом
+	GetInterestAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error)
+	ListInterestAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.InterestAccrual, error)
+	ListInterestPayouts(ctx context.Context, walletId uuid.UUID) ([]entity.InterestPayout, error)
+	// ClaimDueInterestAccount - блокирует (FOR UPDATE SKIP LOCKED) один счет, по которому есть неначисленный день
+	// не позже through, несделанная выплата или закрытие; вызывать внутри Transactor.WithinTx
+	ClaimDueInterestAccount(ctx context.Context, through, now time.Time) (entity.InterestAccount, error)
+	// EndOfDayBalance - баланс кошелька на момент at, восстановленный по транзакциям
+	EndOfDayBalance(ctx context.Context, walletId uuid.UUID, at time.Time) (float32, error)
+	// SaveInterestAccrual - false, если за этот день уже начислено
+	SaveInterestAccrual(ctx context.Context, a entity.InterestAccrual) (bool, error)
+	// SaveInterestPayout - сохраняет выплату и помечает ею невыплаченные начисления; false, если период уже выплачен
+	SaveInterestPayout(ctx context.Context, p entity.InterestPayout) (bool, error)
+	// UpdateInterestAccountProgress - сохраняет status, accrued_through, pending, payout_due и retry_at
+	UpdateInterestAccountProgress(ctx context.Context, acc entity.InterestAccount) error
+}
+
+// кредитные линии заводит администратор (AdminRepo.SetCreditLine), здесь - чтение и работа воркера
+type CreditRepo interface {
+	// GetCreditLine - линия вместе с текущими лимитом и балансом кошелька
+	GetCreditLine(ctx context.Context, walletId uuid.UUID) (entity.CreditLine, error)
+	ListCreditAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.CreditAccrual, error)
+	ListCreditCharges(ctx context.Context, walletId uuid.UUID) ([]entity.CreditCharge, error)
+	// ListCreditAlerts - уведомления от новых к старым
+	ListCreditAlerts(ctx context.Context, walletId uuid.UUID) ([]entity.CreditAlert, error)
+	// ClaimDueCreditLine - блокирует (FOR UPDATE SKIP LOCKED) одну линию, по которой есть неначисленный день
+	// не позже through или несделанное списание; вызывать внутри Transactor.WithinTx
+	ClaimDueCreditLine(ctx context.Context, through, now time.Time) (entity.CreditLine, error)
+	// ClaimCreditAlert - блокирует одну линию, у которой поменялся наибольший достигнутый порог из thresholds;
+	// возвращает его (0 - ни одного). Вызывать внутри Transactor.WithinTx
+	ClaimCreditAlert(ctx context.Context, thresholds []int) (entity.CreditLine, int, error)
+	// SaveCreditAlert - сохраняет уведомление и запоминает его порог в линии
+	SaveCreditAlert(ctx context.Context, a entity.CreditAlert) (entity.CreditAlert, error)
+	SetCreditAlertThreshold(ctx context.Context, walletId uuid.UUID, threshold int) error
+	// EndOfDayBalance - баланс кошелька на момент at, восстановленный по транзакциям
+	EndOfDayBalance(ctx context.Context, walletId uuid.UUID, at time.Time) (float32, error)
+	// SaveCreditAccrual - false, если за этот день уже начислено
+	SaveCreditAccrual(ctx context.Context, a entity.CreditAccrual) (bool, error)
+	// SaveCreditCharge - сохраняет списание и помечает им несписанные начисления; false, если период уже списан
+	SaveCreditCharge(ctx context.Context, c entity.CreditCharge) (bool, error)
+	// UpdateCreditLineProgress - сохраняет accrued_through, pending, charge_due и retry_at
+	UpdateCreditLineProgress(ctx context.Context, line entity.CreditLine) error
+}
+
+// DisputeRepo - хранение споров и движение удержанных сумм; допустимость переходов проверяет сервис
+type DisputeRepo interface {
+	// GetTransaction - перевод по id; у корректировок и движений средств сделок одна из сторон - uuid.Nil
+	GetTransaction(ctx context.Context, id int64) (entity.Transaction, error)
+	// CreateDispute - удерживает Amount у получателя (в пределах баланса с кредитным лимитом) и открывает спор
+	// с вложениями; ErrDisputeExists - по переводу уже есть спор
+	CreateDispute(ctx context.Context, d entity.Dispute) (entity.Dispute, error)
+	// GetDispute - спор с вложениями и историей
+	GetDispute(ctx context.Context, id uuid.UUID) (entity.Dispute, error)
+	ListDisputes(ctx context.Context, filter entity.DisputeFilter) ([]entity.Dispute, error)
+	// LockDispute - блокирует спор (FOR UPDATE) до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockDispute(ctx context.Context, id uuid.UUID) (entity.Dispute, error)
+	AddDisputeEvidence(ctx context.Context, id uuid.UUID, evidence []entity.DisputeEvidence) ([]entity.DisputeEvidence, error)
+	// ClaimExpiredDispute - блокирует (FOR UPDATE SKIP LOCKED) один открытый спор с наступившим дедлайном
+	ClaimExpiredDispute(ctx context.Context, now time.Time) (entity.Dispute, error)
+	// SettleDispute - зачисляет удержанную сумму отправителю (reversed) или получателю (released),
+	// меняет статус и пишет историю
+	SettleDispute(ctx context.Context, d entity.Dispute, status, actor, note string) (entity.Dispute, error)
+	// PostponeDisputeDeadline - сдвигает дедлайн и пишет причину в историю
+	PostponeDisputeDeadline(ctx context.Context, id uuid.UUID, deadline time.Time, note string) error
+}
+
+// FraudRepo - история переводов для антифрод-правил и очередь переводов на проверке;
+// в истории учитываются переводы между кошельками, кроме entity.FraudExemptTransferSources, и открытые сделки с удержанием
+type FraudRepo interface {
+	// LockSender - проверки переводов from идут по очереди до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockSender(ctx context.Context, from uuid.UUID) error
+	// CountTransfersSince - сколько исходящих переводов from сделано не раньше since
+	CountTransfersSince(ctx context.Context, from uuid.UUID, since time.Time) (int, error)
+	// HasTransferredTo - переводил ли from когда-либо to
+	HasTransferredTo(ctx context.Context, from, to uuid.UUID) (bool, error)
+	// AverageTransferSince - средняя сумма и количество исходящих переводов from не раньше since
+	AverageTransferSince(ctx context.Context, from uuid.UUID, since time.Time) (float64, int, error)
+	// CountNewRecipientsSince - скольким получателям from сделал первый перевод не раньше since
+	CountNewRecipientsSince(ctx context.Context, from uuid.UUID, since time.Time) (int, error)
+	// HoldTransfer - списывает Amount с отправителя и ставит перевод в очередь на проверку (pending);
+	// проверки и ошибки - как у Transfer
+	HoldTransfer(ctx context.Context, c entity.FraudCase) (entity.FraudCase, error)
+	// SaveBlockedTransfer - сохраняет заблокированный перевод (blocked), средства не двигаются
+	SaveBlockedTransfer(ctx context.Context, c entity.FraudCase) (entity.FraudCase, error)
+	GetFraudCase(ctx context.Context, id uuid.UUID) (entity.FraudCase, error)
+	ListFraudCases(ctx context.Context, filter entity.FraudCaseFilter) ([]entity.FraudCase, error)
+	// LockFraudCase - блокирует запись (FOR UPDATE) до конца транзакции; вызывать внутри Transactor.WithinTx
+	LockFraudCase(ctx context.Context, id uuid.UUID) (entity.FraudCase, error)
+	// SettleFraudCase - зачисляет удержанную сумму получателю (approved) или возвращает отправителю (rejected)
+	// и сохраняет решение
+	SettleFraudCase(ctx context.Context, c entity.FraudCase, status, actor, note string) (entity.FraudCase, error)
 }
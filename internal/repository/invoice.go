@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var invoiceColumns = []string{"id", "merchant", "amount", "currency", "due_at", "reference", "status", "paid_amount", "created_at", "paid_at", "voided_at"}
+
+type invoiceRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+}
+
+func NewInvoiceRepo(db *postgres.Postgres, log *logrus.Logger) *invoiceRepoImpl {
+	return &invoiceRepoImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (ir *invoiceRepoImpl) CreateInvoice(ctx context.Context, inv entity.Invoice) (_ entity.Invoice, err error) {
+	ctx, span := startSpan(ctx, "CreateInvoice")
+	defer func() { endSpan(span, err) }()
+
+	inv.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.CreateInvoice - uuid.NewRandom")
+		return entity.Invoice{}, err
+	}
+	inv.Status = entity.InvoiceOpen
+	inv.PaidAmount = 0
+	inv.CreatedAt = time.Now().UTC()
+
+	err = withinTx(ctx, ir.db, func(ctx context.Context, tx pgx.Tx) error {
+		sql, args, err := ir.db.Builder.
+			Insert("invoices").
+			Columns("id", "merchant", "amount", "currency", "due_at", "reference", "status", "created_at").
+			Values(inv.Id, inv.Merchant, inv.Amount, inv.Currency, inv.DueAt, inv.Reference, inv.Status, inv.CreatedAt).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.CreateInvoice - db.Builder")
+			return err
+		}
+
+		qctx, qspan := startQuerySpan(ctx, "INSERT invoices", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if isForeignKeyViolation(err, "invoices_merchant_fkey") {
+			return repoerrors.ErrWalletNotFound
+		}
+		if isUniqueViolation(err, "invoices_merchant_reference_key") {
+			return repoerrors.ErrInvoiceReferenceExists
+		}
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.CreateInvoice - tx.Exec")
+			return err
+		}
+
+		if len(inv.Items) == 0 {
+			return nil
+		}
+		builder := ir.db.Builder.
+			Insert("invoice_items").
+			Columns("invoice_id", "line_no", "description", "quantity", "unit_price")
+		for i, item := range inv.Items {
+			builder = builder.Values(inv.Id, i, item.Description, item.Quantity, item.UnitPrice)
+		}
+		sql, args, err = builder.ToSql()
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.CreateInvoice - db.Builder")
+			return err
+		}
+
+		qctx, qspan = startQuerySpan(ctx, "INSERT invoice_items", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.CreateInvoice - tx.Exec")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.Invoice{}, err
+	}
+
+	return inv, nil
+}
+
+func (ir *invoiceRepoImpl) GetInvoice(ctx context.Context, id uuid.UUID, withPayments bool) (_ entity.Invoice, err error) {
+	ctx, span := startSpan(ctx, "GetInvoice")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select(invoiceColumns...).
+		From("invoices").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.GetInvoice - db.Builder")
+		return entity.Invoice{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT invoices", sql)
+	inv, err := scanInvoice(conn(ctx, ir.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Invoice{}, repoerrors.ErrInvoiceNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.GetInvoice - QueryRow")
+		return entity.Invoice{}, err
+	}
+
+	inv.Items, err = ir.getItems(ctx, inv.Id)
+	if err != nil {
+		return entity.Invoice{}, err
+	}
+	if withPayments {
+		inv.Payments, err = ir.getPayments(ctx, inv.Id)
+		if err != nil {
+			return entity.Invoice{}, err
+		}
+	}
+	return inv, nil
+}
+
+func (ir *invoiceRepoImpl) ListInvoices(ctx context.Context, merchant uuid.UUID, filter entity.InvoiceFilter) (_ []entity.Invoice, err error) {
+	ctx, span := startSpan(ctx, "ListInvoices")
+	defer func() { endSpan(span, err) }()
+
+	builder := ir.db.Builder.
+		Select(invoiceColumns...).
+		From("invoices").
+		Where("merchant = ?", merchant).
+		OrderBy("created_at", "id")
+	if filter.Status != "" {
+		builder = builder.Where("status = ?", filter.Status)
+	}
+	if filter.Reference != "" {
+		builder = builder.Where("reference = ?", filter.Reference)
+	}
+	if filter.DueFrom != nil {
+		builder = builder.Where(squirrel.GtOrEq{"due_at": *filter.DueFrom})
+	}
+	if filter.DueTo != nil {
+		builder = builder.Where(squirrel.Lt{"due_at": *filter.DueTo})
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.ListInvoices - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT invoices", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.ListInvoices - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invoices []entity.Invoice
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.ListInvoices - rows.Scan")
+			return nil, err
+		}
+		invoices = append(invoices, inv)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.ListInvoices - rows.Err")
+		return nil, err
+	}
+
+	return invoices, nil
+}
+
+func (ir *invoiceRepoImpl) LockInvoice(ctx context.Context, id uuid.UUID) (_ entity.Invoice, err error) {
+	ctx, span := startSpan(ctx, "LockInvoice")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Select(invoiceColumns...).
+		From("invoices").
+		Where("id = ?", id).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.LockInvoice - db.Builder")
+		return entity.Invoice{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT invoices", sql)
+	inv, err := scanInvoice(conn(ctx, ir.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Invoice{}, repoerrors.ErrInvoiceNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.LockInvoice - QueryRow")
+		return entity.Invoice{}, err
+	}
+
+	return inv, nil
+}
+
+func (ir *invoiceRepoImpl) UpdateInvoiceState(ctx context.Context, inv entity.Invoice) (err error) {
+	ctx, span := startSpan(ctx, "UpdateInvoiceState")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := ir.db.Builder.
+		Update("invoices").
+		SetMap(map[string]any{
+			"status":      inv.Status,
+			"paid_amount": inv.PaidAmount,
+			"paid_at":     inv.PaidAt,
+			"voided_at":   inv.VoidedAt,
+		}).
+		Where("id = ?", inv.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.UpdateInvoiceState - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE invoices", sql)
+	_, err = conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.UpdateInvoiceState - Exec")
+		return err
+	}
+
+	return nil
+}
+
+func (ir *invoiceRepoImpl) MarkOverdueInvoices(ctx context.Context, now time.Time, limit int) (_ int, err error) {
+	ctx, span := startSpan(ctx, "MarkOverdueInvoices")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - счет, который прямо сейчас оплачивают, пометим на следующем проходе
+	sql, args, err := ir.db.Builder.
+		Update("invoices").
+		Set("status", entity.InvoiceOverdue).
+		Where("id IN (SELECT id FROM invoices WHERE status IN (?, ?) AND due_at <= ? ORDER BY due_at LIMIT ? FOR UPDATE SKIP LOCKED)",
+			entity.InvoiceOpen, entity.InvoicePartiallyPaid, now, limit).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.MarkOverdueInvoices - db.Builder")
+		return 0, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE invoices", sql)
+	tag, err := conn(ctx, ir.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.MarkOverdueInvoices - Exec")
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func (ir *invoiceRepoImpl) getItems(ctx context.Context, invoiceId uuid.UUID) (_ []entity.InvoiceItem, err error) {
+	sql, args, err := ir.db.Builder.
+		Select("description", "quantity", "unit_price").
+		From("invoice_items").
+		Where("invoice_id = ?", invoiceId).
+		OrderBy("line_no").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getItems - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT invoice_items", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getItems - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []entity.InvoiceItem
+	for rows.Next() {
+		var item entity.InvoiceItem
+		if err := rows.Scan(&item.Description, &item.Quantity, &item.UnitPrice); err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getItems - rows.Scan")
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getItems - rows.Err")
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// оплаты счета - транзакции с источником invoice
+func (ir *invoiceRepoImpl) getPayments(ctx context.Context, invoiceId uuid.UUID) (_ []entity.InvoicePayment, err error) {
+	sql, args, err := ir.db.Builder.
+		Select("made_at", "transfered_from", "amount").
+		From("transactions").
+		Where(squirrel.Eq{"source_type": entity.TransferSourceInvoice, "source_id": invoiceId}).
+		OrderBy("made_at", "id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getPayments - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT transactions", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, ir.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getPayments - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []entity.InvoicePayment
+	for rows.Next() {
+		var p entity.InvoicePayment
+		if err := rows.Scan(&p.Time, &p.From, &p.Amount); err != nil {
+			logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getPayments - rows.Scan")
+			return nil, err
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, ir.log).WithError(err).Error("invoiceRepoImpl.getPayments - rows.Err")
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+func scanInvoice(row pgx.Row) (entity.Invoice, error) {
+	var inv entity.Invoice
+	err := row.Scan(&inv.Id, &inv.Merchant, &inv.Amount, &inv.Currency, &inv.DueAt, &inv.Reference, &inv.Status, &inv.PaidAmount, &inv.CreatedAt, &inv.PaidAt, &inv.VoidedAt)
+	return inv, err
+}
@@ -0,0 +1,425 @@
+// Package memory - реализация repository.WalletRepo в памяти процесса:
+// для юнит-тестов сервисов и локальных демо без postgres. Данные теряются при перезапуске.
+package memory
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+type walletRepoImpl struct {
+	// один мьютекс на все хранилище - перевод атомарен так же, как транзакция в postgres
+	mu           sync.RWMutex
+	wallets      map[uuid.UUID]entity.Wallet
+	transactions []entity.Transaction
+	splits       map[uuid.UUID]entity.SplitPayment
+}
+
+func NewWalletRepo() *walletRepoImpl {
+	return &walletRepoImpl{
+		wallets: make(map[uuid.UUID]entity.Wallet),
+		splits:  make(map[uuid.UUID]entity.SplitPayment),
+	}
+}
+
+func (wr *walletRepoImpl) CreateWallet(ctx context.Context, info entity.WalletInfo) (entity.Wallet, error) {
+	newWalletID, err := uuid.NewRandom()
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+
+	// метки копируются, чтобы вызывающий не мог поменять их в хранилище
+	info.Labels = append([]string{}, info.Labels...)
+	now := time.Now().UTC()
+	wallet := entity.Wallet{Id: newWalletID, Balance: repository.InitialWalletBalance, WalletInfo: info, CreatedAt: now, UpdatedAt: now}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.wallets[newWalletID] = wallet
+
+	return wallet, nil
+}
+
+func (wr *walletRepoImpl) Transfer(ctx context.Context, from, to uuid.UUID, amount float32) error {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	return wr.transfer(ctx, from, to, amount)
+}
+
+// вызывать под wr.mu
+func (wr *walletRepoImpl) transfer(ctx context.Context, from, to uuid.UUID, amount float32) error {
+	if from == to {
+		return repoerrors.ErrSelfTransfer
+	}
+	fromWallet, ok := wr.wallets[from]
+	if !ok {
+		return repoerrors.ErrWalletNotFound
+	}
+	if fromWallet.Frozen {
+		return repoerrors.ErrWalletFrozen
+	}
+	if !repository.CanDebit(fromWallet, amount) {
+		return repoerrors.ErrNotEnoughBalance
+	}
+
+	toWallet, ok := wr.wallets[to]
+	if !ok {
+		return repoerrors.ErrTargetWalletNotFound
+	}
+	if toWallet.Frozen {
+		return repoerrors.ErrTargetWalletFrozen
+	}
+
+	now := time.Now().UTC()
+	fromWallet.Balance -= amount
+	fromWallet.UpdatedAt = now
+	wr.wallets[from] = fromWallet
+	toWallet = wr.wallets[to]
+	toWallet.Balance += amount
+	toWallet.UpdatedAt = now
+	wr.wallets[to] = toWallet
+
+	source, _ := repository.TransferSourceFromContext(ctx)
+	details := repository.TransferDetailsFromContext(ctx)
+	// id - порядковый номер, как у SERIAL в postgres
+	wr.transactions = append(wr.transactions, entity.Transaction{
+		Id:        int64(len(wr.transactions) + 1),
+		Time:      now,
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Source:    source,
+		Memo:      details.Memo,
+		Reference: details.Reference,
+		Metadata:  details.Metadata,
+		ToAlias:   details.ToAlias,
+	})
+
+	// сдача до целой единицы - в карман из правила округления, кроме переводов в свои карманы;
+	// если карман закрыт или своего баланса не хватает (в долг сдача не откладывается), перевод проходит без округления
+	change := repository.RoundUpChange(amount)
+	if change <= 0 || fromWallet.RoundUpPocketId == nil || (toWallet.ParentId != nil && *toWallet.ParentId == from) {
+		return nil
+	}
+	pocket, ok := wr.wallets[*fromWallet.RoundUpPocketId]
+	fromWallet = wr.wallets[from]
+	if !ok || pocket.Frozen || fromWallet.Balance-change < 0 {
+		return nil
+	}
+	fromWallet.Balance -= change
+	wr.wallets[from] = fromWallet
+	pocket.Balance += change
+	pocket.UpdatedAt = now
+	wr.wallets[pocket.Id] = pocket
+	wr.transactions = append(wr.transactions, entity.Transaction{
+		Id:     int64(len(wr.transactions) + 1),
+		Time:   now,
+		From:   from,
+		To:     pocket.Id,
+		Amount: change,
+		Source: &entity.TransferSource{Type: entity.TransferSourceRoundUp, Id: pocket.Id},
+	})
+
+	return nil
+}
+
+func (wr *walletRepoImpl) GetTransactionHistory(ctx context.Context, walletId uuid.UUID, filter entity.TransactionFilter) ([]entity.Transaction, error) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	if _, ok := wr.wallets[walletId]; !ok {
+		return nil, repoerrors.ErrWalletNotFound
+	}
+
+	// транзакции добавляются в порядке совершения - порядок сохраняется
+	var transactions []entity.Transaction
+	for _, tx := range wr.transactions {
+		if filter.Reference != "" && tx.Reference != filter.Reference {
+			continue
+		}
+		if tx.From == walletId || tx.To == walletId {
+			transactions = append(transactions, tx)
+		}
+	}
+
+	// как и в postgres - nil-слайс, если транзакций нет
+	return transactions, nil
+}
+
+func (wr *walletRepoImpl) GetWalletStatus(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	wallet, ok := wr.wallets[walletId]
+	if !ok {
+		return entity.Wallet{}, repoerrors.ErrWalletNotFound
+	}
+	return wallet, nil
+}
+
+func (wr *walletRepoImpl) SplitTransfer(ctx context.Context, sp entity.SplitPayment) (entity.SplitPayment, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return entity.SplitPayment{}, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	fromWallet, ok := wr.wallets[sp.From]
+	if !ok {
+		return entity.SplitPayment{}, repoerrors.ErrWalletNotFound
+	}
+	if fromWallet.Frozen {
+		return entity.SplitPayment{}, repoerrors.ErrWalletFrozen
+	}
+	if !repository.CanDebit(fromWallet, sp.Amount) {
+		return entity.SplitPayment{}, repoerrors.ErrNotEnoughBalance
+	}
+	for _, line := range sp.Lines {
+		toWallet, ok := wr.wallets[line.To]
+		if !ok {
+			return entity.SplitPayment{}, repoerrors.ErrTargetWalletNotFound
+		}
+		if toWallet.Frozen {
+			return entity.SplitPayment{}, repoerrors.ErrTargetWalletFrozen
+		}
+	}
+
+	sp.Id = id
+	sp.Time = time.Now().UTC()
+	source := &entity.TransferSource{Type: entity.TransferSourceSplitPayment, Id: sp.Id}
+
+	fromWallet.Balance -= sp.Amount
+	fromWallet.UpdatedAt = sp.Time
+	wr.wallets[sp.From] = fromWallet
+	for _, line := range sp.Lines {
+		toWallet := wr.wallets[line.To]
+		toWallet.Balance += line.Amount
+		toWallet.UpdatedAt = sp.Time
+		wr.wallets[line.To] = toWallet
+
+		wr.transactions = append(wr.transactions, entity.Transaction{
+			Id:     int64(len(wr.transactions) + 1),
+			Time:   sp.Time,
+			From:   sp.From,
+			To:     line.To,
+			Amount: line.Amount,
+			Source: source,
+		})
+	}
+	wr.splits[sp.Id] = sp
+
+	return sp, nil
+}
+
+func (wr *walletRepoImpl) GetSplitPayment(ctx context.Context, walletId, id uuid.UUID) (entity.SplitPayment, error) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	sp, ok := wr.splits[id]
+	if !ok {
+		return entity.SplitPayment{}, repoerrors.ErrSplitPaymentNotFound
+	}
+	// платеж виден отправителю и получателям
+	if sp.From == walletId {
+		return sp, nil
+	}
+	for _, line := range sp.Lines {
+		if line.To == walletId {
+			return sp, nil
+		}
+	}
+	return entity.SplitPayment{}, repoerrors.ErrSplitPaymentNotFound
+}
+
+func (wr *walletRepoImpl) UpdateWalletInfo(ctx context.Context, walletId uuid.UUID, update entity.WalletInfoUpdate) (entity.Wallet, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	wallet, ok := wr.wallets[walletId]
+	if !ok {
+		return entity.Wallet{}, repoerrors.ErrWalletNotFound
+	}
+	if update.OwnerId == nil && update.DisplayName == nil && update.Labels == nil {
+		return wallet, nil
+	}
+	if update.OwnerId != nil {
+		wallet.OwnerId = *update.OwnerId
+	}
+	if update.DisplayName != nil {
+		wallet.DisplayName = *update.DisplayName
+	}
+	if update.Labels != nil {
+		wallet.Labels = append([]string{}, *update.Labels...)
+	}
+	wallet.UpdatedAt = time.Now().UTC()
+	wr.wallets[walletId] = wallet
+
+	return wallet, nil
+}
+
+func (wr *walletRepoImpl) ListWallets(ctx context.Context, filter entity.WalletFilter) ([]entity.Wallet, error) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	// тот же порядок, что и в postgres: (created_at, id), uuid сравниваются побайтово
+	less := func(a, b entity.Wallet) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return bytes.Compare(a.Id[:], b.Id[:]) < 0
+	}
+
+	var cursor entity.Wallet
+	if filter.After != nil {
+		var ok bool
+		if cursor, ok = wr.wallets[*filter.After]; !ok {
+			return nil, nil
+		}
+	}
+
+	var wallets []entity.Wallet
+	for _, wallet := range wr.wallets {
+		switch {
+		case filter.OwnerId != "" && wallet.OwnerId != filter.OwnerId,
+			filter.Label != "" && !slices.Contains(wallet.Labels, filter.Label),
+			filter.CreatedFrom != nil && wallet.CreatedAt.Before(*filter.CreatedFrom),
+			filter.CreatedTo != nil && !wallet.CreatedAt.Before(*filter.CreatedTo),
+			filter.MinBalance != nil && wallet.Balance < *filter.MinBalance,
+			filter.MaxBalance != nil && wallet.Balance > *filter.MaxBalance,
+			filter.After != nil && !less(cursor, wallet):
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return less(wallets[i], wallets[j]) })
+	if len(wallets) > filter.Limit {
+		wallets = wallets[:filter.Limit]
+	}
+
+	return wallets, nil
+}
+
+func (wr *walletRepoImpl) CreatePocket(ctx context.Context, parentId uuid.UUID, info entity.WalletInfo, limit int) (entity.Wallet, error) {
+	id, err := uuid.NewRandom()
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	parent, ok := wr.wallets[parentId]
+	if !ok {
+		return entity.Wallet{}, repoerrors.ErrWalletNotFound
+	}
+	if parent.ParentId != nil {
+		return entity.Wallet{}, repoerrors.ErrNestedPocket
+	}
+	if len(wr.pockets(parentId)) >= limit {
+		return entity.Wallet{}, repoerrors.ErrTooManyPockets
+	}
+
+	info.Labels = append([]string{}, info.Labels...)
+	if info.OwnerId == "" {
+		info.OwnerId = parent.OwnerId
+	}
+	now := time.Now().UTC()
+	pocket := entity.Wallet{Id: id, ParentId: &parentId, WalletInfo: info, CreatedAt: now, UpdatedAt: now}
+	wr.wallets[id] = pocket
+
+	return pocket, nil
+}
+
+func (wr *walletRepoImpl) ListPockets(ctx context.Context, parentId uuid.UUID) ([]entity.Wallet, error) {
+	wr.mu.RLock()
+	defer wr.mu.RUnlock()
+
+	return wr.pockets(parentId), nil
+}
+
+func (wr *walletRepoImpl) ClosePocket(ctx context.Context, parentId, pocketId uuid.UUID) (entity.Wallet, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	pocket, ok := wr.wallets[pocketId]
+	if !ok || pocket.ParentId == nil || *pocket.ParentId != parentId {
+		return entity.Wallet{}, repoerrors.ErrPocketNotFound
+	}
+	if pocket.ClosedAt != nil {
+		return pocket, nil
+	}
+
+	if pocket.Balance > 0 {
+		sweepCtx := repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourcePocket, Id: pocketId})
+		if err := wr.transfer(sweepCtx, pocketId, parentId, pocket.Balance); err != nil {
+			return entity.Wallet{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	// сдача больше не откладывается в закрытый карман
+	if parent := wr.wallets[parentId]; parent.RoundUpPocketId != nil && *parent.RoundUpPocketId == pocketId {
+		parent.RoundUpPocketId = nil
+		parent.UpdatedAt = now
+		wr.wallets[parentId] = parent
+	}
+	pocket = wr.wallets[pocketId]
+	pocket.Frozen = true
+	pocket.ClosedAt = &now
+	pocket.UpdatedAt = now
+	wr.wallets[pocketId] = pocket
+
+	return pocket, nil
+}
+
+func (wr *walletRepoImpl) SetRoundUp(ctx context.Context, walletId uuid.UUID, pocketId *uuid.UUID) (entity.Wallet, error) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+
+	wallet, ok := wr.wallets[walletId]
+	if !ok {
+		return entity.Wallet{}, repoerrors.ErrWalletNotFound
+	}
+	if pocketId != nil {
+		pocket, ok := wr.wallets[*pocketId]
+		if !ok || pocket.ParentId == nil || *pocket.ParentId != walletId || pocket.ClosedAt != nil {
+			return entity.Wallet{}, repoerrors.ErrPocketNotFound
+		}
+		id := *pocketId
+		pocketId = &id
+	}
+	wallet.RoundUpPocketId = pocketId
+	wallet.UpdatedAt = time.Now().UTC()
+	wr.wallets[walletId] = wallet
+
+	return wallet, nil
+}
+
+// открытые карманы в порядке (created_at, id); вызывать под wr.mu
+func (wr *walletRepoImpl) pockets(parentId uuid.UUID) []entity.Wallet {
+	var pockets []entity.Wallet
+	for _, wallet := range wr.wallets {
+		if wallet.ParentId != nil && *wallet.ParentId == parentId && wallet.ClosedAt == nil {
+			pockets = append(pockets, wallet)
+		}
+	}
+	sort.Slice(pockets, func(i, j int) bool {
+		if !pockets[i].CreatedAt.Equal(pockets[j].CreatedAt) {
+			return pockets[i].CreatedAt.Before(pockets[j].CreatedAt)
+		}
+		return bytes.Compare(pockets[i].Id[:], pockets[j].Id[:]) < 0
+	})
+	return pockets
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/memory"
+	"github.com/timohahaa/ewallet/internal/repository/repotest"
+)
+
+func TestWalletRepo(t *testing.T) {
+	repotest.RunWalletRepoSuite(t, func(t *testing.T) repository.WalletRepo {
+		return memory.NewWalletRepo()
+	})
+}
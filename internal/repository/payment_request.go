@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var paymentRequestColumns = []string{"id", "requester", "payer", "amount", "memo", "status", "expires_at", "created_at", "resolved_at"}
+
+type paymentRequestRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+}
+
+func NewPaymentRequestRepo(db *postgres.Postgres, log *logrus.Logger) *paymentRequestRepoImpl {
+	return &paymentRequestRepoImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (pr *paymentRequestRepoImpl) CreatePaymentRequest(ctx context.Context, req entity.PaymentRequest) (_ entity.PaymentRequest, err error) {
+	ctx, span := startSpan(ctx, "CreatePaymentRequest")
+	defer func() { endSpan(span, err) }()
+
+	req.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.CreatePaymentRequest - uuid.NewRandom")
+		return entity.PaymentRequest{}, err
+	}
+	req.Status = entity.PaymentRequestPending
+	req.CreatedAt = time.Now().UTC()
+
+	sql, args, err := pr.db.Builder.
+		Insert("payment_requests").
+		Columns("id", "requester", "payer", "amount", "memo", "status", "expires_at", "created_at").
+		Values(req.Id, req.Requester, req.Payer, req.Amount, req.Memo, req.Status, req.ExpiresAt, req.CreatedAt).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.CreatePaymentRequest - db.Builder")
+		return entity.PaymentRequest{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT payment_requests", sql)
+	_, err = conn(ctx, pr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if isForeignKeyViolation(err, "payment_requests_requester_fkey") {
+		return entity.PaymentRequest{}, repoerrors.ErrWalletNotFound
+	}
+	if isForeignKeyViolation(err, "payment_requests_payer_fkey") {
+		return entity.PaymentRequest{}, repoerrors.ErrTargetWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.CreatePaymentRequest - Exec")
+		return entity.PaymentRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (pr *paymentRequestRepoImpl) GetPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (_ entity.PaymentRequest, err error) {
+	ctx, span := startSpan(ctx, "GetPaymentRequest")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := pr.db.Builder.
+		Select(paymentRequestColumns...).
+		From("payment_requests").
+		Where("id = ?", id).
+		Where("(requester = ? OR payer = ?)", walletId, walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.GetPaymentRequest - db.Builder")
+		return entity.PaymentRequest{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT payment_requests", sql)
+	req, err := scanPaymentRequest(conn(ctx, pr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.PaymentRequest{}, repoerrors.ErrPaymentRequestNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.GetPaymentRequest - QueryRow")
+		return entity.PaymentRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (pr *paymentRequestRepoImpl) ListPaymentRequests(ctx context.Context, walletId uuid.UUID, direction, status string) (_ []entity.PaymentRequest, err error) {
+	ctx, span := startSpan(ctx, "ListPaymentRequests")
+	defer func() { endSpan(span, err) }()
+
+	builder := pr.db.Builder.
+		Select(paymentRequestColumns...).
+		From("payment_requests").
+		OrderBy("created_at", "id")
+	switch direction {
+	case entity.PaymentRequestsIncoming:
+		builder = builder.Where("payer = ?", walletId)
+	case entity.PaymentRequestsOutgoing:
+		builder = builder.Where("requester = ?", walletId)
+	default:
+		builder = builder.Where("(requester = ? OR payer = ?)", walletId, walletId)
+	}
+	if status != "" {
+		builder = builder.Where("status = ?", status)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ListPaymentRequests - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT payment_requests", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, pr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ListPaymentRequests - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []entity.PaymentRequest
+	for rows.Next() {
+		req, err := scanPaymentRequest(rows)
+		if err != nil {
+			logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ListPaymentRequests - rows.Scan")
+			return nil, err
+		}
+		requests = append(requests, req)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ListPaymentRequests - rows.Err")
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+func (pr *paymentRequestRepoImpl) LockPaymentRequest(ctx context.Context, id uuid.UUID) (_ entity.PaymentRequest, err error) {
+	ctx, span := startSpan(ctx, "LockPaymentRequest")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := pr.db.Builder.
+		Select(paymentRequestColumns...).
+		From("payment_requests").
+		Where("id = ?", id).
+		Suffix("FOR UPDATE").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.LockPaymentRequest - db.Builder")
+		return entity.PaymentRequest{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT payment_requests", sql)
+	req, err := scanPaymentRequest(conn(ctx, pr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.PaymentRequest{}, repoerrors.ErrPaymentRequestNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.LockPaymentRequest - QueryRow")
+		return entity.PaymentRequest{}, err
+	}
+
+	return req, nil
+}
+
+func (pr *paymentRequestRepoImpl) ResolvePaymentRequest(ctx context.Context, id uuid.UUID, status string, at time.Time) (err error) {
+	ctx, span := startSpan(ctx, "ResolvePaymentRequest")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := pr.db.Builder.
+		Update("payment_requests").
+		Set("status", status).
+		Set("resolved_at", at).
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ResolvePaymentRequest - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE payment_requests", sql)
+	tag, err := conn(ctx, pr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ResolvePaymentRequest - Exec")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repoerrors.ErrPaymentRequestNotFound
+	}
+
+	return nil
+}
+
+func (pr *paymentRequestRepoImpl) ExpirePaymentRequests(ctx context.Context, now time.Time, limit int) (_ int, err error) {
+	ctx, span := startSpan(ctx, "ExpirePaymentRequests")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - запрос, который прямо сейчас оплачивают, не трогаем: он истечет на следующем проходе, если оплата не пройдет
+	sql, args, err := pr.db.Builder.
+		Update("payment_requests").
+		Set("status", entity.PaymentRequestExpired).
+		Set("resolved_at", now).
+		Where("id IN (SELECT id FROM payment_requests WHERE status = ? AND expires_at <= ? ORDER BY expires_at LIMIT ? FOR UPDATE SKIP LOCKED)",
+			entity.PaymentRequestPending, now, limit).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ExpirePaymentRequests - db.Builder")
+		return 0, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE payment_requests", sql)
+	tag, err := conn(ctx, pr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, pr.log).WithError(err).Error("paymentRequestRepoImpl.ExpirePaymentRequests - Exec")
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+func scanPaymentRequest(row pgx.Row) (entity.PaymentRequest, error) {
+	var req entity.PaymentRequest
+	err := row.Scan(&req.Id, &req.Requester, &req.Payer, &req.Amount, &req.Memo, &req.Status, &req.ExpiresAt, &req.CreatedAt, &req.ResolvedAt)
+	return req, err
+}
@@ -0,0 +1,96 @@
+// Package pgtest - обвязка для интеграционных тестов репозиториев на локальном postgres.
+// Каждый тест получает собственную схему с накатанными миграциями, схема удаляется после теста.
+// Если PG_URL не задан, тест пропускается.
+//
+//	func TestWalletRepoPostgres(t *testing.T) {
+//		repotest.RunWalletRepoSuite(t, func(t *testing.T) repository.WalletRepo {
+//			return repository.NewWalletRepo(pgtest.New(t), logrus.New())
+//		})
+//	}
+package pgtest
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/timohahaa/ewallet/migrations"
+	"github.com/timohahaa/ewallet/pkg/migrator"
+	"github.com/timohahaa/postgres"
+)
+
+const (
+	// переменная окружения с адресом тестовой базы
+	EnvURL = "PG_URL"
+
+	poolSize = 10
+)
+
+// New - подключение к чистой схеме тестовой базы
+func New(t testing.TB) *postgres.Postgres {
+	t.Helper()
+
+	baseURL := strings.TrimSpace(os.Getenv(EnvURL))
+	if baseURL == "" {
+		t.Skipf("%s is not set, skipping postgres integration test", EnvURL)
+	}
+	ctx := context.Background()
+
+	schema := "test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	admin, err := pgx.Connect(ctx, baseURL)
+	if err != nil {
+		t.Fatalf("pgtest: connect: %v", err)
+	}
+	defer admin.Close(ctx)
+	if _, err := admin.Exec(ctx, "CREATE SCHEMA "+schema); err != nil {
+		t.Fatalf("pgtest: create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		conn, err := pgx.Connect(context.Background(), baseURL)
+		if err != nil {
+			t.Errorf("pgtest: connect for cleanup: %v", err)
+			return
+		}
+		defer conn.Close(context.Background())
+		if _, err := conn.Exec(context.Background(), "DROP SCHEMA "+schema+" CASCADE"); err != nil {
+			t.Errorf("pgtest: drop schema: %v", err)
+		}
+	})
+
+	// неизвестные pgx параметры строки подключения уходят в runtime params - все соединения пула смотрят в свою схему
+	schemaURL, err := withSearchPath(baseURL, schema)
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+	pg, err := postgres.New(schemaURL, postgres.MaxConnPoolSize(poolSize), postgres.ConnectionAttempts(1))
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+	t.Cleanup(pg.ConnPool.Close)
+
+	migr, err := migrator.New(pg.ConnPool, migrations.FS)
+	if err != nil {
+		t.Fatalf("pgtest: load migrations: %v", err)
+	}
+	if _, err := migr.Up(ctx); err != nil {
+		t.Fatalf("pgtest: apply migrations: %v", err)
+	}
+
+	return pg
+}
+
+func withSearchPath(rawURL, schema string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("parse %s: %w", EnvURL, err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// CreatePocket - карман с нулевым балансом; родитель блокируется, поэтому лимит limit не превышается
+// и при одновременном создании карманов
+func (wr *walletRepoImpl) CreatePocket(ctx context.Context, parentId uuid.UUID, info entity.WalletInfo, limit int) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "CreatePocket")
+	defer func() { endSpan(span, err) }()
+
+	var pocket entity.Wallet
+	err = withinTx(ctx, wr.db, func(ctx context.Context, tx pgx.Tx) error {
+		parent, err := wr.getWallet(ctx, tx, parentId, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if parent.ParentId != nil {
+			return repoerrors.ErrNestedPocket
+		}
+
+		sql, args, err := wr.db.Builder.
+			Select("count(*)").
+			From("wallets").
+			Where("parent_id = ? AND closed_at IS NULL", parentId).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreatePocket - db.Builder")
+			return err
+		}
+		var open int
+		qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+		err = tx.QueryRow(qctx, sql, args...).Scan(&open)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreatePocket - QueryRow")
+			return err
+		}
+		if open >= limit {
+			return repoerrors.ErrTooManyPockets
+		}
+
+		id, err := uuid.NewRandom()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreatePocket - uuid.NewRandom")
+			return err
+		}
+		if info.Labels == nil {
+			info.Labels = []string{}
+		}
+		// без явного владельца карман принадлежит владельцу кошелька
+		if info.OwnerId == "" {
+			info.OwnerId = parent.OwnerId
+		}
+		now := time.Now().UTC()
+		pocket = entity.Wallet{Id: id, ParentId: &parentId, WalletInfo: info, CreatedAt: now, UpdatedAt: now}
+
+		sql, args, err = wr.db.Builder.
+			Insert("wallets").
+			Columns("id", "balance", "parent_id", "owner_id", "display_name", "labels", "created_at", "updated_at").
+			Values(pocket.Id, pocket.Balance, parentId, info.OwnerId, info.DisplayName, info.Labels, now, now).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreatePocket - db.Builder")
+			return err
+		}
+
+		qctx, qspan = startQuerySpan(ctx, "INSERT wallets", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreatePocket - tx.Exec")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+
+	return pocket, nil
+}
+
+// ListPockets - открытые карманы кошелька по возрастанию (created_at, id)
+func (wr *walletRepoImpl) ListPockets(ctx context.Context, parentId uuid.UUID) (_ []entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "ListPockets")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := wr.db.Builder.
+		Select(walletColumns...).
+		From("wallets").
+		Where("parent_id = ? AND closed_at IS NULL", parentId).
+		OrderBy("created_at", "id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListPockets - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, wr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListPockets - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pockets []entity.Wallet
+	for rows.Next() {
+		pocket, err := scanWallet(rows)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListPockets - rows.Scan")
+			return nil, err
+		}
+		pockets = append(pockets, pocket)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListPockets - rows.Err")
+		return nil, err
+	}
+
+	return pockets, nil
+}
+
+// ClosePocket - переводит весь баланс кармана родителю (источник pocket), замораживает карман и помечает закрытым;
+// закрытие уже закрытого кармана возвращает его без изменений
+func (wr *walletRepoImpl) ClosePocket(ctx context.Context, parentId, pocketId uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "ClosePocket")
+	defer func() { endSpan(span, err) }()
+
+	var pocket entity.Wallet
+	err = withinTx(ctx, wr.db, func(ctx context.Context, tx pgx.Tx) error {
+		for _, id := range lockOrder(parentId, pocketId) {
+			wallet, err := wr.getWallet(ctx, tx, id, true)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return repoerrors.ErrPocketNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if id == pocketId {
+				pocket = wallet
+			}
+		}
+		if pocket.ParentId == nil || *pocket.ParentId != parentId {
+			return repoerrors.ErrPocketNotFound
+		}
+		if pocket.ClosedAt != nil {
+			return nil
+		}
+
+		if pocket.Balance > 0 {
+			sweepCtx := WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourcePocket, Id: pocketId})
+			if err := wr.transfer(sweepCtx, tx, pocketId, parentId, pocket.Balance); err != nil {
+				return err
+			}
+		}
+
+		// сдача больше не откладывается в закрытый карман
+		sql, args, err := wr.db.Builder.
+			Update("wallets").
+			Set("round_up_pocket_id", nil).
+			Where("id = ? AND round_up_pocket_id = ?", parentId, pocketId).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ClosePocket - db.Builder")
+			return err
+		}
+		qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ClosePocket - tx.Exec")
+			return err
+		}
+
+		sql, args, err = wr.db.Builder.
+			Update("wallets").
+			Set("frozen", true).
+			Set("closed_at", time.Now().UTC()).
+			Where("id = ?", pocketId).
+			Suffix("RETURNING " + strings.Join(walletColumns, ", ")).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ClosePocket - db.Builder")
+			return err
+		}
+
+		qctx, qspan = startQuerySpan(ctx, "UPDATE wallets", sql)
+		pocket, err = scanWallet(tx.QueryRow(qctx, sql, args...))
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ClosePocket - QueryRow")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+
+	return pocket, nil
+}
+
+// SetRoundUp - карман для сдачи исходящих переводов; nil - выключить округление
+func (wr *walletRepoImpl) SetRoundUp(ctx context.Context, walletId uuid.UUID, pocketId *uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "SetRoundUp")
+	defer func() { endSpan(span, err) }()
+
+	var wallet entity.Wallet
+	err = withinTx(ctx, wr.db, func(ctx context.Context, tx pgx.Tx) error {
+		ids := []uuid.UUID{walletId}
+		if pocketId != nil {
+			ids = append(ids, *pocketId)
+		}
+		locked := make(map[uuid.UUID]entity.Wallet, len(ids))
+		for _, id := range lockOrder(ids...) {
+			w, err := wr.getWallet(ctx, tx, id, true)
+			if errors.Is(err, pgx.ErrNoRows) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			locked[id] = w
+		}
+		if _, ok := locked[walletId]; !ok {
+			return repoerrors.ErrWalletNotFound
+		}
+		if pocketId != nil {
+			pocket, ok := locked[*pocketId]
+			if !ok || pocket.ParentId == nil || *pocket.ParentId != walletId || pocket.ClosedAt != nil {
+				return repoerrors.ErrPocketNotFound
+			}
+		}
+
+		sql, args, err := wr.db.Builder.
+			Update("wallets").
+			Set("round_up_pocket_id", pocketId).
+			Where("id = ?", walletId).
+			Suffix("RETURNING " + strings.Join(walletColumns, ", ")).
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SetRoundUp - db.Builder")
+			return err
+		}
+
+		qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+		wallet, err = scanWallet(tx.QueryRow(qctx, sql, args...))
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SetRoundUp - QueryRow")
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+
+	return wallet, nil
+}
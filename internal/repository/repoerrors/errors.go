@@ -6,4 +6,68 @@ var (
 	ErrWalletNotFound       = errors.New("wallet not found")
 	ErrTargetWalletNotFound = errors.New("target wallet not found")
 	ErrNotEnoughBalance     = errors.New("not enough balance")
+	ErrWalletFrozen         = errors.New("wallet is frozen")
+	ErrTargetWalletFrozen   = errors.New("target wallet is frozen")
+	// перевод самому себе: обе стороны - одна строка, второе обновление затерло бы списание
+	ErrSelfTransfer = errors.New("cannot transfer to the same wallet")
+
+	ErrSplitPaymentNotFound = errors.New("split payment not found")
+
+	ErrScheduledTransferNotFound   = errors.New("scheduled transfer not found")
+	ErrScheduledTransferNotPending = errors.New("scheduled transfer is not pending")
+	// нет переводов, время которых наступило
+	ErrNoDueScheduledTransfers = errors.New("no due scheduled transfers")
+
+	ErrStandingOrderNotFound  = errors.New("standing order not found")
+	ErrStandingOrderNotActive = errors.New("standing order is not active")
+	// нет поручений, время очередного запуска которых наступило
+	ErrNoDueStandingOrders = errors.New("no due standing orders")
+
+	ErrBatchTransferNotFound = errors.New("batch transfer not found")
+	// нет пакетов, ожидающих исполнения
+	ErrNoPendingBatchTransfers = errors.New("no pending batch transfers")
+
+	ErrEscrowNotFound = errors.New("escrow not found")
+	// нет сделок с истекшим дедлайном
+	ErrNoExpiredEscrows = errors.New("no expired escrows")
+
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	// у продавца уже есть счет с таким reference
+	ErrInvoiceReferenceExists = errors.New("invoice reference already exists")
+
+	ErrAliasNotFound = errors.New("alias not found")
+	// действующий подтвержденный псевдоним уже закреплен за другим кошельком
+	ErrAliasTaken = errors.New("alias is already taken")
+
+	ErrPocketNotFound = errors.New("pocket not found")
+	// карман не может быть родителем другого кармана
+	ErrNestedPocket = errors.New("a pocket can't have pockets")
+	// у кошелька уже максимальное кол-во открытых карманов
+	ErrTooManyPockets = errors.New("too many pockets")
+
+	ErrSavingsGoalNotFound = errors.New("savings goal not found")
+
+	ErrInterestProductNotFound = errors.New("interest product not found")
+	ErrInterestAccountNotFound = errors.New("interest account not found")
+	// нет счетов, по которым пора начислять или выплачивать проценты
+	ErrNoDueInterestAccounts = errors.New("no due interest accounts")
+
+	ErrCreditLineNotFound = errors.New("credit line not found")
+	// новый лимит меньше текущей задолженности кошелька
+	ErrCreditLimitBelowDebt = errors.New("credit limit is below the current debt")
+	// нет кредитных линий, по которым пора начислять или списывать
+	ErrNoDueCreditLines = errors.New("no due credit lines")
+	// нет кредитных линий, у которых поменялся достигнутый порог использования лимита
+	ErrNoCreditAlertsDue = errors.New("no credit alerts due")
+
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrDisputeNotFound     = errors.New("dispute not found")
+	// по переводу уже открывался спор
+	ErrDisputeExists = errors.New("dispute already exists")
+	// нет открытых споров с наступившим дедлайном
+	ErrNoExpiredDisputes = errors.New("no expired disputes")
+
+	ErrFraudCaseNotFound = errors.New("fraud case not found")
 )
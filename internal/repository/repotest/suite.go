@@ -0,0 +1,647 @@
+// Package repotest - общий набор проверок семантики repository.WalletRepo.
+// Любая реализация (postgres, memory) должна его проходить:
+//
+//	func TestWalletRepo(t *testing.T) {
+//		repotest.RunWalletRepoSuite(t, func(t *testing.T) repository.WalletRepo {
+//			return memory.NewWalletRepo()
+//		})
+//	}
+package repotest
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+// NewRepoFunc - возвращает пустой репозиторий, изолированный от других тестов
+type NewRepoFunc func(t *testing.T) repository.WalletRepo
+
+const balanceTolerance = 1e-3
+
+func RunWalletRepoSuite(t *testing.T, newRepo NewRepoFunc) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repo repository.WalletRepo)
+	}{
+		{"CreateWallet", testCreateWallet},
+		{"WalletNotFound", testWalletNotFound},
+		{"TransferSuccess", testTransferSuccess},
+		{"TransferErrors", testTransferErrors},
+		{"HistoryOrdering", testHistoryOrdering},
+		{"HistoryEmpty", testHistoryEmpty},
+		{"ConcurrentTransfers", testConcurrentTransfers},
+		{"SplitTransfer", testSplitTransfer},
+		{"SplitTransferErrors", testSplitTransferErrors},
+		{"TransferDetails", testTransferDetails},
+		{"UpdateWalletInfo", testUpdateWalletInfo},
+		{"ListWallets", testListWallets},
+		{"Pockets", testPockets},
+		{"ClosePocket", testClosePocket},
+		{"RoundUp", testRoundUp},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, newRepo(t))
+		})
+	}
+}
+
+func testCreateWallet(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+
+	info := entity.WalletInfo{OwnerId: "user-1", DisplayName: "Savings", Labels: []string{"personal", "rub"}}
+	wallet, err := repo.CreateWallet(ctx, info)
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+	if wallet.Id == uuid.Nil {
+		t.Fatal("CreateWallet: zero wallet id")
+	}
+	assertBalance(t, repo, wallet.Id, repository.InitialWalletBalance)
+
+	got, err := repo.GetWalletStatus(ctx, wallet.Id)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	if !reflect.DeepEqual(got.WalletInfo, info) {
+		t.Errorf("GetWalletStatus: got info %+v, want %+v", got.WalletInfo, info)
+	}
+	if got.CreatedAt.IsZero() || got.UpdatedAt.IsZero() {
+		t.Errorf("GetWalletStatus: got createdAt %v, updatedAt %v, want non-zero", got.CreatedAt, got.UpdatedAt)
+	}
+}
+
+func testWalletNotFound(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+
+	if _, err := repo.GetWalletStatus(ctx, uuid.New()); !errors.Is(err, repoerrors.ErrWalletNotFound) {
+		t.Errorf("GetWalletStatus: got %v, want %v", err, repoerrors.ErrWalletNotFound)
+	}
+	if _, err := repo.GetTransactionHistory(ctx, uuid.New(), entity.TransactionFilter{}); !errors.Is(err, repoerrors.ErrWalletNotFound) {
+		t.Errorf("GetTransactionHistory: got %v, want %v", err, repoerrors.ErrWalletNotFound)
+	}
+}
+
+func testTransferSuccess(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	from, to := mustCreate(t, repo), mustCreate(t, repo)
+
+	if err := repo.Transfer(ctx, from, to, 25.5); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	assertBalance(t, repo, from, repository.InitialWalletBalance-25.5)
+	assertBalance(t, repo, to, repository.InitialWalletBalance+25.5)
+
+	// весь баланс целиком - допустимо
+	if err := repo.Transfer(ctx, from, to, repository.InitialWalletBalance-25.5); err != nil {
+		t.Fatalf("Transfer whole balance: %v", err)
+	}
+	assertBalance(t, repo, from, 0)
+}
+
+func testTransferErrors(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	from, to := mustCreate(t, repo), mustCreate(t, repo)
+
+	tests := []struct {
+		name     string
+		from, to uuid.UUID
+		amount   float32
+		want     error
+	}{
+		{"source not found", uuid.New(), to, 1, repoerrors.ErrWalletNotFound},
+		{"source and target not found", uuid.New(), uuid.New(), 1, repoerrors.ErrWalletNotFound},
+		{"target not found", from, uuid.New(), 1, repoerrors.ErrTargetWalletNotFound},
+		{"not enough balance", from, to, repository.InitialWalletBalance + 1, repoerrors.ErrNotEnoughBalance},
+		{"self transfer", from, from, 1, repoerrors.ErrSelfTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Transfer(ctx, tt.from, tt.to, tt.amount); !errors.Is(err, tt.want) {
+				t.Errorf("Transfer: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// неудачные переводы ничего не меняют
+	assertBalance(t, repo, from, repository.InitialWalletBalance)
+	assertBalance(t, repo, to, repository.InitialWalletBalance)
+	history, err := repo.GetTransactionHistory(ctx, from, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("GetTransactionHistory: got %d transactions after failed transfers, want 0", len(history))
+	}
+}
+
+func testHistoryOrdering(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	a, b, c := mustCreate(t, repo), mustCreate(t, repo), mustCreate(t, repo)
+
+	transfers := []struct {
+		from, to uuid.UUID
+		amount   float32
+	}{
+		{a, b, 1}, {b, a, 2}, {c, a, 3}, {b, c, 4}, {a, c, 5},
+	}
+	for _, tr := range transfers {
+		if err := repo.Transfer(ctx, tr.from, tr.to, tr.amount); err != nil {
+			t.Fatalf("Transfer: %v", err)
+		}
+	}
+
+	history, err := repo.GetTransactionHistory(ctx, a, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	// b->c не касается a
+	wantAmounts := []float32{1, 2, 3, 5}
+	if len(history) != len(wantAmounts) {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want %d", len(history), len(wantAmounts))
+	}
+	for i, tx := range history {
+		if tx.Amount != wantAmounts[i] {
+			t.Errorf("history[%d].Amount = %v, want %v", i, tx.Amount, wantAmounts[i])
+		}
+		if i > 0 && tx.Time.Before(history[i-1].Time) {
+			t.Errorf("history[%d] is older than history[%d]", i, i-1)
+		}
+	}
+}
+
+func testHistoryEmpty(t *testing.T, repo repository.WalletRepo) {
+	history, err := repo.GetTransactionHistory(context.Background(), mustCreate(t, repo), entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if history != nil {
+		t.Errorf("GetTransactionHistory: got %v, want nil", history)
+	}
+}
+
+// встречные параллельные переводы: сумма балансов сохраняется, ни один баланс не уходит в минус,
+// каждому успешному переводу соответствует запись в истории
+func testConcurrentTransfers(t *testing.T, repo repository.WalletRepo) {
+	const (
+		workers   = 8
+		perWorker = 25
+		amount    = 7
+	)
+	ctx := context.Background()
+	a, b := mustCreate(t, repo), mustCreate(t, repo)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for w := 0; w < workers; w++ {
+		from, to := a, b
+		if w%2 == 1 {
+			from, to = b, a
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				err := repo.Transfer(ctx, from, to, amount)
+				if errors.Is(err, repoerrors.ErrNotEnoughBalance) {
+					continue
+				}
+				if err != nil {
+					t.Errorf("Transfer: %v", err)
+					return
+				}
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	walletA, err := repo.GetWalletStatus(ctx, a)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	walletB, err := repo.GetWalletStatus(ctx, b)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	if walletA.Balance < 0 || walletB.Balance < 0 {
+		t.Errorf("negative balance: a=%v b=%v", walletA.Balance, walletB.Balance)
+	}
+	if total := walletA.Balance + walletB.Balance; math.Abs(float64(total-2*repository.InitialWalletBalance)) > balanceTolerance {
+		t.Errorf("total balance = %v, want %v", total, 2*repository.InitialWalletBalance)
+	}
+
+	history, err := repo.GetTransactionHistory(ctx, a, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != succeeded {
+		t.Errorf("history has %d transactions, want %d", len(history), succeeded)
+	}
+}
+
+// разделенный платеж: одно списание, зачисления по строкам, строки в истории помечены источником,
+// платеж виден отправителю и получателям, но не посторонним
+func testSplitTransfer(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	from, seller, platform, stranger := mustCreate(t, repo), mustCreate(t, repo), mustCreate(t, repo), mustCreate(t, repo)
+
+	sp, err := repo.SplitTransfer(ctx, entity.SplitPayment{
+		From:   from,
+		Amount: 30,
+		Lines:  []entity.SplitLine{{To: seller, Amount: 27}, {To: platform, Amount: 3}},
+	})
+	if err != nil {
+		t.Fatalf("SplitTransfer: %v", err)
+	}
+	if sp.Id == uuid.Nil {
+		t.Fatal("SplitTransfer: zero split payment id")
+	}
+	assertBalance(t, repo, from, repository.InitialWalletBalance-30)
+	assertBalance(t, repo, seller, repository.InitialWalletBalance+27)
+	assertBalance(t, repo, platform, repository.InitialWalletBalance+3)
+
+	history, err := repo.GetTransactionHistory(ctx, from, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want 2", len(history))
+	}
+	for i, tx := range history {
+		if tx.Source == nil || tx.Source.Type != entity.TransferSourceSplitPayment || tx.Source.Id != sp.Id {
+			t.Errorf("history[%d].Source = %v, want split payment %s", i, tx.Source, sp.Id)
+		}
+	}
+
+	for _, walletId := range []uuid.UUID{from, seller, platform} {
+		got, err := repo.GetSplitPayment(ctx, walletId, sp.Id)
+		if err != nil {
+			t.Fatalf("GetSplitPayment: %v", err)
+		}
+		if len(got.Lines) != 2 {
+			t.Errorf("GetSplitPayment: got %d lines, want 2", len(got.Lines))
+		}
+	}
+	if _, err := repo.GetSplitPayment(ctx, stranger, sp.Id); !errors.Is(err, repoerrors.ErrSplitPaymentNotFound) {
+		t.Errorf("GetSplitPayment by stranger: got %v, want %v", err, repoerrors.ErrSplitPaymentNotFound)
+	}
+	if _, err := repo.GetSplitPayment(ctx, from, uuid.New()); !errors.Is(err, repoerrors.ErrSplitPaymentNotFound) {
+		t.Errorf("GetSplitPayment: got %v, want %v", err, repoerrors.ErrSplitPaymentNotFound)
+	}
+}
+
+// неудачный разделенный платеж не меняет ни один баланс
+func testSplitTransferErrors(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	from, to := mustCreate(t, repo), mustCreate(t, repo)
+
+	tests := []struct {
+		name   string
+		from   uuid.UUID
+		amount float32
+		lines  []entity.SplitLine
+		want   error
+	}{
+		{"source not found", uuid.New(), 2, []entity.SplitLine{{To: to, Amount: 2}}, repoerrors.ErrWalletNotFound},
+		{"one target not found", from, 2, []entity.SplitLine{{To: to, Amount: 1}, {To: uuid.New(), Amount: 1}}, repoerrors.ErrTargetWalletNotFound},
+		{"not enough balance", from, repository.InitialWalletBalance + 2, []entity.SplitLine{{To: to, Amount: repository.InitialWalletBalance + 2}}, repoerrors.ErrNotEnoughBalance},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := repo.SplitTransfer(ctx, entity.SplitPayment{From: tt.from, Amount: tt.amount, Lines: tt.lines})
+			if !errors.Is(err, tt.want) {
+				t.Errorf("SplitTransfer: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	assertBalance(t, repo, from, repository.InitialWalletBalance)
+	assertBalance(t, repo, to, repository.InitialWalletBalance)
+}
+
+func mustCreate(t *testing.T, repo repository.WalletRepo) uuid.UUID {
+	t.Helper()
+	wallet, err := repo.CreateWallet(context.Background(), entity.WalletInfo{})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+	return wallet.Id
+}
+
+func assertBalance(t *testing.T, repo repository.WalletRepo, walletId uuid.UUID, want float32) {
+	t.Helper()
+	wallet, err := repo.GetWalletStatus(context.Background(), walletId)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	if math.Abs(float64(wallet.Balance-want)) > balanceTolerance {
+		t.Errorf("balance = %v, want %v", wallet.Balance, want)
+	}
+}
+
+// memo, reference и metadata из контекста сохраняются с транзакцией, история фильтруется по reference
+func testTransferDetails(t *testing.T, repo repository.WalletRepo) {
+	from, to := mustCreate(t, repo), mustCreate(t, repo)
+
+	details := entity.TransferDetails{Memo: "rent", Reference: "inv-42", Metadata: map[string]any{"orderId": "42"}}
+	if err := repo.Transfer(repository.WithTransferDetails(context.Background(), details), from, to, 10); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := repo.Transfer(context.Background(), from, to, 5); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	history, err := repo.GetTransactionHistory(context.Background(), to, entity.TransactionFilter{Reference: "inv-42"})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetTransactionHistory by reference: got %d transactions, want 1", len(history))
+	}
+	tx := history[0]
+	if tx.Memo != details.Memo || tx.Reference != details.Reference || tx.Metadata["orderId"] != "42" {
+		t.Errorf("GetTransactionHistory: got memo %q, reference %q, metadata %v, want %+v", tx.Memo, tx.Reference, tx.Metadata, details)
+	}
+
+	history, err = repo.GetTransactionHistory(context.Background(), from, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want 2", len(history))
+	}
+	if plain := history[1]; plain.Memo != "" || plain.Reference != "" || plain.Metadata != nil {
+		t.Errorf("GetTransactionHistory: transfer without details got memo %q, reference %q, metadata %v", plain.Memo, plain.Reference, plain.Metadata)
+	}
+}
+
+// меняются только заданные поля, баланс не трогается
+func testUpdateWalletInfo(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	wallet, err := repo.CreateWallet(ctx, entity.WalletInfo{OwnerId: "user-1", DisplayName: "Main", Labels: []string{"a"}})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+
+	name, labels := "Travel", []string{"b", "c"}
+	updated, err := repo.UpdateWalletInfo(ctx, wallet.Id, entity.WalletInfoUpdate{DisplayName: &name, Labels: &labels})
+	if err != nil {
+		t.Fatalf("UpdateWalletInfo: %v", err)
+	}
+	want := entity.WalletInfo{OwnerId: "user-1", DisplayName: name, Labels: labels}
+	if !reflect.DeepEqual(updated.WalletInfo, want) {
+		t.Errorf("UpdateWalletInfo: got info %+v, want %+v", updated.WalletInfo, want)
+	}
+	if updated.UpdatedAt.Before(wallet.UpdatedAt) {
+		t.Errorf("UpdateWalletInfo: updatedAt %v is before %v", updated.UpdatedAt, wallet.UpdatedAt)
+	}
+	assertBalance(t, repo, wallet.Id, repository.InitialWalletBalance)
+
+	if _, err := repo.UpdateWalletInfo(ctx, uuid.New(), entity.WalletInfoUpdate{DisplayName: &name}); !errors.Is(err, repoerrors.ErrWalletNotFound) {
+		t.Errorf("UpdateWalletInfo: got %v, want %v", err, repoerrors.ErrWalletNotFound)
+	}
+}
+
+// фильтры и постраничный обход курсором
+func testListWallets(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	// у владельца - уникальный id, чтобы не зависеть от кошельков других проверок в той же базе
+	owner := "owner-" + uuid.NewString()
+
+	var ids []uuid.UUID
+	for i := 0; i < 5; i++ {
+		labels := []string{"even"}
+		if i%2 == 1 {
+			labels = []string{"odd"}
+		}
+		wallet, err := repo.CreateWallet(ctx, entity.WalletInfo{OwnerId: owner, Labels: labels})
+		if err != nil {
+			t.Fatalf("CreateWallet: %v", err)
+		}
+		ids = append(ids, wallet.Id)
+	}
+	if err := repo.Transfer(ctx, ids[0], ids[1], 50); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	var paged []uuid.UUID
+	filter := entity.WalletFilter{OwnerId: owner, Limit: 2}
+	for page := 0; ; page++ {
+		if page > len(ids) {
+			t.Fatal("ListWallets: pagination does not terminate")
+		}
+		wallets, err := repo.ListWallets(ctx, filter)
+		if err != nil {
+			t.Fatalf("ListWallets: %v", err)
+		}
+		for _, w := range wallets {
+			paged = append(paged, w.Id)
+		}
+		if len(wallets) < filter.Limit {
+			break
+		}
+		filter.After = &wallets[len(wallets)-1].Id
+	}
+	if len(paged) != len(ids) {
+		t.Fatalf("ListWallets: got %d wallets over all pages, want %d", len(paged), len(ids))
+	}
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range paged {
+		if seen[id] {
+			t.Fatalf("ListWallets: wallet %v returned twice", id)
+		}
+		seen[id] = true
+	}
+
+	wallets, err := repo.ListWallets(ctx, entity.WalletFilter{OwnerId: owner, Label: "odd", Limit: 10})
+	if err != nil {
+		t.Fatalf("ListWallets: %v", err)
+	}
+	if len(wallets) != 2 {
+		t.Errorf("ListWallets by label: got %d wallets, want 2", len(wallets))
+	}
+
+	minBalance := float32(120)
+	wallets, err = repo.ListWallets(ctx, entity.WalletFilter{OwnerId: owner, MinBalance: &minBalance, Limit: 10})
+	if err != nil {
+		t.Fatalf("ListWallets: %v", err)
+	}
+	if len(wallets) != 1 || wallets[0].Id != ids[1] {
+		t.Errorf("ListWallets by balance: got %v, want only %v", wallets, ids[1])
+	}
+}
+
+// карман создается с нулевым балансом и владельцем родителя, вложенные карманы и превышение лимита запрещены
+func testPockets(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	parent, err := repo.CreateWallet(ctx, entity.WalletInfo{OwnerId: "user-1"})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+
+	first, err := repo.CreatePocket(ctx, parent.Id, entity.WalletInfo{DisplayName: "Vacation"}, 2)
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+	if first.ParentId == nil || *first.ParentId != parent.Id || first.Balance != 0 || first.OwnerId != "user-1" {
+		t.Errorf("CreatePocket: got parent %v, balance %v, owner %q, want %v, 0, %q", first.ParentId, first.Balance, first.OwnerId, parent.Id, "user-1")
+	}
+	second, err := repo.CreatePocket(ctx, parent.Id, entity.WalletInfo{}, 2)
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+
+	if _, err := repo.CreatePocket(ctx, parent.Id, entity.WalletInfo{}, 2); !errors.Is(err, repoerrors.ErrTooManyPockets) {
+		t.Errorf("CreatePocket over limit: got %v, want %v", err, repoerrors.ErrTooManyPockets)
+	}
+	if _, err := repo.CreatePocket(ctx, first.Id, entity.WalletInfo{}, 2); !errors.Is(err, repoerrors.ErrNestedPocket) {
+		t.Errorf("CreatePocket in pocket: got %v, want %v", err, repoerrors.ErrNestedPocket)
+	}
+	if _, err := repo.CreatePocket(ctx, uuid.New(), entity.WalletInfo{}, 2); !errors.Is(err, repoerrors.ErrWalletNotFound) {
+		t.Errorf("CreatePocket for missing wallet: got %v, want %v", err, repoerrors.ErrWalletNotFound)
+	}
+
+	pockets, err := repo.ListPockets(ctx, parent.Id)
+	if err != nil {
+		t.Fatalf("ListPockets: %v", err)
+	}
+	if len(pockets) != 2 {
+		t.Fatalf("ListPockets: got %d pockets, want 2", len(pockets))
+	}
+	if got := map[uuid.UUID]bool{pockets[0].Id: true, pockets[1].Id: true}; !got[first.Id] || !got[second.Id] {
+		t.Errorf("ListPockets: got %v and %v, want %v and %v", pockets[0].Id, pockets[1].Id, first.Id, second.Id)
+	}
+}
+
+// остаток кармана переводится родителю, карман замораживается; повторное закрытие ничего не меняет
+func testClosePocket(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	parent := mustCreate(t, repo)
+	pocket, err := repo.CreatePocket(ctx, parent, entity.WalletInfo{}, 10)
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+	if err := repo.Transfer(ctx, parent, pocket.Id, 30); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+
+	if _, err := repo.ClosePocket(ctx, mustCreate(t, repo), pocket.Id); !errors.Is(err, repoerrors.ErrPocketNotFound) {
+		t.Errorf("ClosePocket with another parent: got %v, want %v", err, repoerrors.ErrPocketNotFound)
+	}
+
+	closed, err := repo.ClosePocket(ctx, parent, pocket.Id)
+	if err != nil {
+		t.Fatalf("ClosePocket: %v", err)
+	}
+	if closed.ClosedAt == nil || !closed.Frozen || closed.Balance != 0 {
+		t.Errorf("ClosePocket: got closedAt %v, frozen %v, balance %v", closed.ClosedAt, closed.Frozen, closed.Balance)
+	}
+	assertBalance(t, repo, parent, repository.InitialWalletBalance)
+
+	history, err := repo.GetTransactionHistory(ctx, pocket.Id, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want 2", len(history))
+	}
+	sweep := history[1]
+	if sweep.From != pocket.Id || sweep.To != parent || sweep.Source == nil || sweep.Source.Type != entity.TransferSourcePocket {
+		t.Errorf("GetTransactionHistory: got sweep %+v", sweep)
+	}
+
+	again, err := repo.ClosePocket(ctx, parent, pocket.Id)
+	if err != nil {
+		t.Fatalf("ClosePocket again: %v", err)
+	}
+	if !again.ClosedAt.Equal(*closed.ClosedAt) {
+		t.Errorf("ClosePocket again: closedAt changed from %v to %v", closed.ClosedAt, again.ClosedAt)
+	}
+	pockets, err := repo.ListPockets(ctx, parent)
+	if err != nil {
+		t.Fatalf("ListPockets: %v", err)
+	}
+	if len(pockets) != 0 {
+		t.Errorf("ListPockets: got %d pockets after close, want 0", len(pockets))
+	}
+	if err := repo.Transfer(ctx, parent, pocket.Id, 1); !errors.Is(err, repoerrors.ErrTargetWalletFrozen) {
+		t.Errorf("Transfer to closed pocket: got %v, want %v", err, repoerrors.ErrTargetWalletFrozen)
+	}
+}
+
+// сдача исходящего перевода до целой единицы уходит в карман той же транзакцией; переводы в свои карманы
+// и целые суммы не округляются, закрытие кармана выключает правило
+func testRoundUp(t *testing.T, repo repository.WalletRepo) {
+	ctx := context.Background()
+	from, to := mustCreate(t, repo), mustCreate(t, repo)
+	pocket, err := repo.CreatePocket(ctx, from, entity.WalletInfo{}, 10)
+	if err != nil {
+		t.Fatalf("CreatePocket: %v", err)
+	}
+
+	if _, err := repo.SetRoundUp(ctx, to, &pocket.Id); !errors.Is(err, repoerrors.ErrPocketNotFound) {
+		t.Errorf("SetRoundUp with another wallet's pocket: got %v, want %v", err, repoerrors.ErrPocketNotFound)
+	}
+	wallet, err := repo.SetRoundUp(ctx, from, &pocket.Id)
+	if err != nil {
+		t.Fatalf("SetRoundUp: %v", err)
+	}
+	if wallet.RoundUpPocketId == nil || *wallet.RoundUpPocketId != pocket.Id {
+		t.Fatalf("SetRoundUp: got roundUpPocketId %v, want %v", wallet.RoundUpPocketId, pocket.Id)
+	}
+
+	if err := repo.Transfer(ctx, from, to, 2.3); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := repo.Transfer(ctx, from, to, 3); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := repo.Transfer(ctx, from, pocket.Id, 0.5); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	assertBalance(t, repo, from, repository.InitialWalletBalance-2.3-0.7-3-0.5)
+	assertBalance(t, repo, to, repository.InitialWalletBalance+2.3+3)
+	assertBalance(t, repo, pocket.Id, 0.7+0.5)
+
+	history, err := repo.GetTransactionHistory(ctx, pocket.Id, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want 2", len(history))
+	}
+	if change := history[0]; change.Source == nil || change.Source.Type != entity.TransferSourceRoundUp || math.Abs(float64(change.Amount-0.7)) > balanceTolerance {
+		t.Errorf("GetTransactionHistory: got round-up %+v", change)
+	}
+
+	if _, err := repo.ClosePocket(ctx, from, pocket.Id); err != nil {
+		t.Fatalf("ClosePocket: %v", err)
+	}
+	wallet, err = repo.GetWalletStatus(ctx, from)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	if wallet.RoundUpPocketId != nil {
+		t.Errorf("GetWalletStatus: round-up to closed pocket %v is still set", wallet.RoundUpPocketId)
+	}
+	if err := repo.Transfer(ctx, from, to, 0.5); err != nil {
+		t.Fatalf("Transfer after close: %v", err)
+	}
+	assertBalance(t, repo, from, repository.InitialWalletBalance-2.3-3-0.5)
+}
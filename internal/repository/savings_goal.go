@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+// цель вместе с текущим балансом кармана
+var savingsGoalColumns = []string{"g.pocket_id", "g.wallet_id", "g.target_amount", "g.target_date", "g.created_at", "g.updated_at", "w.balance"}
+
+type savingsGoalRepoImpl struct {
+	db      *postgres.Postgres
+	log     *logrus.Logger
+	wallets *walletRepoImpl
+}
+
+func NewSavingsGoalRepo(db *postgres.Postgres, log *logrus.Logger) *savingsGoalRepoImpl {
+	return &savingsGoalRepoImpl{
+		db:      db,
+		log:     log,
+		wallets: NewWalletRepo(db, log),
+	}
+}
+
+// SetSavingsGoal - создает или заменяет цель открытого кармана goal.PocketId кошелька goal.WalletId
+func (gr *savingsGoalRepoImpl) SetSavingsGoal(ctx context.Context, goal entity.SavingsGoal) (_ entity.SavingsGoal, err error) {
+	ctx, span := startSpan(ctx, "SetSavingsGoal")
+	defer func() { endSpan(span, err) }()
+
+	err = withinTx(ctx, gr.db, func(ctx context.Context, tx pgx.Tx) error {
+		// блокировка кармана упорядочивает смену цели с его закрытием
+		pocket, err := gr.wallets.getWallet(ctx, tx, goal.PocketId, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return repoerrors.ErrPocketNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if pocket.ParentId == nil || *pocket.ParentId != goal.WalletId || pocket.ClosedAt != nil {
+			return repoerrors.ErrPocketNotFound
+		}
+
+		now := time.Now().UTC()
+		sql, args, err := gr.db.Builder.
+			Insert("savings_goals").
+			Columns("pocket_id", "wallet_id", "target_amount", "target_date", "created_at", "updated_at").
+			Values(goal.PocketId, goal.WalletId, goal.TargetAmount, goal.TargetDate, now, now).
+			Suffix("ON CONFLICT (pocket_id) DO UPDATE SET target_amount = EXCLUDED.target_amount, target_date = EXCLUDED.target_date, updated_at = EXCLUDED.updated_at").
+			ToSql()
+		if err != nil {
+			logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.SetSavingsGoal - db.Builder")
+			return err
+		}
+
+		qctx, qspan := startQuerySpan(ctx, "INSERT savings_goals", sql)
+		_, err = tx.Exec(qctx, sql, args...)
+		endSpan(qspan, err)
+		if err != nil {
+			logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.SetSavingsGoal - tx.Exec")
+			return err
+		}
+
+		goal, err = gr.getSavingsGoal(ctx, tx, goal.WalletId, goal.PocketId)
+		return err
+	})
+	if err != nil {
+		return entity.SavingsGoal{}, err
+	}
+
+	return goal, nil
+}
+
+func (gr *savingsGoalRepoImpl) GetSavingsGoal(ctx context.Context, walletId, pocketId uuid.UUID) (_ entity.SavingsGoal, err error) {
+	ctx, span := startSpan(ctx, "GetSavingsGoal")
+	defer func() { endSpan(span, err) }()
+
+	return gr.getSavingsGoal(ctx, conn(ctx, gr.db), walletId, pocketId)
+}
+
+// ListSavingsGoals - цели открытых карманов кошелька по возрастанию created_at
+func (gr *savingsGoalRepoImpl) ListSavingsGoals(ctx context.Context, walletId uuid.UUID) (_ []entity.SavingsGoal, err error) {
+	ctx, span := startSpan(ctx, "ListSavingsGoals")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := gr.db.Builder.
+		Select(savingsGoalColumns...).
+		From("savings_goals g").
+		Join("wallets w ON w.id = g.pocket_id").
+		Where("g.wallet_id = ? AND w.closed_at IS NULL", walletId).
+		OrderBy("g.created_at", "g.pocket_id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.ListSavingsGoals - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT savings_goals", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, gr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.ListSavingsGoals - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var goals []entity.SavingsGoal
+	for rows.Next() {
+		goal, err := scanSavingsGoal(rows)
+		if err != nil {
+			logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.ListSavingsGoals - rows.Scan")
+			return nil, err
+		}
+		goals = append(goals, goal)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.ListSavingsGoals - rows.Err")
+		return nil, err
+	}
+
+	return goals, nil
+}
+
+func (gr *savingsGoalRepoImpl) DeleteSavingsGoal(ctx context.Context, walletId, pocketId uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "DeleteSavingsGoal")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := gr.db.Builder.
+		Delete("savings_goals").
+		Where("pocket_id = ? AND wallet_id = ?", pocketId, walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.DeleteSavingsGoal - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "DELETE savings_goals", sql)
+	tag, err := conn(ctx, gr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.DeleteSavingsGoal - Exec")
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repoerrors.ErrSavingsGoalNotFound
+	}
+
+	return nil
+}
+
+// цель открытого кармана pocketId кошелька walletId
+func (gr *savingsGoalRepoImpl) getSavingsGoal(ctx context.Context, q querier, walletId, pocketId uuid.UUID) (entity.SavingsGoal, error) {
+	sql, args, err := gr.db.Builder.
+		Select(savingsGoalColumns...).
+		From("savings_goals g").
+		Join("wallets w ON w.id = g.pocket_id").
+		Where("g.pocket_id = ? AND g.wallet_id = ? AND w.closed_at IS NULL", pocketId, walletId).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.getSavingsGoal - db.Builder")
+		return entity.SavingsGoal{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT savings_goals", sql)
+	goal, err := scanSavingsGoal(q.QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.SavingsGoal{}, repoerrors.ErrSavingsGoalNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, gr.log).WithError(err).Error("savingsGoalRepoImpl.getSavingsGoal - QueryRow")
+		return entity.SavingsGoal{}, err
+	}
+	return goal, nil
+}
+
+func scanSavingsGoal(row pgx.Row) (entity.SavingsGoal, error) {
+	var goal entity.SavingsGoal
+	err := row.Scan(&goal.PocketId, &goal.WalletId, &goal.TargetAmount, &goal.TargetDate, &goal.CreatedAt, &goal.UpdatedAt, &goal.Saved)
+	return goal, err
+}
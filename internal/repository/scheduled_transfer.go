@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var scheduledTransferColumns = []string{
+	"id", "transfer_from", "transfer_to", "amount", "execute_at", "status",
+	"attempts", "max_attempts", "failure_reason", "created_at", "executed_at",
+}
+
+type scheduledTransferRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+}
+
+func NewScheduledTransferRepo(db *postgres.Postgres, log *logrus.Logger) *scheduledTransferRepoImpl {
+	return &scheduledTransferRepoImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (sr *scheduledTransferRepoImpl) CreateScheduledTransfer(ctx context.Context, st entity.ScheduledTransfer) (_ entity.ScheduledTransfer, err error) {
+	ctx, span := startSpan(ctx, "CreateScheduledTransfer")
+	defer func() { endSpan(span, err) }()
+
+	st.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CreateScheduledTransfer - uuid.NewRandom")
+		return entity.ScheduledTransfer{}, err
+	}
+	st.Status = entity.ScheduledTransferPending
+	st.CreatedAt = time.Now().UTC()
+
+	sql, args, err := sr.db.Builder.
+		Insert("scheduled_transfers").
+		Columns("id", "transfer_from", "transfer_to", "amount", "execute_at", "status", "max_attempts", "created_at").
+		Values(st.Id, st.From, st.To, st.Amount, st.ExecuteAt, st.Status, st.MaxAttempts, st.CreatedAt).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CreateScheduledTransfer - db.Builder")
+		return entity.ScheduledTransfer{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT scheduled_transfers", sql)
+	_, err = conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if isForeignKeyViolation(err, "scheduled_transfers_transfer_from_fkey") {
+		return entity.ScheduledTransfer{}, repoerrors.ErrWalletNotFound
+	}
+	if isForeignKeyViolation(err, "scheduled_transfers_transfer_to_fkey") {
+		return entity.ScheduledTransfer{}, repoerrors.ErrTargetWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CreateScheduledTransfer - Exec")
+		return entity.ScheduledTransfer{}, err
+	}
+
+	return st, nil
+}
+
+func (sr *scheduledTransferRepoImpl) ListScheduledTransfers(ctx context.Context, walletId uuid.UUID, status string) (_ []entity.ScheduledTransfer, err error) {
+	ctx, span := startSpan(ctx, "ListScheduledTransfers")
+	defer func() { endSpan(span, err) }()
+
+	builder := sr.db.Builder.
+		Select(scheduledTransferColumns...).
+		From("scheduled_transfers").
+		Where("transfer_from = ?", walletId).
+		OrderBy("execute_at", "created_at")
+	if status != "" {
+		builder = builder.Where("status = ?", status)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ListScheduledTransfers - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT scheduled_transfers", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, sr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ListScheduledTransfers - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var transfers []entity.ScheduledTransfer
+	for rows.Next() {
+		st, err := scanScheduledTransfer(rows)
+		if err != nil {
+			logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ListScheduledTransfers - rows.Scan")
+			return nil, err
+		}
+		transfers = append(transfers, st)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ListScheduledTransfers - rows.Err")
+		return nil, err
+	}
+
+	return transfers, nil
+}
+
+// отменить можно только ожидающий перевод своего кошелька
+func (sr *scheduledTransferRepoImpl) CancelScheduledTransfer(ctx context.Context, walletId, id uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "CancelScheduledTransfer")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sr.db.Builder.
+		Update("scheduled_transfers").
+		Set("status", entity.ScheduledTransferCanceled).
+		Where(squirrel.Eq{"id": id, "transfer_from": walletId, "status": entity.ScheduledTransferPending}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CancelScheduledTransfer - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE scheduled_transfers", sql)
+	tag, err := conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CancelScheduledTransfer - Exec")
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// ничего не обновили - либо перевода нет, либо он уже не pending
+	sql, args, err = sr.db.Builder.
+		Select("1").
+		From("scheduled_transfers").
+		Where(squirrel.Eq{"id": id, "transfer_from": walletId}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CancelScheduledTransfer - db.Builder")
+		return err
+	}
+	var exists int
+	err = conn(ctx, sr.db).QueryRow(ctx, sql, args...).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repoerrors.ErrScheduledTransferNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.CancelScheduledTransfer - QueryRow")
+		return err
+	}
+	return repoerrors.ErrScheduledTransferNotPending
+}
+
+func (sr *scheduledTransferRepoImpl) ClaimDueScheduledTransfer(ctx context.Context, now time.Time) (_ entity.ScheduledTransfer, err error) {
+	ctx, span := startSpan(ctx, "ClaimDueScheduledTransfer")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - несколько воркеров (реплик) разбирают очередь, не мешая друг другу
+	sql, args, err := sr.db.Builder.
+		Select(scheduledTransferColumns...).
+		From("scheduled_transfers").
+		Where("status = ?", entity.ScheduledTransferPending).
+		Where("execute_at <= ?", now).
+		OrderBy("execute_at").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ClaimDueScheduledTransfer - db.Builder")
+		return entity.ScheduledTransfer{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT scheduled_transfers", sql)
+	st, err := scanScheduledTransfer(conn(ctx, sr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.ScheduledTransfer{}, repoerrors.ErrNoDueScheduledTransfers
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.ClaimDueScheduledTransfer - QueryRow")
+		return entity.ScheduledTransfer{}, err
+	}
+
+	return st, nil
+}
+
+func (sr *scheduledTransferRepoImpl) UpdateScheduledTransferResult(ctx context.Context, st entity.ScheduledTransfer) (err error) {
+	ctx, span := startSpan(ctx, "UpdateScheduledTransferResult")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sr.db.Builder.
+		Update("scheduled_transfers").
+		SetMap(map[string]any{
+			"status":         st.Status,
+			"attempts":       st.Attempts,
+			"failure_reason": st.FailureReason,
+			"execute_at":     st.ExecuteAt,
+			"executed_at":    st.ExecutedAt,
+		}).
+		Where("id = ?", st.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.UpdateScheduledTransferResult - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE scheduled_transfers", sql)
+	_, err = conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("scheduledTransferRepoImpl.UpdateScheduledTransferResult - Exec")
+		return err
+	}
+
+	return nil
+}
+
+func scanScheduledTransfer(row pgx.Row) (entity.ScheduledTransfer, error) {
+	var st entity.ScheduledTransfer
+	err := row.Scan(
+		&st.Id, &st.From, &st.To, &st.Amount, &st.ExecuteAt, &st.Status,
+		&st.Attempts, &st.MaxAttempts, &st.FailureReason, &st.CreatedAt, &st.ExecutedAt,
+	)
+	return st, err
+}
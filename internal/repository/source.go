@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/timohahaa/ewallet/internal/entity"
+)
+
+type (
+	sourceCtxKey  struct{}
+	detailsCtxKey struct{}
+)
+
+// WithTransferSource - переводы, совершенные с этим контекстом, будут записаны с источником src.
+// Так подсистемы поверх WalletService.Transfer (отложенные переводы, постоянные поручения) помечают свои транзакции,
+// не меняя сигнатуру перевода.
+func WithTransferSource(ctx context.Context, src entity.TransferSource) context.Context {
+	return context.WithValue(ctx, sourceCtxKey{}, src)
+}
+
+// TransferSourceFromContext - источник перевода из контекста, если он задан
+func TransferSourceFromContext(ctx context.Context) (*entity.TransferSource, bool) {
+	src, ok := ctx.Value(sourceCtxKey{}).(entity.TransferSource)
+	if !ok {
+		return nil, false
+	}
+	return &src, true
+}
+
+// WithTransferDetails - переводы, совершенные с этим контекстом, будут записаны с memo, reference, metadata и псевдонимом получателя из details
+func WithTransferDetails(ctx context.Context, details entity.TransferDetails) context.Context {
+	return context.WithValue(ctx, detailsCtxKey{}, details)
+}
+
+// TransferDetailsFromContext - данные перевода из контекста; нулевое значение, если не заданы
+func TransferDetailsFromContext(ctx context.Context) entity.TransferDetails {
+	details, _ := ctx.Value(detailsCtxKey{}).(entity.TransferDetails)
+	return details
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// разделенный платеж - в одной транзакции БД, кошельки отправителя и всех получателей заблокированы
+// правило округления отправителя к платежу не применяется
+func (wr *walletRepoImpl) SplitTransfer(ctx context.Context, sp entity.SplitPayment) (_ entity.SplitPayment, err error) {
+	ctx, span := startSpan(ctx, "SplitTransfer")
+	defer func() { endSpan(span, err) }()
+
+	sp.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - uuid.NewRandom")
+		return entity.SplitPayment{}, err
+	}
+	sp.Time = time.Now().UTC()
+
+	err = withinTx(ctx, wr.db, func(ctx context.Context, tx pgx.Tx) error {
+		return wr.splitTransfer(ctx, tx, sp)
+	})
+	if err != nil {
+		return entity.SplitPayment{}, err
+	}
+	return sp, nil
+}
+
+func (wr *walletRepoImpl) splitTransfer(ctx context.Context, tx pgx.Tx, sp entity.SplitPayment) error {
+	ids := make([]uuid.UUID, 0, len(sp.Lines)+1)
+	ids = append(ids, sp.From)
+	for _, line := range sp.Lines {
+		ids = append(ids, line.To)
+	}
+	// тот же порядок блокировки, что и у обычного перевода
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+
+	wallets := make(map[uuid.UUID]entity.Wallet, len(ids))
+	for _, id := range ids {
+		if _, ok := wallets[id]; ok {
+			continue
+		}
+		wallet, err := wr.getWallet(ctx, tx, id, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - getWallet")
+			return err
+		}
+		wallets[id] = wallet
+	}
+
+	fromWallet, ok := wallets[sp.From]
+	if !ok {
+		return repoerrors.ErrWalletNotFound
+	}
+	if fromWallet.Frozen {
+		return repoerrors.ErrWalletFrozen
+	}
+	if !CanDebit(fromWallet, sp.Amount) {
+		return repoerrors.ErrNotEnoughBalance
+	}
+	for _, line := range sp.Lines {
+		toWallet, ok := wallets[line.To]
+		if !ok {
+			return repoerrors.ErrTargetWalletNotFound
+		}
+		if toWallet.Frozen {
+			return repoerrors.ErrTargetWalletFrozen
+		}
+	}
+
+	// обновляем балансы
+	fromWallet.Balance -= sp.Amount
+	if err := wr.updateWallet(ctx, tx, fromWallet.Id, fromWallet.Balance); err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - updateWallet")
+		return err
+	}
+	for _, line := range sp.Lines {
+		toWallet := wallets[line.To]
+		toWallet.Balance += line.Amount
+		wallets[line.To] = toWallet
+		if err := wr.updateWallet(ctx, tx, toWallet.Id, toWallet.Balance); err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - updateWallet")
+			return err
+		}
+	}
+
+	// родительская запись и транзакции-строки
+	sql, args, err := wr.db.Builder.
+		Insert("split_payments").
+		Columns("id", "transfer_from", "amount", "made_at").
+		Values(sp.Id, sp.From, sp.Amount, sp.Time).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - db.Builder")
+		return err
+	}
+	qctx, qspan := startQuerySpan(ctx, "INSERT split_payments", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - tx.Exec")
+		return err
+	}
+
+	builder := wr.db.Builder.
+		Insert("transactions").
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id")
+	for _, line := range sp.Lines {
+		builder = builder.Values(sp.Time, sp.From, line.To, line.Amount, entity.TransferSourceSplitPayment, sp.Id)
+	}
+	sql, args, err = builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - db.Builder")
+		return err
+	}
+	qctx, qspan = startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = tx.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.SplitTransfer - tx.Exec")
+		return err
+	}
+
+	return nil
+}
+
+func (wr *walletRepoImpl) GetSplitPayment(ctx context.Context, walletId, id uuid.UUID) (_ entity.SplitPayment, err error) {
+	ctx, span := startSpan(ctx, "GetSplitPayment")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := wr.db.Builder.
+		Select("id", "transfer_from", "amount", "made_at").
+		From("split_payments").
+		Where("id = ?", id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - db.Builder")
+		return entity.SplitPayment{}, err
+	}
+
+	var sp entity.SplitPayment
+	qctx, qspan := startQuerySpan(ctx, "SELECT split_payments", sql)
+	err = conn(ctx, wr.db).QueryRow(qctx, sql, args...).Scan(&sp.Id, &sp.From, &sp.Amount, &sp.Time)
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.SplitPayment{}, repoerrors.ErrSplitPaymentNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - QueryRow")
+		return entity.SplitPayment{}, err
+	}
+
+	sql, args, err = wr.db.Builder.
+		Select("transfered_to", "amount").
+		From("transactions").
+		Where(squirrel.Eq{"source_type": entity.TransferSourceSplitPayment, "source_id": id}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - db.Builder")
+		return entity.SplitPayment{}, err
+	}
+
+	qctx, qspan = startQuerySpan(ctx, "SELECT transactions", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, wr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - Query")
+		return entity.SplitPayment{}, err
+	}
+	defer rows.Close()
+
+	visible := sp.From == walletId
+	for rows.Next() {
+		var line entity.SplitLine
+		if err := rows.Scan(&line.To, &line.Amount); err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - rows.Scan")
+			return entity.SplitPayment{}, err
+		}
+		visible = visible || line.To == walletId
+		sp.Lines = append(sp.Lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetSplitPayment - rows.Err")
+		return entity.SplitPayment{}, err
+	}
+
+	// чужой платеж - как будто его нет
+	if !visible {
+		return entity.SplitPayment{}, repoerrors.ErrSplitPaymentNotFound
+	}
+	return sp, nil
+}
@@ -0,0 +1,320 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"github.com/timohahaa/postgres"
+)
+
+var standingOrderColumns = []string{
+	"id", "transfer_from", "transfer_to", "amount", "schedule", "starts_at", "ends_at", "max_count",
+	"missed_runs", "status", "runs_count", "next_run_at", "last_failure_reason", "created_at",
+}
+
+type standingOrderRepoImpl struct {
+	db  *postgres.Postgres
+	log *logrus.Logger
+}
+
+func NewStandingOrderRepo(db *postgres.Postgres, log *logrus.Logger) *standingOrderRepoImpl {
+	return &standingOrderRepoImpl{
+		db:  db,
+		log: log,
+	}
+}
+
+func (sr *standingOrderRepoImpl) CreateStandingOrder(ctx context.Context, so entity.StandingOrder) (_ entity.StandingOrder, err error) {
+	ctx, span := startSpan(ctx, "CreateStandingOrder")
+	defer func() { endSpan(span, err) }()
+
+	so.Id, err = uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.CreateStandingOrder - uuid.NewRandom")
+		return entity.StandingOrder{}, err
+	}
+	so.Status = entity.StandingOrderActive
+	so.CreatedAt = time.Now().UTC()
+
+	sql, args, err := sr.db.Builder.
+		Insert("standing_orders").
+		Columns("id", "transfer_from", "transfer_to", "amount", "schedule", "starts_at", "ends_at", "max_count", "missed_runs", "status", "next_run_at", "created_at").
+		Values(so.Id, so.From, so.To, so.Amount, so.Schedule, so.StartsAt, so.EndsAt, so.MaxCount, so.MissedRuns, so.Status, so.NextRunAt, so.CreatedAt).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.CreateStandingOrder - db.Builder")
+		return entity.StandingOrder{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT standing_orders", sql)
+	_, err = conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if isForeignKeyViolation(err, "standing_orders_transfer_from_fkey") {
+		return entity.StandingOrder{}, repoerrors.ErrWalletNotFound
+	}
+	if isForeignKeyViolation(err, "standing_orders_transfer_to_fkey") {
+		return entity.StandingOrder{}, repoerrors.ErrTargetWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.CreateStandingOrder - Exec")
+		return entity.StandingOrder{}, err
+	}
+
+	return so, nil
+}
+
+func (sr *standingOrderRepoImpl) ListStandingOrders(ctx context.Context, walletId uuid.UUID, status string) (_ []entity.StandingOrder, err error) {
+	ctx, span := startSpan(ctx, "ListStandingOrders")
+	defer func() { endSpan(span, err) }()
+
+	builder := sr.db.Builder.
+		Select(standingOrderColumns...).
+		From("standing_orders").
+		Where("transfer_from = ?", walletId).
+		OrderBy("created_at", "id")
+	if status != "" {
+		builder = builder.Where("status = ?", status)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrders - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT standing_orders", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, sr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrders - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orders []entity.StandingOrder
+	for rows.Next() {
+		so, err := scanStandingOrder(rows)
+		if err != nil {
+			logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrders - rows.Scan")
+			return nil, err
+		}
+		orders = append(orders, so)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrders - rows.Err")
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (sr *standingOrderRepoImpl) ListStandingOrderRuns(ctx context.Context, walletId, id uuid.UUID) (_ []entity.StandingOrderRun, err error) {
+	ctx, span := startSpan(ctx, "ListStandingOrderRuns")
+	defer func() { endSpan(span, err) }()
+
+	// поручение должно принадлежать кошельку
+	if err := sr.checkOwner(ctx, walletId, id); err != nil {
+		return nil, err
+	}
+
+	sql, args, err := sr.db.Builder.
+		Select("standing_order_id", "scheduled_for", "status", "failure_reason", "executed_at").
+		From("standing_order_runs").
+		Where("standing_order_id = ?", id).
+		OrderBy("scheduled_for DESC").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrderRuns - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT standing_order_runs", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, sr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrderRuns - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []entity.StandingOrderRun
+	for rows.Next() {
+		var run entity.StandingOrderRun
+		err := rows.Scan(&run.StandingOrderId, &run.ScheduledFor, &run.Status, &run.FailureReason, &run.ExecutedAt)
+		if err != nil {
+			logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrderRuns - rows.Scan")
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ListStandingOrderRuns - rows.Err")
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+// отменить можно только активное поручение своего кошелька
+func (sr *standingOrderRepoImpl) CancelStandingOrder(ctx context.Context, walletId, id uuid.UUID) (err error) {
+	ctx, span := startSpan(ctx, "CancelStandingOrder")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sr.db.Builder.
+		Update("standing_orders").
+		Set("status", entity.StandingOrderCanceled).
+		Set("next_run_at", nil).
+		Where(squirrel.Eq{"id": id, "transfer_from": walletId, "status": entity.StandingOrderActive}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.CancelStandingOrder - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE standing_orders", sql)
+	tag, err := conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.CancelStandingOrder - Exec")
+		return err
+	}
+	if tag.RowsAffected() > 0 {
+		return nil
+	}
+
+	// ничего не обновили - либо поручения нет, либо оно уже не активно
+	if err := sr.checkOwner(ctx, walletId, id); err != nil {
+		return err
+	}
+	return repoerrors.ErrStandingOrderNotActive
+}
+
+func (sr *standingOrderRepoImpl) checkOwner(ctx context.Context, walletId, id uuid.UUID) error {
+	sql, args, err := sr.db.Builder.
+		Select("1").
+		From("standing_orders").
+		Where(squirrel.Eq{"id": id, "transfer_from": walletId}).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.checkOwner - db.Builder")
+		return err
+	}
+
+	var exists int
+	qctx, qspan := startQuerySpan(ctx, "SELECT standing_orders", sql)
+	err = conn(ctx, sr.db).QueryRow(qctx, sql, args...).Scan(&exists)
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return repoerrors.ErrStandingOrderNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.checkOwner - QueryRow")
+		return err
+	}
+	return nil
+}
+
+func (sr *standingOrderRepoImpl) ClaimDueStandingOrder(ctx context.Context, now time.Time) (_ entity.StandingOrder, err error) {
+	ctx, span := startSpan(ctx, "ClaimDueStandingOrder")
+	defer func() { endSpan(span, err) }()
+
+	// SKIP LOCKED - несколько воркеров (реплик) разбирают поручения, не мешая друг другу
+	sql, args, err := sr.db.Builder.
+		Select(standingOrderColumns...).
+		From("standing_orders").
+		Where("status = ?", entity.StandingOrderActive).
+		Where("next_run_at <= ?", now).
+		OrderBy("next_run_at").
+		Limit(1).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ClaimDueStandingOrder - db.Builder")
+		return entity.StandingOrder{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT standing_orders", sql)
+	so, err := scanStandingOrder(conn(ctx, sr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.StandingOrder{}, repoerrors.ErrNoDueStandingOrders
+	}
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.ClaimDueStandingOrder - QueryRow")
+		return entity.StandingOrder{}, err
+	}
+
+	return so, nil
+}
+
+func (sr *standingOrderRepoImpl) SaveStandingOrderRun(ctx context.Context, run entity.StandingOrderRun) (_ bool, err error) {
+	ctx, span := startSpan(ctx, "SaveStandingOrderRun")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sr.db.Builder.
+		Insert("standing_order_runs").
+		Columns("standing_order_id", "scheduled_for", "status", "failure_reason", "executed_at").
+		Values(run.StandingOrderId, run.ScheduledFor, run.Status, run.FailureReason, run.ExecutedAt).
+		Suffix("ON CONFLICT (standing_order_id, scheduled_for) DO NOTHING").
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.SaveStandingOrderRun - db.Builder")
+		return false, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "INSERT standing_order_runs", sql)
+	tag, err := conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.SaveStandingOrderRun - Exec")
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (sr *standingOrderRepoImpl) UpdateStandingOrderProgress(ctx context.Context, so entity.StandingOrder) (err error) {
+	ctx, span := startSpan(ctx, "UpdateStandingOrderProgress")
+	defer func() { endSpan(span, err) }()
+
+	sql, args, err := sr.db.Builder.
+		Update("standing_orders").
+		SetMap(map[string]any{
+			"status":              so.Status,
+			"runs_count":          so.RunsCount,
+			"next_run_at":         so.NextRunAt,
+			"last_failure_reason": so.LastFailureReason,
+		}).
+		Where("id = ?", so.Id).
+		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.UpdateStandingOrderProgress - db.Builder")
+		return err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE standing_orders", sql)
+	_, err = conn(ctx, sr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
+	if err != nil {
+		logger.FromContext(ctx, sr.log).WithError(err).Error("standingOrderRepoImpl.UpdateStandingOrderProgress - Exec")
+		return err
+	}
+
+	return nil
+}
+
+func scanStandingOrder(row pgx.Row) (entity.StandingOrder, error) {
+	var so entity.StandingOrder
+	err := row.Scan(
+		&so.Id, &so.From, &so.To, &so.Amount, &so.Schedule, &so.StartsAt, &so.EndsAt, &so.MaxCount,
+		&so.MissedRuns, &so.Status, &so.RunsCount, &so.NextRunAt, &so.LastFailureReason, &so.CreatedAt,
+	)
+	return so, err
+}
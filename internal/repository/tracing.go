@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+var tracer = otel.Tracer("github.com/timohahaa/ewallet/internal/repository")
+
+// спан на один sql-запрос - по ним видно, какой именно запрос тормозит
+func startQuerySpan(ctx context.Context, operation, sql string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "postgres "+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", sql),
+		),
+	)
+}
+
+// спан на метод репозитория, внутри него - спаны отдельных запросов
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "walletRepo."+method)
+}
+
+// завершает спан; pgx.ErrNoRows и ошибки из repoerrors - штатные ситуации, а не ошибки
+func endSpan(span trace.Span, err error) {
+	if err != nil && !isExpectedError(err) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func isExpectedError(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows) ||
+		errors.Is(err, repoerrors.ErrWalletNotFound) ||
+		errors.Is(err, repoerrors.ErrTargetWalletNotFound) ||
+		errors.Is(err, repoerrors.ErrNotEnoughBalance) ||
+		errors.Is(err, repoerrors.ErrWalletFrozen) ||
+		errors.Is(err, repoerrors.ErrTargetWalletFrozen) ||
+		errors.Is(err, repoerrors.ErrSelfTransfer) ||
+		errors.Is(err, repoerrors.ErrSplitPaymentNotFound) ||
+		errors.Is(err, repoerrors.ErrScheduledTransferNotFound) ||
+		errors.Is(err, repoerrors.ErrScheduledTransferNotPending) ||
+		errors.Is(err, repoerrors.ErrNoDueScheduledTransfers) ||
+		errors.Is(err, repoerrors.ErrStandingOrderNotFound) ||
+		errors.Is(err, repoerrors.ErrStandingOrderNotActive) ||
+		errors.Is(err, repoerrors.ErrNoDueStandingOrders) ||
+		errors.Is(err, repoerrors.ErrBatchTransferNotFound) ||
+		errors.Is(err, repoerrors.ErrNoPendingBatchTransfers) ||
+		errors.Is(err, repoerrors.ErrEscrowNotFound) ||
+		errors.Is(err, repoerrors.ErrNoExpiredEscrows) ||
+		errors.Is(err, repoerrors.ErrPaymentRequestNotFound) ||
+		errors.Is(err, repoerrors.ErrInvoiceNotFound) ||
+		errors.Is(err, repoerrors.ErrInvoiceReferenceExists) ||
+		errors.Is(err, repoerrors.ErrAliasNotFound) ||
+		errors.Is(err, repoerrors.ErrAliasTaken) ||
+		errors.Is(err, repoerrors.ErrPocketNotFound) ||
+		errors.Is(err, repoerrors.ErrNestedPocket) ||
+		errors.Is(err, repoerrors.ErrTooManyPockets) ||
+		errors.Is(err, repoerrors.ErrSavingsGoalNotFound) ||
+		errors.Is(err, repoerrors.ErrInterestProductNotFound) ||
+		errors.Is(err, repoerrors.ErrInterestAccountNotFound) ||
+		errors.Is(err, repoerrors.ErrNoDueInterestAccounts) ||
+		errors.Is(err, repoerrors.ErrCreditLineNotFound) ||
+		errors.Is(err, repoerrors.ErrCreditLimitBelowDebt) ||
+		errors.Is(err, repoerrors.ErrNoDueCreditLines) ||
+		errors.Is(err, repoerrors.ErrNoCreditAlertsDue) ||
+		errors.Is(err, repoerrors.ErrTransactionNotFound) ||
+		errors.Is(err, repoerrors.ErrDisputeNotFound) ||
+		errors.Is(err, repoerrors.ErrDisputeExists) ||
+		errors.Is(err, repoerrors.ErrNoExpiredDisputes) ||
+		errors.Is(err, repoerrors.ErrFraudCaseNotFound)
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/timohahaa/postgres"
+)
+
+type txCtxKey struct{}
+
+// Transactor - выполнение нескольких операций репозиториев в одной транзакции БД.
+// Транзакция передается через контекст: все методы postgres-репозиториев, получившие такой контекст,
+// работают внутри нее. Вложенный WithinTx создает savepoint - его ошибка откатывает только вложенную часть.
+type Transactor interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactorImpl struct {
+	db *postgres.Postgres
+}
+
+func NewTransactor(db *postgres.Postgres) *transactorImpl {
+	return &transactorImpl{
+		db: db,
+	}
+}
+
+func (t *transactorImpl) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return withinTx(ctx, t.db, func(ctx context.Context, _ pgx.Tx) error {
+		return fn(ctx)
+	})
+}
+
+// withinTx - транзакция из контекста (savepoint в ней) или новая транзакция из пула
+func withinTx(ctx context.Context, db *postgres.Postgres, fn func(ctx context.Context, tx pgx.Tx) error) error {
+	var beginner interface {
+		Begin(ctx context.Context) (pgx.Tx, error)
+	} = db.ConnPool
+	if tx, ok := ctx.Value(txCtxKey{}).(pgx.Tx); ok {
+		beginner = tx
+	}
+
+	return pgx.BeginFunc(ctx, beginner, func(tx pgx.Tx) error {
+		return fn(context.WithValue(ctx, txCtxKey{}, tx), tx)
+	})
+}
+
+// conn - транзакция из контекста, если она есть, иначе пул
+func conn(ctx context.Context, db *postgres.Postgres) querier {
+	if tx, ok := ctx.Value(txCtxKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.ConnPool
+}
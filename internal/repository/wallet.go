@@ -1,15 +1,23 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/Masterminds/squirrel"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/sirupsen/logrus"
 	"github.com/timohahaa/ewallet/internal/entity"
 	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
 	"github.com/timohahaa/postgres"
 )
 
@@ -29,172 +37,339 @@ func NewWalletRepo(db *postgres.Postgres, log *logrus.Logger) *walletRepoImpl {
 	}
 }
 
+var walletColumns = []string{"id", "balance", "frozen", "credit_limit", "parent_id", "owner_id", "display_name", "labels", "created_at", "updated_at", "closed_at", "round_up_pocket_id"}
+
 // создание нового кошелька
-func (wr *walletRepoImpl) CreateWallet(ctx context.Context) (entity.Wallet, error) {
+func (wr *walletRepoImpl) CreateWallet(ctx context.Context, info entity.WalletInfo) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "CreateWallet")
+	defer func() { endSpan(span, err) }()
+
 	newWalletID, err := uuid.NewRandom()
 	if err != nil {
-		wr.log.Error("walletRepoImpl.CreateWallet - uuid.NewRandom", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreateWallet - uuid.NewRandom")
 		return entity.Wallet{}, err
 	}
+	if info.Labels == nil {
+		info.Labels = []string{}
+	}
+	now := time.Now().UTC()
 
 	sql, args, err := wr.db.Builder.
 		Insert("wallets").
-		Columns("id", "balance").
-		Values(newWalletID, InitialWalletBalance).
+		Columns("id", "balance", "owner_id", "display_name", "labels", "created_at", "updated_at").
+		Values(newWalletID, InitialWalletBalance, info.OwnerId, info.DisplayName, info.Labels, now, now).
 		ToSql()
 
 	if err != nil {
-		wr.log.Error("walletRepoImpl.CreateWallet - db.Builder", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreateWallet - db.Builder")
 		return entity.Wallet{}, err
 	}
 
-	_, err = wr.db.ConnPool.Exec(ctx, sql, args...)
-
+	qctx, qspan := startQuerySpan(ctx, "INSERT wallets", sql)
+	_, err = conn(ctx, wr.db).Exec(qctx, sql, args...)
+	endSpan(qspan, err)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.CreateWallet - db.ConnPool.Exec", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.CreateWallet - db.ConnPool.Exec")
 		return entity.Wallet{}, err
 	}
-	return entity.Wallet{Id: newWalletID, Balance: InitialWalletBalance}, nil
+	return entity.Wallet{Id: newWalletID, Balance: InitialWalletBalance, WalletInfo: info, CreatedAt: now, UpdatedAt: now}, nil
 }
 
 // вспомогательные функции для совершения транзакции - Dont Repeat Youtself ;)
-func (wr *walletRepoImpl) getWallet(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error) {
-	sql, args, err := wr.db.Builder.
-		Select("id", "balance").
+// q - пул или транзакция, forUpdate - заблокировать строку кошелька до конца транзакции
+func (wr *walletRepoImpl) getWallet(ctx context.Context, q querier, walletId uuid.UUID, forUpdate bool) (entity.Wallet, error) {
+	builder := wr.db.Builder.
+		Select(walletColumns...).
 		From("wallets").
-		Where("id = ?", walletId).
-		ToSql()
+		Where("id = ?", walletId)
+	if forUpdate {
+		builder = builder.Suffix("FOR UPDATE")
+	}
+	sql, args, err := builder.ToSql()
 	if err != nil {
-		wr.log.Error("walletRepoImpl.getWallet - db.Builder", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.getWallet - db.Builder")
 		return entity.Wallet{}, err
 	}
 
-	var wallet entity.Wallet
-	err = wr.db.ConnPool.QueryRow(ctx, sql, args...).Scan(&wallet.Id, &wallet.Balance)
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+	wallet, err := scanWallet(q.QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
 	// кошелек не найден
 	if errors.Is(err, pgx.ErrNoRows) {
 		return entity.Wallet{}, pgx.ErrNoRows
 	}
 	if err != nil {
-		wr.log.Error("walletRepoImpl.getWallet - db.ConnPool.QueryRow", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.getWallet - QueryRow")
 		return entity.Wallet{}, err
 	}
 
 	return wallet, nil
 }
 
-func (wr *walletRepoImpl) updateWallet(ctx context.Context, walletId uuid.UUID, newBalance float32) error {
+func (wr *walletRepoImpl) updateWallet(ctx context.Context, q querier, walletId uuid.UUID, newBalance float32) error {
 	sql, args, err := wr.db.Builder.
 		Update("wallets").
 		Set("balance", newBalance).
 		Where("id = ?", walletId).
 		ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.updateWallet - db.Builder")
+		return err
+	}
 
-	_, err = wr.db.ConnPool.Exec(ctx, sql, args...)
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+	_, err = q.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.updateWallet - db.ConnPool.Exec", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.updateWallet - Exec")
 		return err
 	}
 	return nil
 }
 
-// совершение транзакции
-func (wr *walletRepoImpl) Transfer(ctx context.Context, from, to uuid.UUID, amount float32) error {
-	// проверяем исходящий кошелек
-	fromWallet, err := wr.getWallet(ctx, from)
+// совершение транзакции - целиком в одной транзакции БД, строки обоих кошельков заблокированы
+func (wr *walletRepoImpl) Transfer(ctx context.Context, from, to uuid.UUID, amount float32) (err error) {
+	ctx, span := startSpan(ctx, "Transfer")
+	defer func() { endSpan(span, err) }()
+
+	return withinTx(ctx, wr.db, func(ctx context.Context, tx pgx.Tx) error {
+		return wr.transfer(ctx, tx, from, to, amount)
+	})
+}
 
+func (wr *walletRepoImpl) transfer(ctx context.Context, tx pgx.Tx, from, to uuid.UUID, amount float32) error {
+	if from == to {
+		return repoerrors.ErrSelfTransfer
+	}
+	// карман для сдачи блокируется вместе с остальными кошельками в общем порядке, поэтому правило округления
+	// читается заранее, без блокировки; если оно успеет поменяться, сдача в этот раз не откладывается
+	ids := []uuid.UUID{from, to}
+	change := RoundUpChange(amount)
+	var roundUpTo *uuid.UUID
+	if change > 0 {
+		wallet, err := wr.getWallet(ctx, tx, from, false)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - getWallet")
+			return err
+		}
+		if roundUpTo = wallet.RoundUpPocketId; roundUpTo != nil {
+			ids = append(ids, *roundUpTo)
+		}
+	}
+
+	// блокируем кошельки всегда в одном порядке - иначе встречные переводы A->B и B->A задедлочатся
+	wallets := make(map[uuid.UUID]entity.Wallet, len(ids))
+	for _, id := range lockOrder(ids...) {
+		wallet, err := wr.getWallet(ctx, tx, id, true)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - getWallet")
+			return err
+		}
+		wallets[id] = wallet
+	}
+
+	// проверяем исходящий кошелек
+	fromWallet, ok := wallets[from]
 	// исходящий кошелек не найден
-	if errors.Is(err, pgx.ErrNoRows) {
+	if !ok {
 		return repoerrors.ErrWalletNotFound
 	}
-	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - getWallet", "err", err)
-		return err
+	if fromWallet.Frozen {
+		return repoerrors.ErrWalletFrozen
 	}
-	// баланса не достаточно для перевода
-	if fromWallet.Balance-amount < 0 {
+	// баланса с учетом кредитного лимита не достаточно для перевода
+	if !CanDebit(fromWallet, amount) {
 		return repoerrors.ErrNotEnoughBalance
 	}
 
 	// проверяем целевой кошелек
-	toWallet, err := wr.getWallet(ctx, to)
+	toWallet, ok := wallets[to]
 	// целевой кошелек не найден
-	if errors.Is(err, pgx.ErrNoRows) {
+	if !ok {
 		return repoerrors.ErrTargetWalletNotFound
 	}
-	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - getWallet", "err", err)
-		return err
+	if toWallet.Frozen {
+		return repoerrors.ErrTargetWalletFrozen
 	}
 
 	//обновляем балансы и сохраняем транзакцию
 	txTime := time.Now().UTC()
 	fromWallet.Balance -= amount
 	toWallet.Balance += amount
-	err = wr.updateWallet(ctx, fromWallet.Id, fromWallet.Balance)
+	err := wr.updateWallet(ctx, tx, fromWallet.Id, fromWallet.Balance)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - updateWallet", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - updateWallet")
 		return err
 	}
-	err = wr.updateWallet(ctx, toWallet.Id, toWallet.Balance)
+	err = wr.updateWallet(ctx, tx, toWallet.Id, toWallet.Balance)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - updateWallet", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - updateWallet")
 		return err
 	}
 
+	source, _ := TransferSourceFromContext(ctx)
+	err = wr.saveTransaction(ctx, tx, entity.Transaction{
+		Time: txTime, From: fromWallet.Id, To: toWallet.Id, Amount: amount, Source: source,
+	}, TransferDetailsFromContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	// сдача откладывается, только если правило не поменялось, перевод - не в свой карман,
+	// карман открыт и хватает своего баланса (в долг сдача не откладывается); иначе перевод проходит без округления
+	if roundUpTo == nil || fromWallet.RoundUpPocketId == nil || *fromWallet.RoundUpPocketId != *roundUpTo ||
+		(toWallet.ParentId != nil && *toWallet.ParentId == from) || fromWallet.Balance-change < 0 {
+		return nil
+	}
+	pocket, ok := wallets[*roundUpTo]
+	if !ok || pocket.Frozen {
+		return nil
+	}
+	err = wr.updateWallet(ctx, tx, fromWallet.Id, fromWallet.Balance-change)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - updateWallet")
+		return err
+	}
+	err = wr.updateWallet(ctx, tx, pocket.Id, pocket.Balance+change)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.Transfer - updateWallet")
+		return err
+	}
+	return wr.saveTransaction(ctx, tx, entity.Transaction{
+		Time:   txTime,
+		From:   fromWallet.Id,
+		To:     pocket.Id,
+		Amount: change,
+		Source: &entity.TransferSource{Type: entity.TransferSourceRoundUp, Id: pocket.Id},
+	}, entity.TransferDetails{})
+}
+
+func (wr *walletRepoImpl) saveTransaction(ctx context.Context, q querier, t entity.Transaction, details entity.TransferDetails) error {
+	var sourceType *string
+	var sourceId *uuid.UUID
+	if t.Source != nil {
+		sourceType, sourceId = &t.Source.Type, &t.Source.Id
+	}
 	sql, args, err := wr.db.Builder.
 		Insert("transactions").
-		Columns("made_at", "transfered_from", "transfered_to", "amount").
-		Values(txTime, fromWallet.Id, toWallet.Id, amount).
+		Columns("made_at", "transfered_from", "transfered_to", "amount", "source_type", "source_id", "memo", "reference", "metadata", "to_alias").
+		Values(t.Time, t.From, t.To, t.Amount, sourceType, sourceId, nullIfEmpty(details.Memo), nullIfEmpty(details.Reference), metadataValue(details.Metadata), nullIfEmpty(details.ToAlias)).
 		ToSql()
 	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - db.Builder", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.saveTransaction - db.Builder")
 		return err
 	}
 
-	_, err = wr.db.ConnPool.Exec(ctx, sql, args...)
+	qctx, qspan := startQuerySpan(ctx, "INSERT transactions", sql)
+	_, err = q.Exec(qctx, sql, args...)
+	endSpan(qspan, err)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - db.ConnPool.Exec", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.saveTransaction - Exec")
 		return err
 	}
-
 	return nil
 }
 
-func (wr *walletRepoImpl) GetTransactionHistory(ctx context.Context, walletId uuid.UUID) ([]entity.Transaction, error) {
+// RoundUpChange - сдача до ближайшей целой единицы в тысячных, как хранятся суммы; для целой суммы - 0
+func RoundUpChange(amount float32) float32 {
+	rem := units(amount) % 1000
+	if rem == 0 {
+		return 0
+	}
+	return float32(1000-rem) / 1000
+}
+
+// CanDebit - хватает ли кошельку баланса вместе с кредитным лимитом на списание amount;
+// считается в тысячных, как хранятся суммы, чтобы списание ровно до лимита не упиралось в ошибку float32
+func CanDebit(wallet entity.Wallet, amount float32) bool {
+	return units(wallet.Balance)+units(wallet.CreditLimit)-units(amount) >= 0
+}
+
+func units(amount float32) int64 {
+	return int64(math.Round(float64(amount) * 1000))
+}
+
+// unitsNumeric - сумма в тысячных как точный NUMERIC для запроса
+func unitsNumeric(u int64) pgtype.Numeric {
+	return pgtype.Numeric{Int: big.NewInt(u), Exp: -3, Valid: true}
+}
+
+func nullIfEmpty(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// пустые метаданные хранятся как NULL, а не '{}'
+func metadataValue(metadata map[string]any) any {
+	if len(metadata) == 0 {
+		return nil
+	}
+	return metadata
+}
+
+// порядок блокировки кошельков - по возрастанию id без повторов (postgres сравнивает uuid побайтово)
+func lockOrder(ids ...uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID{}, ids...)
+	slices.SortFunc(sorted, func(a, b uuid.UUID) int { return bytes.Compare(a[:], b[:]) })
+	return slices.Compact(sorted)
+}
+
+func (wr *walletRepoImpl) GetTransactionHistory(ctx context.Context, walletId uuid.UUID, filter entity.TransactionFilter) (_ []entity.Transaction, err error) {
+	ctx, span := startSpan(ctx, "GetTransactionHistory")
+	defer func() { endSpan(span, err) }()
+
 	// проверка на существование кошелька
-	wallet, err := wr.getWallet(ctx, walletId)
+	wallet, err := wr.getWallet(ctx, conn(ctx, wr.db), walletId, false)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, repoerrors.ErrWalletNotFound
 	}
 	if err != nil {
-		wr.log.Error("walletRepoImpl.Transfer - getWallet", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetTransactionHistory - getWallet")
 		return nil, err
 	}
 
-	sql, args, err := wr.db.Builder.
-		Select("made_at", "transfered_from", "transfered_to", "amount").
+	builder := wr.db.Builder.
+		// у корректировок одна из сторон NULL - отдаем ее как uuid.Nil
+		Select("id", "made_at", "COALESCE(transfered_from, '"+uuid.Nil.String()+"')", "COALESCE(transfered_to, '"+uuid.Nil.String()+"')", "amount", "source_type", "source_id",
+			"COALESCE(memo, '')", "COALESCE(reference, '')", "metadata", "COALESCE(to_alias, '')").
 		From("transactions").
-		Where("transfered_from = ? OR transfered_to = ?", wallet.Id, wallet.Id).
-		ToSql()
+		Where("(transfered_from = ? OR transfered_to = ?)", wallet.Id, wallet.Id).
+		OrderBy("made_at", "id")
+	if filter.Reference != "" {
+		builder = builder.Where("reference = ?", filter.Reference)
+	}
+	sql, args, err := builder.ToSql()
 	if err != nil {
-		wr.log.Error("walletRepoImpl.GetTransactionHistory - db.Builder", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetTransactionHistory - db.Builder")
 		return nil, err
 	}
 
-	rows, err := wr.db.ConnPool.Query(ctx, sql, args...)
+	qctx, qspan := startQuerySpan(ctx, "SELECT transactions", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, wr.db).Query(qctx, sql, args...)
 	if err != nil {
-		wr.log.Error("walletRepoImpl.GetTransactionHistory - db.ConnPool.Query", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetTransactionHistory - db.ConnPool.Query")
 		return nil, err
 	}
+	defer rows.Close()
 
 	var transactions []entity.Transaction
 	for rows.Next() {
 		var tx entity.Transaction
+		var sourceType *string
+		var sourceId *uuid.UUID
 		// игнорируем ошибку, но:
 		// можно бы было сделать ошибку ErrScan или типа того, и записывать ее в переменную
 		// в скоупе вне цикла, а затем возвращать неполный список транзакций и ошибку
-		_ = rows.Scan(&tx.Time, &tx.From, &tx.To, &tx.Amount)
+		_ = rows.Scan(&tx.Id, &tx.Time, &tx.From, &tx.To, &tx.Amount, &sourceType, &sourceId, &tx.Memo, &tx.Reference, &tx.Metadata, &tx.ToAlias)
+		if sourceType != nil && sourceId != nil {
+			tx.Source = &entity.TransferSource{Type: *sourceType, Id: *sourceId}
+		}
 		transactions = append(transactions, tx)
 	}
 
@@ -205,15 +380,133 @@ func (wr *walletRepoImpl) GetTransactionHistory(ctx context.Context, walletId uu
 	return transactions, nil
 }
 
-func (wr *walletRepoImpl) GetWalletStatus(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error) {
-	wallet, err := wr.getWallet(ctx, walletId)
+func (wr *walletRepoImpl) GetWalletStatus(ctx context.Context, walletId uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "GetWalletStatus")
+	defer func() { endSpan(span, err) }()
+
+	wallet, err := wr.getWallet(ctx, conn(ctx, wr.db), walletId, false)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return entity.Wallet{}, repoerrors.ErrWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.GetWalletStatus - getWallet")
+		return entity.Wallet{}, err
+	}
+
+	return wallet, nil
+}
+
+// UpdateWalletInfo - меняет только заданные в update поля; updated_at обновляет триггер
+func (wr *walletRepoImpl) UpdateWalletInfo(ctx context.Context, walletId uuid.UUID, update entity.WalletInfoUpdate) (_ entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "UpdateWalletInfo")
+	defer func() { endSpan(span, err) }()
+
+	if update.OwnerId == nil && update.DisplayName == nil && update.Labels == nil {
+		return wr.GetWalletStatus(ctx, walletId)
+	}
+	builder := wr.db.Builder.
+		Update("wallets").
+		Where("id = ?", walletId).
+		Suffix("RETURNING " + strings.Join(walletColumns, ", "))
+	if update.OwnerId != nil {
+		builder = builder.Set("owner_id", *update.OwnerId)
+	}
+	if update.DisplayName != nil {
+		builder = builder.Set("display_name", *update.DisplayName)
+	}
+	if update.Labels != nil {
+		labels := *update.Labels
+		if labels == nil {
+			labels = []string{}
+		}
+		builder = builder.Set("labels", labels)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.UpdateWalletInfo - db.Builder")
+		return entity.Wallet{}, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "UPDATE wallets", sql)
+	wallet, err := scanWallet(conn(ctx, wr.db).QueryRow(qctx, sql, args...))
+	endSpan(qspan, err)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return entity.Wallet{}, repoerrors.ErrWalletNotFound
 	}
 	if err != nil {
-		wr.log.Error("walletRepoImpl.GetWalletStatus - getWallet", "err", err)
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.UpdateWalletInfo - QueryRow")
 		return entity.Wallet{}, err
 	}
 
 	return wallet, nil
 }
+
+// ListWallets - кошельки по возрастанию (created_at, id), не больше filter.Limit
+func (wr *walletRepoImpl) ListWallets(ctx context.Context, filter entity.WalletFilter) (_ []entity.Wallet, err error) {
+	ctx, span := startSpan(ctx, "ListWallets")
+	defer func() { endSpan(span, err) }()
+
+	builder := wr.db.Builder.
+		Select(walletColumns...).
+		From("wallets").
+		OrderBy("created_at", "id").
+		Limit(uint64(filter.Limit))
+	if filter.OwnerId != "" {
+		builder = builder.Where("owner_id = ?", filter.OwnerId)
+	}
+	if filter.Label != "" {
+		builder = builder.Where("labels @> ARRAY[?]::TEXT[]", filter.Label)
+	}
+	if filter.CreatedFrom != nil {
+		builder = builder.Where(squirrel.GtOrEq{"created_at": *filter.CreatedFrom})
+	}
+	if filter.CreatedTo != nil {
+		builder = builder.Where(squirrel.Lt{"created_at": *filter.CreatedTo})
+	}
+	if filter.MinBalance != nil {
+		builder = builder.Where(squirrel.GtOrEq{"balance": *filter.MinBalance})
+	}
+	if filter.MaxBalance != nil {
+		builder = builder.Where(squirrel.LtOrEq{"balance": *filter.MaxBalance})
+	}
+	if filter.After != nil {
+		// курсор на несуществующий кошелек дает пустую страницу
+		builder = builder.Where("(created_at, id) > (SELECT created_at, id FROM wallets WHERE id = ?)", *filter.After)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListWallets - db.Builder")
+		return nil, err
+	}
+
+	qctx, qspan := startQuerySpan(ctx, "SELECT wallets", sql)
+	defer func() { endSpan(qspan, err) }()
+	rows, err := conn(ctx, wr.db).Query(qctx, sql, args...)
+	if err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListWallets - Query")
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallets []entity.Wallet
+	for rows.Next() {
+		wallet, err := scanWallet(rows)
+		if err != nil {
+			logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListWallets - rows.Scan")
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	if err := rows.Err(); err != nil {
+		logger.FromContext(ctx, wr.log).WithError(err).Error("walletRepoImpl.ListWallets - rows.Err")
+		return nil, err
+	}
+
+	return wallets, nil
+}
+
+func scanWallet(row pgx.Row) (entity.Wallet, error) {
+	var wallet entity.Wallet
+	err := row.Scan(&wallet.Id, &wallet.Balance, &wallet.Frozen, &wallet.CreditLimit, &wallet.ParentId, &wallet.OwnerId, &wallet.DisplayName, &wallet.Labels, &wallet.CreatedAt, &wallet.UpdatedAt, &wallet.ClosedAt, &wallet.RoundUpPocketId)
+	return wallet, err
+}
@@ -0,0 +1,191 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/pgtest"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/internal/repository/repotest"
+	"github.com/timohahaa/postgres"
+)
+
+// та же семантика, что и у memory.NewWalletRepo; без PG_URL пропускается
+func TestWalletRepoPostgres(t *testing.T) {
+	repotest.RunWalletRepoSuite(t, func(t *testing.T) repository.WalletRepo {
+		return repository.NewWalletRepo(pgtest.New(t), logrus.New())
+	})
+}
+
+// проверки, специфичные для postgres: заморозка через AdminRepo в той же базе, блокировки строк при встречных переводах
+
+func newWalletRepo(t *testing.T) (repository.WalletRepo, *postgres.Postgres) {
+	t.Helper()
+	pg := pgtest.New(t)
+	return repository.NewWalletRepo(pg, logrus.New()), pg
+}
+
+func createWallet(t *testing.T, repo repository.WalletRepo) uuid.UUID {
+	t.Helper()
+	wallet, err := repo.CreateWallet(context.Background(), entity.WalletInfo{})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+	return wallet.Id
+}
+
+func balanceOf(t *testing.T, repo repository.WalletRepo, walletId uuid.UUID) float32 {
+	t.Helper()
+	wallet, err := repo.GetWalletStatus(context.Background(), walletId)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	return wallet.Balance
+}
+
+func TestCreateWalletPostgres(t *testing.T) {
+	repo, _ := newWalletRepo(t)
+
+	wallet, err := repo.CreateWallet(context.Background(), entity.WalletInfo{OwnerId: "user-1"})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+	if wallet.Id == uuid.Nil || wallet.Balance != repository.InitialWalletBalance || wallet.OwnerId != "user-1" {
+		t.Errorf("CreateWallet: got %+v", wallet)
+	}
+	if got := balanceOf(t, repo, wallet.Id); got != repository.InitialWalletBalance {
+		t.Errorf("balance = %v, want %v", got, repository.InitialWalletBalance)
+	}
+}
+
+func TestTransferPostgres(t *testing.T) {
+	repo, pg := newWalletRepo(t)
+	ctx := context.Background()
+	from, to, frozen := createWallet(t, repo), createWallet(t, repo), createWallet(t, repo)
+	if err := repository.NewAdminRepo(pg, logrus.New()).SetFrozen(ctx, frozen, true); err != nil {
+		t.Fatalf("SetFrozen: %v", err)
+	}
+
+	if err := repo.Transfer(ctx, from, to, 40); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if got := balanceOf(t, repo, from); got != repository.InitialWalletBalance-40 {
+		t.Errorf("source balance = %v, want %v", got, repository.InitialWalletBalance-40)
+	}
+	if got := balanceOf(t, repo, to); got != repository.InitialWalletBalance+40 {
+		t.Errorf("target balance = %v, want %v", got, repository.InitialWalletBalance+40)
+	}
+
+	tests := []struct {
+		name     string
+		from, to uuid.UUID
+		amount   float32
+		want     error
+	}{
+		{"source not found", uuid.New(), to, 1, repoerrors.ErrWalletNotFound},
+		{"target not found", from, uuid.New(), 1, repoerrors.ErrTargetWalletNotFound},
+		{"not enough balance", from, to, repository.InitialWalletBalance, repoerrors.ErrNotEnoughBalance},
+		{"source frozen", frozen, to, 1, repoerrors.ErrWalletFrozen},
+		{"target frozen", from, frozen, 1, repoerrors.ErrTargetWalletFrozen},
+		{"self transfer", from, from, 1, repoerrors.ErrSelfTransfer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := repo.Transfer(ctx, tt.from, tt.to, tt.amount); !errors.Is(err, tt.want) {
+				t.Errorf("Transfer: got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// неудачные переводы балансы не меняют
+	if got := balanceOf(t, repo, from); got != repository.InitialWalletBalance-40 {
+		t.Errorf("source balance after failed transfers = %v, want %v", got, repository.InitialWalletBalance-40)
+	}
+	if got := balanceOf(t, repo, frozen); got != repository.InitialWalletBalance {
+		t.Errorf("frozen balance = %v, want %v", got, repository.InitialWalletBalance)
+	}
+}
+
+func TestTransactionHistoryPostgres(t *testing.T) {
+	repo, _ := newWalletRepo(t)
+	ctx := context.Background()
+	a, b := createWallet(t, repo), createWallet(t, repo)
+
+	amounts := []float32{1, 2.5, 3}
+	for i, amount := range amounts {
+		from, to := a, b
+		if i%2 == 1 {
+			from, to = b, a
+		}
+		if err := repo.Transfer(ctx, from, to, amount); err != nil {
+			t.Fatalf("Transfer: %v", err)
+		}
+	}
+
+	history, err := repo.GetTransactionHistory(ctx, a, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != len(amounts) {
+		t.Fatalf("GetTransactionHistory: got %d transactions, want %d", len(history), len(amounts))
+	}
+	for i, tx := range history {
+		if tx.Amount != amounts[i] {
+			t.Errorf("history[%d].Amount = %v, want %v", i, tx.Amount, amounts[i])
+		}
+		if i > 0 && (tx.Time.Before(history[i-1].Time) || tx.Id <= history[i-1].Id) {
+			t.Errorf("history[%d] is ordered before history[%d]", i, i-1)
+		}
+	}
+
+	if _, err := repo.GetTransactionHistory(ctx, uuid.New(), entity.TransactionFilter{}); !errors.Is(err, repoerrors.ErrWalletNotFound) {
+		t.Errorf("GetTransactionHistory: got %v, want %v", err, repoerrors.ErrWalletNotFound)
+	}
+}
+
+// встречные переводы в параллельных транзакциях: строки блокируются в одном порядке - без дедлоков,
+// сумма балансов сохраняется
+func TestConcurrentTransfersPostgres(t *testing.T) {
+	const (
+		workers   = 6
+		perWorker = 20
+	)
+	repo, _ := newWalletRepo(t)
+	ctx := context.Background()
+	a, b := createWallet(t, repo), createWallet(t, repo)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		from, to := a, b
+		if w%2 == 1 {
+			from, to = b, a
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				err := repo.Transfer(ctx, from, to, 3)
+				if err != nil && !errors.Is(err, repoerrors.ErrNotEnoughBalance) {
+					t.Errorf("Transfer: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	balanceA, balanceB := balanceOf(t, repo, a), balanceOf(t, repo, b)
+	if balanceA < 0 || balanceB < 0 {
+		t.Errorf("negative balance: a=%v b=%v", balanceA, balanceB)
+	}
+	if total := balanceA + balanceB; math.Abs(float64(total-2*repository.InitialWalletBalance)) > 1e-3 {
+		t.Errorf("total balance = %v, want %v", total, 2*repository.InitialWalletBalance)
+	}
+}
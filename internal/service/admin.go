@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type adminServiceImpl struct {
+	walletService WalletService
+	adminRepo     repository.AdminRepo
+	log           *logrus.Logger
+}
+
+// переводы администратора идут через WalletService - те же бизнес-правила, что и для API, кроме антифрод-проверки
+func NewAdminService(ws WalletService, ar repository.AdminRepo, log *logrus.Logger) *adminServiceImpl {
+	return &adminServiceImpl{
+		walletService: ws,
+		adminRepo:     ar,
+		log:           log,
+	}
+}
+
+func (as *adminServiceImpl) Transfer(ctx context.Context, actor, reason string, from, to uuid.UUID, amount float32) error {
+	if err := validateAudit(actor, reason); err != nil {
+		return err
+	}
+
+	err := as.walletService.Transfer(withoutFraudScreening(ctx), from, to, amount)
+	return as.audit(ctx, entity.AuditRecord{
+		Actor:    actor,
+		Action:   entity.AuditActionTransfer,
+		WalletId: from,
+		Details:  map[string]any{"to": to, "amount": amount},
+		Reason:   reason,
+	}, err)
+}
+
+func (as *adminServiceImpl) AdjustBalance(ctx context.Context, actor, reason string, walletId uuid.UUID, amount float32) error {
+	if err := validateAudit(actor, reason); err != nil {
+		return err
+	}
+	abs := amount
+	if abs < 0 {
+		abs = -abs
+	}
+	if msg := validateAmount(abs); msg != "" {
+		return newValidationError([]FieldError{{Field: "amount", Message: "absolute value " + msg}})
+	}
+
+	err := as.adminRepo.AdjustBalance(ctx, walletId, amount)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		err = ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrNotEnoughBalance) {
+		err = ErrNotEnoughBalance
+	}
+	return as.audit(ctx, entity.AuditRecord{
+		Actor:    actor,
+		Action:   entity.AuditActionAdjustment,
+		WalletId: walletId,
+		Details:  map[string]any{"amount": amount},
+		Reason:   reason,
+	}, err)
+}
+
+func (as *adminServiceImpl) FreezeWallet(ctx context.Context, actor, reason string, walletId uuid.UUID, frozen bool) error {
+	if err := validateAudit(actor, reason); err != nil {
+		return err
+	}
+
+	action := entity.AuditActionFreeze
+	if !frozen {
+		action = entity.AuditActionUnfreeze
+	}
+
+	err := as.adminRepo.SetFrozen(ctx, walletId, frozen)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		err = ErrWalletNotFound
+	}
+	return as.audit(ctx, entity.AuditRecord{
+		Actor:    actor,
+		Action:   action,
+		WalletId: walletId,
+		Details:  map[string]any{},
+		Reason:   reason,
+	}, err)
+}
+
+func (as *adminServiceImpl) VerifyAlias(ctx context.Context, actor, reason string, walletId uuid.UUID, kind string) (entity.WalletAlias, error) {
+	if err := validateAudit(actor, reason); err != nil {
+		return entity.WalletAlias{}, err
+	}
+	// handle подтверждается при создании
+	if kind != entity.AliasEmail && kind != entity.AliasPhone {
+		return entity.WalletAlias{}, newValidationError([]FieldError{{Field: "kind", Message: "must be one of email, phone"}})
+	}
+
+	details := map[string]any{"kind": kind}
+	alias, err := as.adminRepo.VerifyAlias(ctx, walletId, kind)
+	if errors.Is(err, repoerrors.ErrAliasNotFound) {
+		err = ErrAliasNotFound
+	}
+	if errors.Is(err, repoerrors.ErrAliasTaken) {
+		err = ErrAliasTaken
+	}
+	if err == nil {
+		details["value"] = alias.Value
+	}
+	return alias, as.audit(ctx, entity.AuditRecord{
+		Actor:    actor,
+		Action:   entity.AuditActionVerifyAlias,
+		WalletId: walletId,
+		Details:  details,
+		Reason:   reason,
+	}, err)
+}
+
+// SetCreditLine - из line берутся WalletId, CreditLimit, AnnualRate, DayCount и DailyFee; пустые ставка и
+// соглашение о днях - "0" и act/365. Лимит 0 выключает овердрафт, но не раньше, чем погашена задолженность
+func (as *adminServiceImpl) SetCreditLine(ctx context.Context, actor, reason string, line entity.CreditLine) (entity.CreditLine, error) {
+	if err := validateAudit(actor, reason); err != nil {
+		return entity.CreditLine{}, err
+	}
+	if line.AnnualRate == "" {
+		line.AnnualRate = "0"
+	}
+	if line.DayCount == "" {
+		line.DayCount = entity.DayCountActual365
+	}
+	if err := validateCreditLine(line); err != nil {
+		return entity.CreditLine{}, err
+	}
+
+	// у кармана нет своих долгов - он тратит только то, что в него отложено
+	wallet, err := as.walletService.WalletStatus(ctx, line.WalletId)
+	if err == nil && wallet.ParentId != nil {
+		return entity.CreditLine{}, newValidationError([]FieldError{{Field: "wallet", Message: "pockets can't have a credit line"}})
+	}
+	var saved entity.CreditLine
+	if err == nil {
+		// у новой линии начисление - со следующего закончившегося дня
+		line.AccruedThrough = time.Now().UTC().Truncate(day).AddDate(0, 0, -1)
+		saved, err = as.adminRepo.SetCreditLine(ctx, line)
+	}
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		err = ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrCreditLimitBelowDebt) {
+		err = ErrCreditLimitBelowDebt
+	}
+	return saved, as.audit(ctx, entity.AuditRecord{
+		Actor:    actor,
+		Action:   entity.AuditActionCreditLine,
+		WalletId: line.WalletId,
+		Details:  map[string]any{"creditLimit": line.CreditLimit, "annualRate": line.AnnualRate, "dayCount": line.DayCount, "dailyFee": line.DailyFee},
+		Reason:   reason,
+	}, err)
+}
+
+func (as *adminServiceImpl) Reconcile(ctx context.Context) ([]entity.ReconciliationMismatch, error) {
+	return as.adminRepo.Reconcile(ctx)
+}
+
+// пишет аудит по результату операции opErr и возвращает opErr;
+// если не удалось записать аудит - это тоже ошибка, молча терять аудит нельзя
+func (as *adminServiceImpl) audit(ctx context.Context, record entity.AuditRecord, opErr error) error {
+	record.Time = time.Now().UTC()
+	record.Outcome = entity.AuditOutcomeSuccess
+	if opErr != nil {
+		record.Outcome = entity.AuditOutcomeFailed
+		record.Details["error"] = opErr.Error()
+	}
+	// кошелька может не быть - тогда ссылку на него не сохраняем
+	if errors.Is(opErr, ErrWalletNotFound) || errors.Is(opErr, ErrAliasNotFound) {
+		record.Details["walletId"] = record.WalletId
+		record.WalletId = uuid.Nil
+	}
+
+	if err := as.adminRepo.SaveAuditRecord(ctx, record); err != nil {
+		logger.FromContext(ctx, as.log).WithError(err).Error("adminServiceImpl.audit - adminRepo.SaveAuditRecord")
+		if opErr != nil {
+			return opErr
+		}
+		return fmt.Errorf("operation succeeded but audit record was not saved: %w", err)
+	}
+	return opErr
+}
+
+func validateAudit(actor, reason string) error {
+	var fields []FieldError
+	if strings.TrimSpace(actor) == "" {
+		fields = append(fields, FieldError{Field: "actor", Message: "is required"})
+	}
+	if strings.TrimSpace(reason) == "" {
+		fields = append(fields, FieldError{Field: "reason", Message: "is required"})
+	}
+	return newValidationError(fields)
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// максимальная длина email по RFC 5321
+const MaxEmailLength = 254
+
+var (
+	// handle: латиница в нижнем регистре, цифры и _, начинается с буквы - так его не спутать с телефоном
+	handlePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{2,31}$`)
+	// телефон в формате E.164
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+)
+
+type aliasServiceImpl struct {
+	repo repository.AliasRepo
+	log  *logrus.Logger
+}
+
+// handle закрепляется за кошельком сразу, email и phone участвуют в поиске и переводах только после
+// подтверждения оператором (ewalletctl verify-alias)
+func NewAliasService(repo repository.AliasRepo, log *logrus.Logger) *aliasServiceImpl {
+	return &aliasServiceImpl{
+		repo: repo,
+		log:  log,
+	}
+}
+
+// SetAlias - задает псевдоним вида kind; прежний псевдоним того же вида закрывается и остается в истории
+func (as *aliasServiceImpl) SetAlias(ctx context.Context, walletId uuid.UUID, kind, value string) (entity.WalletAlias, error) {
+	if err := validateAliasKind(kind); err != nil {
+		return entity.WalletAlias{}, err
+	}
+	value, msg := normalizeAlias(kind, value)
+	if msg != "" {
+		return entity.WalletAlias{}, newValidationError([]FieldError{{Field: "value", Message: msg}})
+	}
+
+	a, err := as.repo.SetAlias(ctx, entity.WalletAlias{
+		WalletId: walletId,
+		Kind:     kind,
+		Value:    value,
+		Verified: kind == entity.AliasHandle,
+	})
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.WalletAlias{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrAliasTaken) {
+		return entity.WalletAlias{}, ErrAliasTaken
+	}
+	if err != nil {
+		logger.FromContext(ctx, as.log).WithError(err).Error("aliasServiceImpl.SetAlias - repo.SetAlias")
+		return entity.WalletAlias{}, err
+	}
+	return a, nil
+}
+
+func (as *aliasServiceImpl) RemoveAlias(ctx context.Context, walletId uuid.UUID, kind string) error {
+	if err := validateAliasKind(kind); err != nil {
+		return err
+	}
+	err := as.repo.RemoveAlias(ctx, walletId, kind)
+	if errors.Is(err, repoerrors.ErrAliasNotFound) {
+		return ErrAliasNotFound
+	}
+	return err
+}
+
+func (as *aliasServiceImpl) ListAliases(ctx context.Context, walletId uuid.UUID, withRemoved bool) ([]entity.WalletAlias, error) {
+	return as.repo.ListAliases(ctx, walletId, withRemoved)
+}
+
+// LookupAlias - подтвержденные псевдонимы кошелька, за которым закреплен alias; email и phone маскируются
+func (as *aliasServiceImpl) LookupAlias(ctx context.Context, alias string) (entity.AliasLookup, error) {
+	walletId, _, err := as.ResolveAlias(ctx, alias)
+	if err != nil {
+		return entity.AliasLookup{}, err
+	}
+
+	aliases, err := as.repo.ListAliases(ctx, walletId, false)
+	if err != nil {
+		logger.FromContext(ctx, as.log).WithError(err).Error("aliasServiceImpl.LookupAlias - repo.ListAliases")
+		return entity.AliasLookup{}, err
+	}
+	var lookup entity.AliasLookup
+	for _, a := range aliases {
+		if !a.Verified {
+			continue
+		}
+		switch a.Kind {
+		case entity.AliasHandle:
+			lookup.Handle = formatAlias(a.Kind, a.Value)
+		case entity.AliasEmail:
+			lookup.Email = maskEmail(a.Value)
+		case entity.AliasPhone:
+			lookup.Phone = maskPhone(a.Value)
+		}
+	}
+	return lookup, nil
+}
+
+// ResolveAlias - кошелек, за которым закреплен подтвержденный псевдоним, и сам псевдоним в нормализованном виде
+// (@handle, email или phone); вид псевдонима определяется по записи
+func (as *aliasServiceImpl) ResolveAlias(ctx context.Context, alias string) (uuid.UUID, string, error) {
+	kind, value, msg := parseAlias(alias)
+	if msg != "" {
+		return uuid.Nil, "", newValidationError([]FieldError{{Field: "alias", Message: msg}})
+	}
+
+	a, err := as.repo.FindAlias(ctx, kind, value)
+	if errors.Is(err, repoerrors.ErrAliasNotFound) {
+		return uuid.Nil, "", ErrAliasNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, as.log).WithError(err).Error("aliasServiceImpl.ResolveAlias - repo.FindAlias")
+		return uuid.Nil, "", err
+	}
+	return a.WalletId, formatAlias(kind, value), nil
+}
+
+func validateAliasKind(kind string) error {
+	switch kind {
+	case entity.AliasHandle, entity.AliasEmail, entity.AliasPhone:
+		return nil
+	default:
+		return newValidationError([]FieldError{{Field: "kind", Message: "must be one of handle, email, phone"}})
+	}
+}
+
+// вид псевдонима по записи: @handle, email, +телефон; без префиксов - handle, если начинается с буквы, иначе телефон
+func parseAlias(s string) (string, string, string) {
+	s = strings.TrimSpace(s)
+	var kind string
+	switch {
+	case s == "":
+		return "", "", "is required"
+	case strings.HasPrefix(s, "@"):
+		kind = entity.AliasHandle
+	case strings.Contains(s, "@"):
+		kind = entity.AliasEmail
+	case strings.HasPrefix(s, "+") || strings.HasPrefix(s, "(") || (s[0] >= '0' && s[0] <= '9'):
+		kind = entity.AliasPhone
+	default:
+		kind = entity.AliasHandle
+	}
+	value, msg := normalizeAlias(kind, s)
+	return kind, value, msg
+}
+
+// нормализованное значение псевдонима или сообщение об ошибке
+func normalizeAlias(kind, value string) (string, string) {
+	value = strings.TrimSpace(value)
+	switch kind {
+	case entity.AliasHandle:
+		value = strings.ToLower(strings.TrimPrefix(value, "@"))
+		if !handlePattern.MatchString(value) {
+			return "", "must be 3 to 32 latin letters, digits or underscores, starting with a letter"
+		}
+	case entity.AliasEmail:
+		value = strings.ToLower(value)
+		addr, err := mail.ParseAddress(value)
+		at := strings.LastIndexByte(value, '@')
+		if err != nil || addr.Address != value || len(value) > MaxEmailLength || !strings.Contains(value[at+1:], ".") {
+			return "", "must be a valid email address"
+		}
+	case entity.AliasPhone:
+		value = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(value)
+		if !phonePattern.MatchString(value) {
+			return "", "must be in international format, e.g. +79001234567"
+		}
+	}
+	return value, ""
+}
+
+// псевдоним в том виде, в каком его пишут пользователи
+func formatAlias(kind, value string) string {
+	if kind == entity.AliasHandle {
+		return "@" + value
+	}
+	return value
+}
+
+// ivan.petrov@mail.ru -> i***@m***.ru
+func maskEmail(email string) string {
+	at := strings.LastIndexByte(email, '@')
+	local, domain := email[:at], email[at+1:]
+	dot := strings.LastIndexByte(domain, '.')
+	return string([]rune(local)[:1]) + "***@" + string([]rune(domain)[:1]) + "***" + domain[dot:]
+}
+
+// +79001234567 -> +7********67
+func maskPhone(phone string) string {
+	return phone[:2] + strings.Repeat("*", len(phone)-4) + phone[len(phone)-2:]
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newAliasEnv(t *testing.T) (pgEnv, repository.AdminRepo, *aliasServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	return env, repository.NewAdminRepo(env.pg, discardLogger()), NewAliasService(repository.NewAliasRepo(env.pg, discardLogger()), discardLogger())
+}
+
+// handle закрепляется сразу и без учета регистра; замененный handle остается в истории и освобождается
+func TestAliasHandlePostgres(t *testing.T) {
+	env, _, as := newAliasEnv(t)
+	ctx := context.Background()
+	ivan, other := env.wallet(t), env.wallet(t)
+
+	a, err := as.SetAlias(ctx, ivan, entity.AliasHandle, "@Ivan_P")
+	if err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	if a.Value != "ivan_p" || !a.Verified {
+		t.Errorf("SetAlias: got %+v, want verified ivan_p", a)
+	}
+	if _, err := as.SetAlias(ctx, other, entity.AliasHandle, "ivan_p"); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("SetAlias of a taken handle: got %v, want %v", err, ErrAliasTaken)
+	}
+
+	walletId, alias, err := as.ResolveAlias(ctx, "IVAN_P")
+	if err != nil || walletId != ivan || alias != "@ivan_p" {
+		t.Errorf("ResolveAlias: got %s, %q, %v, want %s, @ivan_p", walletId, alias, err, ivan)
+	}
+
+	if _, err := as.SetAlias(ctx, ivan, entity.AliasHandle, "ivan_petrov"); err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	if _, _, err := as.ResolveAlias(ctx, "@ivan_p"); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("ResolveAlias of a replaced handle: got %v, want %v", err, ErrAliasNotFound)
+	}
+	if _, err := as.SetAlias(ctx, other, entity.AliasHandle, "ivan_p"); err != nil {
+		t.Errorf("SetAlias of a released handle: %v", err)
+	}
+
+	history, err := as.ListAliases(ctx, ivan, true)
+	if err != nil {
+		t.Fatalf("ListAliases: %v", err)
+	}
+	if len(history) != 2 || history[0].RemovedAt == nil || history[1].RemovedAt != nil {
+		t.Errorf("history = %+v, want the replaced and the current handle", history)
+	}
+	if active, err := as.ListAliases(ctx, ivan, false); err != nil || len(active) != 1 || active[0].Value != "ivan_petrov" {
+		t.Errorf("ListAliases: got %+v, %v, want only ivan_petrov", active, err)
+	}
+
+	if err := as.RemoveAlias(ctx, ivan, entity.AliasHandle); err != nil {
+		t.Fatalf("RemoveAlias: %v", err)
+	}
+	if err := as.RemoveAlias(ctx, ivan, entity.AliasHandle); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("second RemoveAlias: got %v, want %v", err, ErrAliasNotFound)
+	}
+}
+
+// email и phone ищутся только после подтверждения оператором, в поиске замаскированы
+func TestAliasVerificationPostgres(t *testing.T) {
+	env, admin, as := newAliasEnv(t)
+	ctx := context.Background()
+	wallet := env.wallet(t)
+
+	if _, err := as.SetAlias(ctx, wallet, entity.AliasHandle, "ivan"); err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	email, err := as.SetAlias(ctx, wallet, entity.AliasEmail, "Ivan.Petrov@Mail.ru")
+	if err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	if email.Value != "ivan.petrov@mail.ru" || email.Verified {
+		t.Errorf("SetAlias: got %+v, want unverified ivan.petrov@mail.ru", email)
+	}
+	if _, err := as.SetAlias(ctx, wallet, entity.AliasPhone, "+7 (900) 123-45-67"); err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+
+	if _, _, err := as.ResolveAlias(ctx, "ivan.petrov@mail.ru"); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("ResolveAlias of an unverified email: got %v, want %v", err, ErrAliasNotFound)
+	}
+	lookup, err := as.LookupAlias(ctx, "@ivan")
+	if err != nil {
+		t.Fatalf("LookupAlias: %v", err)
+	}
+	if lookup != (entity.AliasLookup{Handle: "@ivan"}) {
+		t.Errorf("LookupAlias before verification: got %+v, want only the handle", lookup)
+	}
+
+	for _, kind := range []string{entity.AliasEmail, entity.AliasPhone} {
+		if _, err := admin.VerifyAlias(ctx, wallet, kind); err != nil {
+			t.Fatalf("VerifyAlias %s: %v", kind, err)
+		}
+	}
+	if walletId, _, err := as.ResolveAlias(ctx, "+79001234567"); err != nil || walletId != wallet {
+		t.Errorf("ResolveAlias of a verified phone: got %s, %v, want %s", walletId, err, wallet)
+	}
+	lookup, err = as.LookupAlias(ctx, "ivan.petrov@mail.ru")
+	if err != nil {
+		t.Fatalf("LookupAlias: %v", err)
+	}
+	want := entity.AliasLookup{Handle: "@ivan", Email: "i***@m***.ru", Phone: "+7********67"}
+	if lookup != want {
+		t.Errorf("LookupAlias: got %+v, want %+v", lookup, want)
+	}
+}
+
+// перевод по псевдониму хранит псевдоним в истории - она читаема и после смены псевдонима
+func TestTransferToAliasPostgres(t *testing.T) {
+	env, _, as := newAliasEnv(t)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	if _, err := as.SetAlias(ctx, to, entity.AliasHandle, "shop"); err != nil {
+		t.Fatalf("SetAlias: %v", err)
+	}
+	walletId, alias, err := as.ResolveAlias(ctx, "@shop")
+	if err != nil {
+		t.Fatalf("ResolveAlias: %v", err)
+	}
+	if err := env.ws.Transfer(repository.WithTransferDetails(ctx, entity.TransferDetails{ToAlias: alias}), from, walletId, 5); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := as.RemoveAlias(ctx, to, entity.AliasHandle); err != nil {
+		t.Fatalf("RemoveAlias: %v", err)
+	}
+
+	history, err := env.wallets.GetTransactionHistory(ctx, from, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].ToAlias != "@shop" {
+		t.Errorf("history = %+v, want one transfer to @shop", history)
+	}
+	env.assertBalance(t, to, repository.InitialWalletBalance+5)
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+type batchTransferServiceImpl struct {
+	repo       repository.BatchTransferRepo
+	transactor repository.Transactor
+	log        *logrus.Logger
+	// максимальное кол-во строк в пакете
+	maxLines int
+	// пакеты больше этого размера исполняются асинхронно воркером
+	asyncThreshold int
+	pockets        pocketRule
+	fraud          *FraudScreen
+}
+
+// wr и pockets - проверка пакетов, отправленных из кармана; fraud - антифрод-проверка строк (nil - без проверки)
+func NewBatchTransferService(repo repository.BatchTransferRepo, transactor repository.Transactor, log *logrus.Logger, maxLines, asyncThreshold int, wr repository.WalletRepo, pockets PocketPolicy, fraud *FraudScreen) *batchTransferServiceImpl {
+	return &batchTransferServiceImpl{
+		repo:           repo,
+		transactor:     transactor,
+		log:            log,
+		maxLines:       maxLines,
+		asyncThreshold: asyncThreshold,
+		pockets:        newPocketRule(wr, pockets),
+		fraud:          fraud,
+	}
+}
+
+// CreateBatchTransfer - небольшой пакет исполняется сразу и возвращается с результатами строк,
+// большой - сохраняется в статусе pending и исполняется воркером (статус - через GetBatchTransfer)
+func (bs *batchTransferServiceImpl) CreateBatchTransfer(ctx context.Context, from uuid.UUID, mode string, lines []entity.BatchTransferLine) (entity.BatchTransfer, error) {
+	if mode == "" {
+		mode = entity.BatchModeAllOrNothing
+	}
+	if err := bs.validate(from, mode, lines); err != nil {
+		return entity.BatchTransfer{}, err
+	}
+	to := make([]uuid.UUID, len(lines))
+	for i, line := range lines {
+		to[i] = line.To
+	}
+	if err := bs.pockets.check(ctx, from, to...); err != nil {
+		return entity.BatchTransfer{}, err
+	}
+	ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: from.String()})
+
+	bt := entity.BatchTransfer{From: from, Mode: mode, Lines: lines}
+	if len(lines) > bs.asyncThreshold {
+		bt, err := bs.repo.CreateBatchTransfer(ctx, bt)
+		if errors.Is(err, repoerrors.ErrWalletNotFound) {
+			return entity.BatchTransfer{}, ErrWalletNotFound
+		}
+		return bt, err
+	}
+
+	err := bs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		created, err := bs.repo.CreateBatchTransfer(ctx, bt)
+		if err != nil {
+			return err
+		}
+		bt, err = bs.execute(ctx, created)
+		return err
+	})
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.BatchTransfer{}, ErrWalletNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, bs.log).WithError(err).Error("batchTransferServiceImpl.CreateBatchTransfer")
+		return entity.BatchTransfer{}, err
+	}
+	return bt, nil
+}
+
+func (bs *batchTransferServiceImpl) GetBatchTransfer(ctx context.Context, walletId, id uuid.UUID) (entity.BatchTransfer, error) {
+	bt, err := bs.repo.GetBatchTransfer(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrBatchTransferNotFound) {
+		return entity.BatchTransfer{}, ErrBatchTransferNotFound
+	}
+	return bt, err
+}
+
+// ExecutePending - исполняет до limit ожидающих пакетов; возвращает, сколько исполнено
+func (bs *batchTransferServiceImpl) ExecutePending(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		err := bs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			bt, err := bs.repo.ClaimPendingBatchTransfer(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = bs.execute(logger.WithFields(ctx, logrus.Fields{"batch_transfer_id": bt.Id.String()}), bt)
+			return err
+		})
+		if errors.Is(err, repoerrors.ErrNoPendingBatchTransfers) {
+			break
+		}
+		if err != nil {
+			logger.FromContext(ctx, bs.log).WithError(err).Error("batchTransferServiceImpl.ExecutePending")
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// execute - строки проверяются антифрод-правилами в транзакции исполнения, каждая как перевод своему получателю.
+// Удержать строку нельзя, поэтому решение review для нее - блокировка; заблокированная строка не исполняется,
+// как строка без баланса: пакет all_or_nothing отклоняется целиком
+func (bs *batchTransferServiceImpl) execute(ctx context.Context, bt entity.BatchTransfer) (entity.BatchTransfer, error) {
+	ctx = withoutFraudHold(repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceBatchTransfer, Id: bt.Id}))
+
+	transfers := make([]fraudTransfer, len(bt.Lines))
+	for i, line := range bt.Lines {
+		transfers[i] = fraudTransfer{To: line.To, Amount: line.Amount}
+	}
+	results, err := bs.fraud.screenAll(ctx, bt.From, transfers)
+	if err != nil {
+		return entity.BatchTransfer{}, err
+	}
+	for i, res := range results {
+		if res != nil {
+			bt.Lines[i].Status, bt.Lines[i].Error = entity.BatchLineFailed, res.Error()
+		}
+	}
+
+	return bs.repo.ExecuteBatchTransfer(ctx, bt)
+}
+
+func (bs *batchTransferServiceImpl) validate(from uuid.UUID, mode string, lines []entity.BatchTransferLine) error {
+	var fields []FieldError
+	if mode != entity.BatchModeAllOrNothing && mode != entity.BatchModeBestEffort {
+		fields = append(fields, FieldError{Field: "mode", Message: "must be one of all_or_nothing, best_effort"})
+	}
+
+	switch {
+	case len(lines) == 0:
+		fields = append(fields, FieldError{Field: "lines", Message: "must not be empty"})
+	case len(lines) > bs.maxLines:
+		fields = append(fields, FieldError{Field: "lines", Message: "must contain at most " + strconv.Itoa(bs.maxLines) + " lines"})
+	default:
+		for i, line := range lines {
+			var validationErr *ValidationError
+			if errors.As(validateTransfer(from, line.To, line.Amount), &validationErr) {
+				for _, f := range validationErr.Fields {
+					fields = append(fields, FieldError{Field: fmt.Sprintf("lines[%d].%s", i, f.Field), Message: f.Message})
+				}
+			}
+		}
+	}
+
+	return newValidationError(fields)
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newBatchTransferService(env pgEnv, asyncThreshold int) *batchTransferServiceImpl {
+	repo := repository.NewBatchTransferRepo(env.pg, discardLogger())
+	return NewBatchTransferService(repo, env.transactor, discardLogger(), 1000, asyncThreshold, env.wallets, PocketPolicy{}, nil)
+}
+
+// строка на несуществующий кошелек: all_or_nothing не исполняет ничего, best_effort - все остальные строки
+func TestBatchTransferModesPostgres(t *testing.T) {
+	tests := []struct {
+		mode       string
+		wantStatus string
+		wantLines  []string
+		wantMoved  bool
+	}{
+		{
+			mode:       entity.BatchModeAllOrNothing,
+			wantStatus: entity.BatchTransferFailed,
+			wantLines:  []string{entity.BatchLineFailed, entity.BatchLineFailed, entity.BatchLineFailed},
+		},
+		{
+			mode:       entity.BatchModeBestEffort,
+			wantStatus: entity.BatchTransferCompleted,
+			wantLines:  []string{entity.BatchLineSucceeded, entity.BatchLineFailed, entity.BatchLineSucceeded},
+			wantMoved:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			env := newPgEnv(t)
+			bs := newBatchTransferService(env, 10)
+			ctx := context.Background()
+			from, a, b := env.wallet(t), env.wallet(t), env.wallet(t)
+
+			bt, err := bs.CreateBatchTransfer(ctx, from, tt.mode, []entity.BatchTransferLine{
+				{To: a, Amount: 10},
+				{To: uuid.New(), Amount: 20},
+				{To: b, Amount: 30.5},
+			})
+			if err != nil {
+				t.Fatalf("CreateBatchTransfer: %v", err)
+			}
+			if bt.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", bt.Status, tt.wantStatus)
+			}
+			for i, line := range bt.Lines {
+				if line.Status != tt.wantLines[i] || (line.Status == entity.BatchLineFailed) != (line.Error != "") {
+					t.Errorf("line %d: got %q (%q), want %q", i, line.Status, line.Error, tt.wantLines[i])
+				}
+			}
+
+			// результат сохранен так же, как возвращен
+			stored, err := bs.GetBatchTransfer(ctx, from, bt.Id)
+			if err != nil {
+				t.Fatalf("GetBatchTransfer: %v", err)
+			}
+			if stored.Status != bt.Status || len(stored.Lines) != len(bt.Lines) {
+				t.Errorf("stored batch: got %+v, want %+v", stored, bt)
+			}
+
+			if tt.wantMoved {
+				env.assertBalance(t, from, repository.InitialWalletBalance-40.5)
+				env.assertBalance(t, a, repository.InitialWalletBalance+10)
+				env.assertBalance(t, b, repository.InitialWalletBalance+30.5)
+			} else {
+				env.assertBalance(t, from, repository.InitialWalletBalance)
+				env.assertBalance(t, a, repository.InitialWalletBalance)
+				env.assertBalance(t, b, repository.InitialWalletBalance)
+			}
+		})
+	}
+}
+
+// строки проверяются по порядку: строка, на которую уже не хватает баланса, отклоняется, следующая поменьше - проходит
+func TestBatchTransferBalancePostgres(t *testing.T) {
+	env := newPgEnv(t)
+	bs := newBatchTransferService(env, 10)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	bt, err := bs.CreateBatchTransfer(ctx, from, entity.BatchModeBestEffort, []entity.BatchTransferLine{
+		{To: to, Amount: repository.InitialWalletBalance - 10},
+		{To: to, Amount: 20},
+		{To: to, Amount: 10},
+	})
+	if err != nil {
+		t.Fatalf("CreateBatchTransfer: %v", err)
+	}
+	want := []string{entity.BatchLineSucceeded, entity.BatchLineFailed, entity.BatchLineSucceeded}
+	for i, line := range bt.Lines {
+		if line.Status != want[i] {
+			t.Errorf("line %d: got %q (%q), want %q", i, line.Status, line.Error, want[i])
+		}
+	}
+	env.assertBalance(t, from, 0)
+	env.assertBalance(t, to, 2*repository.InitialWalletBalance)
+}
+
+// пакет больше asyncThreshold сохраняется pending и исполняется воркером ровно один раз
+func TestBatchTransferAsyncPostgres(t *testing.T) {
+	env := newPgEnv(t)
+	bs := newBatchTransferService(env, 1)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	// тысяча строк по 0.1 - сумма в тысячных без накопленной ошибки float32
+	lines := make([]entity.BatchTransferLine, 1000)
+	for i := range lines {
+		lines[i] = entity.BatchTransferLine{To: to, Amount: 0.1}
+	}
+	bt, err := bs.CreateBatchTransfer(ctx, from, entity.BatchModeAllOrNothing, lines)
+	if err != nil {
+		t.Fatalf("CreateBatchTransfer: %v", err)
+	}
+	if bt.Status != entity.BatchTransferPending {
+		t.Fatalf("status = %q, want %q", bt.Status, entity.BatchTransferPending)
+	}
+	env.assertBalance(t, from, repository.InitialWalletBalance)
+
+	if n, err := bs.ExecutePending(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("ExecutePending: got %d, %v, want 1 processed", n, err)
+	}
+	if n, err := bs.ExecutePending(ctx, 10); err != nil || n != 0 {
+		t.Errorf("second ExecutePending: got %d, %v, want nothing processed", n, err)
+	}
+
+	stored, err := bs.GetBatchTransfer(ctx, from, bt.Id)
+	if err != nil {
+		t.Fatalf("GetBatchTransfer: %v", err)
+	}
+	if stored.Status != entity.BatchTransferCompleted || stored.CompletedAt == nil {
+		t.Errorf("stored batch: got status %q, completedAt %v, want completed", stored.Status, stored.CompletedAt)
+	}
+	env.assertBalance(t, from, repository.InitialWalletBalance-100)
+	env.assertBalance(t, to, repository.InitialWalletBalance+100)
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// месяц уже был списан раньше - перевод откатывается
+var errCreditChargeAlreadyMade = errors.New("credit charge already made")
+
+// CreditPolicy - куда списываются проценты и комиссия по кредитным линиям и о каких порогах использования лимита уведомлять
+type CreditPolicy struct {
+	// uuid.Nil - начисление выключено, AccrueDue ничего не делает
+	TreasuryWalletId uuid.UUID
+	// через сколько повторить списание, отклоненное по бизнес-причине (например, кошельку не хватило лимита)
+	RetryDelay time.Duration
+	// пороги задолженности в процентах лимита по возрастанию
+	AlertThresholds []int
+}
+
+type creditServiceImpl struct {
+	walletService WalletService
+	repo          repository.CreditRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+	policy        CreditPolicy
+}
+
+// списания идут через WalletService.Transfer на казначейский кошелек, транзакция помечается источником credit_charge
+func NewCreditService(ws WalletService, repo repository.CreditRepo, transactor repository.Transactor, log *logrus.Logger, policy CreditPolicy) *creditServiceImpl {
+	return &creditServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+		policy:        policy,
+	}
+}
+
+func (cs *creditServiceImpl) GetLine(ctx context.Context, walletId uuid.UUID) (entity.CreditLine, error) {
+	line, err := cs.repo.GetCreditLine(ctx, walletId)
+	if errors.Is(err, repoerrors.ErrCreditLineNotFound) {
+		return entity.CreditLine{}, ErrCreditLineNotFound
+	}
+	return line, err
+}
+
+func (cs *creditServiceImpl) ListAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.CreditAccrual, error) {
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, newValidationError([]FieldError{{Field: "to", Message: "must not be before from"}})
+	}
+	if _, err := cs.GetLine(ctx, walletId); err != nil {
+		return nil, err
+	}
+	return cs.repo.ListCreditAccruals(ctx, walletId, filter)
+}
+
+func (cs *creditServiceImpl) ListCharges(ctx context.Context, walletId uuid.UUID) ([]entity.CreditCharge, error) {
+	if _, err := cs.GetLine(ctx, walletId); err != nil {
+		return nil, err
+	}
+	return cs.repo.ListCreditCharges(ctx, walletId)
+}
+
+func (cs *creditServiceImpl) ListAlerts(ctx context.Context, walletId uuid.UUID) ([]entity.CreditAlert, error) {
+	if _, err := cs.GetLine(ctx, walletId); err != nil {
+		return nil, err
+	}
+	return cs.repo.ListCreditAlerts(ctx, walletId)
+}
+
+// AccrueDue - до limit шагов начисления: каждый шаг - один день одной линии и, если месяц закончился, списание;
+// возвращает, сколько шагов сделано
+func (cs *creditServiceImpl) AccrueDue(ctx context.Context, limit int) (int, error) {
+	if cs.policy.TreasuryWalletId == uuid.Nil {
+		return 0, nil
+	}
+	processed := 0
+	for processed < limit {
+		ok, err := cs.accrueNext(ctx, time.Now().UTC())
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// начисление за день, списание и сдвиг линии - в одной транзакции, как у процентов на остаток
+func (cs *creditServiceImpl) accrueNext(ctx context.Context, now time.Time) (bool, error) {
+	err := cs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		through := now.Truncate(day).AddDate(0, 0, -1)
+		line, err := cs.repo.ClaimDueCreditLine(ctx, through, now)
+		if err != nil {
+			return err
+		}
+		ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: line.WalletId.String()})
+
+		pending, ok := new(big.Rat).SetString(line.Pending)
+		if !ok {
+			return fmt.Errorf("invalid pending credit charge %q", line.Pending)
+		}
+
+		if line.AccruedThrough.Before(through) {
+			date := line.AccruedThrough.AddDate(0, 0, 1)
+			amount, err := cs.accrue(ctx, line, date)
+			if err != nil {
+				return err
+			}
+			pending.Add(pending, amount)
+			line.AccruedThrough = date
+			if periodEnd(date, entity.CompoundingMonthly) {
+				line.ChargeDue = true
+			}
+		}
+
+		line.RetryAt = nil
+		if line.ChargeDue {
+			err = cs.charge(ctx, line, pending, now)
+			switch {
+			case err == nil:
+				line.ChargeDue = false
+			case errors.Is(err, errCreditChargeAlreadyMade):
+				logger.FromContext(ctx, cs.log).WithField("period_end", line.AccruedThrough).Warn("credit charge already made, skipping")
+				line.ChargeDue = false
+			case errorReason(err) != metrics.ReasonInternal:
+				// бизнес-ошибка - начисленное остается к списанию, повтор через RetryDelay
+				retryAt := now.Add(cs.policy.RetryDelay)
+				line.RetryAt = &retryAt
+				logger.FromContext(ctx, cs.log).WithError(err).Warn("credit charge failed")
+			default:
+				return err
+			}
+		}
+
+		line.Pending = pending.FloatString(AccrualPrecision)
+		return cs.repo.UpdateCreditLineProgress(ctx, line)
+	})
+	if errors.Is(err, repoerrors.ErrNoDueCreditLines) {
+		return false, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx, cs.log).WithError(err).Error("creditServiceImpl.accrueNext")
+		return false, err
+	}
+	return true, nil
+}
+
+// проценты и комиссия за день date, если он закончился с отрицательным балансом; иначе 0
+func (cs *creditServiceImpl) accrue(ctx context.Context, line entity.CreditLine, date time.Time) (*big.Rat, error) {
+	balance, err := cs.repo.EndOfDayBalance(ctx, line.WalletId, date.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	if toUnits(balance) >= 0 {
+		return new(big.Rat), nil
+	}
+
+	interest, err := dailyInterest(-balance, line.AnnualRate, line.DayCount, date)
+	if err != nil {
+		return nil, err
+	}
+	inserted, err := cs.repo.SaveCreditAccrual(ctx, entity.CreditAccrual{
+		WalletId:   line.WalletId,
+		Date:       date,
+		Balance:    balance,
+		AnnualRate: line.AnnualRate,
+		DayCount:   line.DayCount,
+		Interest:   interest.FloatString(AccrualPrecision),
+		Fee:        line.DailyFee,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		logger.FromContext(ctx, cs.log).WithField("date", date).Warn("credit charges already accrued for the day, skipping")
+		return new(big.Rat), nil
+	}
+	return interest.Add(interest, big.NewRat(toUnits(line.DailyFee), int64(amountUnit))), nil
+}
+
+// списывает pending, округленное вниз до тысячных; остаток остается в pending до следующего списания.
+// Списание - обычный перевод, поэтому упирается в кредитный лимит: если его не хватает, повторяется позже
+func (cs *creditServiceImpl) charge(ctx context.Context, line entity.CreditLine, pending *big.Rat, now time.Time) error {
+	charged := truncateRat(pending, AmountPrecision)
+	if charged.Sign() == 0 {
+		return nil
+	}
+	carry := new(big.Rat).Sub(pending, charged)
+	amount, _ := charged.Float32()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, cs.log).WithError(err).Error("creditServiceImpl.charge - uuid.NewRandom")
+		return err
+	}
+	c := entity.CreditCharge{
+		Id:        id,
+		WalletId:  line.WalletId,
+		PeriodEnd: line.AccruedThrough,
+		Accrued:   pending.FloatString(AccrualPrecision),
+		Amount:    amount,
+		Carry:     carry.FloatString(AccrualPrecision),
+		ChargedAt: now,
+	}
+
+	// списание и перевод - в savepoint: если перевод не прошел, начисления остаются несписанными
+	err = cs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		inserted, err := cs.repo.SaveCreditCharge(ctx, c)
+		if err != nil {
+			return err
+		}
+		if !inserted {
+			return errCreditChargeAlreadyMade
+		}
+		ctx = repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceCreditCharge, Id: c.Id})
+		return cs.walletService.Transfer(ctx, line.WalletId, cs.policy.TreasuryWalletId, amount)
+	})
+	if err != nil {
+		return err
+	}
+	pending.Set(carry)
+	return nil
+}
+
+// CheckUtilization - до limit линий, у которых поменялся наибольший достигнутый порог использования лимита:
+// о росте пишется уведомление, при снижении порог просто запоминается, чтобы следующий рост уведомил снова
+func (cs *creditServiceImpl) CheckUtilization(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		err := cs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			line, reached, err := cs.repo.ClaimCreditAlert(ctx, cs.policy.AlertThresholds)
+			if err != nil {
+				return err
+			}
+			if reached < line.AlertThreshold {
+				return cs.repo.SetCreditAlertThreshold(ctx, line.WalletId, reached)
+			}
+
+			alert, err := cs.repo.SaveCreditAlert(ctx, entity.CreditAlert{
+				WalletId:    line.WalletId,
+				Threshold:   reached,
+				Balance:     line.Balance,
+				CreditLimit: line.CreditLimit,
+			})
+			if err != nil {
+				return err
+			}
+			logger.FromContext(ctx, cs.log).WithFields(logrus.Fields{
+				logger.FieldWalletID: alert.WalletId.String(),
+				"threshold":          alert.Threshold,
+				"balance":            alert.Balance,
+				"credit_limit":       alert.CreditLimit,
+			}).Warn("credit utilization threshold crossed")
+			return nil
+		})
+		if errors.Is(err, repoerrors.ErrNoCreditAlertsDue) {
+			break
+		}
+		if err != nil {
+			logger.FromContext(ctx, cs.log).WithError(err).Error("creditServiceImpl.CheckUtilization")
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// кредитная линия: лимит в пределах суммы перевода, ставка - как у процентных продуктов (0 - без процентов),
+// комиссия за день - не отрицательная сумма с точностью до тысячных
+func validateCreditLine(line entity.CreditLine) error {
+	var fields []FieldError
+
+	if line.CreditLimit != 0 {
+		if msg := validateAmount(line.CreditLimit); msg != "" {
+			fields = append(fields, FieldError{Field: "creditLimit", Message: msg})
+		}
+	}
+	rate, ok := new(big.Rat).SetString(line.AnnualRate)
+	if !annualRateRe.MatchString(line.AnnualRate) || !ok {
+		fields = append(fields, FieldError{Field: "annualRate", Message: "must be a decimal number with at most 4 decimal places"})
+	} else if rate.Cmp(big.NewRat(MaxAnnualRate, 1)) > 0 {
+		fields = append(fields, FieldError{Field: "annualRate", Message: fmt.Sprintf("must be at most %d", MaxAnnualRate)})
+	}
+	switch line.DayCount {
+	case entity.DayCountActual365, entity.DayCountActual360, entity.DayCountActualActual:
+	default:
+		fields = append(fields, FieldError{Field: "dayCount", Message: "must be one of act/365, act/360, act/act"})
+	}
+	if line.DailyFee != 0 {
+		if msg := validateAmount(line.DailyFee); msg != "" {
+			fields = append(fields, FieldError{Field: "dailyFee", Message: msg})
+		}
+	}
+
+	return newValidationError(fields)
+}
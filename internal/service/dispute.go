@@ -0,0 +1,338 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	MaxDisputeReasonLength = 512
+	// вложений у одного спора
+	MaxDisputeEvidence       = 20
+	MaxEvidenceNameLength    = 128
+	MaxEvidenceURLLength     = 2048
+	MaxEvidenceNoteLength    = 512
+	MaxDisputeDecisionLength = 512
+)
+
+// в чью пользу решение -> итоговый статус спора
+var disputeOutcomes = map[string]string{
+	entity.DisputeFavorSender:    entity.DisputeReversed,
+	entity.DisputeFavorRecipient: entity.DisputeReleased,
+}
+
+type disputeServiceImpl struct {
+	repo            repository.DisputeRepo
+	transactor      repository.Transactor
+	log             *logrus.Logger
+	defaultDeadline time.Duration
+	retryDelay      time.Duration
+}
+
+// defaultDeadline - срок решения спора, если оператор не задал дедлайн; retryDelay - на сколько сдвигается дедлайн,
+// если по его наступлении снять удержание не удалось (например, кошелек получателя заморожен)
+func NewDisputeService(repo repository.DisputeRepo, transactor repository.Transactor, log *logrus.Logger, defaultDeadline, retryDelay time.Duration) *disputeServiceImpl {
+	return &disputeServiceImpl{
+		repo:            repo,
+		transactor:      transactor,
+		log:             log,
+		defaultDeadline: defaultDeadline,
+		retryDelay:      retryDelay,
+	}
+}
+
+// OpenDispute - из d берутся TransactionId, Amount (0 - вся сумма перевода), Reason, Deadline (нулевой - через
+// defaultDeadline) и Evidence; сумма сразу удерживается у получателя
+func (ds *disputeServiceImpl) OpenDispute(ctx context.Context, actor string, d entity.Dispute) (entity.Dispute, error) {
+	now := time.Now().UTC()
+	if err := validateDispute(actor, d, now); err != nil {
+		return entity.Dispute{}, err
+	}
+
+	t, err := ds.repo.GetTransaction(ctx, d.TransactionId)
+	if errors.Is(err, repoerrors.ErrTransactionNotFound) {
+		return entity.Dispute{}, ErrTransactionNotFound
+	}
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+	// у корректировок и движений средств сделок и споров одна из сторон пустая
+	if t.From == uuid.Nil || t.To == uuid.Nil || t.From == t.To {
+		return entity.Dispute{}, ErrTransactionNotDisputable
+	}
+	if d.Amount == 0 {
+		d.Amount = t.Amount
+	} else if toUnits(d.Amount) > toUnits(t.Amount) {
+		return entity.Dispute{}, newValidationError([]FieldError{{Field: "amount", Message: "must not exceed the transaction amount"}})
+	}
+	if d.Deadline.IsZero() {
+		d.Deadline = now.Add(ds.defaultDeadline)
+	}
+	d.Sender, d.Recipient = t.From, t.To
+	d.Deadline = d.Deadline.UTC()
+	d.OpenedBy = actor
+	for i := range d.Evidence {
+		d.Evidence[i].AddedBy = actor
+	}
+
+	d, err = ds.repo.CreateDispute(ctx, d)
+	switch {
+	case errors.Is(err, repoerrors.ErrDisputeExists):
+		return entity.Dispute{}, ErrDisputeExists
+	case errors.Is(err, repoerrors.ErrNotEnoughBalance):
+		return entity.Dispute{}, ErrDisputeHoldNotCovered
+	case err != nil:
+		return entity.Dispute{}, transferError(err)
+	}
+
+	logger.FromContext(ctx, ds.log).WithFields(logrus.Fields{
+		"dispute_id":     d.Id.String(),
+		"transaction_id": d.TransactionId,
+		"amount":         d.Amount,
+		"actor":          actor,
+	}).Info("dispute opened")
+	return d, nil
+}
+
+func (ds *disputeServiceImpl) AddEvidence(ctx context.Context, actor string, id uuid.UUID, evidence []entity.DisputeEvidence) (entity.Dispute, error) {
+	var fields []FieldError
+	if strings.TrimSpace(actor) == "" {
+		fields = append(fields, FieldError{Field: "actor", Message: "is required"})
+	}
+	if len(evidence) == 0 {
+		fields = append(fields, FieldError{Field: "evidence", Message: "is required"})
+	}
+	fields = append(fields, validateEvidence(evidence)...)
+	if err := newValidationError(fields); err != nil {
+		return entity.Dispute{}, err
+	}
+	for i := range evidence {
+		evidence[i].AddedBy = actor
+	}
+
+	err := ds.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := ds.lockOpen(ctx, id); err != nil {
+			return err
+		}
+		current, err := ds.repo.GetDispute(ctx, id)
+		if err != nil {
+			return err
+		}
+		if len(current.Evidence)+len(evidence) > MaxDisputeEvidence {
+			return newValidationError([]FieldError{{Field: "evidence", Message: fmt.Sprintf("a dispute can have at most %d attachments", MaxDisputeEvidence)}})
+		}
+		_, err = ds.repo.AddDisputeEvidence(ctx, id, evidence)
+		return err
+	})
+	if errors.Is(err, repoerrors.ErrDisputeNotFound) {
+		return entity.Dispute{}, ErrDisputeNotFound
+	}
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+
+	return ds.GetDispute(ctx, id)
+}
+
+// ResolveDispute - favor: sender - удержанная сумма возвращается отправителю, recipient - удержание снимается
+func (ds *disputeServiceImpl) ResolveDispute(ctx context.Context, actor string, id uuid.UUID, favor, note string) (entity.Dispute, error) {
+	var fields []FieldError
+	if strings.TrimSpace(actor) == "" {
+		fields = append(fields, FieldError{Field: "actor", Message: "is required"})
+	}
+	status, ok := disputeOutcomes[favor]
+	if !ok {
+		fields = append(fields, FieldError{Field: "favor", Message: "must be one of sender, recipient"})
+	}
+	switch {
+	case strings.TrimSpace(note) == "":
+		fields = append(fields, FieldError{Field: "note", Message: "is required"})
+	case len([]rune(note)) > MaxDisputeDecisionLength:
+		fields = append(fields, FieldError{Field: "note", Message: fmt.Sprintf("must be at most %d characters", MaxDisputeDecisionLength)})
+	}
+	if err := newValidationError(fields); err != nil {
+		return entity.Dispute{}, err
+	}
+	ctx = logger.WithFields(ctx, logrus.Fields{"dispute_id": id.String()})
+
+	err := ds.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		d, err := ds.lockOpen(ctx, id)
+		if err != nil {
+			return err
+		}
+		_, err = ds.repo.SettleDispute(ctx, d, status, actor, note)
+		return err
+	})
+	if errors.Is(err, repoerrors.ErrDisputeNotFound) {
+		return entity.Dispute{}, ErrDisputeNotFound
+	}
+	if err != nil {
+		return entity.Dispute{}, transferError(err)
+	}
+
+	logger.FromContext(ctx, ds.log).WithFields(logrus.Fields{"status": status, "actor": actor}).Info("dispute resolved")
+	// в ответе - полная история, а не только последний переход
+	return ds.GetDispute(ctx, id)
+}
+
+func (ds *disputeServiceImpl) GetDispute(ctx context.Context, id uuid.UUID) (entity.Dispute, error) {
+	d, err := ds.repo.GetDispute(ctx, id)
+	if errors.Is(err, repoerrors.ErrDisputeNotFound) {
+		return entity.Dispute{}, ErrDisputeNotFound
+	}
+	return d, err
+}
+
+func (ds *disputeServiceImpl) ListDisputes(ctx context.Context, filter entity.DisputeFilter) ([]entity.Dispute, error) {
+	switch filter.Status {
+	case "", entity.DisputeOpen, entity.DisputeReversed, entity.DisputeReleased:
+	default:
+		return nil, newValidationError([]FieldError{{Field: "status", Message: "must be one of open, reversed, released"}})
+	}
+	return ds.repo.ListDisputes(ctx, filter)
+}
+
+// спор виден отправителю и получателю; чужой неотличим от несуществующего
+func (ds *disputeServiceImpl) GetWalletDispute(ctx context.Context, walletId, id uuid.UUID) (entity.Dispute, error) {
+	d, err := ds.GetDispute(ctx, id)
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+	if walletId != d.Sender && walletId != d.Recipient {
+		return entity.Dispute{}, ErrDisputeNotFound
+	}
+	return d, nil
+}
+
+func (ds *disputeServiceImpl) ListWalletDisputes(ctx context.Context, walletId uuid.UUID, status string) ([]entity.Dispute, error) {
+	return ds.ListDisputes(ctx, entity.DisputeFilter{Status: status, WalletId: &walletId})
+}
+
+// ExpireDue - до limit открытых споров с наступившим дедлайном решаются в пользу получателя, как сделки
+// с удержанием - в пользу продавца; возвращает, сколько обработано
+func (ds *disputeServiceImpl) ExpireDue(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		err := ds.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			d, err := ds.repo.ClaimExpiredDispute(ctx, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: d.Recipient.String(), "dispute_id": d.Id.String()})
+
+			_, err = ds.repo.SettleDispute(ctx, d, entity.DisputeReleased, entity.DisputeActorSystem, "deadline passed")
+			if err == nil {
+				return nil
+			}
+			err = transferError(err)
+			if errorReason(err) == metrics.ReasonInternal {
+				return err
+			}
+
+			// бизнес-ошибка - спор остается открытым, следующая попытка через retryDelay
+			logger.FromContext(ctx, ds.log).WithError(err).Warn("dispute auto-release failed, postponing")
+			return ds.repo.PostponeDisputeDeadline(ctx, d.Id, time.Now().UTC().Add(ds.retryDelay), "auto-release failed: "+err.Error())
+		})
+		if errors.Is(err, repoerrors.ErrNoExpiredDisputes) {
+			break
+		}
+		if err != nil {
+			logger.FromContext(ctx, ds.log).WithError(err).Error("disputeServiceImpl.ExpireDue")
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// блокирует спор; решенный спор не меняется
+func (ds *disputeServiceImpl) lockOpen(ctx context.Context, id uuid.UUID) (entity.Dispute, error) {
+	d, err := ds.repo.LockDispute(ctx, id)
+	if err != nil {
+		return entity.Dispute{}, err
+	}
+	if d.Status != entity.DisputeOpen {
+		return entity.Dispute{}, ErrDisputeNotOpen
+	}
+	return d, nil
+}
+
+func validateDispute(actor string, d entity.Dispute, now time.Time) error {
+	var fields []FieldError
+
+	if strings.TrimSpace(actor) == "" {
+		fields = append(fields, FieldError{Field: "actor", Message: "is required"})
+	}
+	if d.TransactionId <= 0 {
+		fields = append(fields, FieldError{Field: "transactionId", Message: "must be a positive transaction id"})
+	}
+	if d.Amount != 0 {
+		if msg := validateAmount(d.Amount); msg != "" {
+			fields = append(fields, FieldError{Field: "amount", Message: msg})
+		}
+	}
+
+	switch {
+	case strings.TrimSpace(d.Reason) == "":
+		fields = append(fields, FieldError{Field: "reason", Message: "is required"})
+	case len([]rune(d.Reason)) > MaxDisputeReasonLength:
+		fields = append(fields, FieldError{Field: "reason", Message: fmt.Sprintf("must be at most %d characters", MaxDisputeReasonLength)})
+	}
+
+	switch {
+	case d.Deadline.IsZero():
+	case !d.Deadline.After(now):
+		fields = append(fields, FieldError{Field: "deadline", Message: "must be in the future"})
+	case d.Deadline.After(now.Add(MaxScheduleAhead)):
+		fields = append(fields, FieldError{Field: "deadline", Message: "must be within a year"})
+	}
+
+	if len(d.Evidence) > MaxDisputeEvidence {
+		fields = append(fields, FieldError{Field: "evidence", Message: fmt.Sprintf("a dispute can have at most %d attachments", MaxDisputeEvidence)})
+	}
+	fields = append(fields, validateEvidence(d.Evidence)...)
+
+	return newValidationError(fields)
+}
+
+// вложение - именованная ссылка http(s) на файл во внешнем хранилище
+func validateEvidence(evidence []entity.DisputeEvidence) []FieldError {
+	var fields []FieldError
+	for i, e := range evidence {
+		prefix := fmt.Sprintf("evidence[%d].", i)
+
+		switch {
+		case strings.TrimSpace(e.Name) == "":
+			fields = append(fields, FieldError{Field: prefix + "name", Message: "is required"})
+		case len([]rune(e.Name)) > MaxEvidenceNameLength:
+			fields = append(fields, FieldError{Field: prefix + "name", Message: fmt.Sprintf("must be at most %d characters", MaxEvidenceNameLength)})
+		}
+
+		u, err := url.Parse(e.Url)
+		switch {
+		case e.Url == "":
+			fields = append(fields, FieldError{Field: prefix + "url", Message: "is required"})
+		case len(e.Url) > MaxEvidenceURLLength:
+			fields = append(fields, FieldError{Field: prefix + "url", Message: fmt.Sprintf("must be at most %d characters", MaxEvidenceURLLength)})
+		case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+			fields = append(fields, FieldError{Field: prefix + "url", Message: "must be an absolute http(s) url"})
+		}
+
+		if len([]rune(e.Note)) > MaxEvidenceNoteLength {
+			fields = append(fields, FieldError{Field: prefix + "note", Message: fmt.Sprintf("must be at most %d characters", MaxEvidenceNoteLength)})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+const disputeOperator = "operator"
+
+func newDisputeEnv(t *testing.T) (pgEnv, repository.DisputeRepo, *disputeServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	repo := repository.NewDisputeRepo(env.pg, discardLogger())
+	return env, repo, NewDisputeService(repo, env.transactor, discardLogger(), 24*time.Hour, time.Hour)
+}
+
+// перевод amount от from к to; возвращает id транзакции
+func (e pgEnv) transfer(t *testing.T, from, to uuid.UUID, amount float32) int64 {
+	t.Helper()
+	ctx := context.Background()
+	if err := e.ws.Transfer(ctx, from, to, amount); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	history, err := e.wallets.GetTransactionHistory(ctx, from, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	return history[len(history)-1].Id
+}
+
+// открытие удерживает сумму у получателя, решение в пользу отправителя возвращает ее отправителю,
+// в пользу получателя - снимает удержание
+func TestDisputeHoldAndResolvePostgres(t *testing.T) {
+	tests := []struct {
+		favor      string
+		wantStatus string
+		// балансы отправителя и получателя после решения относительно начальных
+		wantSender, wantRecipient float32
+	}{
+		{entity.DisputeFavorSender, entity.DisputeReversed, -40 + 15, 40 - 15},
+		{entity.DisputeFavorRecipient, entity.DisputeReleased, -40, 40},
+	}
+	for _, tt := range tests {
+		t.Run(tt.favor, func(t *testing.T) {
+			env, _, ds := newDisputeEnv(t)
+			ctx := context.Background()
+			sender, recipient := env.wallet(t), env.wallet(t)
+			txId := env.transfer(t, sender, recipient, 40)
+
+			d, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: txId, Amount: 15, Reason: "not delivered"})
+			if err != nil {
+				t.Fatalf("OpenDispute: %v", err)
+			}
+			if d.Status != entity.DisputeOpen || d.Sender != sender || d.Recipient != recipient || d.Amount != 15 {
+				t.Errorf("OpenDispute: got %+v, want an open dispute for 15", d)
+			}
+			env.assertBalance(t, sender, repository.InitialWalletBalance-40)
+			env.assertBalance(t, recipient, repository.InitialWalletBalance+40-15)
+
+			if _, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: txId, Reason: "again"}); !errors.Is(err, ErrDisputeExists) {
+				t.Errorf("second OpenDispute: got %v, want %v", err, ErrDisputeExists)
+			}
+
+			resolved, err := ds.ResolveDispute(ctx, disputeOperator, d.Id, tt.favor, "checked the delivery")
+			if err != nil {
+				t.Fatalf("ResolveDispute: %v", err)
+			}
+			if resolved.Status != tt.wantStatus || resolved.ResolvedAt == nil || len(resolved.Events) != 2 {
+				t.Errorf("ResolveDispute: got %+v, want %s with the opening and the decision in history", resolved, tt.wantStatus)
+			}
+			env.assertBalance(t, sender, repository.InitialWalletBalance+tt.wantSender)
+			env.assertBalance(t, recipient, repository.InitialWalletBalance+tt.wantRecipient)
+
+			// решенный спор не решается повторно, средства не двигаются
+			if _, err := ds.ResolveDispute(ctx, disputeOperator, d.Id, entity.DisputeFavorSender, "again"); !errors.Is(err, ErrDisputeNotOpen) {
+				t.Errorf("second ResolveDispute: got %v, want %v", err, ErrDisputeNotOpen)
+			}
+			env.assertBalance(t, sender, repository.InitialWalletBalance+tt.wantSender)
+			env.assertBalance(t, recipient, repository.InitialWalletBalance+tt.wantRecipient)
+
+			// спор виден участникам, посторонним - нет
+			if got, err := ds.GetWalletDispute(ctx, recipient, d.Id); err != nil || got.Id != d.Id {
+				t.Errorf("GetWalletDispute by recipient: got %+v, %v", got, err)
+			}
+			if _, err := ds.GetWalletDispute(ctx, env.wallet(t), d.Id); !errors.Is(err, ErrDisputeNotFound) {
+				t.Errorf("GetWalletDispute by a stranger: got %v, want %v", err, ErrDisputeNotFound)
+			}
+		})
+	}
+}
+
+// удержание покрывается только балансом получателя; корректировки и движения средств без второй стороны не оспариваются
+func TestDisputeOpenErrorsPostgres(t *testing.T) {
+	env, _, ds := newDisputeEnv(t)
+	ctx := context.Background()
+	sender, recipient, other := env.wallet(t), env.wallet(t), env.wallet(t)
+	txId := env.transfer(t, sender, recipient, 40)
+
+	// получатель успел потратить почти все
+	env.transfer(t, recipient, other, repository.InitialWalletBalance+30)
+	if _, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: txId, Reason: "fraud"}); !errors.Is(err, ErrDisputeHoldNotCovered) {
+		t.Errorf("OpenDispute without balance: got %v, want %v", err, ErrDisputeHoldNotCovered)
+	}
+	env.assertBalance(t, recipient, 10)
+
+	var validationErr *ValidationError
+	if _, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: txId, Amount: 41, Reason: "fraud"}); !errors.As(err, &validationErr) {
+		t.Errorf("OpenDispute over the transaction amount: got %v, want a validation error", err)
+	}
+	if _, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: txId + 1000, Reason: "fraud"}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("OpenDispute of an unknown transaction: got %v, want %v", err, ErrTransactionNotFound)
+	}
+
+	if err := repository.NewAdminRepo(env.pg, discardLogger()).AdjustBalance(ctx, sender, 5); err != nil {
+		t.Fatalf("AdjustBalance: %v", err)
+	}
+	history, err := env.wallets.GetTransactionHistory(ctx, sender, entity.TransactionFilter{})
+	if err != nil {
+		t.Fatalf("GetTransactionHistory: %v", err)
+	}
+	adjustment := history[len(history)-1].Id
+	if _, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: adjustment, Reason: "fraud"}); !errors.Is(err, ErrTransactionNotDisputable) {
+		t.Errorf("OpenDispute of an adjustment: got %v, want %v", err, ErrTransactionNotDisputable)
+	}
+}
+
+// по дедлайну удержание снимается в пользу получателя; замороженному получателю - дедлайн сдвигается на retryDelay
+func TestDisputeExpireDuePostgres(t *testing.T) {
+	env, repo, ds := newDisputeEnv(t)
+	ctx := context.Background()
+	sender, recipient, frozen := env.wallet(t), env.wallet(t), env.wallet(t)
+
+	// наступивший дедлайн - через сдвиг в прошлое: сервис принимает только будущий
+	expired := func(to uuid.UUID) entity.Dispute {
+		d, err := ds.OpenDispute(ctx, disputeOperator, entity.Dispute{TransactionId: env.transfer(t, sender, to, 20), Reason: "not delivered"})
+		if err != nil {
+			t.Fatalf("OpenDispute: %v", err)
+		}
+		if err := repo.PostponeDisputeDeadline(ctx, d.Id, time.Now().UTC().Add(-time.Minute), "test"); err != nil {
+			t.Fatalf("PostponeDisputeDeadline: %v", err)
+		}
+		return d
+	}
+	released := expired(recipient)
+	postponed := expired(frozen)
+	if err := repository.NewAdminRepo(env.pg, discardLogger()).SetFrozen(ctx, frozen, true); err != nil {
+		t.Fatalf("SetFrozen: %v", err)
+	}
+
+	if n, err := ds.ExpireDue(ctx, 10); err != nil || n != 2 {
+		t.Fatalf("ExpireDue: got %d, %v, want 2 processed", n, err)
+	}
+
+	got, err := ds.GetDispute(ctx, released.Id)
+	if err != nil {
+		t.Fatalf("GetDispute: %v", err)
+	}
+	if got.Status != entity.DisputeReleased || got.Events[len(got.Events)-1].Actor != entity.DisputeActorSystem {
+		t.Errorf("released dispute: got %+v, want released by the system", got)
+	}
+	env.assertBalance(t, recipient, repository.InitialWalletBalance+20)
+
+	got, err = ds.GetDispute(ctx, postponed.Id)
+	if err != nil {
+		t.Fatalf("GetDispute: %v", err)
+	}
+	if got.Status != entity.DisputeOpen || !got.Deadline.After(time.Now().Add(50*time.Minute)) {
+		t.Errorf("postponed dispute: got status %q, deadline %v, want open with the deadline moved", got.Status, got.Deadline)
+	}
+	env.assertBalance(t, frozen, repository.InitialWalletBalance)
+
+	if n, err := ds.ExpireDue(ctx, 10); err != nil || n != 0 {
+		t.Errorf("second ExpireDue: got %d, %v, want nothing processed", n, err)
+	}
+}
@@ -8,4 +8,71 @@ var (
 	ErrWalletNotFound       = errors.New("wallet not found")
 	ErrTargetWalletNotFound = errors.New("target wallet not found")
 	ErrNotEnoughBalance     = errors.New("not enough balance")
+	ErrWalletFrozen         = errors.New("wallet is frozen")
+	ErrTargetWalletFrozen   = errors.New("target wallet is frozen")
+	ErrValidation           = errors.New("validation failed")
+
+	ErrSplitPaymentNotFound = errors.New("split payment not found")
+
+	ErrScheduledTransferNotFound   = errors.New("scheduled transfer not found")
+	ErrScheduledTransferNotPending = errors.New("scheduled transfer is not pending")
+
+	ErrStandingOrderNotFound  = errors.New("standing order not found")
+	ErrStandingOrderNotActive = errors.New("standing order is not active")
+
+	ErrBatchTransferNotFound = errors.New("batch transfer not found")
+
+	ErrEscrowNotFound          = errors.New("escrow not found")
+	ErrInvalidEscrowTransition = errors.New("invalid escrow transition")
+	// переход допустим, но не для этого участника сделки
+	ErrEscrowActionNotAllowed = errors.New("escrow action not allowed for this party")
+
+	ErrPaymentRequestNotFound = errors.New("payment request not found")
+	// запрос уже отклонен или истек
+	ErrPaymentRequestNotPending = errors.New("payment request is not pending")
+	// получатель не может сам оплатить или отклонить свой запрос
+	ErrPaymentRequestActionNotAllowed = errors.New("only the payer can accept or decline a payment request")
+
+	ErrInvoiceNotFound        = errors.New("invoice not found")
+	ErrInvoiceReferenceExists = errors.New("invoice reference already exists")
+	// счет уже оплачен или аннулирован
+	ErrInvoiceNotPayable = errors.New("invoice is not payable")
+	// аннулировать можно только счет без оплат
+	ErrInvoiceNotVoidable = errors.New("invoice cannot be voided")
+
+	ErrAliasNotFound = errors.New("alias not found")
+	// действующий подтвержденный псевдоним уже закреплен за другим кошельком
+	ErrAliasTaken = errors.New("alias is already taken")
+
+	ErrPocketNotFound = errors.New("pocket not found")
+	ErrPocketClosed   = errors.New("pocket is closed")
+	// карман нельзя создать внутри другого кармана
+	ErrNestedPocket   = errors.New("pockets cannot have pockets")
+	ErrTooManyPockets = errors.New("too many pockets")
+	// из кармана можно переводить только родителю и в соседние карманы (POCKETS_RESTRICT_EXTERNAL_TRANSFERS)
+	ErrPocketTransferNotAllowed = errors.New("transfers out of a pocket are allowed only to its parent wallet and sibling pockets")
+
+	ErrSavingsGoalNotFound = errors.New("savings goal not found")
+
+	ErrInterestProductNotFound = errors.New("interest product not found")
+	ErrInterestAccountNotFound = errors.New("interest account not found")
+
+	ErrCreditLineNotFound   = errors.New("credit line not found")
+	ErrCreditLimitBelowDebt = errors.New("credit limit is below the current debt")
+
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// спорить можно только о переводе между кошельками, не о корректировке или движении средств сделки
+	ErrTransactionNotDisputable = errors.New("only transfers between wallets can be disputed")
+	ErrDisputeExists            = errors.New("transaction is already disputed")
+	ErrDisputeNotFound          = errors.New("dispute not found")
+	ErrDisputeNotOpen           = errors.New("dispute is already resolved")
+	// баланса получателя не хватает, чтобы удержать сумму спора; кредитный лимит не учитывается
+	ErrDisputeHoldNotCovered = errors.New("recipient has not enough balance for the hold")
+
+	// перевод отправлен антифрод-правилами на проверку, конкретная ошибка - *TransferHeldError
+	ErrTransferHeld = errors.New("transfer is held for review")
+	// перевод заблокирован антифрод-правилами
+	ErrTransferBlocked     = errors.New("transfer is blocked by fraud rules")
+	ErrFraudCaseNotFound   = errors.New("fraud case not found")
+	ErrFraudCaseNotPending = errors.New("fraud case is already decided")
 )
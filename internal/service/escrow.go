@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// максимальная длина описания сделки
+const MaxEscrowDescriptionLength = 256
+
+// допустимые переходы сделки и кто из участников может их совершить; released и refunded - конечные
+var escrowTransitions = map[string]map[string]string{
+	entity.EscrowFunded: {
+		// покупатель подтверждает получение
+		entity.EscrowReleased: "buyer",
+		// продавец отменяет сделку
+		entity.EscrowRefunded: "seller",
+	},
+}
+
+type escrowServiceImpl struct {
+	repo       repository.EscrowRepo
+	transactor repository.Transactor
+	log        *logrus.Logger
+	retryDelay time.Duration
+	pockets    pocketRule
+	fraud      *FraudScreen
+}
+
+// retryDelay - на сколько сдвигается дедлайн, если автоматически передать средства не удалось (например, кошелек продавца заморожен);
+// wr и pockets - проверка сделок, где покупатель - карман; fraud - антифрод-проверка открытия сделки (nil - без проверки)
+func NewEscrowService(repo repository.EscrowRepo, transactor repository.Transactor, log *logrus.Logger, retryDelay time.Duration, wr repository.WalletRepo, pockets PocketPolicy, fraud *FraudScreen) *escrowServiceImpl {
+	return &escrowServiceImpl{
+		repo:       repo,
+		transactor: transactor,
+		log:        log,
+		retryDelay: retryDelay,
+		pockets:    newPocketRule(wr, pockets),
+		fraud:      fraud,
+	}
+}
+
+func (es *escrowServiceImpl) CreateEscrow(ctx context.Context, buyer, seller uuid.UUID, amount float32, deadline time.Time, description string) (entity.Escrow, error) {
+	now := time.Now().UTC()
+	if err := validateEscrow(buyer, seller, amount, deadline, description, now); err != nil {
+		return entity.Escrow{}, err
+	}
+	if err := es.pockets.check(ctx, buyer, seller); err != nil {
+		return entity.Escrow{}, err
+	}
+
+	// сделку открывает покупатель - для правил это перевод продавцу; у сделки свое состояние, поэтому
+	// решение review для нее такая же блокировка, как для счетов
+	var e entity.Escrow
+	err := es.fraud.screen(withoutFraudHold(ctx), buyer, []fraudTransfer{{To: seller, Amount: amount}}, func(ctx context.Context) error {
+		var err error
+		e, err = es.repo.CreateEscrow(ctx, entity.Escrow{
+			Buyer:       buyer,
+			Seller:      seller,
+			Amount:      amount,
+			Description: description,
+			Deadline:    deadline.UTC(),
+		})
+		return err
+	})
+	return e, transferError(err)
+}
+
+func (es *escrowServiceImpl) GetEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error) {
+	e, err := es.repo.GetEscrow(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrEscrowNotFound) {
+		return entity.Escrow{}, ErrEscrowNotFound
+	}
+	return e, err
+}
+
+func (es *escrowServiceImpl) ListEscrows(ctx context.Context, walletId uuid.UUID, status string) ([]entity.Escrow, error) {
+	switch status {
+	case "", entity.EscrowFunded, entity.EscrowReleased, entity.EscrowRefunded:
+	default:
+		return nil, newValidationError([]FieldError{{Field: "status", Message: "must be one of funded, released, refunded"}})
+	}
+	return es.repo.ListEscrows(ctx, walletId, status)
+}
+
+func (es *escrowServiceImpl) ReleaseEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error) {
+	return es.transition(ctx, walletId, id, entity.EscrowReleased)
+}
+
+func (es *escrowServiceImpl) CancelEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error) {
+	return es.transition(ctx, walletId, id, entity.EscrowRefunded)
+}
+
+// переход по действию участника: сделка блокируется, затем проверяются участие, статус и роль
+func (es *escrowServiceImpl) transition(ctx context.Context, walletId, id uuid.UUID, to string) (entity.Escrow, error) {
+	ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: walletId.String(), "escrow_id": id.String()})
+
+	var e entity.Escrow
+	err := es.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		e, err = es.repo.LockEscrow(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		var role string
+		switch walletId {
+		case e.Buyer:
+			role = "buyer"
+		case e.Seller:
+			role = "seller"
+		default:
+			// чужая сделка неотличима от несуществующей
+			return repoerrors.ErrEscrowNotFound
+		}
+
+		allowed, ok := escrowTransitions[e.Status][to]
+		if !ok {
+			return ErrInvalidEscrowTransition
+		}
+		if allowed != role {
+			return ErrEscrowActionNotAllowed
+		}
+
+		e, err = es.repo.SettleEscrow(ctx, e, to, walletId.String(), "")
+		return err
+	})
+	if errors.Is(err, repoerrors.ErrEscrowNotFound) {
+		return entity.Escrow{}, ErrEscrowNotFound
+	}
+	if err != nil {
+		return entity.Escrow{}, transferError(err)
+	}
+
+	// в ответе - полная история, а не только последний переход
+	return es.GetEscrow(ctx, walletId, id)
+}
+
+// ReleaseExpired - передает продавцу средства до limit сделок с наступившим дедлайном; возвращает, сколько обработано
+func (es *escrowServiceImpl) ReleaseExpired(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		err := es.transactor.WithinTx(ctx, func(ctx context.Context) error {
+			e, err := es.repo.ClaimExpiredEscrow(ctx, time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: e.Buyer.String(), "escrow_id": e.Id.String()})
+
+			_, err = es.repo.SettleEscrow(ctx, e, entity.EscrowReleased, entity.EscrowActorSystem, "deadline passed")
+			if err == nil {
+				return nil
+			}
+			err = transferError(err)
+			if errorReason(err) == metrics.ReasonInternal {
+				return err
+			}
+
+			// бизнес-ошибка - сделка остается funded, следующая попытка через retryDelay
+			logger.FromContext(ctx, es.log).WithError(err).Warn("escrow auto-release failed, postponing")
+			return es.repo.PostponeEscrowDeadline(ctx, e.Id, time.Now().UTC().Add(es.retryDelay), "auto-release failed: "+err.Error())
+		})
+		if errors.Is(err, repoerrors.ErrNoExpiredEscrows) {
+			break
+		}
+		if err != nil {
+			logger.FromContext(ctx, es.log).WithError(err).Error("escrowServiceImpl.ReleaseExpired")
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+func validateEscrow(buyer, seller uuid.UUID, amount float32, deadline time.Time, description string, now time.Time) error {
+	var fields []FieldError
+
+	if seller == uuid.Nil {
+		fields = append(fields, FieldError{Field: "seller", Message: "must be a non-zero wallet id"})
+	} else if seller == buyer {
+		fields = append(fields, FieldError{Field: "seller", Message: "must differ from the buyer wallet"})
+	}
+
+	if msg := validateAmount(amount); msg != "" {
+		fields = append(fields, FieldError{Field: "amount", Message: msg})
+	}
+
+	switch {
+	case deadline.IsZero():
+		fields = append(fields, FieldError{Field: "deadline", Message: "is required"})
+	case !deadline.After(now):
+		fields = append(fields, FieldError{Field: "deadline", Message: "must be in the future"})
+	case deadline.After(now.Add(MaxScheduleAhead)):
+		fields = append(fields, FieldError{Field: "deadline", Message: "must be within a year"})
+	}
+
+	if len([]rune(description)) > MaxEscrowDescriptionLength {
+		fields = append(fields, FieldError{Field: "description", Message: "must be at most 256 characters"})
+	}
+
+	return newValidationError(fields)
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newEscrowEnv(t *testing.T) (pgEnv, repository.EscrowRepo, *escrowServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	repo := repository.NewEscrowRepo(env.pg, discardLogger())
+	return env, repo, NewEscrowService(repo, env.transactor, discardLogger(), time.Hour, env.wallets, PocketPolicy{}, nil)
+}
+
+func escrowStatuses(e entity.Escrow) []string {
+	statuses := make([]string, len(e.Events))
+	for i, event := range e.Events {
+		statuses[i] = event.ToStatus
+	}
+	return statuses
+}
+
+// открытие списывает сумму с покупателя; release - только покупатель, cancel - только продавец, и только из funded
+func TestEscrowTransitionsPostgres(t *testing.T) {
+	tests := []struct {
+		name       string
+		release    bool
+		wantStatus string
+		// баланс продавца и покупателя после перехода относительно начального
+		wantSeller, wantBuyer float32
+	}{
+		{"release", true, entity.EscrowReleased, 25, -25},
+		{"cancel", false, entity.EscrowRefunded, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, _, es := newEscrowEnv(t)
+			ctx := context.Background()
+			buyer, seller, stranger := env.wallet(t), env.wallet(t), env.wallet(t)
+
+			e, err := es.CreateEscrow(ctx, buyer, seller, 25, time.Now().Add(time.Hour), "order")
+			if err != nil {
+				t.Fatalf("CreateEscrow: %v", err)
+			}
+			if e.Status != entity.EscrowFunded {
+				t.Errorf("status = %q, want %q", e.Status, entity.EscrowFunded)
+			}
+			env.assertBalance(t, buyer, repository.InitialWalletBalance-25)
+			env.assertBalance(t, seller, repository.InitialWalletBalance)
+
+			act, party, otherParty := es.CancelEscrow, seller, buyer
+			if tt.release {
+				act, party, otherParty = es.ReleaseEscrow, buyer, seller
+			}
+			if _, err := act(ctx, otherParty, e.Id); !errors.Is(err, ErrEscrowActionNotAllowed) {
+				t.Errorf("by the other party: got %v, want %v", err, ErrEscrowActionNotAllowed)
+			}
+			if _, err := act(ctx, stranger, e.Id); !errors.Is(err, ErrEscrowNotFound) {
+				t.Errorf("by a stranger: got %v, want %v", err, ErrEscrowNotFound)
+			}
+
+			settled, err := act(ctx, party, e.Id)
+			if err != nil {
+				t.Fatalf("transition: %v", err)
+			}
+			if settled.Status != tt.wantStatus || settled.SettledAt == nil {
+				t.Errorf("settled: got status %q, settledAt %v, want %q", settled.Status, settled.SettledAt, tt.wantStatus)
+			}
+			if got := escrowStatuses(settled); len(got) != 2 || got[0] != entity.EscrowFunded || got[1] != tt.wantStatus {
+				t.Errorf("history = %v, want [funded %s]", got, tt.wantStatus)
+			}
+			env.assertBalance(t, buyer, repository.InitialWalletBalance+tt.wantBuyer)
+			env.assertBalance(t, seller, repository.InitialWalletBalance+tt.wantSeller)
+
+			// закрытая сделка не переходит никуда, средства не двигаются повторно
+			if _, err := es.ReleaseEscrow(ctx, buyer, e.Id); !errors.Is(err, ErrInvalidEscrowTransition) {
+				t.Errorf("release after %s: got %v, want %v", tt.name, err, ErrInvalidEscrowTransition)
+			}
+			if _, err := es.CancelEscrow(ctx, seller, e.Id); !errors.Is(err, ErrInvalidEscrowTransition) {
+				t.Errorf("cancel after %s: got %v, want %v", tt.name, err, ErrInvalidEscrowTransition)
+			}
+			env.assertBalance(t, buyer, repository.InitialWalletBalance+tt.wantBuyer)
+			env.assertBalance(t, seller, repository.InitialWalletBalance+tt.wantSeller)
+		})
+	}
+}
+
+func TestEscrowCreateErrorsPostgres(t *testing.T) {
+	env, _, es := newEscrowEnv(t)
+	ctx := context.Background()
+	buyer, seller := env.wallet(t), env.wallet(t)
+
+	if _, err := es.CreateEscrow(ctx, buyer, seller, repository.InitialWalletBalance+1, time.Now().Add(time.Hour), ""); !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("CreateEscrow: got %v, want %v", err, ErrNotEnoughBalance)
+	}
+	var validationErr *ValidationError
+	if _, err := es.CreateEscrow(ctx, buyer, seller, 10, time.Now().Add(-time.Hour), ""); !errors.As(err, &validationErr) {
+		t.Errorf("CreateEscrow with a past deadline: got %v, want a validation error", err)
+	}
+	env.assertBalance(t, buyer, repository.InitialWalletBalance)
+}
+
+// наступивший дедлайн передает средства продавцу; если продавец заморожен - дедлайн сдвигается на retryDelay
+func TestEscrowReleaseExpiredPostgres(t *testing.T) {
+	env, repo, es := newEscrowEnv(t)
+	ctx := context.Background()
+	buyer, seller, frozen := env.wallet(t), env.wallet(t), env.wallet(t)
+	if err := repository.NewAdminRepo(env.pg, discardLogger()).SetFrozen(ctx, frozen, true); err != nil {
+		t.Fatalf("SetFrozen: %v", err)
+	}
+
+	// дедлайн в прошлом сохраняется напрямую через репозиторий: сервис принимает только будущий
+	expired := func(e entity.Escrow) entity.Escrow {
+		e, err := repo.CreateEscrow(ctx, e)
+		if err != nil {
+			t.Fatalf("CreateEscrow: %v", err)
+		}
+		return e
+	}
+	released := expired(entity.Escrow{Buyer: buyer, Seller: seller, Amount: 10, Deadline: time.Now().UTC().Add(-time.Minute)})
+	postponed := expired(entity.Escrow{Buyer: buyer, Seller: frozen, Amount: 20, Deadline: time.Now().UTC().Add(-time.Minute)})
+
+	n, err := es.ReleaseExpired(ctx, 10)
+	if err != nil || n != 2 {
+		t.Fatalf("ReleaseExpired: got %d, %v, want 2 processed", n, err)
+	}
+
+	got, err := es.GetEscrow(ctx, buyer, released.Id)
+	if err != nil {
+		t.Fatalf("GetEscrow: %v", err)
+	}
+	if got.Status != entity.EscrowReleased || got.Events[len(got.Events)-1].Actor != entity.EscrowActorSystem {
+		t.Errorf("released escrow: got %+v, want released by the system", got)
+	}
+
+	got, err = es.GetEscrow(ctx, buyer, postponed.Id)
+	if err != nil {
+		t.Fatalf("GetEscrow: %v", err)
+	}
+	if got.Status != entity.EscrowFunded || !got.Deadline.After(time.Now().Add(50*time.Minute)) {
+		t.Errorf("postponed escrow: got status %q, deadline %v, want funded with the deadline moved", got.Status, got.Deadline)
+	}
+
+	env.assertBalance(t, buyer, repository.InitialWalletBalance-30)
+	env.assertBalance(t, seller, repository.InitialWalletBalance+10)
+	env.assertBalance(t, frozen, repository.InitialWalletBalance)
+
+	// отложенная сделка до нового дедлайна не выбирается
+	if n, err := es.ReleaseExpired(ctx, 10); err != nil || n != 0 {
+		t.Errorf("second ReleaseExpired: got %d, %v, want nothing processed", n, err)
+	}
+}
@@ -0,0 +1,427 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const MaxFraudDecisionLength = 512
+
+// FraudRule - антифрод-правило; какие параметры используются, зависит от Type (см. entity.FraudRule*)
+type FraudRule struct {
+	Name  string
+	Type  string
+	Score int
+	// velocity, fan_out: сколько переводов (новых получателей) за Window допустимо
+	Count  int
+	Window time.Duration
+	// new_counterparty: сумма, начиная с которой первый перевод получателю подозрителен
+	MinAmount float32
+	// spike: во сколько раз сумма должна превышать среднюю и сколько переводов за Window нужно для средней
+	Factor     float64
+	MinHistory int
+}
+
+// FraudPolicy - правила и пороги: сумма баллов сработавших правил от ReviewScore - перевод на проверку,
+// от BlockScore - блокировка; без правил проверка выключена
+type FraudPolicy struct {
+	Rules       []FraudRule
+	ReviewScore int
+	BlockScore  int
+}
+
+func (p FraudPolicy) decide(score int) string {
+	switch {
+	case score >= p.BlockScore:
+		return entity.FraudBlock
+	case score >= p.ReviewScore:
+		return entity.FraudReview
+	default:
+		return entity.FraudAllow
+	}
+}
+
+// TransferHeldError - перевод отправлен правилами на проверку: сумма списана с отправителя
+// и удерживается до решения оператора по CaseId
+type TransferHeldError struct {
+	CaseId uuid.UUID
+}
+
+func (e *TransferHeldError) Error() string {
+	return ErrTransferHeld.Error()
+}
+
+func (e *TransferHeldError) Is(target error) bool {
+	return target == ErrTransferHeld
+}
+
+type (
+	noFraudScreeningCtxKey struct{}
+	noFraudHoldCtxKey      struct{}
+)
+
+// переводы администратора - уже решение оператора, правила их не проверяют
+func withoutFraudScreening(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noFraudScreeningCtxKey{}, true)
+}
+
+// подсистема со своим состоянием (счет, запрос денег, расписание): удержанный перевод после одобрения
+// это состояние не обновит, поэтому решение review для ее переводов - такая же блокировка, как block
+func withoutFraudHold(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noFraudHoldCtxKey{}, true)
+}
+
+// проверяются прямые переводы и переводы, которые владелец совершает через подсистемы;
+// системные переводы (проценты, кредит, споры) и перемещения между кошельком и карманами не проверяются
+func fraudScreened(ctx context.Context) bool {
+	if src, ok := repository.TransferSourceFromContext(ctx); ok && slices.Contains(entity.FraudExemptTransferSources, src.Type) {
+		return false
+	}
+	skip, _ := ctx.Value(noFraudScreeningCtxKey{}).(bool)
+	return !skip
+}
+
+// FraudScreen - проверка перевода по FraudPolicy перед его выполнением
+type FraudScreen struct {
+	repo       repository.FraudRepo
+	transactor repository.Transactor
+	log        *logrus.Logger
+	policy     FraudPolicy
+}
+
+func NewFraudScreen(repo repository.FraudRepo, transactor repository.Transactor, log *logrus.Logger, policy FraudPolicy) *FraudScreen {
+	return &FraudScreen{
+		repo:       repo,
+		transactor: transactor,
+		log:        log,
+		policy:     policy,
+	}
+}
+
+func (fs *FraudScreen) enabled(ctx context.Context) bool {
+	return fs != nil && len(fs.policy.Rules) > 0 && fraudScreened(ctx)
+}
+
+// screen - проверка и сам перевод transfer в одной транзакции. Если хоть один перевод отправлен на проверку
+// или заблокирован, transfer не вызывается, запись о проверке фиксируется и возвращается ее ошибка (см. check)
+func (fs *FraudScreen) screen(ctx context.Context, from uuid.UUID, transfers []fraudTransfer, transfer func(ctx context.Context) error) error {
+	if !fs.enabled(ctx) {
+		return transfer(ctx)
+	}
+
+	var flagged error
+	err := fs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		results, err := fs.screenAll(ctx, from, transfers)
+		if err != nil {
+			return err
+		}
+		for _, res := range results {
+			if res != nil {
+				flagged = res
+				return nil
+			}
+		}
+		return transfer(ctx)
+	})
+	if err != nil {
+		return err
+	}
+	return flagged
+}
+
+// перевод from одному получателю; операция с несколькими получателями проверяется построчно
+type fraudTransfer struct {
+	To     uuid.UUID
+	Amount float32
+}
+
+// screenAll - проверяет переводы from по порядку, возвращает решение по каждому (nil - перевод можно выполнять).
+// Вызывать внутри транзакции, в которой переводы выполняются: проверки переводов одного отправителя идут
+// по очереди (FraudRepo.LockSender) до ее конца, поэтому параллельные переводы видят друг друга в истории,
+// а не проходят правила разом. Уже проверенные переводы той же операции правила считают выполненными
+func (fs *FraudScreen) screenAll(ctx context.Context, from uuid.UUID, transfers []fraudTransfer) ([]error, error) {
+	results := make([]error, len(transfers))
+	if !fs.enabled(ctx) {
+		return results, nil
+	}
+	if err := fs.repo.LockSender(ctx, from); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var prior fraudHistory
+	for i, t := range transfers {
+		err := fs.check(ctx, from, t.To, t.Amount, now, &prior)
+		if err != nil && !errors.Is(err, ErrTransferHeld) && !errors.Is(err, ErrTransferBlocked) {
+			return nil, err
+		}
+		results[i] = err
+	}
+	return results, nil
+}
+
+// переводы операции, уже пропущенные правилами, но еще не записанные в историю
+type fraudHistory struct {
+	transfers     int
+	sum           float64
+	newRecipients int
+	recipients    map[uuid.UUID]bool
+}
+
+func (h *fraudHistory) add(to uuid.UUID, amount float32, newRecipient bool) {
+	h.transfers++
+	h.sum += float64(amount)
+	if h.recipients[to] {
+		return
+	}
+	if h.recipients == nil {
+		h.recipients = make(map[uuid.UUID]bool)
+	}
+	h.recipients[to] = true
+	if newRecipient {
+		h.newRecipients++
+	}
+}
+
+// check - nil, если перевод можно выполнять; при решении review сумма удерживается и возвращается
+// *TransferHeldError, при block (и review без удержания, см. withoutFraudHold) перевод записывается
+// в очередь и возвращается ErrTransferBlocked
+func (fs *FraudScreen) check(ctx context.Context, from, to uuid.UUID, amount float32, now time.Time, prior *fraudHistory) error {
+	reasons, newRecipient, err := fs.evaluate(ctx, from, to, amount, now, prior)
+	if err != nil {
+		return err
+	}
+	score := 0
+	for _, r := range reasons {
+		score += r.Score
+	}
+	decision := fs.policy.decide(score)
+	if decision == entity.FraudAllow {
+		prior.add(to, amount, newRecipient)
+		return nil
+	}
+	if noHold, _ := ctx.Value(noFraudHoldCtxKey{}).(bool); noHold {
+		decision = entity.FraudBlock
+	}
+
+	details := repository.TransferDetailsFromContext(ctx)
+	c := entity.FraudCase{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Score:     score,
+		Reasons:   reasons,
+		Decision:  decision,
+		Memo:      details.Memo,
+		Reference: details.Reference,
+		Metadata:  details.Metadata,
+		ToAlias:   details.ToAlias,
+	}
+	if decision == entity.FraudBlock {
+		c, err = fs.repo.SaveBlockedTransfer(ctx, c)
+	} else {
+		c, err = fs.repo.HoldTransfer(ctx, c)
+	}
+	if err != nil {
+		return transferError(err)
+	}
+
+	fields := logrus.Fields{
+		"fraud_case_id": c.Id.String(),
+		"to_wallet_id":  to.String(),
+		"amount":        amount,
+		"score":         score,
+		"decision":      decision,
+	}
+	if src, ok := repository.TransferSourceFromContext(ctx); ok {
+		fields["source_type"] = src.Type
+		fields["source_id"] = src.Id.String()
+	}
+	logger.FromContext(ctx, fs.log).WithFields(fields).Warn("transfer flagged by fraud rules")
+
+	if decision == entity.FraudBlock {
+		return ErrTransferBlocked
+	}
+	return &TransferHeldError{CaseId: c.Id}
+}
+
+// сработавшие правила и то, что получатель новый (false - известный или не проверялся); история читается
+// только для правил, которым она нужна, и дополняется prior
+func (fs *FraudScreen) evaluate(ctx context.Context, from, to uuid.UUID, amount float32, now time.Time, prior *fraudHistory) ([]entity.FraudReason, bool, error) {
+	var known *bool
+	isKnown := func() (bool, error) {
+		if known == nil {
+			ok := prior.recipients[to]
+			if !ok {
+				var err error
+				if ok, err = fs.repo.HasTransferredTo(ctx, from, to); err != nil {
+					return false, err
+				}
+			}
+			known = &ok
+		}
+		return *known, nil
+	}
+
+	var reasons []entity.FraudReason
+	for _, rule := range fs.policy.Rules {
+		var message string
+		switch rule.Type {
+		case entity.FraudRuleVelocity:
+			n, err := fs.repo.CountTransfersSince(ctx, from, now.Add(-rule.Window))
+			if err != nil {
+				return nil, false, err
+			}
+			n += prior.transfers
+			if n+1 > rule.Count {
+				message = fmt.Sprintf("%d transfers within %s, allowed %d", n+1, rule.Window, rule.Count)
+			}
+
+		case entity.FraudRuleNewCounterparty:
+			if toUnits(amount) < toUnits(rule.MinAmount) {
+				continue
+			}
+			ok, err := isKnown()
+			if err != nil {
+				return nil, false, err
+			}
+			if !ok {
+				message = fmt.Sprintf("first transfer to the recipient of %s, threshold %s", formatAmount(amount), formatAmount(rule.MinAmount))
+			}
+
+		case entity.FraudRuleSpike:
+			avg, n, err := fs.repo.AverageTransferSince(ctx, from, now.Add(-rule.Window))
+			if err != nil {
+				return nil, false, err
+			}
+			if prior.transfers > 0 {
+				avg = (avg*float64(n) + prior.sum) / float64(n+prior.transfers)
+				n += prior.transfers
+			}
+			if n >= rule.MinHistory && avg > 0 && float64(amount) >= rule.Factor*avg {
+				message = fmt.Sprintf("amount %s is %.1f times the average %.2f of %d transfers within %s",
+					formatAmount(amount), float64(amount)/avg, avg, n, rule.Window)
+			}
+
+		case entity.FraudRuleFanOut:
+			ok, err := isKnown()
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				continue
+			}
+			n, err := fs.repo.CountNewRecipientsSince(ctx, from, now.Add(-rule.Window))
+			if err != nil {
+				return nil, false, err
+			}
+			n += prior.newRecipients
+			if n+1 > rule.Count {
+				message = fmt.Sprintf("%d new recipients within %s, allowed %d", n+1, rule.Window, rule.Count)
+			}
+		}
+
+		if message != "" {
+			reasons = append(reasons, entity.FraudReason{Rule: rule.Name, Type: rule.Type, Score: rule.Score, Message: message})
+		}
+	}
+	return reasons, known != nil && !*known, nil
+}
+
+func formatAmount(amount float32) string {
+	return strconv.FormatFloat(float64(amount), 'f', -1, 32)
+}
+
+type fraudServiceImpl struct {
+	repo       repository.FraudRepo
+	transactor repository.Transactor
+	log        *logrus.Logger
+}
+
+// очередь переводов, отправленных правилами на проверку, и решения оператора по ним
+func NewFraudService(repo repository.FraudRepo, transactor repository.Transactor, log *logrus.Logger) *fraudServiceImpl {
+	return &fraudServiceImpl{
+		repo:       repo,
+		transactor: transactor,
+		log:        log,
+	}
+}
+
+func (fs *fraudServiceImpl) ListCases(ctx context.Context, filter entity.FraudCaseFilter) ([]entity.FraudCase, error) {
+	switch filter.Status {
+	case "", entity.FraudCasePending, entity.FraudCaseApproved, entity.FraudCaseRejected, entity.FraudCaseBlocked:
+	default:
+		return nil, newValidationError([]FieldError{{Field: "status", Message: "must be one of pending, approved, rejected, blocked"}})
+	}
+	return fs.repo.ListFraudCases(ctx, filter)
+}
+
+func (fs *fraudServiceImpl) GetCase(ctx context.Context, id uuid.UUID) (entity.FraudCase, error) {
+	c, err := fs.repo.GetFraudCase(ctx, id)
+	if errors.Is(err, repoerrors.ErrFraudCaseNotFound) {
+		return entity.FraudCase{}, ErrFraudCaseNotFound
+	}
+	return c, err
+}
+
+// ApproveCase - удержанная сумма зачисляется получателю с memo, reference и metadata исходного перевода
+func (fs *fraudServiceImpl) ApproveCase(ctx context.Context, actor string, id uuid.UUID, note string) (entity.FraudCase, error) {
+	return fs.decide(ctx, actor, id, entity.FraudCaseApproved, note)
+}
+
+// RejectCase - удержанная сумма возвращается отправителю
+func (fs *fraudServiceImpl) RejectCase(ctx context.Context, actor string, id uuid.UUID, note string) (entity.FraudCase, error) {
+	return fs.decide(ctx, actor, id, entity.FraudCaseRejected, note)
+}
+
+func (fs *fraudServiceImpl) decide(ctx context.Context, actor string, id uuid.UUID, status, note string) (entity.FraudCase, error) {
+	var fields []FieldError
+	if strings.TrimSpace(actor) == "" {
+		fields = append(fields, FieldError{Field: "actor", Message: "is required"})
+	}
+	switch {
+	case strings.TrimSpace(note) == "":
+		fields = append(fields, FieldError{Field: "note", Message: "is required"})
+	case len([]rune(note)) > MaxFraudDecisionLength:
+		fields = append(fields, FieldError{Field: "note", Message: fmt.Sprintf("must be at most %d characters", MaxFraudDecisionLength)})
+	}
+	if err := newValidationError(fields); err != nil {
+		return entity.FraudCase{}, err
+	}
+	ctx = logger.WithFields(ctx, logrus.Fields{"fraud_case_id": id.String()})
+
+	var settled entity.FraudCase
+	err := fs.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		c, err := fs.repo.LockFraudCase(ctx, id)
+		if err != nil {
+			return err
+		}
+		// заблокированный перевод средств не списывал, решать по нему нечего
+		if c.Status != entity.FraudCasePending {
+			return ErrFraudCaseNotPending
+		}
+		settled, err = fs.repo.SettleFraudCase(ctx, c, status, actor, note)
+		return err
+	})
+	if errors.Is(err, repoerrors.ErrFraudCaseNotFound) {
+		return entity.FraudCase{}, ErrFraudCaseNotFound
+	}
+	if err != nil {
+		return entity.FraudCase{}, transferError(err)
+	}
+
+	logger.FromContext(ctx, fs.log).WithFields(logrus.Fields{"status": status, "actor": actor}).Info("fraud case decided")
+	return settled, nil
+}
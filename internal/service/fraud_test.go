@@ -0,0 +1,618 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/memory"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+// история отправителя задается полями; удержание средства не двигает, только сохраняет запись
+type fakeFraudRepo struct {
+	repository.FraudRepo
+
+	transfers     int
+	known         bool
+	knownCalls    int
+	average       float64
+	history       int
+	newRecipients int
+	locks         int
+
+	cases map[uuid.UUID]entity.FraudCase
+}
+
+func (r *fakeFraudRepo) LockSender(context.Context, uuid.UUID) error {
+	r.locks++
+	return nil
+}
+
+func (r *fakeFraudRepo) CountTransfersSince(context.Context, uuid.UUID, time.Time) (int, error) {
+	return r.transfers, nil
+}
+
+func (r *fakeFraudRepo) HasTransferredTo(context.Context, uuid.UUID, uuid.UUID) (bool, error) {
+	r.knownCalls++
+	return r.known, nil
+}
+
+func (r *fakeFraudRepo) AverageTransferSince(context.Context, uuid.UUID, time.Time) (float64, int, error) {
+	return r.average, r.history, nil
+}
+
+func (r *fakeFraudRepo) CountNewRecipientsSince(context.Context, uuid.UUID, time.Time) (int, error) {
+	return r.newRecipients, nil
+}
+
+func (r *fakeFraudRepo) HoldTransfer(_ context.Context, c entity.FraudCase) (entity.FraudCase, error) {
+	return r.save(c, entity.FraudCasePending), nil
+}
+
+func (r *fakeFraudRepo) SaveBlockedTransfer(_ context.Context, c entity.FraudCase) (entity.FraudCase, error) {
+	return r.save(c, entity.FraudCaseBlocked), nil
+}
+
+func (r *fakeFraudRepo) LockFraudCase(_ context.Context, id uuid.UUID) (entity.FraudCase, error) {
+	c, ok := r.cases[id]
+	if !ok {
+		return entity.FraudCase{}, repoerrors.ErrFraudCaseNotFound
+	}
+	return c, nil
+}
+
+func (r *fakeFraudRepo) SettleFraudCase(_ context.Context, c entity.FraudCase, status, actor, note string) (entity.FraudCase, error) {
+	now := time.Now().UTC()
+	c.Status, c.DecidedBy, c.DecisionNote, c.DecidedAt = status, actor, note, &now
+	r.cases[c.Id] = c
+	return c, nil
+}
+
+func (r *fakeFraudRepo) save(c entity.FraudCase, status string) entity.FraudCase {
+	if r.cases == nil {
+		r.cases = make(map[uuid.UUID]entity.FraudCase)
+	}
+	c.Id, c.Status = uuid.New(), status
+	r.cases[c.Id] = c
+	return c
+}
+
+type fakeTransactor struct{}
+
+func (fakeTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+func discardLogger() *logrus.Logger {
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	return log
+}
+
+var (
+	velocityRule        = FraudRule{Name: "velocity-10m", Type: entity.FraudRuleVelocity, Score: 50, Count: 3, Window: 10 * time.Minute}
+	newCounterpartyRule = FraudRule{Name: "new-counterparty", Type: entity.FraudRuleNewCounterparty, Score: 30, MinAmount: 1000}
+	spikeRule           = FraudRule{Name: "spike-24h", Type: entity.FraudRuleSpike, Score: 40, Factor: 5, MinHistory: 3, Window: 24 * time.Hour}
+	fanOutRule          = FraudRule{Name: "fan-out-1h", Type: entity.FraudRuleFanOut, Score: 20, Count: 2, Window: time.Hour}
+)
+
+func TestFraudEvaluate(t *testing.T) {
+	allRules := []FraudRule{velocityRule, newCounterpartyRule, spikeRule, fanOutRule}
+
+	tests := []struct {
+		name   string
+		rules  []FraudRule
+		repo   fakeFraudRepo
+		amount float32
+		want   []string
+	}{
+		{"velocity within limit", []FraudRule{velocityRule}, fakeFraudRepo{transfers: 2}, 10, nil},
+		{"velocity over limit", []FraudRule{velocityRule}, fakeFraudRepo{transfers: 3}, 10, []string{"velocity-10m"}},
+		{"new counterparty below min amount", []FraudRule{newCounterpartyRule}, fakeFraudRepo{}, 999.999, nil},
+		{"new counterparty known recipient", []FraudRule{newCounterpartyRule}, fakeFraudRepo{known: true}, 1000, nil},
+		{"new counterparty first transfer", []FraudRule{newCounterpartyRule}, fakeFraudRepo{}, 1000, []string{"new-counterparty"}},
+		{"spike short history", []FraudRule{spikeRule}, fakeFraudRepo{average: 10, history: 2}, 100, nil},
+		{"spike below factor", []FraudRule{spikeRule}, fakeFraudRepo{average: 10, history: 3}, 49.999, nil},
+		{"spike at factor", []FraudRule{spikeRule}, fakeFraudRepo{average: 10, history: 3}, 50, []string{"spike-24h"}},
+		{"spike without average", []FraudRule{spikeRule}, fakeFraudRepo{history: 3}, 50, nil},
+		{"fan out known recipient", []FraudRule{fanOutRule}, fakeFraudRepo{known: true, newRecipients: 5}, 10, nil},
+		{"fan out within limit", []FraudRule{fanOutRule}, fakeFraudRepo{newRecipients: 1}, 10, nil},
+		{"fan out over limit", []FraudRule{fanOutRule}, fakeFraudRepo{newRecipients: 2}, 10, []string{"fan-out-1h"}},
+		{"no rule fires", allRules, fakeFraudRepo{known: true, average: 500, history: 3}, 1000, nil},
+		{"all rules fire", allRules, fakeFraudRepo{transfers: 3, average: 10, history: 3, newRecipients: 2}, 1000,
+			[]string{"velocity-10m", "new-counterparty", "spike-24h", "fan-out-1h"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo
+			fs := NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), FraudPolicy{Rules: tt.rules})
+
+			reasons, _, err := fs.evaluate(context.Background(), uuid.New(), uuid.New(), tt.amount, time.Now().UTC(), &fraudHistory{})
+			if err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+			if len(reasons) != len(tt.want) {
+				t.Fatalf("evaluate: got reasons %+v, want %v", reasons, tt.want)
+			}
+			rules := make(map[string]FraudRule, len(tt.rules))
+			for _, r := range tt.rules {
+				rules[r.Name] = r
+			}
+			for i, r := range reasons {
+				rule := rules[tt.want[i]]
+				if r.Rule != rule.Name || r.Type != rule.Type || r.Score != rule.Score {
+					t.Errorf("reasons[%d] = %+v, want rule %s (%s, %d)", i, r, rule.Name, rule.Type, rule.Score)
+				}
+				if r.Message == "" {
+					t.Errorf("reasons[%d] has no message", i)
+				}
+			}
+			// история получателя читается не больше одного раза на перевод
+			if repo.knownCalls > 1 {
+				t.Errorf("HasTransferredTo called %d times, want at most 1", repo.knownCalls)
+			}
+		})
+	}
+}
+
+func TestFraudPolicyDecide(t *testing.T) {
+	policy := FraudPolicy{ReviewScore: 50, BlockScore: 100}
+
+	tests := []struct {
+		score int
+		want  string
+	}{
+		{0, entity.FraudAllow},
+		{49, entity.FraudAllow},
+		{50, entity.FraudReview},
+		{99, entity.FraudReview},
+		{100, entity.FraudBlock},
+		{150, entity.FraudBlock},
+	}
+	for _, tt := range tests {
+		if got := policy.decide(tt.score); got != tt.want {
+			t.Errorf("decide(%d) = %q, want %q", tt.score, got, tt.want)
+		}
+	}
+}
+
+func TestFraudScreenCheck(t *testing.T) {
+	policy := FraudPolicy{
+		Rules:       []FraudRule{velocityRule, newCounterpartyRule, fanOutRule},
+		ReviewScore: 50,
+		BlockScore:  100,
+	}
+
+	tests := []struct {
+		name         string
+		repo         fakeFraudRepo
+		amount       float32
+		noHold       bool
+		wantErr      error
+		wantScore    int
+		wantDecision string
+		wantStatus   string
+	}{
+		{"allow", fakeFraudRepo{transfers: 1, known: true}, 1000, false, nil, 0, "", ""},
+		{"allow below review score", fakeFraudRepo{transfers: 1}, 1000, false, nil, 0, "", ""},
+		{"review by one rule", fakeFraudRepo{transfers: 3, known: true}, 10, false, ErrTransferHeld, 50, entity.FraudReview, entity.FraudCasePending},
+		{"review by score sum", fakeFraudRepo{newRecipients: 2}, 1000, false, ErrTransferHeld, 50, entity.FraudReview, entity.FraudCasePending},
+		{"block", fakeFraudRepo{transfers: 3, newRecipients: 2}, 1000, false, ErrTransferBlocked, 100, entity.FraudBlock, entity.FraudCaseBlocked},
+		{"review without hold", fakeFraudRepo{transfers: 3, known: true}, 10, true, ErrTransferBlocked, 50, entity.FraudBlock, entity.FraudCaseBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo
+			fs := NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), policy)
+			from, to := uuid.New(), uuid.New()
+			ctx := repository.WithTransferDetails(context.Background(), entity.TransferDetails{Memo: "rent"})
+			if tt.noHold {
+				ctx = withoutFraudHold(ctx)
+			}
+
+			transferred := false
+			err := fs.screen(ctx, from, []fraudTransfer{{To: to, Amount: tt.amount}}, func(context.Context) error {
+				transferred = true
+				return nil
+			})
+			if repo.locks != 1 {
+				t.Errorf("screen: sender locked %d times, want 1", repo.locks)
+			}
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("screen: got %v, want nil", err)
+				}
+				if !transferred || len(repo.cases) != 0 {
+					t.Errorf("screen: allowed transfer executed %v and saved %d cases", transferred, len(repo.cases))
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("screen: got %v, want %v", err, tt.wantErr)
+			}
+			if transferred {
+				t.Error("screen: flagged transfer executed")
+			}
+			if len(repo.cases) != 1 {
+				t.Fatalf("screen: saved %d cases, want 1", len(repo.cases))
+			}
+			var c entity.FraudCase
+			for _, saved := range repo.cases {
+				c = saved
+			}
+			var heldErr *TransferHeldError
+			if errors.As(err, &heldErr) && heldErr.CaseId != c.Id {
+				t.Errorf("TransferHeldError.CaseId = %v, want %v", heldErr.CaseId, c.Id)
+			}
+
+			score := 0
+			for _, r := range c.Reasons {
+				score += r.Score
+			}
+			if c.Score != tt.wantScore || score != tt.wantScore {
+				t.Errorf("case score = %d, reasons sum = %d, want %d", c.Score, score, tt.wantScore)
+			}
+			if c.Decision != tt.wantDecision || c.Status != tt.wantStatus {
+				t.Errorf("case decision/status = %s/%s, want %s/%s", c.Decision, c.Status, tt.wantDecision, tt.wantStatus)
+			}
+			if c.From != from || c.To != to || c.Amount != tt.amount || c.Memo != "rent" {
+				t.Errorf("case = %+v, want transfer %v -> %v of %v with memo", c, from, to, tt.amount)
+			}
+		})
+	}
+}
+
+// системные переводы не проверяются, переводы владельца через подсистемы - как прямые
+func TestFraudScreenSources(t *testing.T) {
+	policy := FraudPolicy{Rules: []FraudRule{velocityRule}, ReviewScore: 50, BlockScore: 100}
+
+	tests := []struct {
+		name     string
+		ctx      func(ctx context.Context) context.Context
+		screened bool
+	}{
+		{"direct", func(ctx context.Context) context.Context { return ctx }, true},
+		{"admin", withoutFraudScreening, false},
+	}
+	for _, src := range []string{
+		entity.TransferSourceScheduledTransfer, entity.TransferSourceStandingOrder, entity.TransferSourceInvoice,
+		entity.TransferSourcePaymentRequest, entity.TransferSourceEscrow, entity.TransferSourceBatchTransfer,
+	} {
+		tests = append(tests, struct {
+			name     string
+			ctx      func(ctx context.Context) context.Context
+			screened bool
+		}{src, withSource(src), true})
+	}
+	for _, src := range entity.FraudExemptTransferSources {
+		tests = append(tests, struct {
+			name     string
+			ctx      func(ctx context.Context) context.Context
+			screened bool
+		}{src, withSource(src), false})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := fakeFraudRepo{transfers: 3}
+			fs := NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), policy)
+
+			err := fs.screen(tt.ctx(context.Background()), uuid.New(), []fraudTransfer{{To: uuid.New(), Amount: 10}},
+				func(context.Context) error { return nil })
+			if tt.screened && !errors.Is(err, ErrTransferHeld) {
+				t.Errorf("screen: got %v, want %v", err, ErrTransferHeld)
+			}
+			if !tt.screened && (err != nil || len(repo.cases) != 0 || repo.locks != 0) {
+				t.Errorf("screen: got %v, %d cases and %d locks, want transfer not screened", err, len(repo.cases), repo.locks)
+			}
+		})
+	}
+}
+
+// переводы одной операции проверяются по порядку, и уже пропущенные правила считают выполненными
+func TestFraudScreenAll(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+
+	tests := []struct {
+		name      string
+		rule      FraudRule
+		repo      fakeFraudRepo
+		transfers []fraudTransfer
+		want      []bool
+	}{
+		{
+			name:      "velocity counts earlier lines",
+			rule:      velocityRule,
+			repo:      fakeFraudRepo{transfers: 1},
+			transfers: []fraudTransfer{{a, 10}, {b, 10}, {c, 10}},
+			want:      []bool{false, false, true},
+		},
+		{
+			name:      "fan out counts earlier new recipients once",
+			rule:      FraudRule{Name: "fan-out", Type: entity.FraudRuleFanOut, Score: 50, Count: 2, Window: time.Hour},
+			transfers: []fraudTransfer{{a, 10}, {a, 10}, {b, 10}, {c, 10}},
+			want:      []bool{false, false, false, true},
+		},
+		{
+			name:      "flagged lines are not counted",
+			rule:      velocityRule,
+			repo:      fakeFraudRepo{transfers: 2},
+			transfers: []fraudTransfer{{a, 10}, {b, 10}, {c, 10}},
+			want:      []bool{false, true, true},
+		},
+		{
+			name:      "spike averages earlier lines",
+			rule:      FraudRule{Name: "spike", Type: entity.FraudRuleSpike, Score: 50, Factor: 5, MinHistory: 3, Window: time.Hour},
+			repo:      fakeFraudRepo{average: 100, history: 2},
+			transfers: []fraudTransfer{{a, 10}, {b, 350}},
+			want:      []bool{false, true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.repo
+			fs := NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), FraudPolicy{Rules: []FraudRule{tt.rule}, ReviewScore: 50, BlockScore: 100})
+
+			results, err := fs.screenAll(withoutFraudHold(context.Background()), uuid.New(), tt.transfers)
+			if err != nil {
+				t.Fatalf("screenAll: %v", err)
+			}
+			for i, res := range results {
+				if flagged := res != nil; flagged != tt.want[i] || (flagged && !errors.Is(res, ErrTransferBlocked)) {
+					t.Errorf("results[%d] = %v, want flagged %v", i, res, tt.want[i])
+				}
+			}
+			if repo.locks != 1 {
+				t.Errorf("screenAll: sender locked %d times, want 1", repo.locks)
+			}
+		})
+	}
+}
+
+func withSource(src string) func(ctx context.Context) context.Context {
+	return func(ctx context.Context) context.Context {
+		return repository.WithTransferSource(ctx, entity.TransferSource{Type: src, Id: uuid.New()})
+	}
+}
+
+func TestWalletServiceTransferFraud(t *testing.T) {
+	newCounterparty := newCounterpartyRule
+	newCounterparty.MinAmount = 10
+	policy := FraudPolicy{Rules: []FraudRule{velocityRule, newCounterparty}, ReviewScore: 50, BlockScore: 80}
+
+	tests := []struct {
+		name    string
+		repo    fakeFraudRepo
+		wantErr error
+	}{
+		{"allow", fakeFraudRepo{known: true}, nil},
+		{"review", fakeFraudRepo{transfers: 3, known: true}, ErrTransferHeld},
+		{"block", fakeFraudRepo{transfers: 3}, ErrTransferBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := tt.repo
+			wallets := memory.NewWalletRepo()
+			ws := NewWalletService(wallets, discardLogger(), nil, TransferDetailsPolicy{}, PocketPolicy{},
+				NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), policy))
+			from, _ := wallets.CreateWallet(ctx, entity.WalletInfo{})
+			to, _ := wallets.CreateWallet(ctx, entity.WalletInfo{})
+
+			err := ws.Transfer(ctx, from.Id, to.Id, 50)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Transfer: got %v, want %v", err, tt.wantErr)
+			}
+
+			// при review и block сам перевод не выполняется: удержанием занимается FraudRepo
+			want := float32(repository.InitialWalletBalance)
+			if tt.wantErr == nil {
+				want -= 50
+			}
+			if got, _ := wallets.GetWalletStatus(ctx, from.Id); got.Balance != want {
+				t.Errorf("source balance = %v, want %v", got.Balance, want)
+			}
+		})
+	}
+}
+
+// разделенный платеж проходит только целиком, поэтому review для него - блокировка
+func TestWalletServiceSplitTransferFraud(t *testing.T) {
+	newCounterparty := newCounterpartyRule
+	newCounterparty.MinAmount = 10
+	policy := FraudPolicy{Rules: []FraudRule{velocityRule, newCounterparty}, ReviewScore: 50, BlockScore: 80}
+
+	tests := []struct {
+		name    string
+		repo    fakeFraudRepo
+		wantErr error
+	}{
+		{"allow", fakeFraudRepo{known: true}, nil},
+		{"review", fakeFraudRepo{transfers: 3, known: true}, ErrTransferBlocked},
+		{"block", fakeFraudRepo{transfers: 3}, ErrTransferBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := tt.repo
+			wallets := memory.NewWalletRepo()
+			ws := NewWalletService(wallets, discardLogger(), nil, TransferDetailsPolicy{}, PocketPolicy{},
+				NewFraudScreen(&repo, fakeTransactor{}, discardLogger(), policy))
+			from, _ := wallets.CreateWallet(ctx, entity.WalletInfo{})
+			a, _ := wallets.CreateWallet(ctx, entity.WalletInfo{})
+			b, _ := wallets.CreateWallet(ctx, entity.WalletInfo{})
+			half := 50.0
+
+			_, err := ws.SplitTransfer(ctx, from.Id, 50, []entity.SplitShare{{To: a.Id, Percent: &half}, {To: b.Id, Percent: &half}})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SplitTransfer: got %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				// по кейсу на каждую долю: оператор видит всех получателей
+				if len(repo.cases) != 2 {
+					t.Fatalf("got %d cases, want 2", len(repo.cases))
+				}
+				for _, c := range repo.cases {
+					if c.Status != entity.FraudCaseBlocked {
+						t.Errorf("case status = %q, want %q", c.Status, entity.FraudCaseBlocked)
+					}
+				}
+			}
+
+			want := float32(repository.InitialWalletBalance)
+			if tt.wantErr == nil {
+				want -= 50
+			}
+			if got, _ := wallets.GetWalletStatus(ctx, from.Id); got.Balance != want {
+				t.Errorf("source balance = %v, want %v", got.Balance, want)
+			}
+		})
+	}
+}
+
+func TestFraudServiceDecide(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		approve    bool
+		actor      string
+		note       string
+		missing    bool
+		wantErr    error
+		wantStatus string
+	}{
+		{"approve", entity.FraudCasePending, true, "alice", "confirmed", false, nil, entity.FraudCaseApproved},
+		{"reject", entity.FraudCasePending, false, "alice", "account takeover", false, nil, entity.FraudCaseRejected},
+		{"approve decided", entity.FraudCaseApproved, true, "alice", "again", false, ErrFraudCaseNotPending, ""},
+		{"reject blocked", entity.FraudCaseBlocked, false, "alice", "nothing held", false, ErrFraudCaseNotPending, ""},
+		{"not found", entity.FraudCasePending, true, "alice", "confirmed", true, ErrFraudCaseNotFound, ""},
+		{"no actor", entity.FraudCasePending, true, " ", "confirmed", false, ErrValidation, ""},
+		{"no note", entity.FraudCasePending, false, "alice", "", false, ErrValidation, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := &fakeFraudRepo{}
+			c := repo.save(entity.FraudCase{From: uuid.New(), To: uuid.New(), Amount: 25}, tt.status)
+			fs := NewFraudService(repo, fakeTransactor{}, discardLogger())
+
+			id := c.Id
+			if tt.missing {
+				id = uuid.New()
+			}
+			decide := fs.RejectCase
+			if tt.approve {
+				decide = fs.ApproveCase
+			}
+			settled, err := decide(ctx, tt.actor, id, tt.note)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("decide: got %v, want %v", err, tt.wantErr)
+				}
+				if repo.cases[c.Id].Status != tt.status {
+					t.Errorf("case status = %s, want unchanged %s", repo.cases[c.Id].Status, tt.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decide: %v", err)
+			}
+			if settled.Status != tt.wantStatus || settled.DecidedBy != tt.actor || settled.DecisionNote != tt.note || settled.DecidedAt == nil {
+				t.Errorf("decide: got %+v, want status %s by %s", settled, tt.wantStatus, tt.actor)
+			}
+		})
+	}
+}
+
+// транзакция, которая запоминает, чем закончилась: nil - фиксация
+type recordingTransactor struct {
+	results []error
+}
+
+func (tr *recordingTransactor) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := fn(ctx)
+	tr.results = append(tr.results, err)
+	return err
+}
+
+type fakeInvoiceRepo struct {
+	repository.InvoiceRepo
+
+	inv     entity.Invoice
+	updates int
+}
+
+func (r *fakeInvoiceRepo) LockInvoice(context.Context, uuid.UUID) (entity.Invoice, error) {
+	return r.inv, nil
+}
+
+func (r *fakeInvoiceRepo) UpdateInvoiceState(context.Context, entity.Invoice) error {
+	r.updates++
+	return nil
+}
+
+type fakePaymentRequestRepo struct {
+	repository.PaymentRequestRepo
+
+	req      entity.PaymentRequest
+	resolves int
+}
+
+func (r *fakePaymentRequestRepo) LockPaymentRequest(context.Context, uuid.UUID) (entity.PaymentRequest, error) {
+	return r.req, nil
+}
+
+func (r *fakePaymentRequestRepo) ResolvePaymentRequest(context.Context, uuid.UUID, string, time.Time) error {
+	r.resolves++
+	return nil
+}
+
+// заблокированная оплата фиксирует транзакцию, чтобы перевод остался в очереди, а счет и запрос не меняются
+func TestBlockedPaymentKeepsCase(t *testing.T) {
+	ctx := context.Background()
+	payer, merchant := uuid.New(), uuid.New()
+
+	t.Run("invoice", func(t *testing.T) {
+		ws := fakeTransferService{results: []error{ErrTransferBlocked}}
+		repo := fakeInvoiceRepo{inv: entity.Invoice{Id: uuid.New(), Merchant: merchant, Amount: 100, Status: entity.InvoiceOpen, DueAt: time.Now().Add(time.Hour)}}
+		tr := recordingTransactor{}
+		is := NewInvoiceService(&ws, &repo, &tr, discardLogger(), "RUB")
+
+		_, err := is.PayInvoice(ctx, repo.inv.Id, payer, 0)
+		if !errors.Is(err, ErrTransferBlocked) {
+			t.Fatalf("PayInvoice: got %v, want %v", err, ErrTransferBlocked)
+		}
+		if len(tr.results) != 1 || tr.results[0] != nil {
+			t.Errorf("transaction results = %v, want committed", tr.results)
+		}
+		if repo.updates != 0 {
+			t.Errorf("invoice updated %d times, want 0", repo.updates)
+		}
+	})
+
+	t.Run("payment request", func(t *testing.T) {
+		ws := fakeTransferService{results: []error{ErrTransferBlocked}}
+		repo := fakePaymentRequestRepo{req: entity.PaymentRequest{Id: uuid.New(), Payer: payer, Requester: merchant, Amount: 100,
+			Status: entity.PaymentRequestPending, ExpiresAt: time.Now().Add(time.Hour)}}
+		tr := recordingTransactor{}
+		ps := NewPaymentRequestService(&ws, &repo, &tr, discardLogger(), time.Hour)
+
+		_, err := ps.AcceptPaymentRequest(ctx, payer, repo.req.Id)
+		if !errors.Is(err, ErrTransferBlocked) {
+			t.Fatalf("AcceptPaymentRequest: got %v, want %v", err, ErrTransferBlocked)
+		}
+		if len(tr.results) != 1 || tr.results[0] != nil {
+			t.Errorf("transaction results = %v, want committed", tr.results)
+		}
+		if repo.resolves != 0 {
+			t.Errorf("request resolved %d times, want 0", repo.resolves)
+		}
+	})
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	// знаков после запятой в дневных начислениях и невыплаченном остатке
+	AccrualPrecision = 10
+	// максимальная годовая ставка, %
+	MaxAnnualRate = 100
+
+	maxInterestProductNameLength = 100
+)
+
+// ставка - десятичная дробь, не больше 4 знаков после запятой (как в interest_products.annual_rate)
+var annualRateRe = regexp.MustCompile(`^\d{1,3}(\.\d{1,4})?$`)
+
+// период уже был выплачен раньше - перевод откатывается
+var errInterestPayoutAlreadyMade = errors.New("interest payout already made")
+
+// InterestPolicy - откуда выплачиваются проценты и когда повторять выплату, которая не прошла
+type InterestPolicy struct {
+	TreasuryWalletId uuid.UUID
+	// через сколько повторить выплату, отклоненную по бизнес-причине (например, у казначейства не хватило баланса)
+	RetryDelay time.Duration
+}
+
+type interestServiceImpl struct {
+	walletService WalletService
+	repo          repository.InterestRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+	policy        InterestPolicy
+}
+
+// выплаты идут через WalletService.Transfer с казначейского кошелька, транзакция помечается источником interest
+func NewInterestService(ws WalletService, repo repository.InterestRepo, transactor repository.Transactor, log *logrus.Logger, policy InterestPolicy) *interestServiceImpl {
+	return &interestServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+		policy:        policy,
+	}
+}
+
+// CreateProduct - из p берутся Name, AnnualRate, DayCount и Compounding
+func (is *interestServiceImpl) CreateProduct(ctx context.Context, p entity.InterestProduct) (entity.InterestProduct, error) {
+	p.Name = strings.TrimSpace(p.Name)
+	if err := validateInterestProduct(p); err != nil {
+		return entity.InterestProduct{}, err
+	}
+	return is.repo.CreateInterestProduct(ctx, p)
+}
+
+func (is *interestServiceImpl) ListProducts(ctx context.Context) ([]entity.InterestProduct, error) {
+	return is.repo.ListInterestProducts(ctx)
+}
+
+// OpenAccount - подключает кошелек к продукту, проценты начисляются начиная с сегодняшнего дня (UTC);
+// у подключенного кошелька меняет продукт для следующих начислений
+func (is *interestServiceImpl) OpenAccount(ctx context.Context, walletId, productId uuid.UUID) (entity.InterestAccount, error) {
+	if walletId == is.policy.TreasuryWalletId {
+		return entity.InterestAccount{}, newValidationError([]FieldError{{Field: "walletId", Message: "treasury wallet can't earn interest"}})
+	}
+
+	yesterday := time.Now().UTC().Truncate(day).AddDate(0, 0, -1)
+	acc, err := is.repo.OpenInterestAccount(ctx, walletId, productId, yesterday)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.InterestAccount{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrInterestProductNotFound) {
+		return entity.InterestAccount{}, ErrInterestProductNotFound
+	}
+	return acc, err
+}
+
+// CloseAccount - последний день начисления - вчерашний, начисленное выплачивается воркером, после чего счет закрывается
+func (is *interestServiceImpl) CloseAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error) {
+	acc, err := is.repo.CloseInterestAccount(ctx, walletId, time.Now().UTC().Truncate(day))
+	if errors.Is(err, repoerrors.ErrInterestAccountNotFound) {
+		return entity.InterestAccount{}, ErrInterestAccountNotFound
+	}
+	return acc, err
+}
+
+func (is *interestServiceImpl) GetAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error) {
+	acc, err := is.repo.GetInterestAccount(ctx, walletId)
+	if errors.Is(err, repoerrors.ErrInterestAccountNotFound) {
+		return entity.InterestAccount{}, ErrInterestAccountNotFound
+	}
+	return acc, err
+}
+
+func (is *interestServiceImpl) ListAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.InterestAccrual, error) {
+	if filter.From != nil && filter.To != nil && filter.To.Before(*filter.From) {
+		return nil, newValidationError([]FieldError{{Field: "to", Message: "must not be before from"}})
+	}
+	if _, err := is.GetAccount(ctx, walletId); err != nil {
+		return nil, err
+	}
+	return is.repo.ListInterestAccruals(ctx, walletId, filter)
+}
+
+func (is *interestServiceImpl) ListPayouts(ctx context.Context, walletId uuid.UUID) ([]entity.InterestPayout, error) {
+	if _, err := is.GetAccount(ctx, walletId); err != nil {
+		return nil, err
+	}
+	return is.repo.ListInterestPayouts(ctx, walletId)
+}
+
+// AccrueDue - до limit шагов начисления: каждый шаг - один день одного счета и, если период закончился, выплата;
+// возвращает, сколько шагов сделано. Шаги после простоя догоняют пропущенные дни по порядку
+func (is *interestServiceImpl) AccrueDue(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		ok, err := is.accrueNext(ctx, time.Now().UTC())
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// начисление за день, выплата и сдвиг счета - в одной транзакции: повтор после сбоя не начислит и не выплатит дважды
+func (is *interestServiceImpl) accrueNext(ctx context.Context, now time.Time) (bool, error) {
+	err := is.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		// закончившимся считается день, у которого наступил конец по UTC
+		through := now.Truncate(day).AddDate(0, 0, -1)
+		acc, err := is.repo.ClaimDueInterestAccount(ctx, through, now)
+		if err != nil {
+			return err
+		}
+		ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: acc.WalletId.String()})
+
+		pending, ok := new(big.Rat).SetString(acc.Pending)
+		if !ok {
+			return fmt.Errorf("invalid pending interest %q", acc.Pending)
+		}
+
+		last := through
+		if acc.EndsOn != nil && acc.EndsOn.AddDate(0, 0, -1).Before(last) {
+			last = acc.EndsOn.AddDate(0, 0, -1)
+		}
+		if acc.AccruedThrough.Before(last) {
+			date := acc.AccruedThrough.AddDate(0, 0, 1)
+			amount, err := is.accrue(ctx, acc, date)
+			if err != nil {
+				return err
+			}
+			pending.Add(pending, amount)
+			acc.AccruedThrough = date
+			if periodEnd(date, acc.Product.Compounding) {
+				acc.PayoutDue = true
+			}
+		}
+		// закрытие - начислено по последний день, осталось выплатить остаток
+		closing := acc.EndsOn != nil && !acc.AccruedThrough.Before(last)
+		if closing {
+			acc.PayoutDue = true
+		}
+
+		acc.RetryAt = nil
+		if acc.PayoutDue {
+			err = is.payout(ctx, acc, pending, now)
+			switch {
+			case err == nil:
+				acc.PayoutDue = false
+			case errors.Is(err, errInterestPayoutAlreadyMade):
+				logger.FromContext(ctx, is.log).WithField("period_end", acc.AccruedThrough).Warn("interest payout already made, skipping")
+				acc.PayoutDue = false
+			case errorReason(err) != metrics.ReasonInternal:
+				// бизнес-ошибка - начисленное остается к выплате, повтор через RetryDelay
+				retryAt := now.Add(is.policy.RetryDelay)
+				acc.RetryAt = &retryAt
+				logger.FromContext(ctx, is.log).WithError(err).Warn("interest payout failed")
+			default:
+				return err
+			}
+		}
+		if closing && !acc.PayoutDue {
+			acc.Status = entity.InterestAccountClosed
+		}
+
+		acc.Pending = pending.FloatString(AccrualPrecision)
+		return is.repo.UpdateInterestAccountProgress(ctx, acc)
+	})
+	if errors.Is(err, repoerrors.ErrNoDueInterestAccounts) {
+		return false, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx, is.log).WithError(err).Error("interestServiceImpl.accrueNext")
+		return false, err
+	}
+	return true, nil
+}
+
+// начисление за день date по остатку на его конец; 0, если день уже был начислен
+func (is *interestServiceImpl) accrue(ctx context.Context, acc entity.InterestAccount, date time.Time) (*big.Rat, error) {
+	balance, err := is.repo.EndOfDayBalance(ctx, acc.WalletId, date.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	amount, err := dailyInterest(balance, acc.Product.AnnualRate, acc.Product.DayCount, date)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := is.repo.SaveInterestAccrual(ctx, entity.InterestAccrual{
+		WalletId:   acc.WalletId,
+		Date:       date,
+		ProductId:  acc.ProductId,
+		Balance:    balance,
+		AnnualRate: acc.Product.AnnualRate,
+		DayCount:   acc.Product.DayCount,
+		Amount:     amount.FloatString(AccrualPrecision),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !inserted {
+		logger.FromContext(ctx, is.log).WithField("date", date).Warn("interest already accrued for the day, skipping")
+		return new(big.Rat), nil
+	}
+	return amount, nil
+}
+
+// выплачивает pending, округленное вниз до тысячных; остаток остается в pending до следующей выплаты
+func (is *interestServiceImpl) payout(ctx context.Context, acc entity.InterestAccount, pending *big.Rat, now time.Time) error {
+	// начисления неотрицательны, но выплачивать не-положительную сумму нельзя в любом случае:
+	// перевод не пройдет валидацию, и выплата повторялась бы бесконечно
+	paid := truncateRat(pending, AmountPrecision)
+	if paid.Sign() <= 0 {
+		return nil
+	}
+	carry := new(big.Rat).Sub(pending, paid)
+	amount, _ := paid.Float32()
+
+	id, err := uuid.NewRandom()
+	if err != nil {
+		logger.FromContext(ctx, is.log).WithError(err).Error("interestServiceImpl.payout - uuid.NewRandom")
+		return err
+	}
+	p := entity.InterestPayout{
+		Id:        id,
+		WalletId:  acc.WalletId,
+		PeriodEnd: acc.AccruedThrough,
+		Accrued:   pending.FloatString(AccrualPrecision),
+		Amount:    amount,
+		Carry:     carry.FloatString(AccrualPrecision),
+		PaidAt:    now,
+	}
+
+	// выплата и перевод - в savepoint: если перевод не прошел, начисления остаются невыплаченными
+	err = is.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		inserted, err := is.repo.SaveInterestPayout(ctx, p)
+		if err != nil {
+			return err
+		}
+		if !inserted {
+			return errInterestPayoutAlreadyMade
+		}
+		ctx = repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceInterest, Id: p.Id})
+		return is.walletService.Transfer(ctx, is.policy.TreasuryWalletId, acc.WalletId, amount)
+	})
+	if err != nil {
+		return err
+	}
+	pending.Set(carry)
+	return nil
+}
+
+// начисление за день: остаток * ставка / 100 / дней в году, банковское округление до AccrualPrecision знаков;
+// отрицательный остаток (долг по кредитной линии) процентов не приносит - за него платят по кредитной линии
+func dailyInterest(balance float32, annualRate, dayCount string, date time.Time) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(annualRate)
+	if !ok {
+		return nil, fmt.Errorf("invalid annual rate %q", annualRate)
+	}
+
+	var yearDays int64
+	switch dayCount {
+	case entity.DayCountActual365:
+		yearDays = 365
+	case entity.DayCountActual360:
+		yearDays = 360
+	case entity.DayCountActualActual:
+		start := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		yearDays = int64(start.AddDate(1, 0, 0).Sub(start) / day)
+	default:
+		return nil, fmt.Errorf("unknown day count convention %q", dayCount)
+	}
+
+	// остаток - в целых тысячных, чтобы не тащить в расчет ошибку float32
+	amount := big.NewRat(max(toUnits(balance), 0), int64(amountUnit))
+	amount.Mul(amount, rate)
+	amount.Quo(amount, big.NewRat(100*yearDays, 1))
+	return roundHalfEven(amount, AccrualPrecision), nil
+}
+
+// последний ли date день периода выплаты
+func periodEnd(date time.Time, compounding string) bool {
+	next := date.AddDate(0, 0, 1)
+	switch compounding {
+	case entity.CompoundingDaily:
+		return true
+	case entity.CompoundingMonthly:
+		return next.Day() == 1
+	case entity.CompoundingQuarterly:
+		return next.Day() == 1 && next.Month()%3 == 1
+	case entity.CompoundingYearly:
+		return next.Day() == 1 && next.Month() == time.January
+	}
+	return false
+}
+
+// округление неотрицательного r до scale знаков, половина - к четному; начисления неотрицательны (см. dailyInterest)
+func roundHalfEven(r *big.Rat, scale int) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	scaled := new(big.Rat).Mul(r, new(big.Rat).SetInt(unit))
+
+	q, rem := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	switch new(big.Int).Lsh(rem, 1).Cmp(scaled.Denom()) {
+	case 1:
+		q.Add(q, big.NewInt(1))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return new(big.Rat).SetFrac(q, unit)
+}
+
+// отбрасывание знаков неотрицательного r после scale
+func truncateRat(r *big.Rat, scale int) *big.Rat {
+	unit := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	scaled := new(big.Int).Mul(r.Num(), unit)
+	return new(big.Rat).SetFrac(scaled.Quo(scaled, r.Denom()), unit)
+}
+
+func validateInterestProduct(p entity.InterestProduct) error {
+	var fields []FieldError
+
+	switch {
+	case p.Name == "":
+		fields = append(fields, FieldError{Field: "name", Message: "is required"})
+	case utf8.RuneCountInString(p.Name) > maxInterestProductNameLength:
+		fields = append(fields, FieldError{Field: "name", Message: fmt.Sprintf("must be at most %d characters", maxInterestProductNameLength)})
+	}
+
+	rate, ok := new(big.Rat).SetString(p.AnnualRate)
+	if !annualRateRe.MatchString(p.AnnualRate) || !ok {
+		fields = append(fields, FieldError{Field: "annualRate", Message: "must be a decimal number with at most 4 decimal places"})
+	} else if rate.Sign() <= 0 || rate.Cmp(big.NewRat(MaxAnnualRate, 1)) > 0 {
+		fields = append(fields, FieldError{Field: "annualRate", Message: fmt.Sprintf("must be positive and at most %d", MaxAnnualRate)})
+	}
+
+	switch p.DayCount {
+	case entity.DayCountActual365, entity.DayCountActual360, entity.DayCountActualActual:
+	default:
+		fields = append(fields, FieldError{Field: "dayCount", Message: "must be one of act/365, act/360, act/act"})
+	}
+	switch p.Compounding {
+	case entity.CompoundingDaily, entity.CompoundingMonthly, entity.CompoundingQuarterly, entity.CompoundingYearly:
+	default:
+		fields = append(fields, FieldError{Field: "compounding", Message: "must be one of daily, monthly, quarterly, yearly"})
+	}
+
+	return newValidationError(fields)
+}
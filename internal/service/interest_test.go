@@ -0,0 +1,255 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+func TestDailyInterest(t *testing.T) {
+	date2023 := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+	date2024 := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		balance  float32
+		rate     string
+		dayCount string
+		date     time.Time
+		want     string
+	}{
+		{"actual/365", 1000, "3.65", entity.DayCountActual365, date2024, "0.1000000000"},
+		{"actual/365 ignores leap year", 1000, "3.66", entity.DayCountActual365, date2024, "0.1002739726"},
+		{"actual/360", 1000, "3.6", entity.DayCountActual360, date2023, "0.1000000000"},
+		{"actual/actual leap year", 1000, "3.66", entity.DayCountActualActual, date2024, "0.1000000000"},
+		{"actual/actual common year", 1000, "3.65", entity.DayCountActualActual, date2023, "0.1000000000"},
+		// остаток берется в целых тысячных, без ошибки float32
+		{"float32 balance", 0.1, "3.65", entity.DayCountActual365, date2023, "0.0000100000"},
+		{"rounded to accrual precision", 0.001, "1", entity.DayCountActual365, date2023, "0.0000000274"},
+		{"zero balance", 0, "5", entity.DayCountActual365, date2023, "0.0000000000"},
+		// долг по кредитной линии процентов не приносит
+		{"negative balance", -1000, "3.65", entity.DayCountActual365, date2023, "0.0000000000"},
+		{"zero rate", 1000, "0", entity.DayCountActual360, date2023, "0.0000000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dailyInterest(tt.balance, tt.rate, tt.dayCount, tt.date)
+			if err != nil {
+				t.Fatalf("dailyInterest: %v", err)
+			}
+			if s := got.FloatString(AccrualPrecision); s != tt.want {
+				t.Errorf("dailyInterest(%v, %s, %s) = %s, want %s", tt.balance, tt.rate, tt.dayCount, s, tt.want)
+			}
+		})
+	}
+
+	if _, err := dailyInterest(1000, "x", entity.DayCountActual365, date2023); err == nil {
+		t.Error("dailyInterest: invalid rate accepted")
+	}
+	if _, err := dailyInterest(1000, "5", "30/360", date2023); err == nil {
+		t.Error("dailyInterest: unknown day count accepted")
+	}
+}
+
+func TestPeriodEnd(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		date        time.Time
+		compounding string
+		want        bool
+	}{
+		{date(2024, 6, 14), entity.CompoundingDaily, true},
+		{date(2024, 1, 31), entity.CompoundingMonthly, true},
+		{date(2024, 1, 30), entity.CompoundingMonthly, false},
+		{date(2024, 2, 28), entity.CompoundingMonthly, false},
+		{date(2024, 2, 29), entity.CompoundingMonthly, true},
+		{date(2023, 2, 28), entity.CompoundingMonthly, true},
+		{date(2024, 3, 31), entity.CompoundingQuarterly, true},
+		{date(2024, 4, 30), entity.CompoundingQuarterly, false},
+		{date(2024, 6, 30), entity.CompoundingQuarterly, true},
+		{date(2024, 12, 31), entity.CompoundingQuarterly, true},
+		{date(2024, 6, 30), entity.CompoundingYearly, false},
+		{date(2024, 12, 31), entity.CompoundingYearly, true},
+		{date(2024, 12, 31), "weekly", false},
+	}
+	for _, tt := range tests {
+		if got := periodEnd(tt.date, tt.compounding); got != tt.want {
+			t.Errorf("periodEnd(%s, %s) = %v, want %v", tt.date.Format(time.DateOnly), tt.compounding, got, tt.want)
+		}
+	}
+}
+
+func TestRoundHalfEven(t *testing.T) {
+	tests := []struct {
+		r     string
+		scale int
+		want  string
+	}{
+		{"0.0005", 3, "0.000"},
+		{"0.0015", 3, "0.002"},
+		{"0.0025", 3, "0.002"},
+		{"0.0035", 3, "0.004"},
+		{"0.00050001", 3, "0.001"},
+		{"0.00049999", 3, "0.000"},
+		{"1.2345", 3, "1.234"},
+		{"1.2355", 3, "1.236"},
+		{"1/3", 10, "0.3333333333"},
+		{"2/3", 10, "0.6666666667"},
+		{"0", 3, "0.000"},
+		{"42", 3, "42.000"},
+	}
+	for _, tt := range tests {
+		r, _ := new(big.Rat).SetString(tt.r)
+		if got := roundHalfEven(r, tt.scale).FloatString(tt.scale); got != tt.want {
+			t.Errorf("roundHalfEven(%s, %d) = %s, want %s", tt.r, tt.scale, got, tt.want)
+		}
+	}
+}
+
+func TestTruncateRat(t *testing.T) {
+	tests := []struct {
+		r     string
+		scale int
+		want  string
+	}{
+		{"1.2349", 3, "1.234"},
+		{"0.0009999999", 3, "0.000"},
+		{"0.001", 3, "0.001"},
+		{"2/3", 3, "0.666"},
+		{"5", 3, "5.000"},
+		{"0", 3, "0.000"},
+	}
+	for _, tt := range tests {
+		r, _ := new(big.Rat).SetString(tt.r)
+		if got := truncateRat(r, tt.scale).FloatString(tt.scale); got != tt.want {
+			t.Errorf("truncateRat(%s, %d) = %s, want %s", tt.r, tt.scale, got, tt.want)
+		}
+	}
+}
+
+// один счет; начисления уникальны по дню, как в interest_accruals
+type fakeInterestRepo struct {
+	repository.InterestRepo
+
+	acc      entity.InterestAccount
+	balance  float32
+	accruals map[time.Time]entity.InterestAccrual
+}
+
+func (r *fakeInterestRepo) ClaimDueInterestAccount(_ context.Context, through, _ time.Time) (entity.InterestAccount, error) {
+	if r.acc.Status != entity.InterestAccountActive || (!r.acc.AccruedThrough.Before(through) && !r.acc.PayoutDue) {
+		return entity.InterestAccount{}, repoerrors.ErrNoDueInterestAccounts
+	}
+	return r.acc, nil
+}
+
+func (r *fakeInterestRepo) EndOfDayBalance(context.Context, uuid.UUID, time.Time) (float32, error) {
+	return r.balance, nil
+}
+
+func (r *fakeInterestRepo) SaveInterestAccrual(_ context.Context, a entity.InterestAccrual) (bool, error) {
+	if r.accruals == nil {
+		r.accruals = make(map[time.Time]entity.InterestAccrual)
+	}
+	if _, ok := r.accruals[a.Date]; ok {
+		return false, nil
+	}
+	r.accruals[a.Date] = a
+	return true, nil
+}
+
+func (r *fakeInterestRepo) UpdateInterestAccountProgress(_ context.Context, acc entity.InterestAccount) error {
+	r.acc = acc
+	return nil
+}
+
+func newInterestAccount(accruedThrough time.Time) entity.InterestAccount {
+	return entity.InterestAccount{
+		WalletId:       uuid.New(),
+		Product:        &entity.InterestProduct{AnnualRate: "3.65", DayCount: entity.DayCountActual365, Compounding: entity.CompoundingMonthly},
+		Status:         entity.InterestAccountActive,
+		AccruedThrough: accruedThrough,
+		Pending:        "0",
+	}
+}
+
+// каждый закончившийся день начисляется ровно один раз, в том числе при повторном запуске
+func TestInterestAccrueOncePerDay(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 4, 8, 0, 0, 0, time.UTC)
+	repo := &fakeInterestRepo{acc: newInterestAccount(time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)), balance: 1000}
+	is := NewInterestService(nil, repo, fakeTransactor{}, discardLogger(), InterestPolicy{})
+
+	for i := 0; ; i++ {
+		ok, err := is.accrueNext(ctx, now)
+		if err != nil {
+			t.Fatalf("accrueNext: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if i > 5 {
+			t.Fatal("accrueNext: account is never exhausted")
+		}
+	}
+	// 2 и 3 июня; 4 июня еще не закончился
+	if len(repo.accruals) != 2 {
+		t.Fatalf("accruals = %d, want 2", len(repo.accruals))
+	}
+	if want := time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC); !repo.acc.AccruedThrough.Equal(want) {
+		t.Errorf("AccruedThrough = %s, want %s", repo.acc.AccruedThrough, want)
+	}
+	if repo.acc.Pending != "0.2000000000" {
+		t.Errorf("Pending = %s, want 0.2000000000", repo.acc.Pending)
+	}
+
+	// повтор уже начисленного дня ничего не добавляет
+	amount, err := is.accrue(ctx, repo.acc, time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("accrue: %v", err)
+	}
+	if amount.Sign() != 0 || len(repo.accruals) != 2 {
+		t.Errorf("accrue: got %s and %d accruals, want 0 and 2", amount.FloatString(AccrualPrecision), len(repo.accruals))
+	}
+}
+
+// кошелек ушел в минус по кредитной линии: начисление нулевое, выплата не делается и не повторяется
+func TestInterestNegativeBalance(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 7, 1, 8, 0, 0, 0, time.UTC)
+	repo := &fakeInterestRepo{acc: newInterestAccount(time.Date(2024, 6, 29, 0, 0, 0, 0, time.UTC)), balance: -500}
+	ws := &fakeTransferService{}
+	is := NewInterestService(ws, repo, fakeTransactor{}, discardLogger(), InterestPolicy{TreasuryWalletId: uuid.New(), RetryDelay: time.Hour})
+
+	for i := 0; ; i++ {
+		ok, err := is.accrueNext(ctx, now)
+		if err != nil {
+			t.Fatalf("accrueNext: %v", err)
+		}
+		if !ok {
+			break
+		}
+		if i > 5 {
+			t.Fatal("accrueNext: account is never exhausted")
+		}
+	}
+	for date, a := range repo.accruals {
+		if a.Amount != "0.0000000000" || a.Balance != -500 {
+			t.Errorf("accrual for %s = %s on balance %v, want 0 on -500", date.Format(time.DateOnly), a.Amount, a.Balance)
+		}
+	}
+	// 30 июня - конец месячного периода: выплачивать нечего
+	if ws.calls != 0 {
+		t.Errorf("payout transfers = %d, want 0", ws.calls)
+	}
+	if repo.acc.PayoutDue || repo.acc.RetryAt != nil || repo.acc.Pending != "0.0000000000" {
+		t.Errorf("account = %+v, want no payout due and no retry", repo.acc)
+	}
+}
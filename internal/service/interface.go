@@ -2,14 +2,177 @@ package service
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/timohahaa/ewallet/internal/entity"
 )
 
 type WalletService interface {
-	CreateWallet(ctx context.Context) (entity.Wallet, error)
+	CreateWallet(ctx context.Context, info entity.WalletInfo) (entity.Wallet, error)
+	UpdateWalletInfo(ctx context.Context, walletId uuid.UUID, update entity.WalletInfoUpdate) (entity.Wallet, error)
+	ListWallets(ctx context.Context, filter entity.WalletFilter) (entity.WalletPage, error)
 	Transfer(ctx context.Context, from, to uuid.UUID, amount float32) error
-	TransactionHistory(ctx context.Context, walletId uuid.UUID) ([]entity.Transaction, error)
+	TransferWithDetails(ctx context.Context, from, to uuid.UUID, amount float32, details entity.TransferDetails) error
+	TransactionHistory(ctx context.Context, walletId uuid.UUID, filter entity.TransactionFilter) ([]entity.Transaction, error)
 	WalletStatus(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error)
+	SplitTransfer(ctx context.Context, from uuid.UUID, amount float32, shares []entity.SplitShare) (entity.SplitPayment, error)
+	GetSplitPayment(ctx context.Context, walletId, id uuid.UUID) (entity.SplitPayment, error)
+}
+
+// операции администратора, каждая пишется в аудит с actor и reason
+type AdminService interface {
+	Transfer(ctx context.Context, actor, reason string, from, to uuid.UUID, amount float32) error
+	AdjustBalance(ctx context.Context, actor, reason string, walletId uuid.UUID, amount float32) error
+	FreezeWallet(ctx context.Context, actor, reason string, walletId uuid.UUID, frozen bool) error
+	Reconcile(ctx context.Context) ([]entity.ReconciliationMismatch, error)
+	// VerifyAlias - подтверждает email или phone кошелька, после чего по ним можно искать и переводить
+	VerifyAlias(ctx context.Context, actor, reason string, walletId uuid.UUID, kind string) (entity.WalletAlias, error)
+	// SetCreditLine - кредитный лимит кошелька и плата за задолженность
+	SetCreditLine(ctx context.Context, actor, reason string, line entity.CreditLine) (entity.CreditLine, error)
+}
+
+type ScheduledTransferService interface {
+	CreateScheduledTransfer(ctx context.Context, from, to uuid.UUID, amount float32, executeAt time.Time, maxRetries int) (entity.ScheduledTransfer, error)
+	ListScheduledTransfers(ctx context.Context, walletId uuid.UUID, status string) ([]entity.ScheduledTransfer, error)
+	CancelScheduledTransfer(ctx context.Context, walletId, id uuid.UUID) error
+	ExecuteDue(ctx context.Context, limit int) (int, error)
+}
+
+type StandingOrderService interface {
+	CreateStandingOrder(ctx context.Context, so entity.StandingOrder) (entity.StandingOrder, error)
+	ListStandingOrders(ctx context.Context, walletId uuid.UUID, status string) ([]entity.StandingOrder, error)
+	ListStandingOrderRuns(ctx context.Context, walletId, id uuid.UUID) ([]entity.StandingOrderRun, error)
+	CancelStandingOrder(ctx context.Context, walletId, id uuid.UUID) error
+	ExecuteDue(ctx context.Context, limit int) (int, error)
+}
+
+type BatchTransferService interface {
+	CreateBatchTransfer(ctx context.Context, from uuid.UUID, mode string, lines []entity.BatchTransferLine) (entity.BatchTransfer, error)
+	GetBatchTransfer(ctx context.Context, walletId, id uuid.UUID) (entity.BatchTransfer, error)
+	ExecutePending(ctx context.Context, limit int) (int, error)
+}
+
+type EscrowService interface {
+	CreateEscrow(ctx context.Context, buyer, seller uuid.UUID, amount float32, deadline time.Time, description string) (entity.Escrow, error)
+	GetEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error)
+	ListEscrows(ctx context.Context, walletId uuid.UUID, status string) ([]entity.Escrow, error)
+	// ReleaseEscrow - покупатель подтверждает сделку, средства уходят продавцу
+	ReleaseEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error)
+	// CancelEscrow - продавец отменяет сделку, средства возвращаются покупателю
+	CancelEscrow(ctx context.Context, walletId, id uuid.UUID) (entity.Escrow, error)
+	ReleaseExpired(ctx context.Context, limit int) (int, error)
+}
+
+type PaymentRequestService interface {
+	CreatePaymentRequest(ctx context.Context, requester, payer uuid.UUID, amount float32, memo string, expiresAt time.Time) (entity.PaymentRequest, error)
+	GetPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error)
+	ListPaymentRequests(ctx context.Context, walletId uuid.UUID, direction, status string) ([]entity.PaymentRequest, error)
+	AcceptPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error)
+	DeclinePaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error)
+	ExpireDue(ctx context.Context, limit int) (int, error)
+}
+
+type InvoiceService interface {
+	CreateInvoice(ctx context.Context, merchant uuid.UUID, inv entity.Invoice) (entity.Invoice, error)
+	GetInvoice(ctx context.Context, id uuid.UUID) (entity.Invoice, error)
+	GetMerchantInvoice(ctx context.Context, merchant, id uuid.UUID) (entity.Invoice, error)
+	ListInvoices(ctx context.Context, merchant uuid.UUID, filter entity.InvoiceFilter) ([]entity.Invoice, error)
+	PayInvoice(ctx context.Context, id, from uuid.UUID, amount float32) (entity.Invoice, error)
+	VoidInvoice(ctx context.Context, merchant, id uuid.UUID) (entity.Invoice, error)
+	MarkOverdue(ctx context.Context, limit int) (int, error)
+}
+
+type AliasService interface {
+	SetAlias(ctx context.Context, walletId uuid.UUID, kind, value string) (entity.WalletAlias, error)
+	RemoveAlias(ctx context.Context, walletId uuid.UUID, kind string) error
+	ListAliases(ctx context.Context, walletId uuid.UUID, withRemoved bool) ([]entity.WalletAlias, error)
+	LookupAlias(ctx context.Context, alias string) (entity.AliasLookup, error)
+	ResolveAlias(ctx context.Context, alias string) (uuid.UUID, string, error)
+}
+
+type PocketService interface {
+	CreatePocket(ctx context.Context, parentId uuid.UUID, info entity.WalletInfo) (entity.Wallet, error)
+	ListPockets(ctx context.Context, parentId uuid.UUID) ([]entity.Wallet, error)
+	Deposit(ctx context.Context, parentId, pocketId uuid.UUID, amount float32) (entity.Wallet, error)
+	Withdraw(ctx context.Context, parentId, pocketId uuid.UUID, amount float32) (entity.Wallet, error)
+	ClosePocket(ctx context.Context, parentId, pocketId uuid.UUID) (entity.Wallet, error)
+	// SetRoundUp - правило округления кошелька; nil - выключить
+	SetRoundUp(ctx context.Context, walletId uuid.UUID, pocketId *uuid.UUID) (entity.Wallet, error)
+}
+
+type SavingsGoalService interface {
+	SetGoal(ctx context.Context, walletId, pocketId uuid.UUID, targetAmount float32, targetDate *time.Time) (entity.SavingsGoal, error)
+	GetGoal(ctx context.Context, walletId, pocketId uuid.UUID) (entity.SavingsGoal, error)
+	ListGoals(ctx context.Context, walletId uuid.UUID) ([]entity.SavingsGoal, error)
+	DeleteGoal(ctx context.Context, walletId, pocketId uuid.UUID) error
+}
+
+type InterestService interface {
+	CreateProduct(ctx context.Context, p entity.InterestProduct) (entity.InterestProduct, error)
+	ListProducts(ctx context.Context) ([]entity.InterestProduct, error)
+	// OpenAccount - подключает кошелек к продукту или меняет продукт подключенного кошелька
+	OpenAccount(ctx context.Context, walletId, productId uuid.UUID) (entity.InterestAccount, error)
+	// CloseAccount - прекращает начисление, остаток выплачивается воркером
+	CloseAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error)
+	GetAccount(ctx context.Context, walletId uuid.UUID) (entity.InterestAccount, error)
+	ListAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.InterestAccrual, error)
+	ListPayouts(ctx context.Context, walletId uuid.UUID) ([]entity.InterestPayout, error)
+	AccrueDue(ctx context.Context, limit int) (int, error)
+}
+
+// кредитные линии заводит администратор (AdminService.SetCreditLine), через API - только просмотр
+type CreditService interface {
+	GetLine(ctx context.Context, walletId uuid.UUID) (entity.CreditLine, error)
+	ListAccruals(ctx context.Context, walletId uuid.UUID, filter entity.InterestAccrualFilter) ([]entity.CreditAccrual, error)
+	ListCharges(ctx context.Context, walletId uuid.UUID) ([]entity.CreditCharge, error)
+	ListAlerts(ctx context.Context, walletId uuid.UUID) ([]entity.CreditAlert, error)
+	// AccrueDue - начисляет проценты и комиссию за закончившиеся дни с задолженностью, раз в месяц списывает их
+	AccrueDue(ctx context.Context, limit int) (int, error)
+	// CheckUtilization - уведомляет о пересечении порогов использования лимита
+	CheckUtilization(ctx context.Context, limit int) (int, error)
+}
+
+// споры открывает и решает поддержка через ewalletctl, через API участники перевода только смотрят их
+type DisputeService interface {
+	// OpenDispute - открывает спор от имени оператора actor и удерживает сумму у получателя
+	OpenDispute(ctx context.Context, actor string, d entity.Dispute) (entity.Dispute, error)
+	AddEvidence(ctx context.Context, actor string, id uuid.UUID, evidence []entity.DisputeEvidence) (entity.Dispute, error)
+	// ResolveDispute - favor sender возвращает удержанную сумму отправителю, recipient снимает удержание
+	ResolveDispute(ctx context.Context, actor string, id uuid.UUID, favor, note string) (entity.Dispute, error)
+	GetDispute(ctx context.Context, id uuid.UUID) (entity.Dispute, error)
+	ListDisputes(ctx context.Context, filter entity.DisputeFilter) ([]entity.Dispute, error)
+	// GetWalletDispute, ListWalletDisputes - споры, где кошелек отправитель или получатель
+	GetWalletDispute(ctx context.Context, walletId, id uuid.UUID) (entity.Dispute, error)
+	ListWalletDisputes(ctx context.Context, walletId uuid.UUID, status string) ([]entity.Dispute, error)
+	// ExpireDue - снимает удержание по спорам, не решенным до дедлайна
+	ExpireDue(ctx context.Context, limit int) (int, error)
+}
+
+// очередь переводов, отправленных антифрод-правилами на проверку; решения принимает оператор через ewalletctl
+type FraudService interface {
+	ListCases(ctx context.Context, filter entity.FraudCaseFilter) ([]entity.FraudCase, error)
+	GetCase(ctx context.Context, id uuid.UUID) (entity.FraudCase, error)
+	// ApproveCase - зачисляет удержанную сумму получателю
+	ApproveCase(ctx context.Context, actor string, id uuid.UUID, note string) (entity.FraudCase, error)
+	// RejectCase - возвращает удержанную сумму отправителю
+	RejectCase(ctx context.Context, actor string, id uuid.UUID, note string) (entity.FraudCase, error)
+}
+
+// Services - все сервисы для слоя представления; nil - сервис недоступен (например, с хранилищем в памяти)
+type Services struct {
+	Wallet            WalletService
+	ScheduledTransfer ScheduledTransferService
+	StandingOrder     StandingOrderService
+	BatchTransfer     BatchTransferService
+	Escrow            EscrowService
+	PaymentRequest    PaymentRequestService
+	Invoice           InvoiceService
+	Alias             AliasService
+	Pocket            PocketService
+	SavingsGoal       SavingsGoalService
+	Interest          InterestService
+	Credit            CreditService
+	Dispute           DisputeService
+	Fraud             FraudService
 }
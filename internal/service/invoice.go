@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	// максимальное кол-во позиций в счете
+	MaxInvoiceItems = 100
+	// максимальная длина reference и описания позиции
+	MaxInvoiceReferenceLength       = 64
+	MaxInvoiceItemDescriptionLength = 256
+)
+
+type invoiceServiceImpl struct {
+	walletService WalletService
+	repo          repository.InvoiceRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+	currency      string
+}
+
+// оплата идет через WalletService.Transfer, транзакция помечается источником invoice;
+// currency - валюта кошельков, счета в другой валюте не принимаются
+func NewInvoiceService(ws WalletService, repo repository.InvoiceRepo, transactor repository.Transactor, log *logrus.Logger, currency string) *invoiceServiceImpl {
+	return &invoiceServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+		currency:      strings.ToUpper(currency),
+	}
+}
+
+// CreateInvoice - из inv берутся Amount (нулевой - сумма позиций), Currency, DueAt, Reference и Items
+func (is *invoiceServiceImpl) CreateInvoice(ctx context.Context, merchant uuid.UUID, inv entity.Invoice) (entity.Invoice, error) {
+	inv.Merchant = merchant
+	inv.Currency = strings.ToUpper(inv.Currency)
+	inv.DueAt = inv.DueAt.UTC()
+	if inv.Amount == 0 && len(inv.Items) > 0 {
+		var units int64
+		for _, item := range inv.Items {
+			units += int64(item.Quantity) * toUnits(item.UnitPrice)
+		}
+		inv.Amount = float32(float64(units) / amountUnit)
+	}
+	if err := is.validate(inv, time.Now().UTC()); err != nil {
+		return entity.Invoice{}, err
+	}
+
+	inv, err := is.repo.CreateInvoice(ctx, inv)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.Invoice{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrInvoiceReferenceExists) {
+		return entity.Invoice{}, ErrInvoiceReferenceExists
+	}
+	return inv, err
+}
+
+// GetInvoice - публичное представление счета для ссылки на оплату, без списка плательщиков
+func (is *invoiceServiceImpl) GetInvoice(ctx context.Context, id uuid.UUID) (entity.Invoice, error) {
+	inv, err := is.repo.GetInvoice(ctx, id, false)
+	if errors.Is(err, repoerrors.ErrInvoiceNotFound) {
+		return entity.Invoice{}, ErrInvoiceNotFound
+	}
+	return inv, err
+}
+
+// GetMerchantInvoice - счет продавца вместе с оплатами
+func (is *invoiceServiceImpl) GetMerchantInvoice(ctx context.Context, merchant, id uuid.UUID) (entity.Invoice, error) {
+	inv, err := is.repo.GetInvoice(ctx, id, true)
+	if errors.Is(err, repoerrors.ErrInvoiceNotFound) || (err == nil && inv.Merchant != merchant) {
+		return entity.Invoice{}, ErrInvoiceNotFound
+	}
+	return inv, err
+}
+
+func (is *invoiceServiceImpl) ListInvoices(ctx context.Context, merchant uuid.UUID, filter entity.InvoiceFilter) ([]entity.Invoice, error) {
+	var fields []FieldError
+	switch filter.Status {
+	case "", entity.InvoiceOpen, entity.InvoicePartiallyPaid, entity.InvoicePaid, entity.InvoiceVoid, entity.InvoiceOverdue:
+	default:
+		fields = append(fields, FieldError{Field: "status", Message: "must be one of open, partially_paid, paid, void, overdue"})
+	}
+	if filter.DueFrom != nil && filter.DueTo != nil && !filter.DueTo.After(*filter.DueFrom) {
+		fields = append(fields, FieldError{Field: "dueTo", Message: "must be after dueFrom"})
+	}
+	if err := newValidationError(fields); err != nil {
+		return nil, err
+	}
+	return is.repo.ListInvoices(ctx, merchant, filter)
+}
+
+// PayInvoice - оплата счета с кошелька from; amount == 0 - весь остаток. Счет блокируется на время перевода,
+// поэтому одновременные оплаты не превысят сумму счета
+func (is *invoiceServiceImpl) PayInvoice(ctx context.Context, id, from uuid.UUID, amount float32) (entity.Invoice, error) {
+	ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: from.String(), "invoice_id": id.String()})
+
+	var inv entity.Invoice
+	var blocked error
+	err := is.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		inv, err = is.repo.LockInvoice(ctx, id)
+		if err != nil {
+			return err
+		}
+		if inv.Status == entity.InvoicePaid || inv.Status == entity.InvoiceVoid {
+			return ErrInvoiceNotPayable
+		}
+
+		remaining := toUnits(inv.Amount) - toUnits(inv.PaidAmount)
+		units := remaining
+		if amount != 0 {
+			units = toUnits(amount)
+		}
+		if err := validateInvoicePayment(inv, from, amount, units, remaining); err != nil {
+			return err
+		}
+
+		payment := float32(float64(units) / amountUnit)
+		ctx = withoutFraudHold(repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceInvoice, Id: inv.Id}))
+		err = is.walletService.Transfer(ctx, from, inv.Merchant, payment)
+		if errors.Is(err, ErrTransferBlocked) {
+			// транзакция фиксируется, чтобы заблокированный перевод остался в очереди; счет не меняется
+			blocked = err
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		paid := toUnits(inv.PaidAmount) + units
+		inv.PaidAmount = float32(float64(paid) / amountUnit)
+		switch {
+		case paid == toUnits(inv.Amount):
+			inv.Status = entity.InvoicePaid
+			inv.PaidAt = &now
+		case inv.Status == entity.InvoiceOverdue || !inv.DueAt.After(now):
+			inv.Status = entity.InvoiceOverdue
+		default:
+			inv.Status = entity.InvoicePartiallyPaid
+		}
+		return is.repo.UpdateInvoiceState(ctx, inv)
+	})
+	if errors.Is(err, repoerrors.ErrInvoiceNotFound) {
+		return entity.Invoice{}, ErrInvoiceNotFound
+	}
+	if err == nil {
+		err = blocked
+	}
+	if err != nil {
+		return entity.Invoice{}, err
+	}
+	return inv, nil
+}
+
+// VoidInvoice - продавец аннулирует счет; счет с оплатами аннулировать нельзя - деньги уже у продавца
+func (is *invoiceServiceImpl) VoidInvoice(ctx context.Context, merchant, id uuid.UUID) (entity.Invoice, error) {
+	var inv entity.Invoice
+	err := is.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		inv, err = is.repo.LockInvoice(ctx, id)
+		if err != nil {
+			return err
+		}
+		if inv.Merchant != merchant {
+			return repoerrors.ErrInvoiceNotFound
+		}
+		if (inv.Status != entity.InvoiceOpen && inv.Status != entity.InvoiceOverdue) || inv.PaidAmount > 0 {
+			return ErrInvoiceNotVoidable
+		}
+
+		now := time.Now().UTC()
+		inv.Status = entity.InvoiceVoid
+		inv.VoidedAt = &now
+		return is.repo.UpdateInvoiceState(ctx, inv)
+	})
+	if errors.Is(err, repoerrors.ErrInvoiceNotFound) {
+		return entity.Invoice{}, ErrInvoiceNotFound
+	}
+	if err != nil {
+		return entity.Invoice{}, err
+	}
+	return inv, nil
+}
+
+// MarkOverdue - помечает просроченными до limit неоплаченных счетов; возвращает, сколько помечено
+func (is *invoiceServiceImpl) MarkOverdue(ctx context.Context, limit int) (int, error) {
+	n, err := is.repo.MarkOverdueInvoices(ctx, time.Now().UTC(), limit)
+	if err != nil {
+		logger.FromContext(ctx, is.log).WithError(err).Error("invoiceServiceImpl.MarkOverdue - repo.MarkOverdueInvoices")
+		return 0, err
+	}
+	return n, nil
+}
+
+func (is *invoiceServiceImpl) validate(inv entity.Invoice, now time.Time) error {
+	var fields []FieldError
+
+	if msg := validateAmount(inv.Amount); msg != "" {
+		fields = append(fields, FieldError{Field: "amount", Message: msg})
+	}
+	if inv.Currency != is.currency {
+		fields = append(fields, FieldError{Field: "currency", Message: "must be " + is.currency})
+	}
+
+	switch {
+	case inv.DueAt.IsZero():
+		fields = append(fields, FieldError{Field: "dueAt", Message: "is required"})
+	case !inv.DueAt.After(now):
+		fields = append(fields, FieldError{Field: "dueAt", Message: "must be in the future"})
+	case inv.DueAt.After(now.Add(MaxScheduleAhead)):
+		fields = append(fields, FieldError{Field: "dueAt", Message: "must be within a year"})
+	}
+
+	if len([]rune(inv.Reference)) > MaxInvoiceReferenceLength {
+		fields = append(fields, FieldError{Field: "reference", Message: "must be at most " + strconv.Itoa(MaxInvoiceReferenceLength) + " characters"})
+	}
+
+	if len(inv.Items) > MaxInvoiceItems {
+		fields = append(fields, FieldError{Field: "items", Message: "must contain at most " + strconv.Itoa(MaxInvoiceItems) + " items"})
+		return newValidationError(fields)
+	}
+	var total int64
+	for i, item := range inv.Items {
+		switch n := len([]rune(item.Description)); {
+		case n == 0:
+			fields = append(fields, FieldError{Field: fmt.Sprintf("items[%d].description", i), Message: "is required"})
+		case n > MaxInvoiceItemDescriptionLength:
+			fields = append(fields, FieldError{Field: fmt.Sprintf("items[%d].description", i), Message: "must be at most " + strconv.Itoa(MaxInvoiceItemDescriptionLength) + " characters"})
+		}
+		if item.Quantity <= 0 {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("items[%d].quantity", i), Message: "must be positive"})
+		}
+		if msg := validateAmount(item.UnitPrice); msg != "" {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("items[%d].unitPrice", i), Message: msg})
+		}
+		total += int64(item.Quantity) * toUnits(item.UnitPrice)
+	}
+	// позиции, если есть, должны в точности давать сумму счета
+	if len(inv.Items) > 0 && len(fields) == 0 && total != toUnits(inv.Amount) {
+		fields = append(fields, FieldError{Field: "amount", Message: "must equal the sum of items"})
+	}
+
+	return newValidationError(fields)
+}
+
+// переплата отклоняется: сумма оплаты не больше остатка счета
+func validateInvoicePayment(inv entity.Invoice, from uuid.UUID, amount float32, units, remaining int64) error {
+	var fields []FieldError
+
+	if from == inv.Merchant {
+		fields = append(fields, FieldError{Field: "from", Message: "must differ from the merchant wallet"})
+	}
+	if amount != 0 {
+		if msg := validateAmount(amount); msg != "" {
+			fields = append(fields, FieldError{Field: "amount", Message: msg})
+		} else if units > remaining {
+			remainingAmount := strconv.FormatFloat(float64(remaining)/amountUnit, 'f', -1, 64)
+			fields = append(fields, FieldError{Field: "amount", Message: "must not exceed the remaining " + remainingAmount})
+		}
+	}
+
+	return newValidationError(fields)
+}
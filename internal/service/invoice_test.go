@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newInvoiceEnv(t *testing.T) (pgEnv, *invoiceServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	return env, NewInvoiceService(env.ws, repository.NewInvoiceRepo(env.pg, discardLogger()), env.transactor, discardLogger(), "RUB")
+}
+
+func createInvoice(t *testing.T, is *invoiceServiceImpl, merchant uuid.UUID) entity.Invoice {
+	t.Helper()
+	// сумма счета - из позиций: 2 * 15.5 + 29 = 60
+	inv, err := is.CreateInvoice(context.Background(), merchant, entity.Invoice{
+		Currency: "rub",
+		DueAt:    time.Now().Add(24 * time.Hour),
+		Items: []entity.InvoiceItem{
+			{Description: "coffee", Quantity: 2, UnitPrice: 15.5},
+			{Description: "cake", Quantity: 1, UnitPrice: 29},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateInvoice: %v", err)
+	}
+	return inv
+}
+
+// счет оплачивается частями с разных кошельков; переплата отклоняется, оплаченный счет больше не принимает оплат
+func TestInvoicePartialPaymentsPostgres(t *testing.T) {
+	env, is := newInvoiceEnv(t)
+	ctx := context.Background()
+	merchant, first, second := env.wallet(t), env.wallet(t), env.wallet(t)
+
+	inv := createInvoice(t, is, merchant)
+	if inv.Amount != 60 || inv.Status != entity.InvoiceOpen || inv.Currency != "RUB" {
+		t.Fatalf("CreateInvoice: got %+v, want an open invoice for 60 RUB", inv)
+	}
+
+	inv, err := is.PayInvoice(ctx, inv.Id, first, 20.25)
+	if err != nil {
+		t.Fatalf("PayInvoice: %v", err)
+	}
+	if inv.Status != entity.InvoicePartiallyPaid || inv.PaidAmount != 20.25 || inv.PaidAt != nil {
+		t.Errorf("after partial payment: got %+v, want partially_paid for 20.25", inv)
+	}
+
+	// переплата - ошибка валидации, счет и балансы не меняются
+	var validationErr *ValidationError
+	if _, err := is.PayInvoice(ctx, inv.Id, second, 40); !errors.As(err, &validationErr) {
+		t.Errorf("overpayment: got %v, want a validation error", err)
+	}
+
+	// нулевая сумма - весь остаток
+	inv, err = is.PayInvoice(ctx, inv.Id, second, 0)
+	if err != nil {
+		t.Fatalf("PayInvoice: %v", err)
+	}
+	if inv.Status != entity.InvoicePaid || inv.PaidAmount != 60 || inv.PaidAt == nil {
+		t.Errorf("after full payment: got %+v, want paid", inv)
+	}
+	if _, err := is.PayInvoice(ctx, inv.Id, second, 0); !errors.Is(err, ErrInvoiceNotPayable) {
+		t.Errorf("payment of a paid invoice: got %v, want %v", err, ErrInvoiceNotPayable)
+	}
+
+	env.assertBalance(t, first, repository.InitialWalletBalance-20.25)
+	env.assertBalance(t, second, repository.InitialWalletBalance-39.75)
+	env.assertBalance(t, merchant, repository.InitialWalletBalance+60)
+
+	got, err := is.GetMerchantInvoice(ctx, merchant, inv.Id)
+	if err != nil {
+		t.Fatalf("GetMerchantInvoice: %v", err)
+	}
+	if len(got.Payments) != 2 || got.Payments[0].From != first || got.Payments[1].From != second {
+		t.Errorf("payments = %+v, want one from each payer", got.Payments)
+	}
+	if _, err := is.GetMerchantInvoice(ctx, first, inv.Id); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Errorf("GetMerchantInvoice by a payer: got %v, want %v", err, ErrInvoiceNotFound)
+	}
+}
+
+// одновременные оплаты всего остатка: счет блокируется, проходит ровно одна
+func TestInvoiceConcurrentPaymentsPostgres(t *testing.T) {
+	const workers = 5
+	env, is := newInvoiceEnv(t)
+	ctx := context.Background()
+	merchant := env.wallet(t)
+	inv := createInvoice(t, is, merchant)
+
+	payers := make([]uuid.UUID, workers)
+	for i := range payers {
+		payers[i] = env.wallet(t)
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	paid := 0
+	for _, payer := range payers {
+		wg.Add(1)
+		go func(payer uuid.UUID) {
+			defer wg.Done()
+			_, err := is.PayInvoice(ctx, inv.Id, payer, 0)
+			switch {
+			case err == nil:
+				mu.Lock()
+				paid++
+				mu.Unlock()
+			case !errors.Is(err, ErrInvoiceNotPayable):
+				t.Errorf("PayInvoice: %v", err)
+			}
+		}(payer)
+	}
+	wg.Wait()
+
+	if paid != 1 {
+		t.Errorf("got %d successful payments, want 1", paid)
+	}
+	env.assertBalance(t, merchant, repository.InitialWalletBalance+60)
+}
+
+// аннулировать можно только счет без оплат; аннулированный счет не оплачивается
+func TestInvoiceVoidPostgres(t *testing.T) {
+	env, is := newInvoiceEnv(t)
+	ctx := context.Background()
+	merchant, payer := env.wallet(t), env.wallet(t)
+
+	partial := createInvoice(t, is, merchant)
+	if _, err := is.PayInvoice(ctx, partial.Id, payer, 10); err != nil {
+		t.Fatalf("PayInvoice: %v", err)
+	}
+	if _, err := is.VoidInvoice(ctx, merchant, partial.Id); !errors.Is(err, ErrInvoiceNotVoidable) {
+		t.Errorf("void with payments: got %v, want %v", err, ErrInvoiceNotVoidable)
+	}
+
+	inv := createInvoice(t, is, merchant)
+	if _, err := is.VoidInvoice(ctx, payer, inv.Id); !errors.Is(err, ErrInvoiceNotFound) {
+		t.Errorf("void by a payer: got %v, want %v", err, ErrInvoiceNotFound)
+	}
+	voided, err := is.VoidInvoice(ctx, merchant, inv.Id)
+	if err != nil {
+		t.Fatalf("VoidInvoice: %v", err)
+	}
+	if voided.Status != entity.InvoiceVoid || voided.VoidedAt == nil {
+		t.Errorf("voided: got %+v, want void", voided)
+	}
+	if _, err := is.PayInvoice(ctx, inv.Id, payer, 0); !errors.Is(err, ErrInvoiceNotPayable) {
+		t.Errorf("payment of a void invoice: got %v, want %v", err, ErrInvoiceNotPayable)
+	}
+	env.assertBalance(t, payer, repository.InitialWalletBalance-10)
+}
@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	// максимальный срок жизни запроса денег
+	MaxPaymentRequestTTL = 30 * 24 * time.Hour
+	// максимальная длина комментария к запросу
+	MaxPaymentRequestMemoLength = 256
+)
+
+type paymentRequestServiceImpl struct {
+	walletService WalletService
+	repo          repository.PaymentRequestRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+	defaultTTL    time.Duration
+}
+
+// оплата идет через WalletService.Transfer, транзакция помечается источником payment_request;
+// defaultTTL - срок жизни запроса, если expiresAt не передан
+func NewPaymentRequestService(ws WalletService, repo repository.PaymentRequestRepo, transactor repository.Transactor, log *logrus.Logger, defaultTTL time.Duration) *paymentRequestServiceImpl {
+	return &paymentRequestServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+		defaultTTL:    defaultTTL,
+	}
+}
+
+// CreatePaymentRequest - requester просит payer перевести amount; нулевой expiresAt - через defaultTTL
+func (ps *paymentRequestServiceImpl) CreatePaymentRequest(ctx context.Context, requester, payer uuid.UUID, amount float32, memo string, expiresAt time.Time) (entity.PaymentRequest, error) {
+	now := time.Now().UTC()
+	if expiresAt.IsZero() {
+		expiresAt = now.Add(ps.defaultTTL)
+	}
+	if err := validatePaymentRequest(requester, payer, amount, memo, expiresAt, now); err != nil {
+		return entity.PaymentRequest{}, err
+	}
+
+	req, err := ps.repo.CreatePaymentRequest(ctx, entity.PaymentRequest{
+		Requester: requester,
+		Payer:     payer,
+		Amount:    amount,
+		Memo:      memo,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.PaymentRequest{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrTargetWalletNotFound) {
+		return entity.PaymentRequest{}, ErrTargetWalletNotFound
+	}
+	return req, err
+}
+
+func (ps *paymentRequestServiceImpl) GetPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error) {
+	req, err := ps.repo.GetPaymentRequest(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrPaymentRequestNotFound) {
+		return entity.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	return req, err
+}
+
+func (ps *paymentRequestServiceImpl) ListPaymentRequests(ctx context.Context, walletId uuid.UUID, direction, status string) ([]entity.PaymentRequest, error) {
+	var fields []FieldError
+	switch direction {
+	case "", entity.PaymentRequestsIncoming, entity.PaymentRequestsOutgoing:
+	default:
+		fields = append(fields, FieldError{Field: "direction", Message: "must be one of incoming, outgoing"})
+	}
+	switch status {
+	case "", entity.PaymentRequestPending, entity.PaymentRequestPaid, entity.PaymentRequestDeclined, entity.PaymentRequestExpired:
+	default:
+		fields = append(fields, FieldError{Field: "status", Message: "must be one of pending, paid, declined, expired"})
+	}
+	if err := newValidationError(fields); err != nil {
+		return nil, err
+	}
+	return ps.repo.ListPaymentRequests(ctx, walletId, direction, status)
+}
+
+// AcceptPaymentRequest - плательщик оплачивает запрос. Запрос блокируется на время перевода, поэтому
+// параллельные оплаты выполняются по очереди; повторная оплата уже оплаченного запроса перевода не делает и возвращает запрос
+func (ps *paymentRequestServiceImpl) AcceptPaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error) {
+	ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: walletId.String(), "payment_request_id": id.String()})
+
+	var req entity.PaymentRequest
+	var blocked error
+	err := ps.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		req, err = ps.lockAsPayer(ctx, walletId, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		switch {
+		case req.Status == entity.PaymentRequestPaid:
+			return nil
+		case req.Status != entity.PaymentRequestPending:
+			return ErrPaymentRequestNotPending
+		case !req.ExpiresAt.After(now):
+			// воркер еще не успел пометить запрос - для плательщика он уже истек
+			return ErrPaymentRequestNotPending
+		}
+
+		ctx = withoutFraudHold(repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourcePaymentRequest, Id: req.Id}))
+		err = ps.walletService.Transfer(ctx, req.Payer, req.Requester, req.Amount)
+		if errors.Is(err, ErrTransferBlocked) {
+			// транзакция фиксируется, чтобы заблокированный перевод остался в очереди; запрос остается pending
+			blocked = err
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ps.repo.ResolvePaymentRequest(ctx, req.Id, entity.PaymentRequestPaid, now); err != nil {
+			return err
+		}
+		req.Status = entity.PaymentRequestPaid
+		req.ResolvedAt = &now
+		return nil
+	})
+	if errors.Is(err, repoerrors.ErrPaymentRequestNotFound) {
+		return entity.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	if err == nil {
+		err = blocked
+	}
+	if err != nil {
+		return entity.PaymentRequest{}, err
+	}
+	return req, nil
+}
+
+// DeclinePaymentRequest - плательщик отклоняет ожидающий запрос
+func (ps *paymentRequestServiceImpl) DeclinePaymentRequest(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error) {
+	var req entity.PaymentRequest
+	err := ps.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		req, err = ps.lockAsPayer(ctx, walletId, id)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		if req.Status != entity.PaymentRequestPending || !req.ExpiresAt.After(now) {
+			return ErrPaymentRequestNotPending
+		}
+		if err := ps.repo.ResolvePaymentRequest(ctx, req.Id, entity.PaymentRequestDeclined, now); err != nil {
+			return err
+		}
+		req.Status = entity.PaymentRequestDeclined
+		req.ResolvedAt = &now
+		return nil
+	})
+	if errors.Is(err, repoerrors.ErrPaymentRequestNotFound) {
+		return entity.PaymentRequest{}, ErrPaymentRequestNotFound
+	}
+	if err != nil {
+		return entity.PaymentRequest{}, err
+	}
+	return req, nil
+}
+
+// оплатить или отклонить запрос может только плательщик; для постороннего кошелька запроса нет
+func (ps *paymentRequestServiceImpl) lockAsPayer(ctx context.Context, walletId, id uuid.UUID) (entity.PaymentRequest, error) {
+	req, err := ps.repo.LockPaymentRequest(ctx, id)
+	if err != nil {
+		return entity.PaymentRequest{}, err
+	}
+	switch walletId {
+	case req.Payer:
+		return req, nil
+	case req.Requester:
+		return entity.PaymentRequest{}, ErrPaymentRequestActionNotAllowed
+	default:
+		return entity.PaymentRequest{}, repoerrors.ErrPaymentRequestNotFound
+	}
+}
+
+// ExpireDue - помечает истекшими до limit ожидающих запросов; возвращает, сколько помечено
+func (ps *paymentRequestServiceImpl) ExpireDue(ctx context.Context, limit int) (int, error) {
+	n, err := ps.repo.ExpirePaymentRequests(ctx, time.Now().UTC(), limit)
+	if err != nil {
+		logger.FromContext(ctx, ps.log).WithError(err).Error("paymentRequestServiceImpl.ExpireDue - repo.ExpirePaymentRequests")
+		return 0, err
+	}
+	return n, nil
+}
+
+func validatePaymentRequest(requester, payer uuid.UUID, amount float32, memo string, expiresAt, now time.Time) error {
+	var fields []FieldError
+
+	if payer == uuid.Nil {
+		fields = append(fields, FieldError{Field: "payer", Message: "must be a non-zero wallet id"})
+	} else if payer == requester {
+		fields = append(fields, FieldError{Field: "payer", Message: "must differ from the requesting wallet"})
+	}
+
+	if msg := validateAmount(amount); msg != "" {
+		fields = append(fields, FieldError{Field: "amount", Message: msg})
+	}
+
+	if len([]rune(memo)) > MaxPaymentRequestMemoLength {
+		fields = append(fields, FieldError{Field: "memo", Message: "must be at most 256 characters"})
+	}
+
+	switch {
+	case !expiresAt.After(now):
+		fields = append(fields, FieldError{Field: "expiresAt", Message: "must be in the future"})
+	case expiresAt.After(now.Add(MaxPaymentRequestTTL)):
+		fields = append(fields, FieldError{Field: "expiresAt", Message: "must be within 30 days"})
+	}
+
+	return newValidationError(fields)
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newPaymentRequestEnv(t *testing.T) (pgEnv, repository.PaymentRequestRepo, *paymentRequestServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	repo := repository.NewPaymentRequestRepo(env.pg, discardLogger())
+	return env, repo, NewPaymentRequestService(env.ws, repo, env.transactor, discardLogger(), time.Hour)
+}
+
+// повторная и одновременная оплата переводят деньги один раз и возвращают оплаченный запрос
+func TestPaymentRequestAcceptIdempotentPostgres(t *testing.T) {
+	const workers = 5
+	env, _, ps := newPaymentRequestEnv(t)
+	ctx := context.Background()
+	requester, payer := env.wallet(t), env.wallet(t)
+
+	req, err := ps.CreatePaymentRequest(ctx, requester, payer, 30, "dinner", time.Time{})
+	if err != nil {
+		t.Fatalf("CreatePaymentRequest: %v", err)
+	}
+	if req.Status != entity.PaymentRequestPending {
+		t.Errorf("status = %q, want %q", req.Status, entity.PaymentRequestPending)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := ps.AcceptPaymentRequest(ctx, payer, req.Id)
+			if err != nil {
+				t.Errorf("AcceptPaymentRequest: %v", err)
+				return
+			}
+			if got.Status != entity.PaymentRequestPaid {
+				t.Errorf("AcceptPaymentRequest: got status %q, want %q", got.Status, entity.PaymentRequestPaid)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := ps.AcceptPaymentRequest(ctx, payer, req.Id); err != nil {
+		t.Errorf("repeated AcceptPaymentRequest: %v", err)
+	}
+	env.assertBalance(t, payer, repository.InitialWalletBalance-30)
+	env.assertBalance(t, requester, repository.InitialWalletBalance+30)
+
+	// оплаченный запрос уже не отклонить
+	if _, err := ps.DeclinePaymentRequest(ctx, payer, req.Id); !errors.Is(err, ErrPaymentRequestNotPending) {
+		t.Errorf("DeclinePaymentRequest: got %v, want %v", err, ErrPaymentRequestNotPending)
+	}
+}
+
+func TestPaymentRequestAcceptErrorsPostgres(t *testing.T) {
+	env, _, ps := newPaymentRequestEnv(t)
+	ctx := context.Background()
+	requester, payer, stranger := env.wallet(t), env.wallet(t), env.wallet(t)
+
+	req, err := ps.CreatePaymentRequest(ctx, requester, payer, repository.InitialWalletBalance+1, "", time.Time{})
+	if err != nil {
+		t.Fatalf("CreatePaymentRequest: %v", err)
+	}
+
+	if _, err := ps.AcceptPaymentRequest(ctx, requester, req.Id); !errors.Is(err, ErrPaymentRequestActionNotAllowed) {
+		t.Errorf("accept by requester: got %v, want %v", err, ErrPaymentRequestActionNotAllowed)
+	}
+	if _, err := ps.AcceptPaymentRequest(ctx, stranger, req.Id); !errors.Is(err, ErrPaymentRequestNotFound) {
+		t.Errorf("accept by stranger: got %v, want %v", err, ErrPaymentRequestNotFound)
+	}
+
+	// неудачный перевод откатывает оплату - запрос остается pending, его можно отклонить
+	if _, err := ps.AcceptPaymentRequest(ctx, payer, req.Id); !errors.Is(err, ErrNotEnoughBalance) {
+		t.Errorf("accept without balance: got %v, want %v", err, ErrNotEnoughBalance)
+	}
+	declined, err := ps.DeclinePaymentRequest(ctx, payer, req.Id)
+	if err != nil {
+		t.Fatalf("DeclinePaymentRequest: %v", err)
+	}
+	if declined.Status != entity.PaymentRequestDeclined || declined.ResolvedAt == nil {
+		t.Errorf("declined: got %+v, want declined", declined)
+	}
+	if _, err := ps.AcceptPaymentRequest(ctx, payer, req.Id); !errors.Is(err, ErrPaymentRequestNotPending) {
+		t.Errorf("accept after decline: got %v, want %v", err, ErrPaymentRequestNotPending)
+	}
+	env.assertBalance(t, payer, repository.InitialWalletBalance)
+	env.assertBalance(t, requester, repository.InitialWalletBalance)
+}
+
+func TestPaymentRequestExpirePostgres(t *testing.T) {
+	env, repo, ps := newPaymentRequestEnv(t)
+	ctx := context.Background()
+	requester, payer := env.wallet(t), env.wallet(t)
+
+	// истекший запрос сохраняется напрямую через репозиторий: сервис принимает только будущий срок
+	expired, err := repo.CreatePaymentRequest(ctx, entity.PaymentRequest{
+		Requester: requester, Payer: payer, Amount: 10, ExpiresAt: time.Now().UTC().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreatePaymentRequest: %v", err)
+	}
+	active, err := ps.CreatePaymentRequest(ctx, requester, payer, 10, "", time.Time{})
+	if err != nil {
+		t.Fatalf("CreatePaymentRequest: %v", err)
+	}
+
+	// пока воркер не пометил запрос, оплатить его уже нельзя
+	if _, err := ps.AcceptPaymentRequest(ctx, payer, expired.Id); !errors.Is(err, ErrPaymentRequestNotPending) {
+		t.Errorf("accept expired: got %v, want %v", err, ErrPaymentRequestNotPending)
+	}
+
+	if n, err := ps.ExpireDue(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("ExpireDue: got %d, %v, want 1 expired", n, err)
+	}
+	got, err := ps.GetPaymentRequest(ctx, requester, expired.Id)
+	if err != nil {
+		t.Fatalf("GetPaymentRequest: %v", err)
+	}
+	if got.Status != entity.PaymentRequestExpired {
+		t.Errorf("expired request: status = %q, want %q", got.Status, entity.PaymentRequestExpired)
+	}
+	if got, err := ps.GetPaymentRequest(ctx, payer, active.Id); err != nil || got.Status != entity.PaymentRequestPending {
+		t.Errorf("active request: got %+v, %v, want pending", got, err)
+	}
+	env.assertBalance(t, payer, repository.InitialWalletBalance)
+}
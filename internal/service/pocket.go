@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PocketPolicy - ограничения на карманы кошельков
+type PocketPolicy struct {
+	// максимальное кол-во открытых карманов у кошелька
+	MaxPerWallet int
+	// true - из кармана можно переводить только родителю и в соседние карманы
+	RestrictExternalTransfers bool
+}
+
+// pocketRule - проверка переводов из карманов по PocketPolicy.RestrictExternalTransfers;
+// родитель кошелька не меняется, поэтому проверка вне транзакции перевода не устаревает
+type pocketRule struct {
+	wallets  repository.WalletRepo
+	restrict bool
+}
+
+func newPocketRule(wallets repository.WalletRepo, policy PocketPolicy) pocketRule {
+	return pocketRule{wallets: wallets, restrict: policy.RestrictExternalTransfers}
+}
+
+// check - ErrPocketTransferNotAllowed, если from - карман, а среди получателей есть кошелек вне его семьи;
+// о ненайденных кошельках сообщит сам перевод
+func (r pocketRule) check(ctx context.Context, from uuid.UUID, to ...uuid.UUID) error {
+	if !r.restrict {
+		return nil
+	}
+	source, err := r.wallets.GetWalletStatus(ctx, from)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if source.ParentId == nil {
+		return nil
+	}
+
+	for _, id := range to {
+		if id == *source.ParentId {
+			continue
+		}
+		target, err := r.wallets.GetWalletStatus(ctx, id)
+		if errors.Is(err, repoerrors.ErrWalletNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if target.ParentId == nil || *target.ParentId != *source.ParentId {
+			return ErrPocketTransferNotAllowed
+		}
+	}
+	return nil
+}
+
+type pocketServiceImpl struct {
+	walletRepo    repository.WalletRepo
+	walletService WalletService
+	log           *logrus.Logger
+	maxPerWallet  int
+}
+
+// перемещения между кошельком и карманами - обычные переводы через walletService с источником pocket
+func NewPocketService(wr repository.WalletRepo, ws WalletService, log *logrus.Logger, policy PocketPolicy) *pocketServiceImpl {
+	return &pocketServiceImpl{
+		walletRepo:    wr,
+		walletService: ws,
+		log:           log,
+		maxPerWallet:  policy.MaxPerWallet,
+	}
+}
+
+func (ps *pocketServiceImpl) CreatePocket(ctx context.Context, parentId uuid.UUID, info entity.WalletInfo) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "pocketService.CreatePocket", trace.WithAttributes(attrWalletId.String(parentId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	if err := validateWalletInfo(info); err != nil {
+		return entity.Wallet{}, err
+	}
+	pocket, err := ps.walletRepo.CreatePocket(ctx, parentId, info, ps.maxPerWallet)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.Wallet{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrNestedPocket) {
+		return entity.Wallet{}, ErrNestedPocket
+	}
+	if errors.Is(err, repoerrors.ErrTooManyPockets) {
+		return entity.Wallet{}, ErrTooManyPockets
+	}
+	if err != nil {
+		logger.FromContext(ctx, ps.log).WithError(err).Error("pocketServiceImpl.CreatePocket - walletRepo.CreatePocket")
+		return entity.Wallet{}, err
+	}
+	return pocket, nil
+}
+
+func (ps *pocketServiceImpl) ListPockets(ctx context.Context, parentId uuid.UUID) (_ []entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "pocketService.ListPockets", trace.WithAttributes(attrWalletId.String(parentId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	if _, err := ps.walletRepo.GetWalletStatus(ctx, parentId); err != nil {
+		if errors.Is(err, repoerrors.ErrWalletNotFound) {
+			return nil, ErrWalletNotFound
+		}
+		return nil, err
+	}
+	return ps.walletRepo.ListPockets(ctx, parentId)
+}
+
+// Deposit - перемещение amount с кошелька в его карман
+func (ps *pocketServiceImpl) Deposit(ctx context.Context, parentId, pocketId uuid.UUID, amount float32) (entity.Wallet, error) {
+	return ps.move(ctx, parentId, pocketId, parentId, pocketId, amount)
+}
+
+// Withdraw - перемещение amount из кармана обратно в кошелек
+func (ps *pocketServiceImpl) Withdraw(ctx context.Context, parentId, pocketId uuid.UUID, amount float32) (entity.Wallet, error) {
+	return ps.move(ctx, parentId, pocketId, pocketId, parentId, amount)
+}
+
+// move - перевод между кошельком и карманом; возвращает карман после перевода
+func (ps *pocketServiceImpl) move(ctx context.Context, parentId, pocketId, from, to uuid.UUID, amount float32) (entity.Wallet, error) {
+	if _, err := ps.pocket(ctx, parentId, pocketId); err != nil {
+		return entity.Wallet{}, err
+	}
+	if msg := validateAmount(amount); msg != "" {
+		return entity.Wallet{}, newValidationError([]FieldError{{Field: "amount", Message: msg}})
+	}
+
+	ctx = repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourcePocket, Id: pocketId})
+	if err := ps.walletService.Transfer(ctx, from, to, amount); err != nil {
+		return entity.Wallet{}, err
+	}
+	return ps.pocket(ctx, parentId, pocketId)
+}
+
+// ClosePocket - остаток кармана переводится в кошелек, карман закрывается; повторное закрытие ничего не меняет
+func (ps *pocketServiceImpl) ClosePocket(ctx context.Context, parentId, pocketId uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "pocketService.ClosePocket", trace.WithAttributes(attrWalletId.String(parentId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	pocket, err := ps.walletRepo.ClosePocket(ctx, parentId, pocketId)
+	if errors.Is(err, repoerrors.ErrPocketNotFound) {
+		return entity.Wallet{}, ErrPocketNotFound
+	}
+	if err != nil {
+		err = transferError(err)
+		if !errors.Is(err, ErrWalletFrozen) && !errors.Is(err, ErrTargetWalletFrozen) {
+			logger.FromContext(ctx, ps.log).WithError(err).Error("pocketServiceImpl.ClosePocket - walletRepo.ClosePocket")
+		}
+		return entity.Wallet{}, err
+	}
+	return pocket, nil
+}
+
+// SetRoundUp - сдача исходящих переводов кошелька до целой единицы уходит в карман pocketId; nil - выключить
+func (ps *pocketServiceImpl) SetRoundUp(ctx context.Context, walletId uuid.UUID, pocketId *uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "pocketService.SetRoundUp", trace.WithAttributes(attrWalletId.String(walletId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	wallet, err := ps.walletRepo.SetRoundUp(ctx, walletId, pocketId)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.Wallet{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrPocketNotFound) {
+		return entity.Wallet{}, ErrPocketNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, ps.log).WithError(err).Error("pocketServiceImpl.SetRoundUp - walletRepo.SetRoundUp")
+		return entity.Wallet{}, err
+	}
+	return wallet, nil
+}
+
+// открытый карман pocketId кошелька parentId
+func (ps *pocketServiceImpl) pocket(ctx context.Context, parentId, pocketId uuid.UUID) (entity.Wallet, error) {
+	pocket, err := ps.walletRepo.GetWalletStatus(ctx, pocketId)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.Wallet{}, ErrPocketNotFound
+	}
+	if err != nil {
+		return entity.Wallet{}, err
+	}
+	if pocket.ParentId == nil || *pocket.ParentId != parentId {
+		return entity.Wallet{}, ErrPocketNotFound
+	}
+	if pocket.ClosedAt != nil {
+		return entity.Wallet{}, ErrPocketClosed
+	}
+	return pocket, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/pgtest"
+	"github.com/timohahaa/postgres"
+)
+
+// pgEnv - сервисы поверх postgres-репозиториев в собственной схеме (pgtest); без PG_URL тест пропускается
+type pgEnv struct {
+	pg         *postgres.Postgres
+	wallets    repository.WalletRepo
+	transactor repository.Transactor
+	ws         *walletServiceImpl
+}
+
+func newPgEnv(t *testing.T) pgEnv {
+	t.Helper()
+	pg := pgtest.New(t)
+	wallets := repository.NewWalletRepo(pg, discardLogger())
+	return pgEnv{
+		pg:         pg,
+		wallets:    wallets,
+		transactor: repository.NewTransactor(pg),
+		ws:         NewWalletService(wallets, discardLogger(), nil, TransferDetailsPolicy{}, PocketPolicy{}, nil),
+	}
+}
+
+// wallet - новый кошелек с начальным балансом
+func (e pgEnv) wallet(t *testing.T) uuid.UUID {
+	t.Helper()
+	w, err := e.wallets.CreateWallet(context.Background(), entity.WalletInfo{})
+	if err != nil {
+		t.Fatalf("CreateWallet: %v", err)
+	}
+	return w.Id
+}
+
+func (e pgEnv) assertBalance(t *testing.T, walletId uuid.UUID, want float32) {
+	t.Helper()
+	w, err := e.wallets.GetWalletStatus(context.Background(), walletId)
+	if err != nil {
+		t.Fatalf("GetWalletStatus: %v", err)
+	}
+	if math.Abs(float64(w.Balance-want)) > 1e-3 {
+		t.Errorf("balance of %s = %v, want %v", walletId, w.Balance, want)
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const day = 24 * time.Hour
+
+type savingsGoalServiceImpl struct {
+	repo repository.SavingsGoalRepo
+	log  *logrus.Logger
+}
+
+func NewSavingsGoalService(repo repository.SavingsGoalRepo, log *logrus.Logger) *savingsGoalServiceImpl {
+	return &savingsGoalServiceImpl{
+		repo: repo,
+		log:  log,
+	}
+}
+
+// SetGoal - цель кармана: сумма и (необязательно) день, не раньше сегодняшнего по UTC; заменяет прежнюю цель
+func (gs *savingsGoalServiceImpl) SetGoal(ctx context.Context, walletId, pocketId uuid.UUID, targetAmount float32, targetDate *time.Time) (entity.SavingsGoal, error) {
+	now := time.Now().UTC()
+	var fields []FieldError
+	if msg := validateAmount(targetAmount); msg != "" {
+		fields = append(fields, FieldError{Field: "targetAmount", Message: msg})
+	}
+	if targetDate != nil {
+		date := targetDate.UTC().Truncate(day)
+		if date.Before(now.Truncate(day)) {
+			fields = append(fields, FieldError{Field: "targetDate", Message: "must not be in the past"})
+		}
+		targetDate = &date
+	}
+	if err := newValidationError(fields); err != nil {
+		return entity.SavingsGoal{}, err
+	}
+
+	goal, err := gs.repo.SetSavingsGoal(ctx, entity.SavingsGoal{
+		PocketId:     pocketId,
+		WalletId:     walletId,
+		TargetAmount: targetAmount,
+		TargetDate:   targetDate,
+	})
+	if errors.Is(err, repoerrors.ErrPocketNotFound) {
+		return entity.SavingsGoal{}, ErrPocketNotFound
+	}
+	if err != nil {
+		logger.FromContext(ctx, gs.log).WithError(err).Error("savingsGoalServiceImpl.SetGoal - repo.SetSavingsGoal")
+		return entity.SavingsGoal{}, err
+	}
+	return withProgress(goal, now), nil
+}
+
+func (gs *savingsGoalServiceImpl) GetGoal(ctx context.Context, walletId, pocketId uuid.UUID) (entity.SavingsGoal, error) {
+	goal, err := gs.repo.GetSavingsGoal(ctx, walletId, pocketId)
+	if errors.Is(err, repoerrors.ErrSavingsGoalNotFound) {
+		return entity.SavingsGoal{}, ErrSavingsGoalNotFound
+	}
+	if err != nil {
+		return entity.SavingsGoal{}, err
+	}
+	return withProgress(goal, time.Now().UTC()), nil
+}
+
+// ListGoals - цели открытых карманов кошелька с прогрессом
+func (gs *savingsGoalServiceImpl) ListGoals(ctx context.Context, walletId uuid.UUID) ([]entity.SavingsGoal, error) {
+	goals, err := gs.repo.ListSavingsGoals(ctx, walletId)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for i := range goals {
+		goals[i] = withProgress(goals[i], now)
+	}
+	return goals, nil
+}
+
+func (gs *savingsGoalServiceImpl) DeleteGoal(ctx context.Context, walletId, pocketId uuid.UUID) error {
+	err := gs.repo.DeleteSavingsGoal(ctx, walletId, pocketId)
+	if errors.Is(err, repoerrors.ErrSavingsGoalNotFound) {
+		return ErrSavingsGoalNotFound
+	}
+	return err
+}
+
+// прогресс цели на момент now; суммы считаются в целых тысячных
+func withProgress(goal entity.SavingsGoal, now time.Time) entity.SavingsGoal {
+	saved, target := toUnits(goal.Saved), toUnits(goal.TargetAmount)
+	remaining := max(target-saved, 0)
+
+	goal.Remaining = float32(float64(remaining) / amountUnit)
+	goal.Achieved = remaining == 0
+	// проценты - с точностью до сотых, округление вниз, чтобы 100 было только у достигнутой цели
+	goal.Percent = float32(math.Min(100, math.Floor(float64(saved)*10000/float64(target))/100))
+
+	if goal.TargetDate != nil {
+		days := int(goal.TargetDate.Sub(now.Truncate(day))/day) + 1
+		if days > 0 {
+			goal.DaysLeft = &days
+			if !goal.Achieved {
+				// округление вверх - чтобы, откладывая по dailyAmount, успеть к сроку
+				daily := float32(float64((remaining+int64(days)-1)/int64(days)) / amountUnit)
+				goal.DailyAmount = &daily
+			}
+		} else {
+			goal.Overdue = !goal.Achieved
+		}
+	}
+	return goal
+}
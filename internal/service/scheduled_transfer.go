@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+const (
+	// насколько далеко вперед можно запланировать перевод
+	MaxScheduleAhead = 366 * 24 * time.Hour
+	// сколько раз можно повторить неудачный отложенный перевод
+	MaxScheduledTransferRetries = 10
+)
+
+type scheduledTransferServiceImpl struct {
+	walletService WalletService
+	repo          repository.ScheduledTransferRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+	retryDelay    time.Duration
+}
+
+// исполнение идет через WalletService.Transfer - те же проверки, метрики и трейсы, что и у обычного перевода
+func NewScheduledTransferService(ws WalletService, repo repository.ScheduledTransferRepo, transactor repository.Transactor, log *logrus.Logger, retryDelay time.Duration) *scheduledTransferServiceImpl {
+	return &scheduledTransferServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+		retryDelay:    retryDelay,
+	}
+}
+
+func (ss *scheduledTransferServiceImpl) CreateScheduledTransfer(ctx context.Context, from, to uuid.UUID, amount float32, executeAt time.Time, maxRetries int) (entity.ScheduledTransfer, error) {
+	if err := validateScheduledTransfer(from, to, amount, executeAt, maxRetries, time.Now()); err != nil {
+		return entity.ScheduledTransfer{}, err
+	}
+
+	st, err := ss.repo.CreateScheduledTransfer(ctx, entity.ScheduledTransfer{
+		From:        from,
+		To:          to,
+		Amount:      amount,
+		ExecuteAt:   executeAt.UTC(),
+		MaxAttempts: maxRetries + 1,
+	})
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.ScheduledTransfer{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrTargetWalletNotFound) {
+		return entity.ScheduledTransfer{}, ErrTargetWalletNotFound
+	}
+	return st, err
+}
+
+func (ss *scheduledTransferServiceImpl) ListScheduledTransfers(ctx context.Context, walletId uuid.UUID, status string) ([]entity.ScheduledTransfer, error) {
+	switch status {
+	case "", entity.ScheduledTransferPending, entity.ScheduledTransferExecuted, entity.ScheduledTransferFailed, entity.ScheduledTransferCanceled:
+	default:
+		return nil, newValidationError([]FieldError{{Field: "status", Message: "must be one of pending, executed, failed, canceled"}})
+	}
+	return ss.repo.ListScheduledTransfers(ctx, walletId, status)
+}
+
+func (ss *scheduledTransferServiceImpl) CancelScheduledTransfer(ctx context.Context, walletId, id uuid.UUID) error {
+	err := ss.repo.CancelScheduledTransfer(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrScheduledTransferNotFound) {
+		return ErrScheduledTransferNotFound
+	}
+	if errors.Is(err, repoerrors.ErrScheduledTransferNotPending) {
+		return ErrScheduledTransferNotPending
+	}
+	return err
+}
+
+// ExecuteDue - исполняет до limit переводов, время которых наступило; возвращает, сколько обработано
+func (ss *scheduledTransferServiceImpl) ExecuteDue(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		ok, err := ss.executeNext(ctx, time.Now().UTC())
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// выбор перевода, сам перевод и запись результата - в одной транзакции:
+// перевод не может исполниться дважды, а при падении посередине все откатится и он останется pending
+func (ss *scheduledTransferServiceImpl) executeNext(ctx context.Context, now time.Time) (bool, error) {
+	err := ss.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		st, err := ss.repo.ClaimDueScheduledTransfer(ctx, now)
+		if err != nil {
+			return err
+		}
+		ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: st.From.String(), "scheduled_transfer_id": st.Id.String()})
+		ctx = withoutFraudHold(repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceScheduledTransfer, Id: st.Id}))
+
+		st.Attempts++
+		err = ss.walletService.Transfer(ctx, st.From, st.To, st.Amount)
+		switch {
+		case err == nil:
+			st.Status = entity.ScheduledTransferExecuted
+			st.FailureReason = ""
+			st.ExecutedAt = &now
+		case errorReason(err) != metrics.ReasonInternal:
+			// бизнес-ошибка (не хватает баланса, кошелек заморожен, ...) - записываем причину и, если можно, повторяем позже;
+			// перевод, заблокированный антифрод-правилами, не повторяется - он уже в очереди на разбор
+			st.FailureReason = err.Error()
+			if st.Attempts < st.MaxAttempts && !errors.Is(err, ErrTransferBlocked) {
+				st.ExecuteAt = now.Add(ss.retryDelay)
+			} else {
+				st.Status = entity.ScheduledTransferFailed
+			}
+			logger.FromContext(ctx, ss.log).WithError(err).Warn("scheduled transfer failed")
+		default:
+			// внутренняя ошибка - откатываем все, попытка не засчитывается
+			return err
+		}
+
+		return ss.repo.UpdateScheduledTransferResult(ctx, st)
+	})
+	if errors.Is(err, repoerrors.ErrNoDueScheduledTransfers) {
+		return false, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx, ss.log).WithError(err).Error("scheduledTransferServiceImpl.executeNext")
+		return false, err
+	}
+	return true, nil
+}
+
+func validateScheduledTransfer(from, to uuid.UUID, amount float32, executeAt time.Time, maxRetries int, now time.Time) error {
+	var fields []FieldError
+	var validationErr *ValidationError
+	if errors.As(validateTransfer(from, to, amount), &validationErr) {
+		fields = append(fields, validationErr.Fields...)
+	}
+
+	switch {
+	case executeAt.IsZero():
+		fields = append(fields, FieldError{Field: "executeAt", Message: "is required"})
+	case !executeAt.After(now):
+		fields = append(fields, FieldError{Field: "executeAt", Message: "must be in the future"})
+	case executeAt.After(now.Add(MaxScheduleAhead)):
+		fields = append(fields, FieldError{Field: "executeAt", Message: "must be within a year"})
+	}
+
+	if maxRetries < 0 || maxRetries > MaxScheduledTransferRetries {
+		fields = append(fields, FieldError{Field: "maxRetries", Message: "must be between 0 and 10"})
+	}
+
+	return newValidationError(fields)
+}
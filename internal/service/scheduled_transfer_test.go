@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+)
+
+func newScheduledTransferEnv(t *testing.T) (pgEnv, repository.ScheduledTransferRepo, *scheduledTransferServiceImpl) {
+	t.Helper()
+	env := newPgEnv(t)
+	repo := repository.NewScheduledTransferRepo(env.pg, discardLogger())
+	return env, repo, NewScheduledTransferService(env.ws, repo, env.transactor, discardLogger(), time.Hour)
+}
+
+// наступивший перевод сохраняется в прошлом напрямую через репозиторий: сервис принимает только будущее время
+func scheduleDue(t *testing.T, repo repository.ScheduledTransferRepo, from, to uuid.UUID, amount float32, maxAttempts int) entity.ScheduledTransfer {
+	t.Helper()
+	st, err := repo.CreateScheduledTransfer(context.Background(), entity.ScheduledTransfer{
+		From: from, To: to, Amount: amount, ExecuteAt: time.Now().UTC().Add(-time.Minute), MaxAttempts: maxAttempts,
+	})
+	if err != nil {
+		t.Fatalf("CreateScheduledTransfer: %v", err)
+	}
+	return st
+}
+
+func scheduledTransfer(t *testing.T, repo repository.ScheduledTransferRepo, walletId, id uuid.UUID) entity.ScheduledTransfer {
+	t.Helper()
+	list, err := repo.ListScheduledTransfers(context.Background(), walletId, "")
+	if err != nil {
+		t.Fatalf("ListScheduledTransfers: %v", err)
+	}
+	for _, st := range list {
+		if st.Id == id {
+			return st
+		}
+	}
+	t.Fatalf("scheduled transfer %s not found", id)
+	return entity.ScheduledTransfer{}
+}
+
+func TestScheduledTransferExecuteDuePostgres(t *testing.T) {
+	env, repo, ss := newScheduledTransferEnv(t)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	due := scheduleDue(t, repo, from, to, 40, 1)
+	future, err := ss.CreateScheduledTransfer(ctx, from, to, 10, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateScheduledTransfer: %v", err)
+	}
+
+	n, err := ss.ExecuteDue(ctx, 10)
+	if err != nil || n != 1 {
+		t.Fatalf("ExecuteDue: got %d, %v, want 1 processed", n, err)
+	}
+	env.assertBalance(t, from, repository.InitialWalletBalance-40)
+	env.assertBalance(t, to, repository.InitialWalletBalance+40)
+
+	got := scheduledTransfer(t, repo, from, due.Id)
+	if got.Status != entity.ScheduledTransferExecuted || got.Attempts != 1 || got.ExecutedAt == nil || got.FailureReason != "" {
+		t.Errorf("due transfer: got %+v, want executed after 1 attempt", got)
+	}
+	if got := scheduledTransfer(t, repo, from, future.Id); got.Status != entity.ScheduledTransferPending || got.Attempts != 0 {
+		t.Errorf("future transfer: got %+v, want pending", got)
+	}
+
+	// исполненный перевод второй раз не выбирается
+	if n, err := ss.ExecuteDue(ctx, 10); err != nil || n != 0 {
+		t.Errorf("second ExecuteDue: got %d, %v, want nothing processed", n, err)
+	}
+	env.assertBalance(t, from, repository.InitialWalletBalance-40)
+}
+
+// бизнес-ошибка расходует попытку: пока попытки есть, перевод откладывается на retryDelay, потом - failed
+func TestScheduledTransferRetryPostgres(t *testing.T) {
+	env, repo, ss := newScheduledTransferEnv(t)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	retried := scheduleDue(t, repo, from, to, repository.InitialWalletBalance+1, 2)
+	if n, err := ss.ExecuteDue(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("ExecuteDue: got %d, %v, want 1 processed", n, err)
+	}
+	got := scheduledTransfer(t, repo, from, retried.Id)
+	if got.Status != entity.ScheduledTransferPending || got.Attempts != 1 || got.FailureReason == "" {
+		t.Errorf("after first attempt: got %+v, want pending with a failure reason", got)
+	}
+	if !got.ExecuteAt.After(time.Now().Add(50 * time.Minute)) {
+		t.Errorf("after first attempt: executeAt = %v, want moved by the retry delay", got.ExecuteAt)
+	}
+
+	failed := scheduleDue(t, repo, from, to, repository.InitialWalletBalance+1, 1)
+	if n, err := ss.ExecuteDue(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("ExecuteDue: got %d, %v, want 1 processed", n, err)
+	}
+	got = scheduledTransfer(t, repo, from, failed.Id)
+	if got.Status != entity.ScheduledTransferFailed || got.Attempts != 1 || got.ExecutedAt != nil {
+		t.Errorf("last attempt: got %+v, want failed", got)
+	}
+
+	env.assertBalance(t, from, repository.InitialWalletBalance)
+	env.assertBalance(t, to, repository.InitialWalletBalance)
+}
+
+func TestScheduledTransferCancelPostgres(t *testing.T) {
+	env, repo, ss := newScheduledTransferEnv(t)
+	ctx := context.Background()
+	from, to := env.wallet(t), env.wallet(t)
+
+	st, err := ss.CreateScheduledTransfer(ctx, from, to, 10, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatalf("CreateScheduledTransfer: %v", err)
+	}
+
+	// отменить может только отправитель
+	if err := ss.CancelScheduledTransfer(ctx, to, st.Id); !errors.Is(err, ErrScheduledTransferNotFound) {
+		t.Errorf("cancel by recipient: got %v, want %v", err, ErrScheduledTransferNotFound)
+	}
+	if err := ss.CancelScheduledTransfer(ctx, from, st.Id); err != nil {
+		t.Fatalf("CancelScheduledTransfer: %v", err)
+	}
+	if err := ss.CancelScheduledTransfer(ctx, from, st.Id); !errors.Is(err, ErrScheduledTransferNotPending) {
+		t.Errorf("second cancel: got %v, want %v", err, ErrScheduledTransferNotPending)
+	}
+	if got := scheduledTransfer(t, repo, from, st.Id); got.Status != entity.ScheduledTransferCanceled {
+		t.Errorf("status = %q, want %q", got.Status, entity.ScheduledTransferCanceled)
+	}
+
+	if _, err := ss.CreateScheduledTransfer(ctx, from, uuid.New(), 10, time.Now().Add(time.Hour), 0); !errors.Is(err, ErrTargetWalletNotFound) {
+		t.Errorf("unknown recipient: got %v, want %v", err, ErrTargetWalletNotFound)
+	}
+}
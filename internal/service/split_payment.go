@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// максимальное кол-во получателей в разделенном платеже
+	MaxSplitShares = 20
+	// кол-во знаков после запятой у процента доли
+	PercentPrecision = 2
+)
+
+// суммы считаются в целых тысячных (AmountPrecision), проценты - в сотых долях процента
+var (
+	amountUnit  = math.Pow10(AmountPrecision)
+	percentUnit = math.Pow10(PercentPrecision)
+	fullPercent = int64(100 * percentUnit)
+)
+
+// SplitTransfer - одно списание amount с from и зачисления получателям по долям, атомарно.
+// В метриках учитывается как один перевод.
+func (ws *walletServiceImpl) SplitTransfer(ctx context.Context, from uuid.UUID, amount float32, shares []entity.SplitShare) (entity.SplitPayment, error) {
+	ctx, span := tracer.Start(ctx, "walletService.SplitTransfer", trace.WithAttributes(
+		attrWalletId.String(from.String()),
+		attrAmount.Float64(float64(amount)),
+	))
+	defer span.End()
+
+	start := time.Now()
+	sp, err := ws.splitTransfer(ctx, from, amount, shares)
+	finishSpan(span, err)
+	if err != nil {
+		ws.metrics.TransferFailed(errorReason(err), time.Since(start))
+		return entity.SplitPayment{}, err
+	}
+	ws.metrics.TransferSucceeded(amount, time.Since(start))
+	return sp, nil
+}
+
+func (ws *walletServiceImpl) splitTransfer(ctx context.Context, from uuid.UUID, amount float32, shares []entity.SplitShare) (entity.SplitPayment, error) {
+	lines, err := splitShares(from, amount, shares)
+	if err != nil {
+		return entity.SplitPayment{}, err
+	}
+	to := make([]uuid.UUID, len(lines))
+	transfers := make([]fraudTransfer, len(lines))
+	for i, line := range lines {
+		to[i] = line.To
+		transfers[i] = fraudTransfer{To: line.To, Amount: line.Amount}
+	}
+	if err := ws.pockets.check(ctx, from, to...); err != nil {
+		return entity.SplitPayment{}, err
+	}
+
+	// каждая доля проверяется как перевод своему получателю; платеж проходит только целиком,
+	// поэтому удержать одну долю нельзя - решение review для него такая же блокировка
+	var sp entity.SplitPayment
+	err = ws.fraud.screen(withoutFraudHold(ctx), from, transfers, func(ctx context.Context) error {
+		var err error
+		sp, err = ws.walletRepo.SplitTransfer(ctx, entity.SplitPayment{From: from, Amount: amount, Lines: lines})
+		return transferError(err)
+	})
+	if err != nil {
+		return entity.SplitPayment{}, err
+	}
+	return sp, nil
+}
+
+func (ws *walletServiceImpl) GetSplitPayment(ctx context.Context, walletId, id uuid.UUID) (_ entity.SplitPayment, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.GetSplitPayment", trace.WithAttributes(attrWalletId.String(walletId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	sp, err := ws.walletRepo.GetSplitPayment(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrSplitPaymentNotFound) {
+		return entity.SplitPayment{}, ErrSplitPaymentNotFound
+	}
+	return sp, err
+}
+
+// splitShares - строки платежа по долям. Сначала вычитаются фиксированные суммы, остаток делится по процентам,
+// которые должны давать ровно 100. Остаток от округления до тысячных раздается по одной тысячной
+// долям с наибольшей отброшенной частью (при равенстве - в порядке долей в запросе), так что сумма строк
+// всегда ровно равна amount, а результат детерминирован.
+func splitShares(from uuid.UUID, amount float32, shares []entity.SplitShare) ([]entity.SplitLine, error) {
+	var fields []FieldError
+	if msg := validateAmount(amount); msg != "" {
+		fields = append(fields, FieldError{Field: "amount", Message: msg})
+	}
+	switch {
+	case len(shares) == 0:
+		fields = append(fields, FieldError{Field: "shares", Message: "must not be empty"})
+	case len(shares) > MaxSplitShares:
+		fields = append(fields, FieldError{Field: "shares", Message: "must contain at most " + strconv.Itoa(MaxSplitShares) + " shares"})
+	}
+	if len(fields) > 0 {
+		return nil, newValidationError(fields)
+	}
+
+	var (
+		units        = make([]int64, len(shares))
+		percents     = make([]int64, len(shares))
+		fixedTotal   int64
+		percentTotal int64
+		hasPercent   bool
+		seen         = make(map[uuid.UUID]bool, len(shares))
+	)
+	for i, share := range shares {
+		field := fmt.Sprintf("shares[%d]", i)
+		switch {
+		case share.To == uuid.Nil:
+			fields = append(fields, FieldError{Field: field + ".to", Message: "must be a non-zero wallet id"})
+		case share.To == from:
+			fields = append(fields, FieldError{Field: field + ".to", Message: "must differ from the source wallet"})
+		case seen[share.To]:
+			fields = append(fields, FieldError{Field: field + ".to", Message: "duplicate recipient"})
+		}
+		seen[share.To] = true
+
+		switch {
+		case (share.Percent == nil) == (share.Amount == nil):
+			fields = append(fields, FieldError{Field: field, Message: "exactly one of percent and amount is required"})
+		case share.Amount != nil:
+			if msg := validateAmount(*share.Amount); msg != "" {
+				fields = append(fields, FieldError{Field: field + ".amount", Message: msg})
+				continue
+			}
+			units[i] = toUnits(*share.Amount)
+			fixedTotal += units[i]
+		default:
+			p := *share.Percent
+			bp := math.Round(p * percentUnit)
+			switch {
+			case math.IsNaN(p) || p <= 0 || p > 100:
+				fields = append(fields, FieldError{Field: field + ".percent", Message: "must be greater than 0 and at most 100"})
+				continue
+			case math.Abs(p*percentUnit-bp) > 1e-6:
+				fields = append(fields, FieldError{Field: field + ".percent", Message: "must have at most " + strconv.Itoa(PercentPrecision) + " decimal places"})
+				continue
+			}
+			hasPercent = true
+			percents[i] = int64(bp)
+			percentTotal += percents[i]
+		}
+	}
+	if len(fields) > 0 {
+		return nil, newValidationError(fields)
+	}
+
+	total := toUnits(amount)
+	switch {
+	case fixedTotal > total:
+		return nil, newValidationError([]FieldError{{Field: "shares", Message: "fixed amounts exceed the payment amount"}})
+	case hasPercent && percentTotal != fullPercent:
+		return nil, newValidationError([]FieldError{{Field: "shares", Message: "percentages must sum to exactly 100"}})
+	case !hasPercent && fixedTotal != total:
+		return nil, newValidationError([]FieldError{{Field: "shares", Message: "fixed amounts must sum to exactly the payment amount"}})
+	}
+
+	// делим остаток по процентам методом наибольшего остатка
+	rest := total - fixedTotal
+	var (
+		distributed int64
+		remainders  = make([]int64, len(shares))
+		order       []int
+	)
+	for i := range shares {
+		if percents[i] == 0 {
+			continue
+		}
+		exact := rest * percents[i]
+		units[i] = exact / fullPercent
+		remainders[i] = exact % fullPercent
+		distributed += units[i]
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for k := int64(0); k < rest-distributed; k++ {
+		units[order[k]]++
+	}
+
+	lines := make([]entity.SplitLine, len(shares))
+	for i, share := range shares {
+		if units[i] == 0 {
+			fields = append(fields, FieldError{Field: fmt.Sprintf("shares[%d].percent", i), Message: "share rounds to zero"})
+			continue
+		}
+		lines[i] = entity.SplitLine{To: share.To, Amount: float32(float64(units[i]) / amountUnit)}
+	}
+	if len(fields) > 0 {
+		return nil, newValidationError(fields)
+	}
+	return lines, nil
+}
+
+func toUnits(amount float32) int64 {
+	return int64(math.Round(float64(amount) * amountUnit))
+}
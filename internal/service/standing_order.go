@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/cron"
+	"github.com/timohahaa/ewallet/pkg/logger"
+)
+
+// запуск уже был материализован раньше - перевод откатывается, поручение просто сдвигается на следующий запуск
+var errRunAlreadyMaterialized = errors.New("standing order run already materialized")
+
+type standingOrderServiceImpl struct {
+	walletService WalletService
+	repo          repository.StandingOrderRepo
+	transactor    repository.Transactor
+	log           *logrus.Logger
+}
+
+// каждый запуск исполняется через WalletService.Transfer, транзакция помечается источником standing_order
+func NewStandingOrderService(ws WalletService, repo repository.StandingOrderRepo, transactor repository.Transactor, log *logrus.Logger) *standingOrderServiceImpl {
+	return &standingOrderServiceImpl{
+		walletService: ws,
+		repo:          repo,
+		transactor:    transactor,
+		log:           log,
+	}
+}
+
+// CreateStandingOrder - из so берутся From, To, Amount, Schedule, StartsAt (нулевое - сейчас), EndsAt, MaxCount и MissedRuns (пустое - skip)
+func (ss *standingOrderServiceImpl) CreateStandingOrder(ctx context.Context, so entity.StandingOrder) (entity.StandingOrder, error) {
+	now := time.Now().UTC()
+	if so.MissedRuns == "" {
+		so.MissedRuns = entity.MissedRunsSkip
+	}
+	if so.StartsAt.IsZero() {
+		so.StartsAt = now
+	}
+	so.StartsAt = so.StartsAt.UTC()
+	if so.EndsAt != nil {
+		endsAt := so.EndsAt.UTC()
+		so.EndsAt = &endsAt
+	}
+
+	firstRun, err := validateStandingOrder(so, now)
+	if err != nil {
+		return entity.StandingOrder{}, err
+	}
+	so.NextRunAt = &firstRun
+
+	so, err = ss.repo.CreateStandingOrder(ctx, so)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.StandingOrder{}, ErrWalletNotFound
+	}
+	if errors.Is(err, repoerrors.ErrTargetWalletNotFound) {
+		return entity.StandingOrder{}, ErrTargetWalletNotFound
+	}
+	return so, err
+}
+
+func (ss *standingOrderServiceImpl) ListStandingOrders(ctx context.Context, walletId uuid.UUID, status string) ([]entity.StandingOrder, error) {
+	switch status {
+	case "", entity.StandingOrderActive, entity.StandingOrderCompleted, entity.StandingOrderCanceled:
+	default:
+		return nil, newValidationError([]FieldError{{Field: "status", Message: "must be one of active, completed, canceled"}})
+	}
+	return ss.repo.ListStandingOrders(ctx, walletId, status)
+}
+
+func (ss *standingOrderServiceImpl) ListStandingOrderRuns(ctx context.Context, walletId, id uuid.UUID) ([]entity.StandingOrderRun, error) {
+	runs, err := ss.repo.ListStandingOrderRuns(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrStandingOrderNotFound) {
+		return nil, ErrStandingOrderNotFound
+	}
+	return runs, err
+}
+
+func (ss *standingOrderServiceImpl) CancelStandingOrder(ctx context.Context, walletId, id uuid.UUID) error {
+	err := ss.repo.CancelStandingOrder(ctx, walletId, id)
+	if errors.Is(err, repoerrors.ErrStandingOrderNotFound) {
+		return ErrStandingOrderNotFound
+	}
+	if errors.Is(err, repoerrors.ErrStandingOrderNotActive) {
+		return ErrStandingOrderNotActive
+	}
+	return err
+}
+
+// ExecuteDue - обрабатывает до limit наступивших запусков (в режиме catch_up одно поручение может дать несколько); возвращает, сколько обработано
+func (ss *standingOrderServiceImpl) ExecuteDue(ctx context.Context, limit int) (int, error) {
+	processed := 0
+	for processed < limit {
+		ok, err := ss.executeNext(ctx, time.Now().UTC())
+		if err != nil {
+			return processed, err
+		}
+		if !ok {
+			break
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// выбор поручения, перевод, запись запуска и сдвиг поручения на следующий запуск - в одной транзакции
+func (ss *standingOrderServiceImpl) executeNext(ctx context.Context, now time.Time) (bool, error) {
+	err := ss.transactor.WithinTx(ctx, func(ctx context.Context) error {
+		so, err := ss.repo.ClaimDueStandingOrder(ctx, now)
+		if err != nil {
+			return err
+		}
+		ctx = logger.WithFields(ctx, logrus.Fields{logger.FieldWalletID: so.From.String(), "standing_order_id": so.Id.String()})
+
+		schedule, err := cron.Parse(so.Schedule)
+		if err != nil {
+			logger.FromContext(ctx, ss.log).WithError(err).Error("standingOrderServiceImpl.executeNext - cron.Parse")
+			return err
+		}
+		run := entity.StandingOrderRun{StandingOrderId: so.Id, ScheduledFor: *so.NextRunAt, ExecutedAt: now}
+		next := schedule.Next(run.ScheduledFor)
+
+		// пропущенный во время простоя запуск, за которым уже наступил следующий - в режиме skip исполняем только последний
+		if so.MissedRuns == entity.MissedRunsSkip && !next.After(now) && !standingOrderFinished(so, next) {
+			run.Status = entity.StandingOrderRunSkipped
+			if _, err := ss.repo.SaveStandingOrderRun(ctx, run); err != nil {
+				return err
+			}
+		} else {
+			// перевод и запись запуска - в savepoint: если запуск уже был записан, перевод откатывается
+			err = ss.transactor.WithinTx(ctx, func(ctx context.Context) error {
+				return ss.executeRun(ctx, so, &run)
+			})
+			switch {
+			case errors.Is(err, errRunAlreadyMaterialized):
+				logger.FromContext(ctx, ss.log).WithField("scheduled_for", run.ScheduledFor).Warn("standing order run already materialized, skipping")
+			case err != nil:
+				return err
+			default:
+				// к maxCount идут только прошедшие переводы - неуспешный запуск не расходует лимит
+				if run.Status == entity.StandingOrderRunExecuted {
+					so.RunsCount++
+				}
+				so.LastFailureReason = run.FailureReason
+			}
+		}
+
+		if standingOrderFinished(so, next) {
+			so.Status = entity.StandingOrderCompleted
+			so.NextRunAt = nil
+		} else {
+			so.NextRunAt = &next
+		}
+		return ss.repo.UpdateStandingOrderProgress(ctx, so)
+	})
+	if errors.Is(err, repoerrors.ErrNoDueStandingOrders) {
+		return false, nil
+	}
+	if err != nil {
+		logger.FromContext(ctx, ss.log).WithError(err).Error("standingOrderServiceImpl.executeNext")
+		return false, err
+	}
+	return true, nil
+}
+
+func (ss *standingOrderServiceImpl) executeRun(ctx context.Context, so entity.StandingOrder, run *entity.StandingOrderRun) error {
+	ctx = withoutFraudHold(repository.WithTransferSource(ctx, entity.TransferSource{Type: entity.TransferSourceStandingOrder, Id: so.Id}))
+
+	err := ss.walletService.Transfer(ctx, so.From, so.To, so.Amount)
+	switch {
+	case err == nil:
+		run.Status = entity.StandingOrderRunExecuted
+	case errorReason(err) != metrics.ReasonInternal:
+		// бизнес-ошибка - запуск записывается как неуспешный, повтора нет: следующий запуск по расписанию
+		run.Status = entity.StandingOrderRunFailed
+		run.FailureReason = err.Error()
+		logger.FromContext(ctx, ss.log).WithError(err).Warn("standing order run failed")
+	default:
+		return err
+	}
+
+	inserted, err := ss.repo.SaveStandingOrderRun(ctx, *run)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		return errRunAlreadyMaterialized
+	}
+	return nil
+}
+
+// поручение завершено, если запуска next нет, он позже endsAt или лимит исполненных переводов исчерпан
+func standingOrderFinished(so entity.StandingOrder, next time.Time) bool {
+	return next.IsZero() ||
+		(so.EndsAt != nil && next.After(*so.EndsAt)) ||
+		(so.MaxCount != nil && so.RunsCount >= *so.MaxCount)
+}
+
+func validateStandingOrder(so entity.StandingOrder, now time.Time) (time.Time, error) {
+	var fields []FieldError
+	var validationErr *ValidationError
+	if errors.As(validateTransfer(so.From, so.To, so.Amount), &validationErr) {
+		fields = append(fields, validationErr.Fields...)
+	}
+
+	schedule, err := cron.Parse(so.Schedule)
+	if err != nil {
+		fields = append(fields, FieldError{Field: "schedule", Message: err.Error()})
+	}
+
+	if so.StartsAt.Before(now.Add(-time.Minute)) {
+		fields = append(fields, FieldError{Field: "startsAt", Message: "must not be in the past"})
+	}
+	if so.EndsAt != nil && !so.EndsAt.After(so.StartsAt) {
+		fields = append(fields, FieldError{Field: "endsAt", Message: "must be after startsAt"})
+	}
+	if so.MaxCount != nil && *so.MaxCount <= 0 {
+		fields = append(fields, FieldError{Field: "maxCount", Message: "must be positive"})
+	}
+	if so.MissedRuns != entity.MissedRunsCatchUp && so.MissedRuns != entity.MissedRunsSkip {
+		fields = append(fields, FieldError{Field: "missedRuns", Message: "must be one of catch_up, skip"})
+	}
+
+	// первый запуск - первое срабатывание не раньше startsAt
+	var firstRun time.Time
+	if schedule != nil {
+		firstRun = schedule.Next(so.StartsAt.Add(-time.Nanosecond))
+		if firstRun.IsZero() || (so.EndsAt != nil && firstRun.After(*so.EndsAt)) {
+			fields = append(fields, FieldError{Field: "schedule", Message: "has no runs between startsAt and endsAt"})
+		}
+	}
+
+	return firstRun, newValidationError(fields)
+}
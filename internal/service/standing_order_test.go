@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+)
+
+// одно поручение; запуски уникальны по ScheduledFor, как в standing_order_runs
+type fakeStandingOrderRepo struct {
+	repository.StandingOrderRepo
+
+	so   entity.StandingOrder
+	runs []entity.StandingOrderRun
+}
+
+func (r *fakeStandingOrderRepo) ClaimDueStandingOrder(_ context.Context, now time.Time) (entity.StandingOrder, error) {
+	if r.so.Status != entity.StandingOrderActive || r.so.NextRunAt == nil || r.so.NextRunAt.After(now) {
+		return entity.StandingOrder{}, repoerrors.ErrNoDueStandingOrders
+	}
+	return r.so, nil
+}
+
+func (r *fakeStandingOrderRepo) SaveStandingOrderRun(_ context.Context, run entity.StandingOrderRun) (bool, error) {
+	for _, saved := range r.runs {
+		if saved.ScheduledFor.Equal(run.ScheduledFor) {
+			return false, nil
+		}
+	}
+	r.runs = append(r.runs, run)
+	return true, nil
+}
+
+func (r *fakeStandingOrderRepo) UpdateStandingOrderProgress(_ context.Context, so entity.StandingOrder) error {
+	r.so = so
+	return nil
+}
+
+// результаты переводов по порядку; после них переводы проходят
+type fakeTransferService struct {
+	WalletService
+
+	results []error
+	calls   int
+}
+
+func (ws *fakeTransferService) Transfer(context.Context, uuid.UUID, uuid.UUID, float32) error {
+	ws.calls++
+	if ws.calls <= len(ws.results) {
+		return ws.results[ws.calls-1]
+	}
+	return nil
+}
+
+func TestStandingOrderExecuteDue(t *testing.T) {
+	// 4 наступивших запуска: 09:00, 10:00, 11:00 и 12:00
+	now := time.Date(2024, 9, 2, 12, 0, 0, 0, time.UTC)
+	firstRun := now.Add(-3 * time.Hour)
+	intPtr := func(v int) *int { return &v }
+
+	tests := []struct {
+		name          string
+		missedRuns    string
+		maxCount      *int
+		results       []error
+		wantRuns      []string
+		wantTransfers int
+		wantRunsCount int
+		wantCompleted bool
+	}{
+		{
+			name:          "skip executes only the latest run",
+			missedRuns:    entity.MissedRunsSkip,
+			wantRuns:      []string{entity.StandingOrderRunSkipped, entity.StandingOrderRunSkipped, entity.StandingOrderRunSkipped, entity.StandingOrderRunExecuted},
+			wantTransfers: 1,
+			wantRunsCount: 1,
+		},
+		{
+			name:          "catch up executes every run",
+			missedRuns:    entity.MissedRunsCatchUp,
+			wantRuns:      []string{entity.StandingOrderRunExecuted, entity.StandingOrderRunExecuted, entity.StandingOrderRunExecuted, entity.StandingOrderRunExecuted},
+			wantTransfers: 4,
+			wantRunsCount: 4,
+		},
+		{
+			name:          "max count stops catch up",
+			missedRuns:    entity.MissedRunsCatchUp,
+			maxCount:      intPtr(2),
+			wantRuns:      []string{entity.StandingOrderRunExecuted, entity.StandingOrderRunExecuted},
+			wantTransfers: 2,
+			wantRunsCount: 2,
+			wantCompleted: true,
+		},
+		{
+			name:          "failed runs do not count toward max count",
+			missedRuns:    entity.MissedRunsCatchUp,
+			maxCount:      intPtr(2),
+			results:       []error{ErrNotEnoughBalance, nil, ErrWalletFrozen},
+			wantRuns:      []string{entity.StandingOrderRunFailed, entity.StandingOrderRunExecuted, entity.StandingOrderRunFailed, entity.StandingOrderRunExecuted},
+			wantTransfers: 4,
+			wantRunsCount: 2,
+			wantCompleted: true,
+		},
+		{
+			name:          "skipped runs do not count toward max count",
+			missedRuns:    entity.MissedRunsSkip,
+			maxCount:      intPtr(2),
+			wantRuns:      []string{entity.StandingOrderRunSkipped, entity.StandingOrderRunSkipped, entity.StandingOrderRunSkipped, entity.StandingOrderRunExecuted},
+			wantTransfers: 1,
+			wantRunsCount: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &fakeStandingOrderRepo{so: entity.StandingOrder{
+				Id:         uuid.New(),
+				From:       uuid.New(),
+				To:         uuid.New(),
+				Amount:     10,
+				Schedule:   "0 * * * *",
+				StartsAt:   firstRun,
+				MaxCount:   tt.maxCount,
+				MissedRuns: tt.missedRuns,
+				Status:     entity.StandingOrderActive,
+				NextRunAt:  &firstRun,
+			}}
+			ws := &fakeTransferService{results: tt.results}
+			ss := NewStandingOrderService(ws, repo, fakeTransactor{}, discardLogger())
+
+			for i := 0; ; i++ {
+				ok, err := ss.executeNext(context.Background(), now)
+				if err != nil {
+					t.Fatalf("executeNext: %v", err)
+				}
+				if !ok {
+					break
+				}
+				if i > 10 {
+					t.Fatal("executeNext: order is never exhausted")
+				}
+			}
+
+			if len(repo.runs) != len(tt.wantRuns) {
+				t.Fatalf("runs = %+v, want statuses %v", repo.runs, tt.wantRuns)
+			}
+			for i, run := range repo.runs {
+				if want := firstRun.Add(time.Duration(i) * time.Hour); run.Status != tt.wantRuns[i] || !run.ScheduledFor.Equal(want) {
+					t.Errorf("runs[%d] = %s at %s, want %s at %s", i, run.Status, run.ScheduledFor, tt.wantRuns[i], want)
+				}
+			}
+			if ws.calls != tt.wantTransfers {
+				t.Errorf("transfers = %d, want %d", ws.calls, tt.wantTransfers)
+			}
+			if repo.so.RunsCount != tt.wantRunsCount {
+				t.Errorf("RunsCount = %d, want %d", repo.so.RunsCount, tt.wantRunsCount)
+			}
+
+			if tt.wantCompleted {
+				if repo.so.Status != entity.StandingOrderCompleted || repo.so.NextRunAt != nil {
+					t.Errorf("order = %s, next run %v, want completed", repo.so.Status, repo.so.NextRunAt)
+				}
+				return
+			}
+			if want := now.Add(time.Hour); repo.so.Status != entity.StandingOrderActive || repo.so.NextRunAt == nil || !repo.so.NextRunAt.Equal(want) {
+				t.Errorf("order = %s, next run %v, want active at %s", repo.so.Status, repo.so.NextRunAt, want)
+			}
+		})
+	}
+}
+
+// неуспешный запуск записывает причину; повтора нет - следующий запуск по расписанию
+func TestStandingOrderFailedRun(t *testing.T) {
+	now := time.Date(2024, 9, 2, 12, 0, 0, 0, time.UTC)
+	repo := &fakeStandingOrderRepo{so: entity.StandingOrder{
+		Id: uuid.New(), From: uuid.New(), To: uuid.New(), Amount: 10, Schedule: "@daily",
+		MissedRuns: entity.MissedRunsSkip, Status: entity.StandingOrderActive, NextRunAt: &now,
+	}}
+	ws := &fakeTransferService{results: []error{ErrNotEnoughBalance}}
+	ss := NewStandingOrderService(ws, repo, fakeTransactor{}, discardLogger())
+
+	if ok, err := ss.executeNext(context.Background(), now); !ok || err != nil {
+		t.Fatalf("executeNext: got %v, %v", ok, err)
+	}
+	if len(repo.runs) != 1 || repo.runs[0].Status != entity.StandingOrderRunFailed || repo.runs[0].FailureReason != ErrNotEnoughBalance.Error() {
+		t.Errorf("runs = %+v, want one failed run", repo.runs)
+	}
+	if repo.so.LastFailureReason != ErrNotEnoughBalance.Error() || repo.so.RunsCount != 0 {
+		t.Errorf("order = %+v, want failure reason and no executed runs", repo.so)
+	}
+	if want := time.Date(2024, 9, 3, 0, 0, 0, 0, time.UTC); repo.so.NextRunAt == nil || !repo.so.NextRunAt.Equal(want) {
+		t.Errorf("NextRunAt = %v, want %s", repo.so.NextRunAt, want)
+	}
+	if ok, err := ss.executeNext(context.Background(), now); ok || err != nil {
+		t.Errorf("executeNext: got %v, %v, want nothing due", ok, err)
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/timohahaa/ewallet/internal/metrics"
+)
+
+var tracer = otel.Tracer("github.com/timohahaa/ewallet/internal/service")
+
+// атрибуты спанов сервисного слоя
+const (
+	attrOutcome    = attribute.Key("ewallet.outcome")
+	attrErrorClass = attribute.Key("ewallet.error.class")
+	attrWalletId   = attribute.Key("ewallet.wallet.id")
+	attrToWalletId = attribute.Key("ewallet.wallet.to_id")
+	attrAmount     = attribute.Key("ewallet.amount")
+)
+
+// отмечает в спане результат операции; ожидаемые бизнес-ошибки (нет кошелька, не хватает баланса)
+// не считаются ошибкой спана - только класс ошибки в атрибутах
+func finishSpan(span trace.Span, err error) {
+	if err == nil {
+		span.SetAttributes(attrOutcome.String("success"))
+		return
+	}
+
+	class := errorReason(err)
+	span.SetAttributes(attrOutcome.String("failed"), attrErrorClass.String(class))
+	if class == metrics.ReasonInternal {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+
+	"github.com/timohahaa/ewallet/internal/entity"
+)
+
+const (
+	// максимальная длина назначения платежа и внешнего идентификатора
+	MaxTransferMemoLength      = 256
+	MaxTransferReferenceLength = 64
+	// максимальная длина ключа metadata
+	MaxMetadataKeyLength = 64
+)
+
+// TransferDetailsPolicy - ограничения на metadata перевода
+type TransferDetailsPolicy struct {
+	// допустимые ключи; пустой список - любые ключи
+	MetadataKeys []string
+	// максимальный размер metadata в байтах JSON; 0 - metadata не принимаются
+	MaxMetadataSize int
+}
+
+func (p TransferDetailsPolicy) validate(details entity.TransferDetails) error {
+	var fields []FieldError
+
+	if len([]rune(details.Memo)) > MaxTransferMemoLength {
+		fields = append(fields, FieldError{Field: "memo", Message: "must be at most " + strconv.Itoa(MaxTransferMemoLength) + " characters"})
+	}
+	if len([]rune(details.Reference)) > MaxTransferReferenceLength {
+		fields = append(fields, FieldError{Field: "reference", Message: "must be at most " + strconv.Itoa(MaxTransferReferenceLength) + " characters"})
+	}
+
+	if len(details.Metadata) > 0 {
+		// ключи сортируются, чтобы порядок ошибок не зависел от обхода map
+		keys := make([]string, 0, len(details.Metadata))
+		for key := range details.Metadata {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			switch {
+			case key == "" || len(key) > MaxMetadataKeyLength:
+				fields = append(fields, FieldError{Field: "metadata", Message: "keys must be 1 to " + strconv.Itoa(MaxMetadataKeyLength) + " bytes long"})
+			case len(p.MetadataKeys) > 0 && !slices.Contains(p.MetadataKeys, key):
+				fields = append(fields, FieldError{Field: "metadata." + key, Message: "key is not allowed"})
+			}
+		}
+
+		raw, err := json.Marshal(details.Metadata)
+		if err != nil {
+			fields = append(fields, FieldError{Field: "metadata", Message: "must be a JSON object"})
+		} else if len(raw) > p.MaxMetadataSize {
+			fields = append(fields, FieldError{Field: "metadata", Message: "must be at most " + strconv.Itoa(p.MaxMetadataSize) + " bytes of JSON"})
+		}
+	}
+
+	return newValidationError(fields)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// количество знаков после запятой у денежных сумм - совпадает со scale у NUMERIC(10, 3) в миграции
+	AmountPrecision = 3
+	// максимальная сумма одного перевода - ограничена precision у NUMERIC(10, 3)
+	MaxTransferAmount float32 = 9_999_999
+)
+
+// ошибка валидации конкретного поля запроса
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ошибка валидации, содержит список невалидных полей
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Field+": "+f.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// вспомогательная функция - nil, если ошибок нет (чтобы не возвращать типизированный nil)
+func newValidationError(fields []FieldError) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: fields}
+}
+
+// доменная валидация перевода
+func validateTransfer(from, to uuid.UUID, amount float32) error {
+	var fields []FieldError
+
+	if to == uuid.Nil {
+		fields = append(fields, FieldError{Field: "to", Message: "must be a non-zero wallet id"})
+	} else if to == from {
+		fields = append(fields, FieldError{Field: "to", Message: "must differ from the source wallet"})
+	}
+
+	if msg := validateAmount(amount); msg != "" {
+		fields = append(fields, FieldError{Field: "amount", Message: msg})
+	}
+
+	return newValidationError(fields)
+}
+
+// возвращает пустую строку, если сумма валидна
+func validateAmount(amount float32) string {
+	f := float64(amount)
+	switch {
+	case math.IsNaN(f) || math.IsInf(f, 0):
+		return "must be a finite number"
+	case amount <= 0:
+		return "must be positive"
+	case amount > MaxTransferAmount:
+		return "must not exceed " + strconv.FormatFloat(float64(MaxTransferAmount), 'f', -1, 32)
+	case FractionDigits(float64(amount), 32) > AmountPrecision:
+		return "must have at most " + strconv.Itoa(AmountPrecision) + " decimal places"
+	}
+	return ""
+}
+
+// ExactAmount - сумма из запроса не меняется при приведении к float32 с точностью до AmountPrecision знаков;
+// у float32 около 7 значащих цифр, поэтому, например, 1234567.891 превратилось бы в 1234567.875
+func ExactAmount(num float64) bool {
+	unit := math.Pow10(AmountPrecision)
+	return math.Round(float64(float32(num))*unit) == math.Round(num*unit)
+}
+
+// FractionDigits - кол-во знаков после запятой в кратчайшей десятичной записи числа (в т.ч. для 1e-5 и 1.500);
+// bitSize - 32 для сумм, уже приведенных к float32, 64 - для чисел из запроса
+func FractionDigits(num float64, bitSize int) int {
+	s := strconv.FormatFloat(num, 'f', -1, bitSize)
+	dot := strings.IndexByte(s, '.')
+	if dot == -1 {
+		return 0
+	}
+	return len(s) - dot - 1
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  float32
+		wantErr bool
+	}{
+		{"positive", 25.5, false},
+		{"minor unit", 0.001, false},
+		{"max amount", MaxTransferAmount, false},
+		{"three decimal places", 12.345, false},
+		{"zero", 0, true},
+		{"negative", -1, true},
+		{"NaN", float32(math.NaN()), true},
+		{"+Inf", float32(math.Inf(1)), true},
+		{"-Inf", float32(math.Inf(-1)), true},
+		{"too large", MaxTransferAmount + 1, true},
+		{"beyond minor unit", 0.0001, true},
+		{"four decimal places", 1.2345, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := validateAmount(tt.amount)
+			if (msg != "") != tt.wantErr {
+				t.Errorf("validateAmount(%v) = %q, want error: %v", tt.amount, msg, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateTransfer(t *testing.T) {
+	from, to := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name       string
+		from, to   uuid.UUID
+		amount     float32
+		wantFields []string
+	}{
+		{"valid", from, to, 10, nil},
+		{"nil target", from, uuid.Nil, 10, []string{"to"}},
+		{"self transfer", from, from, 10, []string{"to"}},
+		{"bad amount", from, to, -5, []string{"amount"}},
+		{"nil target and bad amount", from, uuid.Nil, float32(math.NaN()), []string{"to", "amount"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTransfer(tt.from, tt.to, tt.amount)
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("validateTransfer: got %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrValidation) {
+				t.Fatalf("validateTransfer: got %v, want %v", err, ErrValidation)
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("validateTransfer: got %T, want *ValidationError", err)
+			}
+			if len(validationErr.Fields) != len(tt.wantFields) {
+				t.Fatalf("validateTransfer: got fields %+v, want %v", validationErr.Fields, tt.wantFields)
+			}
+			for i, f := range validationErr.Fields {
+				if f.Field != tt.wantFields[i] {
+					t.Errorf("fields[%d] = %q, want %q", i, f.Field, tt.wantFields[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFractionDigits(t *testing.T) {
+	tests := []struct {
+		num     float64
+		bitSize int
+		want    int
+	}{
+		{10, 64, 0},
+		{1.5, 64, 1},
+		{1.500, 64, 1},
+		{1e-5, 64, 5},
+		{0.001, 32, 3},
+		{float64(float32(0.1)), 32, 1},
+	}
+	for _, tt := range tests {
+		if got := FractionDigits(tt.num, tt.bitSize); got != tt.want {
+			t.Errorf("FractionDigits(%v, %d) = %d, want %d", tt.num, tt.bitSize, got, tt.want)
+		}
+	}
+}
+
+func TestExactAmount(t *testing.T) {
+	tests := []struct {
+		num  float64
+		want bool
+	}{
+		{25.125, true},
+		{0.001, true},
+		{9999.999, true},
+		{99999.999, false},
+		{1234567.5, true},
+		{9999999, true},
+		{1234567.891, false},
+		{999999.999, false},
+	}
+	for _, tt := range tests {
+		if got := ExactAmount(tt.num); got != tt.want {
+			t.Errorf("ExactAmount(%v) = %v, want %v", tt.num, got, tt.want)
+		}
+	}
+}
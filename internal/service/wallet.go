@@ -3,37 +3,102 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/metrics"
 	"github.com/timohahaa/ewallet/internal/repository"
 	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"github.com/timohahaa/ewallet/pkg/logger"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type walletServiceImpl struct {
 	walletRepo repository.WalletRepo
 	log        *logrus.Logger
+	metrics    *metrics.Metrics
+	details    TransferDetailsPolicy
+	pockets    pocketRule
+	fraud      *FraudScreen
 }
 
-func NewWalletService(wr repository.WalletRepo, log *logrus.Logger) *walletServiceImpl {
+// details - ограничения на metadata переводов, pockets - правило переводов из карманов,
+// fraud - антифрод-проверка переводов, кроме системных (nil - без проверки)
+func NewWalletService(wr repository.WalletRepo, log *logrus.Logger, m *metrics.Metrics, details TransferDetailsPolicy, pockets PocketPolicy, fraud *FraudScreen) *walletServiceImpl {
 	return &walletServiceImpl{
 		walletRepo: wr,
 		log:        log,
+		metrics:    m,
+		details:    details,
+		pockets:    newPocketRule(wr, pockets),
+		fraud:      fraud,
 	}
 }
 
-func (ws *walletServiceImpl) CreateWallet(ctx context.Context) (entity.Wallet, error) {
-	wallet, err := ws.walletRepo.CreateWallet(ctx)
+func (ws *walletServiceImpl) CreateWallet(ctx context.Context, info entity.WalletInfo) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.CreateWallet")
+	defer func() { finishSpan(span, err); span.End() }()
+
+	if err := validateWalletInfo(info); err != nil {
+		return entity.Wallet{}, err
+	}
+	wallet, err := ws.walletRepo.CreateWallet(ctx, info)
 	if err != nil {
-		ws.log.Error("walletServiceImpl.CreateWallet - walletRepo.CreateWallet", "err", err)
+		logger.FromContext(ctx, ws.log).WithError(err).Error("walletServiceImpl.CreateWallet - walletRepo.CreateWallet")
 		return entity.Wallet{}, err
 	}
+	span.SetAttributes(attrWalletId.String(wallet.Id.String()))
+	ws.metrics.WalletCreated()
 	return wallet, nil
 }
 
 func (ws *walletServiceImpl) Transfer(ctx context.Context, from, to uuid.UUID, amount float32) error {
-	err := ws.walletRepo.Transfer(ctx, from, to, amount)
+	return ws.TransferWithDetails(ctx, from, to, amount, entity.TransferDetails{})
+}
+
+// TransferWithDetails - перевод с memo, reference и metadata, которые сохраняются вместе с транзакцией
+func (ws *walletServiceImpl) TransferWithDetails(ctx context.Context, from, to uuid.UUID, amount float32, details entity.TransferDetails) error {
+	ctx, span := tracer.Start(ctx, "walletService.Transfer", trace.WithAttributes(
+		attrWalletId.String(from.String()),
+		attrToWalletId.String(to.String()),
+		attrAmount.Float64(float64(amount)),
+	))
+	defer span.End()
+
+	start := time.Now()
+	err := ws.details.validate(details)
+	if err == nil {
+		if details.Memo != "" || details.Reference != "" || len(details.Metadata) > 0 || details.ToAlias != "" {
+			ctx = repository.WithTransferDetails(ctx, details)
+		}
+		err = ws.transfer(ctx, from, to, amount)
+	}
+	finishSpan(span, err)
+	if err != nil {
+		ws.metrics.TransferFailed(errorReason(err), time.Since(start))
+		return err
+	}
+	ws.metrics.TransferSucceeded(amount, time.Since(start))
+	return nil
+}
+
+func (ws *walletServiceImpl) transfer(ctx context.Context, from, to uuid.UUID, amount float32) error {
+	if err := validateTransfer(from, to, amount); err != nil {
+		return err
+	}
+	if err := ws.pockets.check(ctx, from, to); err != nil {
+		return err
+	}
+
+	return ws.fraud.screen(ctx, from, []fraudTransfer{{To: to, Amount: amount}}, func(ctx context.Context) error {
+		return transferError(ws.walletRepo.Transfer(ctx, from, to, amount))
+	})
+}
+
+// ошибка репозитория при переводе -> сервисная ошибка
+func transferError(err error) error {
 	if errors.Is(err, repoerrors.ErrWalletNotFound) {
 		return ErrWalletNotFound
 	}
@@ -43,21 +108,81 @@ func (ws *walletServiceImpl) Transfer(ctx context.Context, from, to uuid.UUID, a
 	if errors.Is(err, repoerrors.ErrNotEnoughBalance) {
 		return ErrNotEnoughBalance
 	}
+	if errors.Is(err, repoerrors.ErrWalletFrozen) {
+		return ErrWalletFrozen
+	}
+	if errors.Is(err, repoerrors.ErrTargetWalletFrozen) {
+		return ErrTargetWalletFrozen
+	}
+	if errors.Is(err, repoerrors.ErrSelfTransfer) {
+		return newValidationError([]FieldError{{Field: "to", Message: "must differ from the source wallet"}})
+	}
 	return err
 }
 
-func (ws *walletServiceImpl) TransactionHistory(ctx context.Context, walletId uuid.UUID) ([]entity.Transaction, error) {
-	txs, err := ws.walletRepo.GetTransactionHistory(ctx, walletId)
+// сервисная ошибка -> класс ошибки для метрик и трейсов
+func errorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrValidation):
+		return metrics.ReasonValidation
+	case errors.Is(err, ErrWalletNotFound):
+		return metrics.ReasonWalletNotFound
+	case errors.Is(err, ErrTargetWalletNotFound):
+		return metrics.ReasonTargetWalletMissing
+	case errors.Is(err, ErrNotEnoughBalance):
+		return metrics.ReasonNotEnoughBalance
+	case errors.Is(err, ErrWalletFrozen), errors.Is(err, ErrTargetWalletFrozen):
+		return metrics.ReasonWalletFrozen
+	case errors.Is(err, ErrPocketTransferNotAllowed):
+		return metrics.ReasonPocketRestricted
+	case errors.Is(err, ErrTransferHeld):
+		return metrics.ReasonFraudReview
+	case errors.Is(err, ErrTransferBlocked):
+		return metrics.ReasonFraudBlocked
+	default:
+		return metrics.ReasonInternal
+	}
+}
+
+func (ws *walletServiceImpl) TransactionHistory(ctx context.Context, walletId uuid.UUID, filter entity.TransactionFilter) (_ []entity.Transaction, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.TransactionHistory", trace.WithAttributes(attrWalletId.String(walletId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	txs, err := ws.walletRepo.GetTransactionHistory(ctx, walletId, filter)
 	if errors.Is(err, repoerrors.ErrWalletNotFound) {
 		return nil, ErrWalletNotFound
 	}
 	return txs, err
 }
 
-func (ws *walletServiceImpl) WalletStatus(ctx context.Context, walletId uuid.UUID) (entity.Wallet, error) {
+func (ws *walletServiceImpl) WalletStatus(ctx context.Context, walletId uuid.UUID) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.WalletStatus", trace.WithAttributes(attrWalletId.String(walletId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
 	wallet, err := ws.walletRepo.GetWalletStatus(ctx, walletId)
 	if errors.Is(err, repoerrors.ErrWalletNotFound) {
 		return entity.Wallet{}, ErrWalletNotFound
 	}
-	return wallet, err
+	if err != nil {
+		return wallet, err
+	}
+	available := float32(float64(toUnits(wallet.Balance)+toUnits(wallet.CreditLimit)) / amountUnit)
+	wallet.Available = &available
+	if wallet.ParentId != nil {
+		return wallet, nil
+	}
+
+	// общий баланс считается в целых тысячных, чтобы сумма не зависела от ошибок float32
+	wallet.Pockets, err = ws.walletRepo.ListPockets(ctx, walletId)
+	if err != nil {
+		logger.FromContext(ctx, ws.log).WithError(err).Error("walletServiceImpl.WalletStatus - walletRepo.ListPockets")
+		return entity.Wallet{}, err
+	}
+	total := toUnits(wallet.Balance)
+	for _, pocket := range wallet.Pockets {
+		total += toUnits(pocket.Balance)
+	}
+	totalBalance := float32(float64(total) / amountUnit)
+	wallet.TotalBalance = &totalBalance
+	return wallet, nil
 }
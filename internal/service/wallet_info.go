@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/timohahaa/ewallet/internal/entity"
+	"github.com/timohahaa/ewallet/internal/repository/repoerrors"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	MaxOwnerIdLength     = 64
+	MaxDisplayNameLength = 128
+	// максимальное кол-во меток у кошелька и длина одной метки
+	MaxWalletLabels      = 20
+	MaxWalletLabelLength = 32
+	// размер страницы списка кошельков по умолчанию и максимальный
+	DefaultWalletPageSize = 50
+	MaxWalletPageSize     = 100
+)
+
+func (ws *walletServiceImpl) UpdateWalletInfo(ctx context.Context, walletId uuid.UUID, update entity.WalletInfoUpdate) (_ entity.Wallet, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.UpdateWalletInfo", trace.WithAttributes(attrWalletId.String(walletId.String())))
+	defer func() { finishSpan(span, err); span.End() }()
+
+	// незаданные поля проверять не нужно - они не меняются
+	var info entity.WalletInfo
+	if update.OwnerId != nil {
+		info.OwnerId = *update.OwnerId
+	}
+	if update.DisplayName != nil {
+		info.DisplayName = *update.DisplayName
+	}
+	if update.Labels != nil {
+		info.Labels = *update.Labels
+	}
+	if err := validateWalletInfo(info); err != nil {
+		return entity.Wallet{}, err
+	}
+
+	wallet, err := ws.walletRepo.UpdateWalletInfo(ctx, walletId, update)
+	if errors.Is(err, repoerrors.ErrWalletNotFound) {
+		return entity.Wallet{}, ErrWalletNotFound
+	}
+	return wallet, err
+}
+
+// ListWallets - страница кошельков; filter.Limit == 0 - DefaultWalletPageSize
+func (ws *walletServiceImpl) ListWallets(ctx context.Context, filter entity.WalletFilter) (_ entity.WalletPage, err error) {
+	ctx, span := tracer.Start(ctx, "walletService.ListWallets")
+	defer func() { finishSpan(span, err); span.End() }()
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultWalletPageSize
+	}
+	if err := validateWalletFilter(filter); err != nil {
+		return entity.WalletPage{}, err
+	}
+
+	wallets, err := ws.walletRepo.ListWallets(ctx, filter)
+	if err != nil {
+		return entity.WalletPage{}, err
+	}
+	page := entity.WalletPage{Wallets: wallets}
+	if page.Wallets == nil {
+		page.Wallets = []entity.Wallet{}
+	}
+	// полная страница - возможно, есть следующая
+	if len(wallets) == filter.Limit {
+		page.Next = wallets[len(wallets)-1].Id.String()
+	}
+	return page, nil
+}
+
+func validateWalletInfo(info entity.WalletInfo) error {
+	var fields []FieldError
+
+	if len([]rune(info.OwnerId)) > MaxOwnerIdLength {
+		fields = append(fields, FieldError{Field: "ownerId", Message: "must be at most " + strconv.Itoa(MaxOwnerIdLength) + " characters"})
+	}
+	if len([]rune(info.DisplayName)) > MaxDisplayNameLength {
+		fields = append(fields, FieldError{Field: "displayName", Message: "must be at most " + strconv.Itoa(MaxDisplayNameLength) + " characters"})
+	}
+
+	if len(info.Labels) > MaxWalletLabels {
+		fields = append(fields, FieldError{Field: "labels", Message: "must contain at most " + strconv.Itoa(MaxWalletLabels) + " labels"})
+	}
+	seen := make(map[string]bool, len(info.Labels))
+	for i, label := range info.Labels {
+		field := "labels[" + strconv.Itoa(i) + "]"
+		switch n := len([]rune(label)); {
+		case n == 0:
+			fields = append(fields, FieldError{Field: field, Message: "must not be empty"})
+		case n > MaxWalletLabelLength:
+			fields = append(fields, FieldError{Field: field, Message: "must be at most " + strconv.Itoa(MaxWalletLabelLength) + " characters"})
+		case seen[label]:
+			fields = append(fields, FieldError{Field: field, Message: "is a duplicate"})
+		}
+		seen[label] = true
+	}
+
+	return newValidationError(fields)
+}
+
+func validateWalletFilter(filter entity.WalletFilter) error {
+	var fields []FieldError
+
+	if filter.Limit < 1 || filter.Limit > MaxWalletPageSize {
+		fields = append(fields, FieldError{Field: "limit", Message: "must be between 1 and " + strconv.Itoa(MaxWalletPageSize)})
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedTo.After(*filter.CreatedFrom) {
+		fields = append(fields, FieldError{Field: "createdTo", Message: "must be after createdFrom"})
+	}
+	if filter.MinBalance != nil && filter.MaxBalance != nil && *filter.MaxBalance < *filter.MinBalance {
+		fields = append(fields, FieldError{Field: "maxBalance", Message: "must not be less than minBalance"})
+	}
+
+	return newValidationError(fields)
+}
@@ -1,2 +1,2 @@
 DROP TABLE transactions;
-DROP TABLE wallets;
\ No newline at end of file
+DROP TABLE wallets;
@@ -1,9 +1,10 @@
-CREATE TABLE wallets (
+-- IF NOT EXISTS - базы, на которые up.sql накатывали руками, просто получат запись в schema_migrations
+CREATE TABLE IF NOT EXISTS wallets (
     id UUID PRIMARY KEY NOT NULL,
     balance NUMERIC(10, 3) NOT NULL DEFAULT 0 CHECK ( balance >= 0 )
 );
 
-CREATE TABLE transactions (
+CREATE TABLE IF NOT EXISTS transactions (
     id SERIAL PRIMARY KEY,
     made_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
     transfered_from UUID REFERENCES wallets (id),
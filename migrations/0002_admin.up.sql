@@ -0,0 +1,14 @@
+ALTER TABLE wallets ADD COLUMN frozen BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    made_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    actor TEXT NOT NULL,
+    action TEXT NOT NULL,
+    wallet_id UUID REFERENCES wallets (id),
+    details JSONB NOT NULL DEFAULT '{}',
+    reason TEXT NOT NULL,
+    outcome TEXT NOT NULL
+);
+
+CREATE INDEX admin_audit_log_wallet_id_idx ON admin_audit_log (wallet_id);
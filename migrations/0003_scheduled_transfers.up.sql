@@ -0,0 +1,18 @@
+CREATE TABLE scheduled_transfers (
+    id UUID PRIMARY KEY NOT NULL,
+    transfer_from UUID NOT NULL REFERENCES wallets (id),
+    transfer_to UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    execute_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- pending | executed | failed | canceled
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 1 CHECK ( max_attempts > 0 ),
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    executed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- воркер выбирает только pending с наступившим execute_at
+CREATE INDEX scheduled_transfers_due_idx ON scheduled_transfers (execute_at) WHERE status = 'pending';
+CREATE INDEX scheduled_transfers_from_idx ON scheduled_transfers (transfer_from);
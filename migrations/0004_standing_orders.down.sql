@@ -0,0 +1,6 @@
+DROP TABLE standing_order_runs;
+DROP TABLE standing_orders;
+
+DROP INDEX transactions_source_idx;
+ALTER TABLE transactions DROP COLUMN source_id;
+ALTER TABLE transactions DROP COLUMN source_type;
@@ -0,0 +1,38 @@
+-- источник перевода (отложенный перевод, постоянное поручение, ...) - NULL у обычных переводов
+ALTER TABLE transactions ADD COLUMN source_type TEXT;
+ALTER TABLE transactions ADD COLUMN source_id UUID;
+CREATE INDEX transactions_source_idx ON transactions (source_type, source_id) WHERE source_id IS NOT NULL;
+
+CREATE TABLE standing_orders (
+    id UUID PRIMARY KEY NOT NULL,
+    transfer_from UUID NOT NULL REFERENCES wallets (id),
+    transfer_to UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    -- cron-выражение, UTC
+    schedule TEXT NOT NULL,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    max_count INT CHECK ( max_count > 0 ),
+    -- catch_up | skip
+    missed_runs TEXT NOT NULL,
+    -- active | completed | canceled
+    status TEXT NOT NULL DEFAULT 'active',
+    runs_count INT NOT NULL DEFAULT 0,
+    next_run_at TIMESTAMP WITH TIME ZONE,
+    last_failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX standing_orders_due_idx ON standing_orders (next_run_at) WHERE status = 'active';
+CREATE INDEX standing_orders_from_idx ON standing_orders (transfer_from);
+
+-- первичный ключ - гарантия, что каждый запуск поручения материализуется не больше одного раза
+CREATE TABLE standing_order_runs (
+    standing_order_id UUID NOT NULL REFERENCES standing_orders (id),
+    scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- executed | failed | skipped
+    status TEXT NOT NULL,
+    failure_reason TEXT NOT NULL DEFAULT '',
+    executed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (standing_order_id, scheduled_for)
+);
@@ -0,0 +1,2 @@
+DROP TABLE batch_transfer_lines;
+DROP TABLE batch_transfers;
@@ -0,0 +1,26 @@
+CREATE TABLE batch_transfers (
+    id UUID PRIMARY KEY NOT NULL,
+    transfer_from UUID NOT NULL REFERENCES wallets (id),
+    -- all_or_nothing | best_effort
+    mode TEXT NOT NULL,
+    -- pending | completed | failed
+    status TEXT NOT NULL DEFAULT 'pending',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX batch_transfers_pending_idx ON batch_transfers (created_at) WHERE status = 'pending';
+CREATE INDEX batch_transfers_from_idx ON batch_transfers (transfer_from);
+
+-- строки пакета; кошелек получателя не обязан существовать - это результат строки, а не ошибка всего пакета
+CREATE TABLE batch_transfer_lines (
+    batch_id UUID NOT NULL REFERENCES batch_transfers (id),
+    line_no INT NOT NULL,
+    transfer_to UUID NOT NULL,
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    -- pending | succeeded | failed
+    status TEXT NOT NULL DEFAULT 'pending',
+    error TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (batch_id, line_no)
+);
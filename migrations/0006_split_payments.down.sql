@@ -0,0 +1 @@
+DROP TABLE split_payments;
@@ -0,0 +1,9 @@
+-- родительская запись разделенного платежа; строки - транзакции с source_type = 'split_payment'
+CREATE TABLE split_payments (
+    id UUID PRIMARY KEY NOT NULL,
+    transfer_from UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    made_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX split_payments_from_idx ON split_payments (transfer_from);
@@ -0,0 +1,32 @@
+-- средства сделки хранятся в самой записи escrows: при создании - транзакция покупатель -> NULL,
+-- при закрытии - NULL -> продавец (release) или NULL -> покупатель (refund), обе с source_type = 'escrow'
+CREATE TABLE escrows (
+    id UUID PRIMARY KEY NOT NULL,
+    buyer UUID NOT NULL REFERENCES wallets (id),
+    seller UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    description TEXT NOT NULL DEFAULT '',
+    -- funded | released | refunded
+    status TEXT NOT NULL,
+    deadline TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    settled_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX escrows_deadline_idx ON escrows (deadline) WHERE status = 'funded';
+CREATE INDEX escrows_buyer_idx ON escrows (buyer);
+CREATE INDEX escrows_seller_idx ON escrows (seller);
+
+-- история переходов сделки
+CREATE TABLE escrow_events (
+    id BIGSERIAL PRIMARY KEY,
+    escrow_id UUID NOT NULL REFERENCES escrows (id),
+    made_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    -- id кошелька участника или system
+    actor TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX escrow_events_escrow_id_idx ON escrow_events (escrow_id);
@@ -0,0 +1 @@
+DROP TABLE payment_requests;
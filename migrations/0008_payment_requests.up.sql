@@ -0,0 +1,17 @@
+-- запрос денег: requester просит payer перевести amount; оплата - обычный перевод с source_type = 'payment_request'
+CREATE TABLE payment_requests (
+    id UUID PRIMARY KEY NOT NULL,
+    requester UUID NOT NULL REFERENCES wallets (id),
+    payer UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    memo TEXT NOT NULL DEFAULT '',
+    -- pending | paid | declined | expired
+    status TEXT NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX payment_requests_requester_idx ON payment_requests (requester, created_at);
+CREATE INDEX payment_requests_payer_idx ON payment_requests (payer, created_at);
+CREATE INDEX payment_requests_expires_at_idx ON payment_requests (expires_at) WHERE status = 'pending';
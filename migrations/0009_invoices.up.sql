@@ -0,0 +1,29 @@
+-- счет продавца; оплаты - обычные переводы с source_type = 'invoice', paid_amount - их сумма
+CREATE TABLE invoices (
+    id UUID PRIMARY KEY NOT NULL,
+    merchant UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    currency TEXT NOT NULL,
+    due_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    reference TEXT NOT NULL DEFAULT '',
+    -- open | partially_paid | paid | void | overdue
+    status TEXT NOT NULL,
+    paid_amount NUMERIC(10, 3) NOT NULL DEFAULT 0 CHECK ( paid_amount >= 0 AND paid_amount <= amount ),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    paid_at TIMESTAMP WITH TIME ZONE,
+    voided_at TIMESTAMP WITH TIME ZONE
+);
+
+-- номер заказа продавца уникален в пределах продавца
+CREATE UNIQUE INDEX invoices_merchant_reference_key ON invoices (merchant, reference) WHERE reference <> '';
+CREATE INDEX invoices_merchant_idx ON invoices (merchant, created_at);
+CREATE INDEX invoices_due_at_idx ON invoices (due_at) WHERE status IN ('open', 'partially_paid');
+
+CREATE TABLE invoice_items (
+    invoice_id UUID NOT NULL REFERENCES invoices (id),
+    line_no INT NOT NULL,
+    description TEXT NOT NULL,
+    quantity INT NOT NULL CHECK ( quantity > 0 ),
+    unit_price NUMERIC(10, 3) NOT NULL CHECK ( unit_price > 0 ),
+    PRIMARY KEY (invoice_id, line_no)
+);
@@ -0,0 +1,6 @@
+DROP INDEX transactions_reference_idx;
+
+ALTER TABLE transactions
+    DROP COLUMN metadata,
+    DROP COLUMN reference,
+    DROP COLUMN memo;
@@ -0,0 +1,7 @@
+-- данные, которые отправитель передает вместе с переводом
+ALTER TABLE transactions
+    ADD COLUMN memo TEXT,
+    ADD COLUMN reference TEXT,
+    ADD COLUMN metadata JSONB;
+
+CREATE INDEX transactions_reference_idx ON transactions (reference) WHERE reference IS NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    DROP COLUMN to_alias;
+
+DROP TABLE wallet_aliases;
@@ -0,0 +1,24 @@
+-- псевдонимы кошельков; при смене или удалении запись не стирается, а закрывается (removed_at),
+-- поэтому видно, кому псевдоним принадлежал раньше
+CREATE TABLE wallet_aliases (
+    id UUID PRIMARY KEY NOT NULL,
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    -- handle | email | phone
+    kind TEXT NOT NULL,
+    -- нормализованное значение: handle без @ в нижнем регистре, email в нижнем регистре, phone в формате E.164
+    value TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    -- handle подтвержден сразу, email и phone - после подтверждения оператором
+    verified_at TIMESTAMP WITH TIME ZONE,
+    removed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- у кошелька не больше одного действующего псевдонима каждого вида
+CREATE UNIQUE INDEX wallet_aliases_wallet_kind_key ON wallet_aliases (wallet_id, kind) WHERE removed_at IS NULL;
+-- действующий подтвержденный псевдоним закреплен за одним кошельком
+CREATE UNIQUE INDEX wallet_aliases_value_key ON wallet_aliases (kind, value) WHERE removed_at IS NULL AND verified_at IS NOT NULL;
+CREATE INDEX wallet_aliases_wallet_idx ON wallet_aliases (wallet_id, created_at);
+
+-- псевдоним, по которому отправитель указал получателя: история остается читаемой и после смены псевдонима
+ALTER TABLE transactions
+    ADD COLUMN to_alias TEXT;
@@ -0,0 +1,9 @@
+DROP TRIGGER wallets_updated_at ON wallets;
+DROP FUNCTION wallets_set_updated_at();
+
+ALTER TABLE wallets
+    DROP COLUMN updated_at,
+    DROP COLUMN created_at,
+    DROP COLUMN labels,
+    DROP COLUMN display_name,
+    DROP COLUMN owner_id;
@@ -0,0 +1,23 @@
+-- владелец, название и метки кошелька; у существующих кошельков created_at - время миграции
+ALTER TABLE wallets
+    ADD COLUMN owner_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN labels TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+-- updated_at - время любого изменения строки: баланса, заморозки или данных владельца
+CREATE FUNCTION wallets_set_updated_at() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = now();
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER wallets_updated_at BEFORE UPDATE ON wallets
+    FOR EACH ROW EXECUTE FUNCTION wallets_set_updated_at();
+
+-- список кошельков постранично по (created_at, id)
+CREATE INDEX wallets_created_at_idx ON wallets (created_at, id);
+CREATE INDEX wallets_owner_id_idx ON wallets (owner_id, created_at, id) WHERE owner_id <> '';
+CREATE INDEX wallets_labels_idx ON wallets USING GIN (labels);
@@ -0,0 +1,3 @@
+ALTER TABLE wallets
+    DROP COLUMN closed_at,
+    DROP COLUMN parent_id;
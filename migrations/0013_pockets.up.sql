@@ -0,0 +1,7 @@
+-- карманы: кошелек с parent_id принадлежит родительскому кошельку; вложенных карманов нет
+ALTER TABLE wallets
+    ADD COLUMN parent_id UUID REFERENCES wallets (id),
+    -- закрытый карман заморожен, его баланс переведен родителю
+    ADD COLUMN closed_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX wallets_parent_id_idx ON wallets (parent_id, created_at) WHERE parent_id IS NOT NULL;
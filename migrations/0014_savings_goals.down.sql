@@ -0,0 +1,4 @@
+ALTER TABLE wallets
+    DROP COLUMN round_up_pocket_id;
+
+DROP TABLE savings_goals;
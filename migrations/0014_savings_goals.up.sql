@@ -0,0 +1,16 @@
+-- цель накопления кармана: сумма и (необязательно) день, к которому ее нужно собрать; у кармана не больше одной цели
+CREATE TABLE savings_goals (
+    pocket_id UUID PRIMARY KEY NOT NULL REFERENCES wallets (id),
+    -- родитель кармана - для списка целей кошелька
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    target_amount NUMERIC(10, 3) NOT NULL CHECK ( target_amount > 0 ),
+    target_date DATE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX savings_goals_wallet_idx ON savings_goals (wallet_id, created_at);
+
+-- правило округления кошелька: сдача каждого исходящего перевода до целой единицы уходит в этот карман
+ALTER TABLE wallets
+    ADD COLUMN round_up_pocket_id UUID REFERENCES wallets (id);
@@ -0,0 +1,7 @@
+DROP INDEX transactions_to_made_at_idx;
+DROP INDEX transactions_from_made_at_idx;
+
+DROP TABLE interest_accruals;
+DROP TABLE interest_payouts;
+DROP TABLE interest_accounts;
+DROP TABLE interest_products;
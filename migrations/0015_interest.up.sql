@@ -0,0 +1,71 @@
+-- процентные продукты: годовая ставка, как считаются дни года и как часто проценты выплачиваются на баланс
+CREATE TABLE interest_products (
+    id UUID PRIMARY KEY NOT NULL,
+    name TEXT NOT NULL,
+    -- в процентах годовых
+    annual_rate NUMERIC(7, 4) NOT NULL CHECK ( annual_rate > 0 ),
+    -- act/365 | act/360 | act/act
+    day_count TEXT NOT NULL,
+    -- daily | monthly | quarterly | yearly
+    compounding TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- подключение кошелька к продукту; у кошелька не больше одного счета начисления
+CREATE TABLE interest_accounts (
+    wallet_id UUID PRIMARY KEY NOT NULL REFERENCES wallets (id),
+    product_id UUID NOT NULL REFERENCES interest_products (id),
+    -- active | closed
+    status TEXT NOT NULL DEFAULT 'active',
+    -- последний день, за который начислены проценты
+    accrued_through DATE NOT NULL,
+    -- с этого дня начисление прекращается, остаток выплачивается
+    ends_on DATE,
+    -- начислено, но еще не выплачено - с точностью до 10 знаков
+    pending NUMERIC(20, 10) NOT NULL DEFAULT 0,
+    -- период закончился, выплата еще не сделана
+    payout_due BOOLEAN NOT NULL DEFAULT false,
+    -- выплата не прошла (например, на казначейском кошельке не хватило баланса) - следующая попытка не раньше
+    retry_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX interest_accounts_due_idx ON interest_accounts (accrued_through) WHERE status = 'active';
+
+CREATE TABLE interest_payouts (
+    id UUID PRIMARY KEY NOT NULL,
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    -- последний день периода, за который выплата
+    period_end DATE NOT NULL,
+    -- накоплено к выплате, включая перенесенный остаток прошлых выплат
+    accrued NUMERIC(20, 10) NOT NULL,
+    -- выплачено - accrued, округленное вниз до тысячных
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    -- остаток меньше тысячной, переносится в следующую выплату
+    carry NUMERIC(20, 10) NOT NULL,
+    paid_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- гарантия, что период не выплачивается дважды
+    UNIQUE (wallet_id, period_end)
+);
+
+-- начисление за день по остатку на конец дня (UTC); первичный ключ - гарантия, что день не начисляется дважды
+CREATE TABLE interest_accruals (
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    accrual_date DATE NOT NULL,
+    product_id UUID NOT NULL REFERENCES interest_products (id),
+    balance NUMERIC(10, 3) NOT NULL,
+    annual_rate NUMERIC(7, 4) NOT NULL,
+    day_count TEXT NOT NULL,
+    amount NUMERIC(20, 10) NOT NULL,
+    -- выплата, в которую вошло начисление; NULL - еще не выплачено
+    payout_id UUID REFERENCES interest_payouts (id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (wallet_id, accrual_date)
+);
+
+CREATE INDEX interest_accruals_unpaid_idx ON interest_accruals (wallet_id) WHERE payout_id IS NULL;
+
+-- остаток на конец дня восстанавливается по транзакциям после конца дня
+CREATE INDEX transactions_from_made_at_idx ON transactions (transfered_from, made_at);
+CREATE INDEX transactions_to_made_at_idx ON transactions (transfered_to, made_at);
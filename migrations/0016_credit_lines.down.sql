@@ -0,0 +1,10 @@
+DROP TABLE credit_alerts;
+DROP TABLE credit_accruals;
+DROP TABLE credit_charges;
+DROP TABLE credit_lines;
+
+-- не накатится, пока у кошельков есть задолженность: ее нужно погасить до отката
+ALTER TABLE wallets
+    DROP CONSTRAINT wallets_balance_check,
+    ADD CONSTRAINT wallets_balance_check CHECK ( balance >= 0 ),
+    DROP COLUMN credit_limit;
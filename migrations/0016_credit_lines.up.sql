@@ -0,0 +1,76 @@
+-- кредитный лимит: баланс может уйти в минус, но не ниже -credit_limit; 0 - без овердрафта, как раньше
+ALTER TABLE wallets
+    ADD COLUMN credit_limit NUMERIC(10, 3) NOT NULL DEFAULT 0 CHECK ( credit_limit >= 0 ),
+    DROP CONSTRAINT wallets_balance_check,
+    ADD CONSTRAINT wallets_balance_check CHECK ( balance >= -credit_limit );
+
+-- условия кредитной линии кошелька: проценты и комиссия за дни, закончившиеся с отрицательным балансом
+CREATE TABLE credit_lines (
+    wallet_id UUID PRIMARY KEY NOT NULL REFERENCES wallets (id),
+    -- в процентах годовых на задолженность; 0 - без процентов
+    annual_rate NUMERIC(7, 4) NOT NULL DEFAULT 0 CHECK ( annual_rate >= 0 ),
+    -- act/365 | act/360 | act/act
+    day_count TEXT NOT NULL,
+    -- за каждый день, закончившийся с отрицательным балансом; 0 - без комиссии
+    daily_fee NUMERIC(10, 3) NOT NULL DEFAULT 0 CHECK ( daily_fee >= 0 ),
+    -- последний день, за который начислены проценты и комиссия
+    accrued_through DATE NOT NULL,
+    -- начислено, но еще не списано - с точностью до 10 знаков
+    pending NUMERIC(20, 10) NOT NULL DEFAULT 0,
+    -- месяц закончился, списание еще не сделано
+    charge_due BOOLEAN NOT NULL DEFAULT false,
+    -- списание не прошло (например, не хватило лимита) - следующая попытка не раньше
+    retry_at TIMESTAMP WITH TIME ZONE,
+    -- наибольший порог использования лимита в процентах, о пересечении которого уже уведомили; 0 - ни одного
+    alert_threshold INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX credit_lines_due_idx ON credit_lines (accrued_through);
+
+CREATE TABLE credit_charges (
+    id UUID PRIMARY KEY NOT NULL,
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    -- последний день месяца, за который списание
+    period_end DATE NOT NULL,
+    -- накоплено к списанию, включая перенесенный остаток прошлых списаний
+    accrued NUMERIC(20, 10) NOT NULL,
+    -- списано - accrued, округленное вниз до тысячных
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    -- остаток меньше тысячной, переносится в следующее списание
+    carry NUMERIC(20, 10) NOT NULL,
+    charged_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- гарантия, что месяц не списывается дважды
+    UNIQUE (wallet_id, period_end)
+);
+
+-- начисление за день, закончившийся с отрицательным балансом (UTC); дни без задолженности не записываются
+CREATE TABLE credit_accruals (
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    accrual_date DATE NOT NULL,
+    balance NUMERIC(10, 3) NOT NULL,
+    annual_rate NUMERIC(7, 4) NOT NULL,
+    day_count TEXT NOT NULL,
+    interest NUMERIC(20, 10) NOT NULL,
+    fee NUMERIC(10, 3) NOT NULL,
+    -- списание, в которое вошло начисление; NULL - еще не списано
+    charge_id UUID REFERENCES credit_charges (id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (wallet_id, accrual_date)
+);
+
+CREATE INDEX credit_accruals_uncharged_idx ON credit_accruals (wallet_id) WHERE charge_id IS NULL;
+
+-- уведомления о пересечении порогов использования лимита
+CREATE TABLE credit_alerts (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id UUID NOT NULL REFERENCES wallets (id),
+    -- в процентах лимита
+    threshold INT NOT NULL,
+    balance NUMERIC(10, 3) NOT NULL,
+    credit_limit NUMERIC(10, 3) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX credit_alerts_wallet_id_idx ON credit_alerts (wallet_id, id);
@@ -0,0 +1,3 @@
+DROP TABLE dispute_events;
+DROP TABLE dispute_evidence;
+DROP TABLE disputes;
@@ -0,0 +1,50 @@
+-- спор по переводу: удерживаемая у получателя сумма хранится в самой записи, как у сделок escrows -
+-- при открытии транзакция получатель -> NULL, при решении NULL -> отправитель (reversed)
+-- или NULL -> получатель (released), все с source_type = 'dispute'
+CREATE TABLE disputes (
+    id UUID PRIMARY KEY NOT NULL,
+    -- по одному переводу - не больше одного спора
+    transaction_id INT NOT NULL UNIQUE REFERENCES transactions (id),
+    sender UUID NOT NULL REFERENCES wallets (id),
+    recipient UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    reason TEXT NOT NULL,
+    -- open | reversed | released
+    status TEXT NOT NULL,
+    deadline TIMESTAMP WITH TIME ZONE NOT NULL,
+    opened_by TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    resolved_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX disputes_deadline_idx ON disputes (deadline) WHERE status = 'open';
+CREATE INDEX disputes_status_idx ON disputes (status, created_at);
+CREATE INDEX disputes_sender_idx ON disputes (sender);
+CREATE INDEX disputes_recipient_idx ON disputes (recipient);
+
+-- вложения: сами файлы лежат во внешнем хранилище, здесь - ссылки на них
+CREATE TABLE dispute_evidence (
+    id BIGSERIAL PRIMARY KEY,
+    dispute_id UUID NOT NULL REFERENCES disputes (id),
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    added_by TEXT NOT NULL,
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX dispute_evidence_dispute_id_idx ON dispute_evidence (dispute_id);
+
+-- история переходов спора
+CREATE TABLE dispute_events (
+    id BIGSERIAL PRIMARY KEY,
+    dispute_id UUID NOT NULL REFERENCES disputes (id),
+    made_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    -- оператор или system
+    actor TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX dispute_events_dispute_id_idx ON dispute_events (dispute_id);
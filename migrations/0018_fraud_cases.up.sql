@@ -0,0 +1,30 @@
+-- переводы, которые антифрод-правила отправили на ручную проверку (review) или отклонили (block).
+-- Сумма перевода на проверке удерживается в самой записи, как у сделок escrows: при постановке - транзакция
+-- отправитель -> NULL, после решения - NULL -> получатель (approved) или NULL -> отправитель (rejected),
+-- все с source_type = 'fraud_review'. У заблокированных переводов транзакций нет
+CREATE TABLE fraud_cases (
+    id UUID PRIMARY KEY NOT NULL,
+    transfer_from UUID NOT NULL REFERENCES wallets (id),
+    transfer_to UUID NOT NULL REFERENCES wallets (id),
+    amount NUMERIC(10, 3) NOT NULL CHECK ( amount > 0 ),
+    score INT NOT NULL,
+    -- сработавшие правила: [{rule, type, score, message}]
+    reasons JSONB NOT NULL,
+    -- review | block
+    decision TEXT NOT NULL,
+    -- pending | approved | rejected | blocked
+    status TEXT NOT NULL,
+    -- данные перевода - попадают в транзакцию зачисления получателю после одобрения
+    memo TEXT,
+    reference TEXT,
+    metadata JSONB,
+    to_alias TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    decided_at TIMESTAMP WITH TIME ZONE,
+    decided_by TEXT NOT NULL DEFAULT '',
+    decision_note TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX fraud_cases_status_idx ON fraud_cases (status, created_at);
+CREATE INDEX fraud_cases_from_idx ON fraud_cases (transfer_from);
+CREATE INDEX fraud_cases_to_idx ON fraud_cases (transfer_to);
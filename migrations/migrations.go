@@ -0,0 +1,8 @@
+// Package migrations - sql-миграции схемы, вшитые в бинарник.
+// Файлы именуются NNNN_name.up.sql / NNNN_name.down.sql, NNNN - версия.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
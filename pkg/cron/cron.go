@@ -0,0 +1,193 @@
+// Package cron - разбор cron-выражений из 5 полей (минута, час, день месяца, месяц, день недели)
+// и вычисление следующего срабатывания. Время всегда в UTC.
+//
+// Поддерживается: *, числа, диапазоны (1-5), списки (1,15), шаги (*/15, 0-30/10),
+// L в дне месяца - последний день месяца, 0 и 7 в дне недели - воскресенье.
+// Дескрипторы: @hourly, @daily, @weekly, @monthly, @yearly.
+// Если ограничены и день месяца, и день недели, выражение срабатывает при совпадении любого из них (как в cron).
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// следующее срабатывание ищется не дальше этого горизонта - иначе считаем, что выражение не срабатывает никогда
+const searchHorizon = 5 // лет
+
+var ErrInvalidExpression = errors.New("invalid cron expression")
+
+var descriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+	"@yearly":  "0 0 1 1 *",
+}
+
+// битовая маска допустимых значений поля
+type bits uint64
+
+func (b bits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+type Schedule struct {
+	minute, hour, dom, month, dow bits
+	// в дне месяца указан L
+	lastDom bool
+	// поле не *, для правила "день месяца ИЛИ день недели"
+	domRestricted, dowRestricted bool
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = [5]field{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if d, ok := descriptors[expr]; ok {
+		expr = d
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w: expected %d fields, got %d", ErrInvalidExpression, len(fields), len(parts))
+	}
+
+	s := &Schedule{}
+	masks := [5]*bits{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, part := range parts {
+		if i == 2 && part == "L" {
+			s.lastDom = true
+			s.domRestricted = true
+			continue
+		}
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, err
+		}
+		*masks[i] = mask
+	}
+	s.domRestricted = s.domRestricted || parts[2] != "*"
+	s.dowRestricted = parts[4] != "*"
+	// 7 - тоже воскресенье
+	if s.dow.has(7) {
+		s.dow |= 1
+	}
+
+	return s, nil
+}
+
+func parseField(s string, f field) (bits, error) {
+	var mask bits
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%w: invalid step %q in %s", ErrInvalidExpression, stepStr, f.name)
+			}
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(loStr, f); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(hiStr, f); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%w: invalid range %q in %s", ErrInvalidExpression, rng, f.name)
+			}
+		default:
+			v, err := parseValue(rng, f)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// 5/10 - с 5 до конца с шагом 10
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("%w: %s must be between %d and %d, got %q", ErrInvalidExpression, f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
+
+// Next - первое срабатывание строго после after; нулевое время, если срабатываний нет (например, 30 февраля)
+func (s *Schedule) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(searchHorizon, 0, 0)
+
+	for t.Before(limit) {
+		if !s.month.has(int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.hour.has(t.Hour()) {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !s.minute.has(t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom.has(t.Day())
+	if s.lastDom {
+		domMatch = t.AddDate(0, 0, 1).Day() == 1
+	}
+	dowMatch := s.dow.has(int(t.Weekday()))
+
+	switch {
+	case s.domRestricted && s.dowRestricted:
+		return domMatch || dowMatch
+	case s.domRestricted:
+		return domMatch
+	case s.dowRestricted:
+		return dowMatch
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package cron
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 0 *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"1- * * * *",
+		"a * * * *",
+		"L * * * *",
+		"* * * L *",
+		"@every",
+	}
+	for _, expr := range tests {
+		if _, err := Parse(expr); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("Parse(%q): got %v, want %v", expr, err, ErrInvalidExpression)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatalf("time.Parse(%q): %v", s, err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name  string
+		expr  string
+		after string
+		want  string
+	}{
+		{"every minute", "* * * * *", "2024-09-02T10:07:30Z", "2024-09-02T10:08:00Z"},
+		{"strictly after", "0 10 * * *", "2024-09-02T10:00:00Z", "2024-09-03T10:00:00Z"},
+		{"same minute earlier second", "0 10 * * *", "2024-09-02T09:59:30Z", "2024-09-02T10:00:00Z"},
+		{"step from star", "*/15 * * * *", "2024-09-02T10:07:00Z", "2024-09-02T10:15:00Z"},
+		{"step from value", "5/10 * * * *", "2024-09-02T10:36:00Z", "2024-09-02T10:45:00Z"},
+		{"step from value wraps hour", "5/10 * * * *", "2024-09-02T10:55:00Z", "2024-09-02T11:05:00Z"},
+		{"range", "0 9-17 * * *", "2024-09-02T17:30:00Z", "2024-09-03T09:00:00Z"},
+		{"range with step", "0 9-17/4 * * *", "2024-09-02T10:00:00Z", "2024-09-02T13:00:00Z"},
+		{"list", "0,30 * * * *", "2024-09-02T10:10:00Z", "2024-09-02T10:30:00Z"},
+		{"month rollover", "0 0 1 * *", "2024-12-15T00:00:00Z", "2025-01-01T00:00:00Z"},
+		{"last day of leap february", "0 0 L * *", "2024-02-10T00:00:00Z", "2024-02-29T00:00:00Z"},
+		{"last day of february", "0 0 L * *", "2023-02-10T00:00:00Z", "2023-02-28T00:00:00Z"},
+		{"last day of 30-day month", "0 0 L * *", "2024-04-30T00:00:00Z", "2024-05-31T00:00:00Z"},
+		{"sunday as 0", "0 12 * * 0", "2024-09-02T00:00:00Z", "2024-09-08T12:00:00Z"},
+		{"sunday as 7", "0 12 * * 7", "2024-09-02T00:00:00Z", "2024-09-08T12:00:00Z"},
+		{"weekday range", "0 9 * * 1-5", "2024-09-06T10:00:00Z", "2024-09-09T09:00:00Z"},
+		// день месяца и день недели ограничены оба - срабатывает любой из них
+		{"dom or dow: dow first", "0 0 13 * 5", "2024-10-01T00:00:00Z", "2024-10-04T00:00:00Z"},
+		{"dom or dow: dom first", "0 0 13 * 1", "2024-10-08T00:00:00Z", "2024-10-13T00:00:00Z"},
+		{"dom restricted only", "0 0 13 * *", "2024-10-01T00:00:00Z", "2024-10-13T00:00:00Z"},
+		{"hourly", "@hourly", "2024-09-02T10:07:00Z", "2024-09-02T11:00:00Z"},
+		{"daily", "@daily", "2024-09-02T10:00:00Z", "2024-09-03T00:00:00Z"},
+		{"weekly", "@weekly", "2024-09-02T10:00:00Z", "2024-09-08T00:00:00Z"},
+		{"monthly", "@monthly", "2024-12-15T00:00:00Z", "2025-01-01T00:00:00Z"},
+		{"yearly", "@yearly", "2024-09-02T00:00:00Z", "2025-01-01T00:00:00Z"},
+		{"non-UTC input", "0 10 * * *", "2024-09-02T12:00:00+03:00", "2024-09-02T10:00:00Z"},
+		{"leap day within horizon", "0 0 29 2 *", "2025-01-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		// 30 февраля не наступает никогда - поиск останавливается на горизонте searchHorizon
+		{"never", "0 0 30 2 *", "2024-01-01T00:00:00Z", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.expr, err)
+			}
+			got := s.Next(at(tt.after))
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("Next(%s) = %s, want zero time", tt.after, got)
+				}
+				return
+			}
+			if want := at(tt.want); !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got, want)
+			}
+		})
+	}
+}
+
+// 2100 - не високосный год: после 29.02.2096 следующее 29 февраля только в 2104, дальше горизонта поиска
+func TestNextHorizon(t *testing.T) {
+	s, err := Parse("0 0 29 2 *")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if got := s.Next(time.Date(2096, 3, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next: got %s, want zero time beyond %d years", got, searchHorizon)
+	}
+	want := time.Date(2104, 2, 29, 0, 0, 0, 0, time.UTC)
+	if got := s.Next(time.Date(2099, 3, 1, 0, 0, 0, 0, time.UTC)); !got.Equal(want) {
+		t.Errorf("Next: got %s, want %s", got, want)
+	}
+}
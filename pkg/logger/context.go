@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ключи полей, которые протаскиваются через контекст запроса
+const (
+	FieldRequestID = "request_id"
+	FieldRoute     = "route"
+	FieldWalletID  = "wallet_id"
+)
+
+type fieldsCtxKey struct{}
+
+// WithFields - возвращает контекст с добавленными полями для логов;
+// поля родительского контекста сохраняются, совпадающие ключи перезаписываются
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	parent := fieldsFromContext(ctx)
+	merged := make(log.Fields, len(parent)+len(fields))
+	for k, v := range parent {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsCtxKey{}, merged)
+}
+
+// WithRequestID - сокращение для WithFields с request_id
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return WithFields(ctx, log.Fields{FieldRequestID: requestID})
+}
+
+// RequestID - request_id из контекста, пустая строка если его нет
+func RequestID(ctx context.Context) string {
+	id, _ := fieldsFromContext(ctx)[FieldRequestID].(string)
+	return id
+}
+
+// FromContext - запись логгера со всеми полями из контекста (request_id, route, wallet_id, ...)
+// и самим контекстом, чтобы traceHook добавил trace_id/span_id.
+// Все логи в рамках запроса нужно писать через нее.
+func FromContext(ctx context.Context, l *log.Logger) *log.Entry {
+	return l.WithContext(ctx).WithFields(fieldsFromContext(ctx))
+}
+
+func fieldsFromContext(ctx context.Context) log.Fields {
+	fields, _ := ctx.Value(fieldsCtxKey{}).(log.Fields)
+	return fields
+}
@@ -4,6 +4,7 @@ import (
 	"io"
 
 	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type customHook struct {
@@ -34,3 +35,26 @@ func (h *customHook) Fire(entry *log.Entry) error {
 
 	return err
 }
+
+// traceHook - добавляет trace_id и span_id из контекста записи (logger.WithContext(ctx)),
+// чтобы логи можно было сопоставить с трейсами
+type traceHook struct{}
+
+func (h *traceHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+func (h *traceHook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+
+	spanCtx := trace.SpanContextFromContext(entry.Context)
+	if !spanCtx.IsValid() {
+		return nil
+	}
+	entry.Data["trace_id"] = spanCtx.TraceID().String()
+	entry.Data["span_id"] = spanCtx.SpanID().String()
+
+	return nil
+}
@@ -26,6 +26,8 @@ func GetLogger(logFileName, logPath string) *log.Logger {
 
 	l.SetOutput(io.Discard)
 
+	// хуки вызываются в порядке добавления - trace_id/span_id должны попасть в запись до ее вывода
+	l.AddHook(&traceHook{})
 	l.AddHook(&customHook{
 		levels:  log.AllLevels,
 		writers: []io.Writer{os.Stdout, logFile},
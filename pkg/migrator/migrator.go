@@ -0,0 +1,232 @@
+package migrator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	defaultTable = "schema_migrations"
+	// произвольная константа - ключ advisory lock, общий для всех реплик
+	defaultLockKey int64 = 0x65_77_61_6c_6c_65_74
+)
+
+var ErrNoMigrations = errors.New("no migrations found")
+
+// NNNN_name.up.sql / NNNN_name.down.sql
+var fileNameRe = regexp.MustCompile(`^(\d+)_([a-zA-Z0-9_]+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	table      string
+	lockKey    int64
+}
+
+func New(pool *pgxpool.Pool, fsys fs.FS, opts ...Option) (*Migrator, error) {
+	m := &Migrator{
+		pool:    pool,
+		table:   defaultTable,
+		lockKey: defaultLockKey,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	m.migrations = migrations
+
+	return m, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrator - load - fs.ReadDir: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNameRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrator - load - fs.ReadFile: %w", err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != match[2] {
+			return nil, fmt.Errorf("migrator - load: version %d has different names: %q and %q", version, mig.Name, match[2])
+		}
+		if match[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+	if len(byVersion) == 0 {
+		return nil, ErrNoMigrations
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrator - load: version %d has no up migration", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Latest - версия последней известной бинарнику миграции
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version - текущая версия схемы в базе, 0 - если миграций еще не было
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var exists bool
+	err := m.pool.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", m.table).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("migrator - Version - check table: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int
+	err = m.pool.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+m.table).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("migrator - Version - select: %w", err)
+	}
+	return version, nil
+}
+
+// Up - накатывает все еще не примененные миграции, каждую в своей транзакции
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if mig.Version <= current {
+				continue
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Up); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, "INSERT INTO "+m.table+" (version, name) VALUES ($1, $2)", mig.Version, mig.Name)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migrator - Up - migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			applied = append(applied, mig)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down - откатывает steps последних примененных миграций
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			mig := m.migrations[i]
+			if mig.Version > current {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migrator - Down: migration %04d_%s has no down migration", mig.Version, mig.Name)
+			}
+			err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+				if _, err := tx.Exec(ctx, mig.Down); err != nil {
+					return err
+				}
+				_, err := tx.Exec(ctx, "DELETE FROM "+m.table+" WHERE version = $1", mig.Version)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("migrator - Down - migration %04d_%s: %w", mig.Version, mig.Name, err)
+			}
+			reverted = append(reverted, mig)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// все изменения схемы - под session-level advisory lock на отдельном соединении,
+// чтобы несколько реплик, стартующих одновременно, не накатывали миграции параллельно
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("migrator - pool.Acquire: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", m.lockKey); err != nil {
+		return fmt.Errorf("migrator - pg_advisory_lock: %w", err)
+	}
+	defer func() {
+		// контекст мог быть уже отменен - снимаем лок в любом случае
+		_, _ = conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", m.lockKey)
+	}()
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS `+m.table+` (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("migrator - create %s: %w", m.table, err)
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) currentVersion(ctx context.Context, conn *pgxpool.Conn) (int, error) {
+	var version int
+	err := conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM "+m.table).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("migrator - current version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,15 @@
+package migrator
+
+type Option func(m *Migrator)
+
+func Table(name string) Option {
+	return func(m *Migrator) {
+		m.table = name
+	}
+}
+
+func LockKey(key int64) Option {
+	return func(m *Migrator) {
+		m.lockKey = key
+	}
+}
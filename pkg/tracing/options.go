@@ -0,0 +1,23 @@
+package tracing
+
+type Option func(p *Provider)
+
+func ServiceName(name string) Option {
+	return func(p *Provider) {
+		if name != "" {
+			p.serviceName = name
+		}
+	}
+}
+
+func OTLPEndpoint(endpoint string) Option {
+	return func(p *Provider) {
+		p.otlpEndpoint = endpoint
+	}
+}
+
+func SampleRatio(ratio float64) Option {
+	return func(p *Provider) {
+		p.sampleRatio = ratio
+	}
+}
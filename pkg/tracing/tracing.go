@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+const (
+	defaultServiceName = "ewallet"
+	defaultSampleRatio = 1.0
+)
+
+type Provider struct {
+	exporter     string
+	serviceName  string
+	otlpEndpoint string
+	sampleRatio  float64
+
+	tp *sdktrace.TracerProvider
+}
+
+// New настраивает глобальный TracerProvider и W3C trace-context пропагатор.
+// С экспортером "none" спаны не пишутся, но trace-context все равно пробрасывается.
+func New(exporter string, opts ...Option) (*Provider, error) {
+	p := &Provider{
+		exporter:    exporter,
+		serviceName: defaultServiceName,
+		sampleRatio: defaultSampleRatio,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch p.exporter {
+	case ExporterNone, "":
+		return p, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		var otlpOpts []otlptracehttp.Option
+		// если endpoint не задан - экспортер сам возьмет OTEL_EXPORTER_OTLP_ENDPOINT из окружения
+		if p.otlpEndpoint != "" {
+			otlpOpts = append(otlpOpts, otlptracehttp.WithEndpointURL(p.otlpEndpoint))
+		}
+		spanExporter, err = otlptracehttp.New(context.Background(), otlpOpts...)
+	default:
+		return nil, fmt.Errorf("tracing - New: unknown exporter %q", p.exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing - New - %s exporter: %w", p.exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(p.serviceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("tracing - New - resource.Merge: %w", err)
+	}
+
+	p.tp = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(p.sampleRatio))),
+	)
+	otel.SetTracerProvider(p.tp)
+
+	return p, nil
+}
+
+// Shutdown - дописывает оставшиеся в буфере спаны
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p.tp == nil {
+		return nil
+	}
+	return p.tp.Shutdown(ctx)
+}